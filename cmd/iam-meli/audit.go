@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	Database "github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+// audit implementa `iam-meli audit verify`. Devuelve 0 si la cadena de auditoría está íntegra y 1
+// si está rota o no se pudo verificar.
+func audit(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "Uso: iam-meli audit verify [-org N] [-output text|json]")
+		return 1
+	}
+
+	flags := flag.NewFlagSet("audit verify", flag.ExitOnError)
+
+	org := flags.Int("org", 1, "ID de la organización a verificar")
+	output := flags.String("output", "text", "Formato del resultado: text o json")
+
+	flags.Parse(args[1:])
+
+	if err := pkg.ValidateSigningKey(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	db := Database.New()
+	defer db.Close()
+
+	repository := repositories.AuditRepository{Database: db}
+
+	ctx := context.WithValue(context.Background(), "current_org_id", *org)
+
+	verification, err := repository.Verify(ctx, pkg.SigningKey())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	if *output == "json" {
+		json.NewEncoder(os.Stdout).Encode(verification)
+	} else {
+		fmt.Printf("Registros encadenados: %d\n", verification.Entries)
+		fmt.Printf("Registros anteriores a la cadena: %d\n", verification.LegacyEntries)
+		fmt.Printf("Puntos de control: %d\n", verification.Checkpoints)
+
+		if verification.Valid {
+			fmt.Println("La cadena de auditoría está íntegra.")
+		} else {
+			fmt.Printf("La cadena de auditoría está rota en el registro %d: %s\n", *verification.BrokenAt, verification.Reason)
+		}
+	}
+
+	if !verification.Valid {
+		return 1
+	}
+
+	return 0
+}
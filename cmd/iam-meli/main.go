@@ -1,26 +1,50 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 
 	server "github.com/dsolartec/iam-meli/internal"
+	"github.com/dsolartec/iam-meli/internal/core/services"
 	Database "github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
 	_ "github.com/joho/godotenv/autoload"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(reconcile(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		os.Exit(audit(os.Args[2:]))
+	}
+
 	if os.Getenv("JWT_KEY") == "" {
 		log.Fatal("Se debe iniciar la variable `JWT_KEY`.")
 	}
 
+	if err := pkg.ValidateSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+
+	if _, _, err := pkg.TokenSigningKey(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Database connection.
 	db := Database.New()
 	if err := db.Conn.Ping(); err != nil {
 		log.Fatal(err)
 	}
 
+	if err := services.ValidateBreakGlassPermissions(context.Background(), &repositories.PermissionsRepository{Database: db}); err != nil {
+		log.Fatal(err)
+	}
+
 	// Start the server.
 	port := os.Getenv("PORT")
 	if port == "" {
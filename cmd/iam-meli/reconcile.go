@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	Database "github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/notifiers"
+	"github.com/dsolartec/iam-meli/internal/reconciler"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+)
+
+// reconcile implementa `iam-meli reconcile`. Devuelve 0 si no hay diferencias o se aplicaron, 1 si
+// falla y 2 si hay diferencias sin aplicar, para poder usarlo en un pipeline.
+func reconcile(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+
+	file := flags.String("file", "", "Archivo JSON con el estado deseado")
+	apply := flags.Bool("apply", false, "Aplica el plan en lugar de solo mostrarlo")
+	prune := flags.Bool("prune", false, "Elimina los permisos y asignaciones no declarados")
+	org := flags.Int("org", 1, "ID de la organización a reconciliar")
+	user := flags.String("user", "", "Usuario con el que se aplican los cambios")
+	output := flags.String("output", "text", "Formato del plan: text o json")
+
+	flags.Parse(args)
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "Se debe indicar el archivo con `-file`.")
+		return 1
+	}
+
+	db := Database.New()
+	defer db.Close()
+
+	rec := reconciler.Reconciler{
+		Applications: &repositories.ApplicationsRepository{Database: db},
+		Auth:         &repositories.AuthorizationRepository{Database: db},
+		Constraints:  &repositories.ConstraintsRepository{Database: db},
+		Permissions:  &repositories.PermissionsRepository{Database: db},
+		State:        &repositories.StateRepository{Database: db},
+		Users:        &repositories.UsersRepository{Database: db},
+		Notifier:     notifiers.New(),
+	}
+
+	config := reconciler.Config{File: *file, Apply: *apply, Prune: *prune, OrgID: *org, User: *user}
+
+	plan, err := rec.Reconcile(context.Background(), config)
+	if plan != nil {
+		if *output == "json" {
+			json.NewEncoder(os.Stdout).Encode(plan.ReconcilePlan)
+		} else {
+			reconciler.WritePlan(os.Stdout, plan)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	if !*apply && plan.Drift() > 0 {
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/dsolartec/iam-meli/internal/iamctl"
+)
+
+// iamctl es la CLI de administración del IAM. Los códigos de salida están en internal/iamctl.
+func main() {
+	os.Exit(iamctl.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,244 @@
+package authcache
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const DefaultTTL = time.Minute
+
+type entry struct {
+	userID      uint
+	permissions *models.EffectivePermissions
+	expiresAt   time.Time
+}
+
+// Cache guarda los permisos efectivos de los usuarios usados recientemente, con un máximo de
+// entradas y un tiempo de vida para cada una.
+type Cache struct {
+	Size int
+	TTL  time.Duration
+	Now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[uint]*list.Element
+	order   *list.List
+
+	// Cambia con cada invalidación para descartar las cargas que empezaron antes de ella.
+	generation uint64
+
+	// Mientras no se escuchan las invalidaciones, la caché no guarda ni devuelve nada.
+	disabled bool
+
+	hits          int
+	misses        int
+	bypasses      int
+	evictions     int
+	invalidations int
+}
+
+func New(size int, ttl time.Duration) *Cache {
+	return &Cache{Size: size, TTL: ttl}
+}
+
+// FromEnv crea la caché si `AUTHZ_CACHE_SIZE` es mayor que cero.
+func FromEnv() (*Cache, bool) {
+	size, err := strconv.Atoi(os.Getenv("AUTHZ_CACHE_SIZE"))
+	if err != nil || size <= 0 {
+		return nil, false
+	}
+
+	cache := New(size, DefaultTTL)
+
+	if ttl, err := time.ParseDuration(os.Getenv("AUTHZ_CACHE_TTL")); err == nil && ttl > 0 {
+		cache.TTL = ttl
+	}
+
+	return cache, true
+}
+
+func (cache *Cache) now() time.Time {
+	if cache.Now != nil {
+		return cache.Now()
+	}
+
+	return time.Now()
+}
+
+func (cache *Cache) init() {
+	if cache.entries == nil {
+		cache.entries = map[uint]*list.Element{}
+		cache.order = list.New()
+	}
+}
+
+func (cache *Cache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*entry).userID)
+}
+
+// Load devuelve los permisos guardados del usuario o los carga con `load` si no están o ya vencieron.
+func (cache *Cache) Load(userID uint, load func() (*models.EffectivePermissions, error)) (*models.EffectivePermissions, error) {
+	cache.mu.Lock()
+	cache.init()
+
+	if cache.disabled {
+		cache.bypasses++
+		cache.mu.Unlock()
+
+		return load()
+	}
+
+	if element, ok := cache.entries[userID]; ok {
+		current := element.Value.(*entry)
+		if cache.now().Before(current.expiresAt) {
+			cache.hits++
+			cache.order.MoveToFront(element)
+			cache.mu.Unlock()
+
+			return current.permissions, nil
+		}
+
+		cache.remove(element)
+	}
+
+	cache.misses++
+	generation := cache.generation
+	cache.mu.Unlock()
+
+	permissions, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// Si llegó una invalidación mientras se cargaba, lo leído puede estar desactualizado.
+	if cache.generation != generation || cache.disabled {
+		return permissions, nil
+	}
+
+	if element, ok := cache.entries[userID]; ok {
+		cache.remove(element)
+	}
+
+	cache.entries[userID] = cache.order.PushFront(&entry{userID: userID, permissions: permissions, expiresAt: cache.now().Add(cache.TTL)})
+
+	for cache.order.Len() > cache.Size {
+		cache.remove(cache.order.Back())
+		cache.evictions++
+	}
+
+	return permissions, nil
+}
+
+func (cache *Cache) Invalidate(userID uint) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.init()
+	cache.generation++
+	cache.invalidations++
+
+	if element, ok := cache.entries[userID]; ok {
+		cache.remove(element)
+	}
+}
+
+func (cache *Cache) Purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+	cache.invalidations++
+	cache.entries = nil
+	cache.init()
+}
+
+// Disable vacía la caché y deja de usarla hasta llamar a Enable, por ejemplo mientras no hay
+// conexión con el canal de invalidaciones.
+func (cache *Cache) Disable() {
+	cache.Purge()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.disabled = true
+}
+
+// Enable vuelve a usar la caché, vacía, una vez que se escuchan las invalidaciones.
+func (cache *Cache) Enable() {
+	cache.Purge()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.disabled = false
+}
+
+func (cache *Cache) Enabled() bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return !cache.disabled
+}
+
+func (cache *Cache) Len() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.order == nil {
+		return 0
+	}
+
+	return cache.order.Len()
+}
+
+// ServeHTTP expone los aciertos y fallos de la caché en el formato de texto de Prometheus.
+func (cache *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entries := 0
+	if cache.order != nil {
+		entries = cache.order.Len()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP iam_authz_cache_hits_total Verificaciones de permisos resueltas desde la caché.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_hits_total counter")
+	fmt.Fprintf(w, "iam_authz_cache_hits_total %d\n", cache.hits)
+	fmt.Fprintln(w, "# HELP iam_authz_cache_misses_total Verificaciones de permisos que consultaron la base de datos.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_misses_total counter")
+	fmt.Fprintf(w, "iam_authz_cache_misses_total %d\n", cache.misses)
+	fmt.Fprintln(w, "# HELP iam_authz_cache_bypasses_total Verificaciones de permisos hechas sin caché porque no se escuchan las invalidaciones.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_bypasses_total counter")
+	fmt.Fprintf(w, "iam_authz_cache_bypasses_total %d\n", cache.bypasses)
+	fmt.Fprintln(w, "# HELP iam_authz_cache_evictions_total Entradas descartadas por superar el tamaño máximo.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_evictions_total counter")
+	fmt.Fprintf(w, "iam_authz_cache_evictions_total %d\n", cache.evictions)
+	fmt.Fprintln(w, "# HELP iam_authz_cache_invalidations_total Invalidaciones recibidas.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_invalidations_total counter")
+	fmt.Fprintf(w, "iam_authz_cache_invalidations_total %d\n", cache.invalidations)
+	fmt.Fprintln(w, "# HELP iam_authz_cache_entries Usuarios con permisos en la caché.")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_entries gauge")
+	fmt.Fprintf(w, "iam_authz_cache_entries %d\n", entries)
+
+	enabled := 1
+	if cache.disabled {
+		enabled = 0
+	}
+
+	fmt.Fprintln(w, "# HELP iam_authz_cache_enabled Si la caché se está usando (1) o no, porque no se escuchan las invalidaciones (0).")
+	fmt.Fprintln(w, "# TYPE iam_authz_cache_enabled gauge")
+	fmt.Fprintf(w, "iam_authz_cache_enabled %d\n", enabled)
+}
@@ -0,0 +1,108 @@
+package authcache
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Canal de PostgreSQL en el que los triggers avisan qué usuario cambió, o `*` si pueden ser todos.
+const Channel = "iam_authz"
+
+// Espera máxima entre los intentos de escuchar el canal.
+const maxListenDelay = time.Minute
+
+// Notify aplica un aviso del canal a la caché.
+func (cache *Cache) Notify(payload string) {
+	userID, err := strconv.ParseUint(payload, 10, 64)
+	if err != nil {
+		cache.Purge()
+		return
+	}
+
+	cache.Invalidate(uint(userID))
+}
+
+// Listen invalida la caché con los avisos de `LISTEN/NOTIFY`, así los cambios hechos en cualquier
+// réplica se reflejan en todas. La caché solo se usa mientras se escucha el canal: hasta entonces,
+// o si se pierde la conexión, los permisos se consultan en la base de datos. Si no se puede
+// escuchar el canal se reintenta con espera exponencial.
+func Listen(uri string, cache *Cache, stop <-chan struct{}) {
+	cache.Disable()
+
+	delay := time.Second
+
+	for {
+		listener := pq.NewListener(uri, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Error en la escucha de invalidaciones: %s", err.Error())
+			}
+
+			// Sin conexión no llegan los avisos, así que no se puede confiar en lo guardado.
+			if event == pq.ListenerEventDisconnected || event == pq.ListenerEventConnectionAttemptFailed {
+				cache.Disable()
+			}
+		})
+
+		// Listen espera a que haya conexión, así que se cierra el listener para dejar de esperar.
+		listening := make(chan struct{})
+		go func() {
+			select {
+			case <-stop:
+				listener.Close()
+			case <-listening:
+			}
+		}()
+
+		err := listener.Listen(Channel)
+		close(listening)
+
+		if err == nil {
+			cache.Enable()
+			serve(listener, cache, stop)
+			return
+		}
+
+		listener.Close()
+
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		log.Printf("No se pudo escuchar el canal %s, se reintenta en %s: %s", Channel, delay, err.Error())
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxListenDelay {
+			delay = maxListenDelay
+		}
+	}
+}
+
+func serve(listener *pq.Listener, cache *Cache, stop <-chan struct{}) {
+	defer listener.Close()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case notification := <-listener.Notify:
+			// Un aviso nil indica que la conexión se restableció y se volvió a escuchar el canal,
+			// pero pudo perder avisos mientras tanto.
+			if notification == nil {
+				cache.Enable()
+				continue
+			}
+
+			cache.Notify(notification.Extra)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"context"
 	"errors"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -39,6 +40,11 @@ func Authorizator(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, "current_user_id", claim.ID)
+		ctx = context.WithValue(ctx, "current_org_id", claim.Org)
+
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			ctx = context.WithValue(ctx, "request_ip", ip)
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -3,35 +3,153 @@ package services
 import (
 	"net/http"
 
+	"github.com/dsolartec/iam-meli/internal/events"
 	"github.com/dsolartec/iam-meli/pkg/interfaces"
 	"github.com/go-chi/chi"
 )
 
 func New(
+	applications_repository interfaces.ApplicationsRepository,
+	audit_repository interfaces.AuditRepository,
 	auth_repository interfaces.AuthorizationRepository,
+	break_glass_repository interfaces.BreakGlassRepository,
+	constraints_repository interfaces.ConstraintsRepository,
+	denies_repository interfaces.DeniesRepository,
+	organizations_repository interfaces.OrganizationsRepository,
+	outbox_repository interfaces.OutboxRepository,
 	permissions_repository interfaces.PermissionsRepository,
+	policies_repository interfaces.PoliciesRepository,
+	relations_repository interfaces.RelationsRepository,
+	reviews_repository interfaces.ReviewsRepository,
+	state_repository interfaces.StateRepository,
 	users_repository interfaces.UsersRepository,
+	webhooks_repository interfaces.WebhooksRepository,
+	notifier interfaces.Notifier,
+	broker *events.Broker,
 ) http.Handler {
 	r := chi.NewRouter()
 
+	applications := ApplicationsService{
+		Applications: applications_repository,
+		Audit:        audit_repository,
+		Auth:         auth_repository,
+		Users:        users_repository,
+	}
+
+	audit := AuditService{
+		Audit: audit_repository,
+		Auth:  auth_repository,
+	}
+
 	authorization := AuthorizationService{
-		Users: users_repository,
+		Audit:         audit_repository,
+		Auth:          auth_repository,
+		Organizations: organizations_repository,
+		Permissions:   permissions_repository,
+		Users:         users_repository,
+	}
+
+	authz := AuthzService{
+		Auth:        auth_repository,
+		Permissions: permissions_repository,
+		Users:       users_repository,
+	}
+
+	breakGlass := BreakGlassService{
+		Audit:      audit_repository,
+		Auth:       auth_repository,
+		BreakGlass: break_glass_repository,
+		Notifier:   notifier,
+		Users:      users_repository,
+	}
+
+	constraints := ConstraintsService{
+		Audit:       audit_repository,
+		Auth:        auth_repository,
+		Constraints: constraints_repository,
+		Permissions: permissions_repository,
+	}
+
+	denies := DeniesService{
+		Audit:       audit_repository,
+		Auth:        auth_repository,
+		Denies:      denies_repository,
+		Permissions: permissions_repository,
+		Users:       users_repository,
+	}
+
+	events := EventsService{
+		Auth:   auth_repository,
+		Broker: broker,
+		Outbox: outbox_repository,
+	}
+
+	organizations := OrganizationsService{
+		Audit:         audit_repository,
+		Auth:          auth_repository,
+		Organizations: organizations_repository,
 	}
 
 	permissions := PermissionsService{
+		Applications: applications_repository,
+		Audit:        audit_repository,
+		Auth:         auth_repository,
+		Permissions:  permissions_repository,
+		Policies:     policies_repository,
+	}
+
+	relations := RelationsService{
+		Audit:     audit_repository,
+		Auth:      auth_repository,
+		Relations: relations_repository,
+	}
+
+	reviews := ReviewsService{
+		Audit:       audit_repository,
 		Auth:        auth_repository,
 		Permissions: permissions_repository,
+		Reviews:     reviews_repository,
+		Users:       users_repository,
+	}
+
+	state := StateService{
+		Applications: applications_repository,
+		Audit:        audit_repository,
+		Auth:         auth_repository,
+		Constraints:  constraints_repository,
+		Permissions:  permissions_repository,
+		State:        state_repository,
 	}
 
 	users := UsersService{
+		Audit:       audit_repository,
 		Auth:        auth_repository,
+		Denies:      denies_repository,
 		Permissions: permissions_repository,
 		Users:       users_repository,
 	}
 
+	webhooks := WebhooksService{
+		Audit:    audit_repository,
+		Auth:     auth_repository,
+		Webhooks: webhooks_repository,
+	}
+
+	r.Mount("/applications", applications.Routes())
+	r.Mount("/audit", audit.Routes())
 	r.Mount("/auth", authorization.Routes())
+	r.Mount("/authz", authz.Routes())
+	r.Mount("/breakglass", breakGlass.Routes())
+	r.Mount("/constraints", constraints.Routes())
+	r.Mount("/denies", denies.Routes())
+	r.Mount("/events", events.Routes())
+	r.Mount("/organizations", organizations.Routes())
 	r.Mount("/permissions", permissions.Routes())
+	r.Mount("/relations", relations.Routes())
+	r.Mount("/reviews", reviews.Routes())
+	r.Mount("/state", state.Routes())
 	r.Mount("/users", users.Routes())
+	r.Mount("/webhooks", webhooks.Routes())
 
 	return r
 }
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+)
+
+type ApplicationsService struct {
+	Applications interfaces.ApplicationsRepository
+	Audit        interfaces.AuditRepository
+	Auth         interfaces.AuthorizationRepository
+	Users        interfaces.UsersRepository
+}
+
+func (service *ApplicationsService) findApplication(r *http.Request) (models.Application, error) {
+	application, err := service.Applications.GetByName(r.Context(), chi.URLParam(r, "name"))
+	if err != nil && err.Error() == "sql: no rows in result set" {
+		return models.Application{}, fmt.Errorf("La aplicación %s no existe", chi.URLParam(r, "name"))
+	}
+
+	return application, err
+}
+
+func (service *ApplicationsService) findUser(r *http.Request, find string) (models.User, error) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		return service.Users.GetByUsername(ctx, find, false)
+	}
+
+	return service.Users.GetByID(ctx, uint(userID))
+}
+
+func (service *ApplicationsService) AddAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_applications"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	application, err := service.findApplication(r)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := service.findUser(r, chi.URLParam(r, "find"))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = service.Applications.AddAdmin(ctx, application.ID, user.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "application.add_admin",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		After:      pkg.Map{"application": application.Name},
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"application": application.Name, "admin": user})
+}
+
+func (service *ApplicationsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_applications"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateApplicationBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if err := utils.ValidateApplicationName(data.Name); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(data.Description) < 10 || len(data.Description) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La descripción de la aplicación debe tener entre 10 y 150 caracteres")
+		return
+	}
+
+	if _, err := service.Applications.GetByName(ctx, data.Name); err == nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre de la aplicación ya está en uso")
+		return
+	}
+
+	application := models.Application{
+		Name:        data.Name,
+		Description: data.Description,
+	}
+
+	if err := service.Applications.Create(ctx, &application); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%s", r.URL.String(), application.Name))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"application": application})
+}
+
+func (service *ApplicationsService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	applications, err := service.Applications.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(applications) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"applications": applications})
+}
+
+func (service *ApplicationsService) GetOneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	application, err := service.findApplication(r)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if application.Admins, err = service.Applications.GetAdmins(ctx, application.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"application": application})
+}
+
+func (service *ApplicationsService) RemoveAdminHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_applications"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	application, err := service.findApplication(r)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := service.findUser(r, chi.URLParam(r, "find"))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = service.Applications.RemoveAdmin(ctx, application.ID, user.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "application.remove_admin",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		Before:     pkg.Map{"application": application.Name},
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
+}
+
+func (service *ApplicationsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+
+	r.Get("/{name}", service.GetOneHandler)
+
+	r.Put("/{name}/admins/{find}", service.AddAdminHandler)
+	r.Delete("/{name}/admins/{find}", service.RemoveAdminHandler)
+
+	return r
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// recordAudit guarda la acción en el registro de auditoría con los datos de la petición. La acción
+// ya se aplicó, así que si no se puede registrar devuelve un error para que la petición falle en
+// lugar de responder como si el cambio hubiera quedado auditado.
+func recordAudit(ctx context.Context, repository interfaces.AuditRepository, r *http.Request, entry models.AuditEntry) error {
+	if repository == nil {
+		return nil
+	}
+
+	if entry.ActorID == nil {
+		if userID, ok := ctx.Value("current_user_id").(int); ok {
+			actorID := uint(userID)
+			entry.ActorID = &actorID
+		}
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.IP = ip
+	}
+
+	entry.UserAgent = r.UserAgent()
+	entry.RequestID = middleware.GetReqID(r.Context())
+
+	if err := repository.Create(ctx, &entry); err != nil {
+		log.Printf("No se pudo registrar la acción %s en la auditoría: %s", entry.Action, err.Error())
+		return errors.New("No se pudo guardar la acción en el registro de auditoría")
+	}
+
+	return nil
+}
+
+type AuditService struct {
+	Audit interfaces.AuditRepository
+	Auth  interfaces.AuthorizationRepository
+}
+
+func (service *AuditService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "view_audit_log"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := models.AuditFilter{
+		Actor:  query.Get("actor"),
+		Target: query.Get("target"),
+		Action: query.Get("action"),
+	}
+
+	for _, date := range []struct {
+		param string
+		value **time.Time
+	}{{param: "from", value: &filter.From}, {param: "to", value: &filter.To}} {
+		if query.Get(date.param) == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, query.Get(date.param))
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "Las fechas deben tener el formato RFC 3339")
+			return
+		}
+
+		*date.value = &parsed
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La fecha inicial debe ser anterior a la fecha final")
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(query)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := service.Audit.GetAll(ctx, filter, limit, (page-1)*limit)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(entries) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"entries": entries, "page": page, "limit": limit})
+}
+
+// Recorre la cadena de la organización actual y devuelve si está íntegra o el primer registro roto.
+func (service *AuditService) VerifyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "view_audit_log"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	verification, err := service.Audit.Verify(ctx, pkg.SigningKey())
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"verification": verification})
+}
+
+// CheckpointAudit firma el último registro de cada organización; lo llama el servidor
+// periódicamente.
+func CheckpointAudit(ctx context.Context, repository interfaces.AuditRepository) {
+	created, err := repository.Checkpoint(ctx, pkg.SigningKey())
+	if err != nil {
+		log.Printf("No se pudieron crear los puntos de control de la auditoría: %s", err.Error())
+		return
+	}
+
+	if created > 0 {
+		log.Printf("Se crearon %d puntos de control de la auditoría", created)
+	}
+}
+
+func (service *AuditService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Get("/verify", service.VerifyHandler)
+
+	return r
+}
@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/dsolartec/iam-meli/pkg"
 	"github.com/dsolartec/iam-meli/pkg/dto"
@@ -15,7 +18,86 @@ import (
 )
 
 type AuthorizationService struct {
-	Users interfaces.UsersRepository
+	Audit         interfaces.AuditRepository
+	Auth          interfaces.AuthorizationRepository
+	Organizations interfaces.OrganizationsRepository
+	Permissions   interfaces.PermissionsRepository
+	Users         interfaces.UsersRepository
+}
+
+// Los tokens con permisos vencen pronto porque los cambios posteriores solo se reflejan al renovarlos.
+func tokenProfileTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("TOKEN_PROFILE_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+
+	return 5 * time.Minute
+}
+
+// Genera el token de acceso del usuario y, si se pidió un perfil, incluye sus permisos.
+func (service *AuthorizationService) generateToken(ctx context.Context, userID uint, orgID uint, profile string) (string, *pkg.Claim, error) {
+	claim := pkg.Claim{ID: int(userID), Org: int(orgID)}
+
+	if profile != "" {
+		// El catálogo se lee primero: si cambia después, el token queda con una versión anterior y
+		// quien lo verifique sabrá que debe renovarlo.
+		catalog, err := service.Permissions.GetCatalog(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+
+		permissions, err := service.Auth.TokenPermissions(ctx, userID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		claim.CatalogVersion = catalog.Version
+		claim.ExpiresAt = time.Now().Add(tokenProfileTTL()).Unix()
+
+		if profile == pkg.TokenProfileBitset {
+			claim.PermissionBits = pkg.EncodePermissionBits(permissions, catalog.Permissions)
+		} else {
+			claim.Permissions = permissions
+		}
+	}
+
+	token, err := pkg.SignToken(&claim)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &claim, nil
+}
+
+func tokenResponse(token string, claim *pkg.Claim, userID uint) pkg.Map {
+	response := pkg.Map{"accessToken": token, "id": userID}
+
+	if claim.ExpiresAt != 0 {
+		response["expiresAt"] = time.Unix(claim.ExpiresAt, 0).UTC()
+		response["catalogVersion"] = claim.CatalogVersion
+	}
+
+	return response
+}
+
+// Activa en el contexto la organización indicada por nombre o, si no se indica, la de la plataforma.
+func (service *AuthorizationService) organization(ctx context.Context, name string) (context.Context, uint, error) {
+	orgID := models.PlatformOrganizationID
+
+	if name != "" {
+		organization, err := service.Organizations.GetByName(ctx, name)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				return nil, 0, errors.New("La organización no existe")
+			}
+
+			return nil, 0, err
+		}
+
+		orgID = organization.ID
+	}
+
+	return context.WithValue(ctx, "current_org_id", int(orgID)), orgID, nil
 }
 
 func (service *AuthorizationService) LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,23 +120,48 @@ func (service *AuthorizationService) LoginHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	ctx := r.Context()
+	if err := utils.ValidateTokenProfile(data.Profile); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, orgID, err := service.organization(r.Context(), data.Organization)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	user, err := service.Users.GetByUsername(ctx, data.Username, true)
 	if err != nil || !user.IsPassword(data.Password) {
+		// La petición falla de todas formas con el mismo mensaje.
+		_ = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+			Action:     "auth.login_failed",
+			TargetType: "user",
+			TargetName: data.Username,
+		})
+
 		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre de usuario o la contraseña es incorrecta")
 		return
 	}
 
-	claim := pkg.Claim{ID: int(user.ID)}
-
-	token, err := claim.GenerateToken(os.Getenv("JWT_KEY"))
+	token, claim, err := service.generateToken(ctx, user.ID, orgID, data.Profile)
 	if err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	pkg.JSON(w, r, http.StatusOK, pkg.Map{"accessToken": token, "id": user.ID})
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		ActorID:    &user.ID,
+		Action:     "auth.login",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, tokenResponse(token, claim, user.ID))
 }
 
 func (service *AuthorizationService) SignUpHandler(w http.ResponseWriter, r *http.Request) {
@@ -67,14 +174,23 @@ func (service *AuthorizationService) SignUpHandler(w http.ResponseWriter, r *htt
 
 	defer r.Body.Close()
 
-	ctx := r.Context()
-
 	if err := utils.ValidateUsername(data.Username); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	_, err := service.Users.GetByUsername(ctx, data.Username, false)
+	if err := utils.ValidateTokenProfile(data.Profile); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, orgID, err := service.organization(r.Context(), data.Organization)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = service.Users.GetByUsername(ctx, data.Username, false)
 	if err == nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre de usuario ya está en uso")
 		return
@@ -96,10 +212,21 @@ func (service *AuthorizationService) SignUpHandler(w http.ResponseWriter, r *htt
 	}
 
 	data.Password = ""
+	user.Password = ""
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		ActorID:    &user.ID,
+		Action:     "auth.signup",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		After:      user,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	claim := pkg.Claim{ID: int(user.ID)}
-
-	token, err := claim.GenerateToken(os.Getenv("JWT_KEY"))
+	token, claim, err := service.generateToken(ctx, user.ID, orgID, data.Profile)
 	if err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
@@ -107,7 +234,7 @@ func (service *AuthorizationService) SignUpHandler(w http.ResponseWriter, r *htt
 
 	w.Header().Add("Location", fmt.Sprintf("%s%d", r.URL.String(), user.ID))
 
-	pkg.JSON(w, r, http.StatusOK, pkg.Map{"accessToken": token, "id": user.ID})
+	pkg.JSON(w, r, http.StatusOK, tokenResponse(token, claim, user.ID))
 }
 
 func (service *AuthorizationService) Routes() http.Handler {
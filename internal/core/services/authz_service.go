@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/policies"
+	"github.com/go-chi/chi"
+)
+
+type AuthzService struct {
+	Auth        interfaces.AuthorizationRepository
+	Permissions interfaces.PermissionsRepository
+	Users       interfaces.UsersRepository
+}
+
+// CheckHandler indica si el usuario autenticado tiene el permiso, para los servicios que verifican
+// los permisos de sus usuarios reenviando su token.
+func (service *AuthzService) CheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	permissionName := r.URL.Query().Get("permission")
+	if permissionName == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el nombre del permiso")
+		return
+	}
+
+	// Los servicios envían los atributos de su recurso como `resource.*` para las políticas.
+	ctx = policies.WithResource(ctx, policies.ResourceFromQuery(r.URL.Query()))
+
+	if err := service.Auth.VerifyPermission(ctx, permissionName); err != nil {
+		pkg.JSON(w, r, http.StatusOK, pkg.Map{"allowed": false, "reason": err.Error()})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"allowed": true})
+}
+
+func (service *AuthzService) ExplainHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "explain_authorization"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	find := r.URL.Query().Get("user")
+	if find == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el ID o nombre del usuario")
+		return
+	}
+
+	permissionName := r.URL.Query().Get("permission")
+	if permissionName == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el nombre del permiso")
+		return
+	}
+
+	user := models.User{}
+
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		user, err = service.Users.GetByUsername(ctx, find, false)
+	} else {
+		user, err = service.Users.GetByID(ctx, uint(userID))
+	}
+
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	_, err = service.Permissions.GetByName(ctx, permissionName)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	user.Attributes, err = service.Users.GetAttributes(ctx, user.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Permite simular la IP de origen al evaluar las políticas del permiso.
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		ctx = context.WithValue(ctx, "request_ip", ip)
+	}
+
+	ctx = policies.WithResource(ctx, policies.ResourceFromQuery(r.URL.Query()))
+
+	decision, err := service.Auth.Explain(ctx, user, permissionName)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"decision": decision})
+}
+
+func (service *AuthzService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/check", service.CheckHandler)
+	r.Get("/explain", service.ExplainHandler)
+
+	return r
+}
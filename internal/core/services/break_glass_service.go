@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/go-chi/chi"
+)
+
+const (
+	DefaultBreakGlassWindow = time.Hour
+	MaxBreakGlassWindow     = 4 * time.Hour
+)
+
+type BreakGlassService struct {
+	Audit      interfaces.AuditRepository
+	Auth       interfaces.AuthorizationRepository
+	BreakGlass interfaces.BreakGlassRepository
+	Notifier   interfaces.Notifier
+	Users      interfaces.UsersRepository
+}
+
+func breakGlassPermissions() []string {
+	var permissions []string
+	for _, permission := range strings.Split(os.Getenv("BREAK_GLASS_PERMISSIONS"), ",") {
+		if permission = strings.TrimSpace(permission); permission != "" {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	return permissions
+}
+
+// ValidateBreakGlassPermissions exige que los permisos de `BREAK_GLASS_PERMISSIONS` existan en la
+// plataforma; con un nombre mal escrito la sesión de emergencia no otorgaría el permiso esperado.
+func ValidateBreakGlassPermissions(ctx context.Context, permissions interfaces.PermissionsRepository) error {
+	for _, name := range breakGlassPermissions() {
+		if _, err := permissions.GetByName(ctx, name); err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				return fmt.Errorf("El permiso %s de `BREAK_GLASS_PERMISSIONS` no existe.", name)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func breakGlassWindow() time.Duration {
+	window, err := time.ParseDuration(os.Getenv("BREAK_GLASS_WINDOW"))
+	if err != nil || window <= 0 || window > MaxBreakGlassWindow {
+		return DefaultBreakGlassWindow
+	}
+
+	return window
+}
+
+func (service *BreakGlassService) ActivateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "break_glass"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	permissions := breakGlassPermissions()
+	if len(permissions) == 0 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El acceso de emergencia no está configurado")
+		return
+	}
+
+	var data dto.BreakGlassBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	data.Justification = strings.TrimSpace(data.Justification)
+	if len(data.Justification) < 20 || len(data.Justification) > 500 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La justificación del acceso de emergencia debe tener entre 20 y 500 caracteres")
+		return
+	}
+
+	userID := uint(ctx.Value("current_user_id").(int))
+
+	user, err := service.Users.GetByID(ctx, userID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Un acceso de emergencia no se puede extender, se debe esperar a que expire.
+	if active, err := service.BreakGlass.GetActive(ctx, userID); err == nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("Ya tienes un acceso de emergencia activo hasta el %s", active.ExpiresAt.Format("2006-01-02 15:04")))
+		return
+	}
+
+	now := time.Now()
+
+	session := models.BreakGlassSession{
+		UserID:        user.ID,
+		Username:      user.Username,
+		Justification: data.Justification,
+		Permissions:   permissions,
+		StartedAt:     now,
+		ExpiresAt:     now.Add(breakGlassWindow()),
+	}
+
+	if err = service.BreakGlass.Create(ctx, &session); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			// Otra petición activó el acceso de emergencia al mismo tiempo.
+			pkg.HTTPError(w, r, http.StatusBadRequest, "Ya tienes un acceso de emergencia activo")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "break_glass.activate",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		After:      session,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	event := models.SecurityEvent{
+		Type:      "break_glass.activated",
+		Severity:  "high",
+		UserID:    user.ID,
+		Message:   fmt.Sprintf("El usuario %s activó el acceso de emergencia", user.Username),
+		Data:      map[string]interface{}{"session": session},
+		CreatedAt: now,
+	}
+
+	// El acceso no se bloquea si la notificación falla, pero queda registrado en el log.
+	if err = service.Notifier.Notify(ctx, event); err != nil {
+		log.Printf("No se pudo notificar el acceso de emergencia %d: %v", session.ID, err)
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), session.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"session": session})
+}
+
+func (service *BreakGlassService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "review_break_glass"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessions, err := service.BreakGlass.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(sessions) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"sessions": sessions})
+}
+
+func (service *BreakGlassService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.ActivateHandler)
+
+	return r
+}
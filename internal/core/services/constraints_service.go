@@ -0,0 +1,205 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+)
+
+type ConstraintsService struct {
+	Audit       interfaces.AuditRepository
+	Auth        interfaces.AuthorizationRepository
+	Constraints interfaces.ConstraintsRepository
+	Permissions interfaces.PermissionsRepository
+}
+
+func (service *ConstraintsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_constraints"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateConstraintBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if data.MaxAllowed == 0 {
+		data.MaxAllowed = 1
+	}
+
+	if err := utils.ValidateConstraintName(data.Name); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(data.Description) < 10 || len(data.Description) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La descripción de la restricción debe tener entre 10 y 150 caracteres")
+		return
+	}
+
+	if err := utils.ValidateConstraintPermissions(data.Permissions, data.MaxAllowed); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := service.Constraints.GetByName(ctx, data.Name); err == nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Ya existe una restricción con ese nombre")
+		return
+	}
+
+	constraint := models.SeparationConstraint{
+		Name:        data.Name,
+		Description: data.Description,
+		MaxAllowed:  data.MaxAllowed,
+		Permissions: data.Permissions,
+	}
+
+	for _, permissionName := range data.Permissions {
+		permission, err := service.Permissions.GetByName(ctx, permissionName)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("El permiso %s no existe", permissionName))
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		constraint.PermissionIDs = append(constraint.PermissionIDs, int64(permission.ID))
+	}
+
+	if err := service.Constraints.Create(ctx, &constraint); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "constraint.create",
+		TargetType: "constraint",
+		TargetID:   fmt.Sprint(constraint.ID),
+		TargetName: constraint.Name,
+		After:      constraint,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), constraint.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"constraint": constraint})
+}
+
+func (service *ConstraintsService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_constraints"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	constraint, err := service.Constraints.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La restricción no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = service.Constraints.Delete(ctx, constraint.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "constraint.delete",
+		TargetType: "constraint",
+		TargetID:   fmt.Sprint(constraint.ID),
+		TargetName: constraint.Name,
+		Before:     constraint,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"constraint": constraint})
+}
+
+func (service *ConstraintsService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	constraints, err := service.Constraints.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(constraints) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"constraints": constraints})
+}
+
+func (service *ConstraintsService) GetViolationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_constraints"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	violations, err := service.Constraints.GetViolations(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(violations) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"violations": violations})
+}
+
+func (service *ConstraintsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+
+	r.Get("/violations", service.GetViolationsHandler)
+
+	r.Delete("/{id}", service.DeleteHandler)
+
+	return r
+}
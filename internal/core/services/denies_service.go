@@ -0,0 +1,244 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/go-chi/chi"
+)
+
+type DeniesService struct {
+	Audit       interfaces.AuditRepository
+	Auth        interfaces.AuthorizationRepository
+	Denies      interfaces.DeniesRepository
+	Permissions interfaces.PermissionsRepository
+	Users       interfaces.UsersRepository
+}
+
+func (service *DeniesService) findUser(r *http.Request, find string) (models.User, error) {
+	ctx := r.Context()
+
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		return service.Users.GetByUsername(ctx, find, false)
+	}
+
+	return service.Users.GetByID(ctx, uint(userID))
+}
+
+func (service *DeniesService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_denies"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateDenyBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if data.Reason == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el motivo de la denegación")
+		return
+	}
+
+	if len(data.Reason) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El motivo de la denegación no puede tener más de 150 caracteres")
+		return
+	}
+
+	if data.User != "" && len(data.ExceptUsers) > 0 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "No puedes denegar el permiso a un usuario y exceptuar usuarios al mismo tiempo")
+		return
+	}
+
+	if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La fecha de expiración debe ser posterior a la fecha actual")
+		return
+	}
+
+	permission, err := service.Permissions.GetByName(ctx, data.PermissionName)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	createdBy := uint(ctx.Value("current_user_id").(int))
+
+	deny := models.PermissionDeny{
+		PermissionID:   permission.ID,
+		PermissionName: permission.Name,
+		ExceptUserIDs:  []int64{},
+		Reason:         data.Reason,
+		ExpiresAt:      data.ExpiresAt,
+		CreatedBy:      &createdBy,
+	}
+
+	if data.User != "" {
+		user, err := service.findUser(r, data.User)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		deny.UserID = &user.ID
+	}
+
+	// Una denegación sin usuario aplica a todos excepto a los usuarios indicados.
+	for _, find := range data.ExceptUsers {
+		user, err := service.findUser(r, find)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("El usuario %s no existe", find))
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		deny.ExceptUserIDs = append(deny.ExceptUserIDs, int64(user.ID))
+	}
+
+	if err = service.Denies.Create(ctx, &deny); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "deny.create",
+		TargetType: "deny",
+		TargetID:   fmt.Sprint(deny.ID),
+		TargetName: deny.PermissionName,
+		After:      deny,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), deny.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"deny": deny})
+}
+
+func (service *DeniesService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_denies"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deny, err := service.Denies.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La denegación no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = service.Denies.Delete(ctx, deny.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "deny.delete",
+		TargetType: "deny",
+		TargetID:   fmt.Sprint(deny.ID),
+		TargetName: deny.PermissionName,
+		Before:     deny,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"deny": deny})
+}
+
+func (service *DeniesService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	denies, err := service.Denies.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(denies) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"denies": denies})
+}
+
+func (service *DeniesService) GetOneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deny, err := service.Denies.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La denegación no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"deny": deny})
+}
+
+func (service *DeniesService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+
+	r.Get("/{id}", service.GetOneHandler)
+	r.Delete("/{id}", service.DeleteHandler)
+
+	return r
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/internal/events"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/go-chi/chi"
+)
+
+const (
+	// Cada cuánto se envía un comentario para mantener viva la conexión y detectar clientes
+	// desconectados.
+	eventsHeartbeat = 15 * time.Second
+
+	// Tiempo máximo para escribir cada evento; reemplaza el `WriteTimeout` del servidor, que
+	// cortaría el stream.
+	eventsWriteTimeout = 10 * time.Second
+
+	// Cada cuánto se vuelve a verificar el permiso `view_events` mientras el stream está abierto.
+	eventsPermissionCheck = time.Minute
+)
+
+// eventStream escribe los eventos del stream. Si puede toma la conexión para manejar los plazos
+// de escritura por evento; si no (por ejemplo en HTTP/2) usa el `http.Flusher` de la respuesta.
+type eventStream struct {
+	conn    net.Conn
+	buf     *bufio.ReadWriter
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func openEventStream(w http.ResponseWriter, r *http.Request) (*eventStream, context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	if hijacker, ok := w.(http.Hijacker); ok && r.ProtoMajor == 1 {
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			cancel()
+			return nil, nil, nil, err
+		}
+
+		stream := &eventStream{conn: conn, buf: buf}
+
+		// Al tomar la conexión se pierden los encabezados que ya pusieron los middlewares, como los
+		// de CORS, así que los escribimos nosotros junto con los del stream.
+		header := w.Header().Clone()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "close")
+
+		var raw strings.Builder
+		raw.WriteString("HTTP/1.1 200 OK\r\n")
+		header.Write(&raw)
+		raw.WriteString("\r\n")
+
+		if err = stream.write(raw.String()); err != nil {
+			conn.Close()
+			cancel()
+			return nil, nil, nil, err
+		}
+
+		// El contexto de la petición no se cancela al tomar la conexión, así que detectamos la
+		// desconexión leyendo de ella.
+		go func() {
+			buf.ReadByte()
+			cancel()
+		}()
+
+		return stream, ctx, cancel, nil
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		cancel()
+		return nil, nil, nil, fmt.Errorf("El servidor no permite enviar eventos")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventStream{w: w, flusher: flusher}, ctx, cancel, nil
+}
+
+func (stream *eventStream) write(data string) error {
+	if stream.conn == nil {
+		if _, err := stream.w.Write([]byte(data)); err != nil {
+			return err
+		}
+
+		stream.flusher.Flush()
+		return nil
+	}
+
+	stream.conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+
+	if _, err := stream.buf.WriteString(data); err != nil {
+		return err
+	}
+
+	return stream.buf.Flush()
+}
+
+func (stream *eventStream) send(event models.OutboxEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return stream.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, b))
+}
+
+func (stream *eventStream) Close() {
+	if stream.conn != nil {
+		stream.conn.Close()
+	}
+}
+
+func currentOrgID(ctx context.Context) uint {
+	if org, ok := ctx.Value("current_org_id").(int); ok && org > 0 {
+		return uint(org)
+	}
+
+	return models.PlatformOrganizationID
+}
+
+type EventsService struct {
+	Auth   interfaces.AuthorizationRepository
+	Broker *events.Broker
+	Outbox interfaces.OutboxRepository
+}
+
+// eventAccess decide qué eventos recibe el usuario del stream. Con `view_events` se reciben los
+// eventos de toda la organización; sin él, solo los del propio usuario.
+type eventAccess struct {
+	userID string
+	all    atomic.Bool
+}
+
+func (access *eventAccess) own(event models.OutboxEvent) bool {
+	return event.AggregateType == "user" && event.AggregateID == access.userID
+}
+
+func (access *eventAccess) allows(event models.OutboxEvent) bool {
+	return access.all.Load() || access.own(event)
+}
+
+// refreshAccess vuelve a verificar `view_events`. Se hace al abrir el stream, periódicamente y
+// cada vez que cambia el usuario, para que un permiso retirado no siga entregando los eventos de
+// la organización mientras la conexión esté abierta.
+func (service *EventsService) refreshAccess(ctx context.Context, access *eventAccess) {
+	access.all.Store(service.Auth.VerifyPermission(ctx, "view_events") == nil)
+}
+
+func (service *EventsService) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El encabezado Last-Event-ID debe ser un número")
+			return
+		}
+
+		lastEventID = id
+	}
+
+	access := &eventAccess{userID: strconv.Itoa(ctx.Value("current_user_id").(int))}
+	service.refreshAccess(ctx, access)
+
+	// Nos suscribimos antes de leer los eventos pendientes para no perder los que lleguen
+	// mientras tanto.
+	subscription := service.Broker.Subscribe(currentOrgID(ctx), access.allows)
+	defer service.Broker.Unsubscribe(subscription)
+
+	stream, ctx, cancel, err := openEventStream(w, r)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer cancel()
+	defer stream.Close()
+
+	if err = stream.write("retry: 3000\n\n"); err != nil {
+		return
+	}
+
+	// Eventos que el cliente no recibió desde `Last-Event-ID` hasta que se suscribió.
+	sent := lastEventID
+	for lastEventID > 0 && sent < subscription.From {
+		pending, err := service.Outbox.GetSince(ctx, sent, subscription.From, events.BatchSize)
+		if err != nil {
+			stream.write(fmt.Sprintf(": %s\n\n", err.Error()))
+			return
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		for _, event := range pending {
+			if access.allows(event) {
+				if err = stream.send(event); err != nil {
+					return
+				}
+			}
+
+			sent = event.ID
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	permissionCheck := time.NewTicker(eventsPermissionCheck)
+	defer permissionCheck.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err = stream.write(": ping\n\n"); err != nil {
+				return
+			}
+		case <-permissionCheck.C:
+			service.refreshAccess(ctx, access)
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return
+			}
+
+			if event.ID <= sent {
+				continue
+			}
+
+			// Un evento del propio usuario puede ser el que le retira `view_events`; los que ya están
+			// en cola se vuelven a filtrar con el permiso actualizado.
+			if access.own(event) {
+				service.refreshAccess(ctx, access)
+			} else if !access.allows(event) {
+				continue
+			}
+
+			if err = stream.send(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (service *EventsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/stream", service.StreamHandler)
+
+	return r
+}
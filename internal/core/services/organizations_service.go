@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+)
+
+type OrganizationsService struct {
+	Audit         interfaces.AuditRepository
+	Auth          interfaces.AuthorizationRepository
+	Organizations interfaces.OrganizationsRepository
+}
+
+// Solo los usuarios de la organización de la plataforma pueden administrar organizaciones,
+// así otra organización no puede crear su propio permiso manage_organizations.
+func (service *OrganizationsService) verifyPlatformAdmin(ctx context.Context) error {
+	if org, ok := ctx.Value("current_org_id").(int); !ok || uint(org) != models.PlatformOrganizationID {
+		return errors.New("¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
+	}
+
+	return service.Auth.VerifyPermission(ctx, "manage_organizations")
+}
+
+func (service *OrganizationsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.verifyPlatformAdmin(ctx); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateOrganizationBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if err := utils.ValidateOrganizationName(data.Name); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.ValidateUsername(data.Owner.Username); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.ValidatePassword(data.Owner.Password); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := service.Organizations.GetByName(ctx, data.Name); err == nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre de la organización ya está en uso")
+		return
+	}
+
+	organization := models.Organization{Name: data.Name}
+
+	owner := models.User{
+		Username: data.Owner.Username,
+		Password: data.Owner.Password,
+	}
+
+	if err := service.Organizations.Create(ctx, &organization, &owner); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	owner.Password = ""
+
+	// El registro queda en la organización de la plataforma, que es la del actor.
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "organization.create",
+		TargetType: "organization",
+		TargetID:   fmt.Sprint(organization.ID),
+		TargetName: organization.Name,
+		After:      pkg.Map{"organization": organization, "owner": owner},
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), organization.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"organization": organization, "owner": owner})
+}
+
+func (service *OrganizationsService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.verifyPlatformAdmin(ctx); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	organizations, err := service.Organizations.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(organizations) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"organizations": organizations})
+}
+
+func (service *OrganizationsService) GetOneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.verifyPlatformAdmin(ctx); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	organization, err := service.Organizations.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La organización no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"organization": organization})
+}
+
+func (service *OrganizationsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+	r.Get("/{id}", service.GetOneHandler)
+
+	return r
+}
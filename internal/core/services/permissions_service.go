@@ -1,47 +1,139 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/dsolartec/iam-meli/internal/core/middlewares"
 	"github.com/dsolartec/iam-meli/pkg"
 	"github.com/dsolartec/iam-meli/pkg/dto"
 	"github.com/dsolartec/iam-meli/pkg/interfaces"
 	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/policies"
 	"github.com/dsolartec/iam-meli/pkg/utils"
 	"github.com/go-chi/chi"
 )
 
 type PermissionsService struct {
-	Auth        interfaces.AuthorizationRepository
-	Permissions interfaces.PermissionsRepository
+	Applications interfaces.ApplicationsRepository
+	Audit        interfaces.AuditRepository
+	Auth         interfaces.AuthorizationRepository
+	Permissions  interfaces.PermissionsRepository
+	Policies     interfaces.PoliciesRepository
 }
 
-func (service *PermissionsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+// Los administradores de una aplicación pueden gestionar sus permisos aunque no tengan el
+// permiso global, salvo que se les haya denegado explícitamente.
+func (service *PermissionsService) applicationAdmin(ctx context.Context, authErr error, permissionName string) bool {
+	application, _ := models.SplitPermissionName(permissionName)
+	if application == "" || errors.Is(authErr, models.ErrPermissionDenied) {
+		return false
+	}
+
+	userID, ok := ctx.Value("current_user_id").(int)
+	if !ok {
+		return false
+	}
+
+	admin, err := service.Applications.IsAdmin(ctx, application, uint(userID))
+	return err == nil && admin
+}
+
+// Obtiene el permiso de la ruta si el usuario tiene el permiso global indicado o administra
+// la aplicación a la que pertenece.
+func (service *PermissionsService) managedPermission(r *http.Request, action string) (models.Permission, error) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "create_permission"); err != nil {
-		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
-		return
+	id, idErr := strconv.Atoi(chi.URLParam(r, "id"))
+
+	// Las políticas del permiso global reciben como `resource` el permiso de la ruta.
+	authCtx := policies.WithResourceLoader(ctx, func() (map[string]interface{}, error) {
+		if idErr != nil {
+			return nil, idErr
+		}
+
+		permission, err := service.Permissions.GetByID(ctx, uint(id))
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{"id": int64(permission.ID), "name": permission.Name, "application": permission.Application}, nil
+	})
+
+	authErr := service.Auth.VerifyPermission(authCtx, action)
+
+	if idErr != nil {
+		if authErr != nil {
+			return models.Permission{}, authErr
+		}
+
+		return models.Permission{}, idErr
 	}
 
+	permission, err := service.Permissions.GetByID(ctx, uint(id))
+	if authErr != nil && !service.applicationAdmin(ctx, authErr, permission.Name) {
+		return models.Permission{}, authErr
+	}
+
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return models.Permission{}, errors.New("El permiso no existe")
+		}
+
+		return models.Permission{}, err
+	}
+
+	return permission, nil
+}
+
+func (service *PermissionsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authErr := service.Auth.VerifyPermission(ctx, "create_permission")
+
 	var data dto.CreatePermissionBody
 
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+	// Leemos el cuerpo antes de rechazar la petición porque los administradores de la
+	// aplicación del permiso también pueden crearlo.
+	var decodeErr error
+	if r.Body != nil {
+		decodeErr = json.NewDecoder(r.Body).Decode(&data)
+
+		defer r.Body.Close()
+	}
+
+	if authErr != nil && !service.applicationAdmin(ctx, authErr, data.Name) {
+		pkg.HTTPError(w, r, http.StatusBadRequest, authErr.Error())
 		return
 	}
 
-	defer r.Body.Close()
+	if decodeErr != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, decodeErr.Error())
+		return
+	}
 
 	if err := utils.ValidatePermissionName(data.Name); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if application, _ := models.SplitPermissionName(data.Name); application != "" {
+		if _, err := service.Applications.GetByName(ctx, application); err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("La aplicación %s no existe", application))
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+	}
+
 	_, err := service.Permissions.GetByName(ctx, data.Name)
 	if err == nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre del permiso ya está en uso")
@@ -65,15 +157,26 @@ func (service *PermissionsService) CreateHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "permission.create",
+		TargetType: "permission",
+		TargetID:   fmt.Sprint(permission.ID),
+		TargetName: permission.Name,
+		After:      permission,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	w.Header().Add("Location", fmt.Sprintf("%s%d", r.URL.String(), permission.ID))
 
 	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"permission": permission})
 }
 
-func (service *PermissionsService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+func (service *PermissionsService) CreatePolicyHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "delete_permission"); err != nil {
+	if err := service.Auth.VerifyPermission(ctx, "update_permission"); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -97,20 +200,158 @@ func (service *PermissionsService) DeleteHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// Una política sobre un permiso integrado como grant_permission podría dejar sin acceso a todos
+	// los administradores.
+	if !permission.Editable {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no puede ser editado")
+		return
+	}
+
+	var data dto.CreatePermissionPolicyBody
+
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if len(data.Description) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La descripción de la política no puede tener más de 150 caracteres")
+		return
+	}
+
+	if _, err = policies.Compile(data.Condition); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policy := models.PermissionPolicy{
+		PermissionID: permission.ID,
+		Description:  data.Description,
+		Condition:    data.Condition,
+	}
+
+	if err = service.Policies.Create(ctx, &policy); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "permission.create_policy",
+		TargetType: "permission",
+		TargetID:   fmt.Sprint(permission.ID),
+		TargetName: permission.Name,
+		After:      policy,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), policy.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"policy": policy})
+}
+
+func (service *PermissionsService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	permission, err := service.managedPermission(r, "delete_permission")
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	if !permission.Deletable {
 		pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no puede ser borrado")
 		return
 	}
 
-	err = service.Permissions.Delete(ctx, uint(id))
+	err = service.Permissions.Delete(ctx, permission.ID)
 	if err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "permission.delete",
+		TargetType: "permission",
+		TargetID:   fmt.Sprint(permission.ID),
+		TargetName: permission.Name,
+		Before:     permission,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
 }
 
+func (service *PermissionsService) DeletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "update_permission"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policyID, err := strconv.Atoi(chi.URLParam(r, "policy_id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	permission, err := service.Permissions.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	permissionPolicies, err := service.Policies.GetByPermission(ctx, permission.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, policy := range permissionPolicies {
+		if policy.ID != uint(policyID) {
+			continue
+		}
+
+		if err = service.Policies.Delete(ctx, policy.ID); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+			Action:     "permission.delete_policy",
+			TargetType: "permission",
+			TargetID:   fmt.Sprint(permission.ID),
+			TargetName: permission.Name,
+			Before:     policy,
+		}); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pkg.JSON(w, r, http.StatusOK, pkg.Map{})
+		return
+	}
+
+	pkg.HTTPError(w, r, http.StatusBadRequest, "La política no existe")
+}
+
 func (service *PermissionsService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -128,6 +369,28 @@ func (service *PermissionsService) GetAllHandler(w http.ResponseWriter, r *http.
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{"permissions": permissions})
 }
 
+// GetCatalogHandler publica el catálogo con el que se emiten los tokens con permisos. El `ETag` es
+// la versión, así que los verificadores pueden consultarlo con `If-None-Match` para saber si cambió.
+func (service *PermissionsService) GetCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	catalog, err := service.Permissions.GetCatalog(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	etag := fmt.Sprintf(`"%d"`, catalog.Version)
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"catalog": catalog})
+}
+
 func (service *PermissionsService) GetByIDHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 
@@ -153,14 +416,100 @@ func (service *PermissionsService) GetByIDHandler(w http.ResponseWriter, r *http
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{"permission": permission})
 }
 
-func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+// Quién tiene cada permiso, incluidos los accesos de emergencia vigentes, es información de
+// auditoría.
+func (service *PermissionsService) GetHoldersHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "update_permission"); err != nil {
+	if err := service.Auth.VerifyPermission(ctx, "view_audit_log"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	idStr := chi.URLParam(r, "id")
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	permission, err := service.Permissions.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		holders, err := service.Permissions.GetHolders(ctx, permission.ID, 0, 0)
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		records := [][]string{{"user_id", "username", "user_permission_id", "source", "granted_by", "granted_by_username", "granted_at", "expires_at"}}
+		for _, holder := range holders {
+			record := []string{fmt.Sprint(holder.UserID), holder.Username, "", holder.Source, "", "", "", ""}
+
+			if holder.UserPermissionID != nil {
+				record[2] = fmt.Sprint(*holder.UserPermissionID)
+			}
+
+			if holder.GrantedBy != nil {
+				record[4] = fmt.Sprint(*holder.GrantedBy)
+			}
+
+			if holder.GrantedByUsername != nil {
+				record[5] = *holder.GrantedByUsername
+			}
+
+			if holder.GrantedAt != nil {
+				record[6] = holder.GrantedAt.Format(time.RFC3339)
+			}
+
+			if holder.ExpiresAt != nil {
+				record[7] = holder.ExpiresAt.Format(time.RFC3339)
+			}
+
+			records = append(records, record)
+		}
+
+		pkg.CSV(w, r, http.StatusOK, permission.Name+"_holders.csv", records)
+		return
+	}
+
+	page, limit, err := utils.ParsePagination(r.URL.Query())
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total, err := service.Permissions.CountHolders(ctx, permission.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	holders, err := service.Permissions.GetHolders(ctx, permission.ID, limit, (page-1)*limit)
+	if err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	if holders == nil || len(holders) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"holders": holders, "page": page, "limit": limit, "total": total})
+}
+
+func (service *PermissionsService) GetPoliciesHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 
 	id, err := strconv.Atoi(idStr)
@@ -169,6 +518,8 @@ func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	ctx := r.Context()
+
 	permission, err := service.Permissions.GetByID(ctx, uint(id))
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
@@ -180,6 +531,94 @@ func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
+	permissionPolicies, err := service.Policies.GetByPermission(ctx, permission.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if permissionPolicies == nil || len(permissionPolicies) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"policies": permissionPolicies})
+}
+
+func (service *PermissionsService) ImportManifestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	applicationName := chi.URLParam(r, "app")
+
+	// Los administradores de la aplicación pueden importar su propio manifiesto.
+	if err := service.Auth.VerifyPermission(ctx, "import_permission_manifest"); err != nil && !service.applicationAdmin(ctx, err, applicationName+":") {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := service.Applications.GetByName(ctx, applicationName); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("La aplicación %s no existe", applicationName))
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	var data dto.PermissionManifestBody
+
+	// El manifiesto puede venir en YAML o en JSON según el `Content-Type`.
+	if err := utils.DecodeManifest(r.Header.Get("Content-Type"), r.Body, &data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	current, err := service.Permissions.GetByApplication(ctx, applicationName)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := utils.PlanPermissionManifest(applicationName, data, current)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	if !dryRun && plan.HasChanges() {
+		if err = service.Permissions.ApplyManifest(ctx, &plan); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+			Action:     "permission.import_manifest",
+			TargetType: "application",
+			TargetName: applicationName,
+			After:      plan,
+		}); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"plan": plan, "dry_run": dryRun})
+}
+
+func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	permission, err := service.managedPermission(r, "update_permission")
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	if !permission.Editable {
 		pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no puede ser editado")
 		return
@@ -204,6 +643,11 @@ func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.
 			return
 		}
 
+		if application, _ := models.SplitPermissionName(data.Name); application != permission.Application {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "No se puede cambiar la aplicación de un permiso")
+			return
+		}
+
 		_, err = service.Permissions.GetByName(ctx, data.Name)
 		if err == nil {
 			pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre del permiso ya está en uso")
@@ -220,15 +664,64 @@ func (service *PermissionsService) UpdateHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = service.Permissions.Update(ctx, uint(id), &data)
+	err = service.Permissions.Update(ctx, permission.ID, &data)
 	if err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	updated := permission
+	updated.Name = data.Name
+	updated.Description = data.Description
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "permission.update",
+		TargetType: "permission",
+		TargetID:   fmt.Sprint(permission.ID),
+		TargetName: permission.Name,
+		Before:     permission,
+		After:      updated,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
 }
 
+func (service *PermissionsService) GetStaleGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "view_permission_usage"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	days := 90
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > 3650 {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "Los días deben ser un número entre 1 y 3650")
+			return
+		}
+	}
+
+	grants, err := service.Permissions.GetStaleGrants(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(grants) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"grants": grants, "days": days})
+}
+
 func (service *PermissionsService) Routes() http.Handler {
 	r := chi.NewRouter()
 
@@ -237,9 +730,20 @@ func (service *PermissionsService) Routes() http.Handler {
 	r.Get("/", service.GetAllHandler)
 	r.Post("/", service.CreateHandler)
 
+	r.Get("/catalog", service.GetCatalogHandler)
+	r.Get("/stale", service.GetStaleGrantsHandler)
+
+	r.Put("/manifests/{app}", service.ImportManifestHandler)
+
 	r.Get("/{id}", service.GetByIDHandler)
 	r.Put("/{id}", service.UpdateHandler)
 	r.Delete("/{id}", service.DeleteHandler)
 
+	r.Get("/{id}/holders", service.GetHoldersHandler)
+
+	r.Get("/{id}/policies", service.GetPoliciesHandler)
+	r.Post("/{id}/policies", service.CreatePolicyHandler)
+	r.Delete("/{id}/policies/{policy_id}", service.DeletePolicyHandler)
+
 	return r
 }
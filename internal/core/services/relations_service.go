@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/relations"
+	"github.com/go-chi/chi"
+)
+
+type RelationsService struct {
+	Audit     interfaces.AuditRepository
+	Auth      interfaces.AuthorizationRepository
+	Relations interfaces.RelationsRepository
+}
+
+func (service *RelationsService) engine(ctx context.Context) (*relations.Engine, error) {
+	stored, err := service.Relations.GetNamespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	engine := relations.Engine{Tuples: service.Relations}
+
+	for _, namespace := range stored {
+		namespaces, err := relations.Parse(namespace.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		engine.Namespaces = append(engine.Namespaces, namespaces...)
+	}
+
+	return &engine, nil
+}
+
+func (service *RelationsService) CheckHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	object := r.URL.Query().Get("object")
+	relation := r.URL.Query().Get("relation")
+	subject := r.URL.Query().Get("subject")
+
+	if object == "" || relation == "" || subject == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el objeto, la relación y el sujeto")
+		return
+	}
+
+	engine, err := service.engine(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	allowed, err := engine.Check(ctx, object, relation, subject)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"allowed": allowed})
+}
+
+func (service *RelationsService) DeleteTupleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_relations"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tuple, err := relations.ParseTuple(r.URL.Query().Get("tuple"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tuples, err := service.Relations.GetTuples(ctx, tuple.Namespace, tuple.ObjectID, tuple.Relation)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, stored := range tuples {
+		if stored.Subject() != tuple.Subject() {
+			continue
+		}
+
+		if err = service.Relations.DeleteTuple(ctx, stored.ID); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+			Action:     "relation.delete_tuple",
+			TargetType: "relation_tuple",
+			TargetID:   fmt.Sprint(stored.ID),
+			TargetName: stored.String(),
+			Before:     stored,
+		}); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		pkg.JSON(w, r, http.StatusOK, pkg.Map{})
+		return
+	}
+
+	pkg.HTTPError(w, r, http.StatusBadRequest, "La tupla no existe")
+}
+
+func (service *RelationsService) ExpandHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	object := r.URL.Query().Get("object")
+	relation := r.URL.Query().Get("relation")
+
+	if object == "" || relation == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el objeto y la relación")
+		return
+	}
+
+	engine, err := service.engine(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tree, err := engine.Expand(ctx, object, relation)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"tree": tree})
+}
+
+func (service *RelationsService) GetNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	namespaces, err := service.Relations.GetNamespaces(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if namespaces == nil || len(namespaces) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"namespaces": namespaces})
+}
+
+func (service *RelationsService) GetTuplesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	namespace, objectID, err := relations.ParseObject(r.URL.Query().Get("object"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	relation := r.URL.Query().Get("relation")
+	if relation == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar la relación")
+		return
+	}
+
+	tuples, err := service.Relations.GetTuples(ctx, namespace, objectID, relation)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if tuples == nil || len(tuples) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"tuples": tuples})
+}
+
+func (service *RelationsService) ListObjectsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	namespace := r.URL.Query().Get("namespace")
+	relation := r.URL.Query().Get("relation")
+	subject := r.URL.Query().Get("subject")
+
+	if namespace == "" || relation == "" || subject == "" {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes ingresar el namespace, la relación y el sujeto")
+		return
+	}
+
+	engine, err := service.engine(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	objects, err := engine.ListObjects(ctx, namespace, relation, subject)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"objects": objects})
+}
+
+func (service *RelationsService) SaveNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_relations"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.SaveRelationNamespacesBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	namespaces, err := relations.Parse(data.Config)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	saved := []models.RelationNamespace{}
+	for _, namespace := range namespaces {
+		stored := models.RelationNamespace{
+			Name:   namespace.Name,
+			Config: namespace.String(),
+		}
+
+		if err = service.Relations.SaveNamespace(ctx, &stored); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		saved = append(saved, stored)
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "relation.save_namespaces",
+		TargetType: "organization",
+		After:      saved,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"namespaces": saved})
+}
+
+func (service *RelationsService) WriteTupleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_relations"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.WriteRelationTupleBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	tuple, err := relations.ParseTuple(data.Tuple)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	engine, err := service.engine(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = engine.Validate(tuple.Namespace, tuple.Relation); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if tuple.SubjectRelation != "" {
+		if err = engine.Validate(tuple.SubjectNamespace, tuple.SubjectRelation); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	tuples, err := service.Relations.GetTuples(ctx, tuple.Namespace, tuple.ObjectID, tuple.Relation)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, stored := range tuples {
+		if stored.Subject() == tuple.Subject() {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La tupla ya existe")
+			return
+		}
+	}
+
+	if err = service.Relations.WriteTuple(ctx, &tuple); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "relation.write_tuple",
+		TargetType: "relation_tuple",
+		TargetID:   fmt.Sprint(tuple.ID),
+		TargetName: tuple.String(),
+		After:      tuple,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), tuple.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"tuple": tuple})
+}
+
+func (service *RelationsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/namespaces", service.GetNamespacesHandler)
+	r.Put("/namespaces", service.SaveNamespacesHandler)
+
+	r.Get("/tuples", service.GetTuplesHandler)
+	r.Post("/tuples", service.WriteTupleHandler)
+	r.Delete("/tuples", service.DeleteTupleHandler)
+
+	r.Get("/check", service.CheckHandler)
+	r.Get("/expand", service.ExpandHandler)
+	r.Get("/list-objects", service.ListObjectsHandler)
+
+	return r
+}
@@ -0,0 +1,510 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/go-chi/chi"
+)
+
+type ReviewsService struct {
+	Audit       interfaces.AuditRepository
+	Auth        interfaces.AuthorizationRepository
+	Permissions interfaces.PermissionsRepository
+	Reviews     interfaces.ReviewsRepository
+	Users       interfaces.UsersRepository
+}
+
+// Cierra las campañas vencidas revocando los elementos que no fueron revisados.
+func CloseExpiredCampaigns(ctx context.Context, reviews interfaces.ReviewsRepository) {
+	campaigns, err := reviews.GetExpired(ctx)
+	if err != nil {
+		log.Printf("No se pudieron obtener las campañas de revisión vencidas: %v", err)
+		return
+	}
+
+	for _, campaign := range campaigns {
+		if err = reviews.Close(ctx, campaign.ID); err != nil {
+			log.Printf("No se pudo cerrar la campaña de revisión %d: %v", campaign.ID, err)
+		}
+	}
+}
+
+func (service *ReviewsService) findUser(ctx context.Context, find string) (models.User, error) {
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		return service.Users.GetByUsername(ctx, find, false)
+	}
+
+	return service.Users.GetByID(ctx, uint(userID))
+}
+
+// Obtiene la campaña y, si su fecha límite ya pasó, la cierra antes de devolverla.
+func (service *ReviewsService) campaign(ctx context.Context, idStr string) (models.ReviewCampaign, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.ReviewCampaign{}, err
+	}
+
+	campaign, err := service.Reviews.GetByID(ctx, uint(id))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return models.ReviewCampaign{}, errors.New("La campaña de revisión no existe")
+		}
+
+		return models.ReviewCampaign{}, err
+	}
+
+	if campaign.Expired() {
+		if err = service.Reviews.Close(ctx, campaign.ID); err != nil {
+			return models.ReviewCampaign{}, err
+		}
+
+		now := time.Now()
+
+		campaign.Status = models.CampaignClosed
+		campaign.ClosedAt = &now
+	}
+
+	return campaign, nil
+}
+
+func (service *ReviewsService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_reviews"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateReviewCampaignBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if len(data.Name) < 4 || len(data.Name) > 50 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El nombre de la campaña debe tener entre 4 y 50 caracteres")
+		return
+	}
+
+	if len(data.Description) < 10 || len(data.Description) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La descripción de la campaña debe tener entre 10 y 150 caracteres")
+		return
+	}
+
+	if data.Permission == "" && len(data.Users) == 0 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes indicar el permiso o los usuarios que se van a revisar")
+		return
+	}
+
+	if len(data.Reviewers) == 0 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Debes indicar al menos un revisor")
+		return
+	}
+
+	if !data.Deadline.After(time.Now()) {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La fecha límite de la campaña debe ser posterior a la fecha actual")
+		return
+	}
+
+	createdBy := uint(ctx.Value("current_user_id").(int))
+
+	campaign := models.ReviewCampaign{
+		Name:        data.Name,
+		Description: data.Description,
+		UserIDs:     []int64{},
+		Deadline:    data.Deadline,
+		CreatedBy:   &createdBy,
+	}
+
+	if data.Permission != "" {
+		permission, err := service.Permissions.GetByName(ctx, data.Permission)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, "El permiso no existe")
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		campaign.PermissionID = &permission.ID
+	}
+
+	for _, find := range data.Users {
+		user, err := service.findUser(ctx, find)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("El usuario %s no existe", find))
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		campaign.UserIDs = append(campaign.UserIDs, int64(user.ID))
+	}
+
+	for _, find := range data.Reviewers {
+		reviewer, err := service.findUser(ctx, find)
+		if err != nil {
+			if err.Error() == "sql: no rows in result set" {
+				pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("El revisor %s no existe", find))
+			} else {
+				pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			}
+
+			return
+		}
+
+		campaign.ReviewerIDs = append(campaign.ReviewerIDs, int64(reviewer.ID))
+	}
+
+	items, err := service.Reviews.GetCandidates(ctx, campaign.PermissionID, campaign.UserIDs)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(items) == 0 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "No hay permisos asignados para revisar con este alcance")
+		return
+	}
+
+	// Los elementos se reparten entre los revisores sin que nadie revise sus propios permisos.
+	next := 0
+	for i := range items {
+		for attempt := 0; attempt < len(campaign.ReviewerIDs); attempt++ {
+			reviewerID := uint(campaign.ReviewerIDs[next%len(campaign.ReviewerIDs)])
+			next++
+
+			if reviewerID != items[i].UserID {
+				items[i].ReviewerID = reviewerID
+				break
+			}
+		}
+
+		if items[i].ReviewerID == 0 {
+			pkg.HTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("El usuario %s no puede revisar sus propios permisos, debes agregar otro revisor", items[i].Username))
+			return
+		}
+	}
+
+	campaign.Items = items
+
+	if err = service.Reviews.Create(ctx, &campaign); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), campaign.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"campaign": campaign})
+}
+
+func (service *ReviewsService) CloseHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_reviews"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	campaign, err := service.campaign(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if campaign.Status != models.CampaignOpen {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La campaña de revisión ya está cerrada")
+		return
+	}
+
+	if err = service.Reviews.Close(ctx, campaign.ID); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
+}
+
+func (service *ReviewsService) decide(w http.ResponseWriter, r *http.Request, decision string, action string) {
+	ctx := r.Context()
+
+	campaign, err := service.campaign(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if campaign.Status != models.CampaignOpen {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La campaña de revisión ya está cerrada")
+		return
+	}
+
+	itemID, err := strconv.Atoi(chi.URLParam(r, "item_id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	item, err := service.Reviews.GetItem(ctx, campaign.ID, uint(itemID))
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El elemento de revisión no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if currentUserID := ctx.Value("current_user_id").(int); uint(currentUserID) != item.ReviewerID {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Este elemento de revisión está asignado a otro revisor")
+		return
+	}
+
+	if item.Decision != models.ReviewPending {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "Este elemento de revisión ya fue revisado")
+		return
+	}
+
+	var data dto.ReviewDecisionBody
+
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		defer r.Body.Close()
+	}
+
+	if len(data.Comment) > 150 {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El comentario no puede tener más de 150 caracteres")
+		return
+	}
+
+	item.Decision = decision
+	item.Comment = data.Comment
+
+	if err = service.Reviews.Decide(ctx, &item); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   fmt.Sprint(item.UserID),
+		TargetName: item.Username,
+		After:      item,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"item": item})
+}
+
+func (service *ReviewsService) CertifyHandler(w http.ResponseWriter, r *http.Request) {
+	service.decide(w, r, models.ReviewCertified, "review.certify")
+}
+
+func (service *ReviewsService) RevokeHandler(w http.ResponseWriter, r *http.Request) {
+	service.decide(w, r, models.ReviewRevoked, "review.revoke")
+}
+
+func (service *ReviewsService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_reviews"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	campaigns, err := service.Reviews.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(campaigns) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"campaigns": campaigns})
+}
+
+func (service *ReviewsService) GetOneHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	campaign, err := service.campaign(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Los revisores solo ven los elementos que tienen asignados.
+	var reviewerID *uint
+	if err = service.Auth.VerifyPermission(ctx, "manage_reviews"); err != nil {
+		currentUserID := uint(ctx.Value("current_user_id").(int))
+
+		isReviewer := false
+		for _, id := range campaign.ReviewerIDs {
+			isReviewer = isReviewer || uint(id) == currentUserID
+		}
+
+		if !isReviewer {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		reviewerID = &currentUserID
+	}
+
+	campaign.Items, err = service.Reviews.GetItems(ctx, campaign.ID, reviewerID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"campaign": campaign})
+}
+
+func (service *ReviewsService) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_reviews"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	campaign, err := service.campaign(ctx, chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if campaign.Status != models.CampaignClosed {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El reporte solo está disponible cuando la campaña está cerrada")
+		return
+	}
+
+	campaign.Items, err = service.Reviews.GetItems(ctx, campaign.ID, nil)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var body, signed []byte
+
+	if r.URL.Query().Get("format") == "csv" {
+		records := [][]string{{"campaign_id", "item_id", "user_id", "username", "permission_id", "permission_name", "reviewer_id", "reviewer_username", "decision", "comment", "decided_at"}}
+		for _, item := range campaign.Items {
+			decidedAt := ""
+			if item.DecidedAt != nil {
+				decidedAt = item.DecidedAt.Format(time.RFC3339)
+			}
+
+			records = append(records, []string{
+				fmt.Sprint(campaign.ID),
+				fmt.Sprint(item.ID),
+				fmt.Sprint(item.UserID),
+				item.Username,
+				fmt.Sprint(item.PermissionID),
+				item.PermissionName,
+				fmt.Sprint(item.ReviewerID),
+				item.ReviewerUsername,
+				item.Decision,
+				item.Comment,
+				decidedAt,
+			})
+		}
+
+		buffer := bytes.Buffer{}
+
+		writer := csv.NewWriter(&buffer)
+		if err = writer.WriteAll(records); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		body = buffer.Bytes()
+		signed = body
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"campaign_%d_report.csv\"", campaign.ID))
+	} else {
+		report := models.ReviewReport{
+			Campaign:    campaign,
+			Summary:     map[string]int{},
+			GeneratedAt: time.Now(),
+		}
+
+		for _, item := range campaign.Items {
+			report.Summary[item.Decision]++
+		}
+
+		if signed, err = json.Marshal(report); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		// La firma se calcula sobre el reporte tal como se envía, sin el objeto que lo contiene.
+		body, err = json.Marshal(pkg.Map{
+			"report":    json.RawMessage(signed),
+			"algorithm": "HMAC-SHA256",
+			"signature": pkg.Sign(pkg.SigningKey(), signed),
+		})
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	w.Header().Set("X-Report-Signature", "sha256="+pkg.Sign(pkg.SigningKey(), signed))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (service *ReviewsService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+
+	r.Get("/{id}", service.GetOneHandler)
+	r.Post("/{id}/close", service.CloseHandler)
+	r.Get("/{id}/report", service.ReportHandler)
+
+	r.Post("/{id}/items/{item_id}/certify", service.CertifyHandler)
+	r.Post("/{id}/items/{item_id}/revoke", service.RevokeHandler)
+
+	return r
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+)
+
+type StateService struct {
+	Applications interfaces.ApplicationsRepository
+	Audit        interfaces.AuditRepository
+	Auth         interfaces.AuthorizationRepository
+	Constraints  interfaces.ConstraintsRepository
+	Permissions  interfaces.PermissionsRepository
+	State        interfaces.StateRepository
+}
+
+// verifyGrants aplica a cada asignación planeada la misma validación de delegación que al otorgar
+// un permiso a mano. Las que no se pueden delegar pasan a ser conflictos.
+func (service *StateService) verifyGrants(ctx context.Context, plan *models.StateImportPlan, grants []models.StateGrant) ([]models.StateGrant, error) {
+	allowed := []models.StateGrant{}
+
+	for _, grant := range grants {
+		// Los permisos que se crean en la misma importación todavía no tienen ID.
+		permission, err := service.Permissions.GetByName(ctx, grant.Permission)
+		if err != nil {
+			if err.Error() != "sql: no rows in result set" {
+				return nil, err
+			}
+
+			permission = models.Permission{Name: grant.Permission}
+		}
+
+		if err = service.Auth.VerifyDelegation(ctx, permission, grant.Grantable); err != nil {
+			plan.Conflicts = append(plan.Conflicts, models.StateConflict{Kind: "grant", Name: grant.Username + "/" + grant.Permission, Reason: err.Error()})
+			continue
+		}
+
+		allowed = append(allowed, grant)
+	}
+
+	return allowed, nil
+}
+
+func (service *StateService) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "export_iam_state"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Los hashes de las contraseñas solo se exportan si se piden explícitamente.
+	document, err := service.State.Export(ctx, r.URL.Query().Get("include_passwords") == "true")
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, document)
+}
+
+func (service *StateService) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "import_iam_state"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var document models.StateDocument
+
+	if err := json.NewDecoder(r.Body).Decode(&document); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if document.Version != models.StateVersion {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "La versión del documento no es compatible")
+		return
+	}
+
+	current, err := service.State.Export(ctx, false)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	applications, err := service.Applications.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	applicationNames := map[string]bool{}
+	for _, application := range applications {
+		applicationNames[application.Name] = true
+	}
+
+	constraints, err := service.Constraints.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan := utils.PlanStateImport(document, current, applicationNames, constraints)
+
+	if plan.CreateGrants, err = service.verifyGrants(ctx, &plan, plan.CreateGrants); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if plan.UpdateGrants, err = service.verifyGrants(ctx, &plan, plan.UpdateGrants); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	if !dryRun && plan.HasChanges() {
+		if err = service.State.Import(ctx, &plan); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+			Action:     "state.import",
+			TargetType: "organization",
+			After:      plan,
+		}); err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"plan": plan, "dry_run": dryRun})
+}
+
+func (service *StateService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/export", service.ExportHandler)
+	r.Post("/import", service.ImportHandler)
+
+	return r
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,21 +10,58 @@ import (
 
 	"github.com/dsolartec/iam-meli/internal/core/middlewares"
 	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
 	"github.com/dsolartec/iam-meli/pkg/interfaces"
 	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/policies"
+	"github.com/dsolartec/iam-meli/pkg/utils"
 	"github.com/go-chi/chi"
 )
 
 type UsersService struct {
+	Audit       interfaces.AuditRepository
 	Auth        interfaces.AuthorizationRepository
+	Denies      interfaces.DeniesRepository
 	Users       interfaces.UsersRepository
 	Permissions interfaces.PermissionsRepository
 }
 
+// userResource expone al usuario de la ruta (y al permiso, si se indica) como `resource` en las
+// políticas del permiso que se verifica.
+func (service *UsersService) userResource(ctx context.Context, find string, permissionName string) policies.ResourceLoader {
+	return func() (map[string]interface{}, error) {
+		user := models.User{}
+
+		id, err := strconv.Atoi(find)
+		if err != nil {
+			user, err = service.Users.GetByUsername(ctx, find, false)
+		} else {
+			user, err = service.Users.GetByID(ctx, uint(id))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		attributes, err := service.Users.GetAttributes(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		resource := policies.NewSubject(user.ID, user.Username, attributes)
+		if permissionName != "" {
+			resource["permission"] = permissionName
+		}
+
+		return resource, nil
+	}
+}
+
 func (service *UsersService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "delete_user"); err != nil {
+	authCtx := policies.WithResourceLoader(ctx, service.userResource(ctx, chi.URLParam(r, "find"), ""))
+	if err := service.Auth.VerifyPermission(authCtx, "delete_user"); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -58,6 +97,17 @@ func (service *UsersService) DeleteHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		Before:     user,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
 }
 
@@ -105,6 +155,39 @@ func (service *UsersService) GetOneHandler(w http.ResponseWriter, r *http.Reques
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{"user": user})
 }
 
+func (service *UsersService) GetAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	find := chi.URLParam(r, "find")
+
+	user := models.User{}
+
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		user, err = service.Users.GetByUsername(ctx, find, false)
+	} else {
+		user, err = service.Users.GetByID(ctx, uint(userID))
+	}
+
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	attributes, err := service.Users.GetAttributes(ctx, user.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"attributes": attributes})
+}
+
 func (service *UsersService) GetAllUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -135,18 +218,38 @@ func (service *UsersService) GetAllUserPermissionsHandler(w http.ResponseWriter,
 		return
 	}
 
-	if user_permissions == nil || len(user_permissions) == 0 {
+	denies, err := service.Denies.GetActiveByUser(ctx, user.ID)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(user_permissions) == 0 && len(denies) == 0 {
 		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
 		return
 	}
 
-	pkg.JSON(w, r, http.StatusOK, pkg.Map{"user_permissions": user_permissions})
+	if user_permissions == nil {
+		user_permissions = []models.UserPermission{}
+	}
+
+	// Marcamos los permisos otorgados que están anulados por una denegación.
+	for i := range user_permissions {
+		for _, deny := range denies {
+			if deny.PermissionID == user_permissions[i].PermissionID {
+				user_permissions[i].Denied = true
+			}
+		}
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"user_permissions": user_permissions, "denies": denies})
 }
 
 func (service *UsersService) GrantPermissionHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "grant_permission"); err != nil {
+	authCtx := policies.WithResourceLoader(ctx, service.userResource(ctx, chi.URLParam(r, "find"), chi.URLParam(r, "permission_name")))
+	if err := service.Auth.VerifyPermission(authCtx, "grant_permission"); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -188,9 +291,20 @@ func (service *UsersService) GrantPermissionHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
+	grantable := r.URL.Query().Get("grantable") == "true"
+
+	if err = service.Auth.VerifyDelegation(ctx, permission, grantable); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	grantedBy := uint(ctx.Value("current_user_id").(int))
+
 	data := models.UserPermission{
 		UserID:       user.ID,
 		PermissionID: permission.ID,
+		GrantedBy:    &grantedBy,
+		Grantable:    grantable,
 	}
 
 	_, err = service.Users.GetUserPermission(ctx, data.UserID, data.PermissionID)
@@ -204,14 +318,28 @@ func (service *UsersService) GrantPermissionHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	w.Header().Add("Location", fmt.Sprintf("%s%d", r.URL.String(), data.ID))
+	data.PermissionName = permission.Name
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "user.grant_permission",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		After:      data,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s%d", r.URL.Path, data.ID))
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{"user_permission": data})
 }
 
 func (service *UsersService) RevokePermissionHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	if err := service.Auth.VerifyPermission(ctx, "revoke_permission"); err != nil {
+	authCtx := policies.WithResourceLoader(ctx, service.userResource(ctx, chi.URLParam(r, "find"), chi.URLParam(r, "permission_name")))
+	if err := service.Auth.VerifyPermission(authCtx, "revoke_permission"); err != nil {
 		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -253,6 +381,11 @@ func (service *UsersService) RevokePermissionHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	if err = service.Auth.VerifyDelegation(ctx, permission, false); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	user_permission, err := service.Users.GetUserPermission(ctx, user.ID, permission.ID)
 	if err != nil {
 		if err.Error() == "sql: no rows in result set" {
@@ -270,9 +403,93 @@ func (service *UsersService) RevokePermissionHandler(w http.ResponseWriter, r *h
 		return
 	}
 
+	user_permission.PermissionName = permission.Name
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "user.revoke_permission",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		Before:     user_permission,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
 }
 
+func (service *UsersService) UpdateAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	authCtx := policies.WithResourceLoader(ctx, service.userResource(ctx, chi.URLParam(r, "find"), ""))
+	if err := service.Auth.VerifyPermission(authCtx, "update_user_attributes"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	find := chi.URLParam(r, "find")
+
+	user := models.User{}
+
+	userID, err := strconv.Atoi(find)
+	if err != nil {
+		user, err = service.Users.GetByUsername(ctx, find, false)
+	} else {
+		user, err = service.Users.GetByID(ctx, uint(userID))
+	}
+
+	if currentUserID := ctx.Value("current_user_id").(int); err == nil && currentUserID == int(user.ID) {
+		err = errors.New("No puedes modificar tus propios atributos")
+	}
+
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El usuario no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	var data dto.UpdateUserAttributesBody
+
+	if err = json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if data.Attributes == nil {
+		data.Attributes = map[string]string{}
+	}
+
+	if err = utils.ValidateUserAttributes(data.Attributes); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = service.Users.UpdateAttributes(ctx, user.ID, data.Attributes); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "user.update_attributes",
+		TargetType: "user",
+		TargetID:   fmt.Sprint(user.ID),
+		TargetName: user.Username,
+		After:      data.Attributes,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"attributes": data.Attributes})
+}
+
 func (service *UsersService) Routes() http.Handler {
 	r := chi.NewRouter()
 
@@ -283,6 +500,9 @@ func (service *UsersService) Routes() http.Handler {
 	r.Get("/{find}", service.GetOneHandler)
 	r.Delete("/{find}", service.DeleteHandler)
 
+	r.Get("/{find}/attributes", service.GetAttributesHandler)
+	r.Put("/{find}/attributes", service.UpdateAttributesHandler)
+
 	r.Get("/{find}/permissions", service.GetAllUserPermissionsHandler)
 	r.Patch("/{find}/permissions/{permission_name}", service.GrantPermissionHandler)
 	r.Delete("/{find}/permissions/{permission_name}", service.RevokePermissionHandler)
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/dsolartec/iam-meli/internal/core/middlewares"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+	"github.com/go-chi/chi"
+)
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+type WebhooksService struct {
+	Audit    interfaces.AuditRepository
+	Auth     interfaces.AuthorizationRepository
+	Webhooks interfaces.WebhooksRepository
+}
+
+func (service *WebhooksService) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_webhooks"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data dto.CreateWebhookBody
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	defer r.Body.Close()
+
+	if err := utils.ValidateWebhook(&data); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Si no se envía un secreto se genera uno; solo se muestra en esta respuesta.
+	if data.Secret == "" {
+		secret, err := randomHex(32)
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		data.Secret = secret
+	}
+
+	subscription := models.WebhookSubscription{
+		URL:        data.URL,
+		Secret:     data.Secret,
+		EventTypes: data.EventTypes,
+	}
+
+	if err := service.Webhooks.Create(ctx, &subscription); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// El secreto no se guarda en la auditoría.
+	audited := subscription
+	audited.Secret = ""
+
+	if err := recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "webhook.create",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(subscription.ID),
+		TargetName: subscription.URL,
+		After:      audited,
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Add("Location", fmt.Sprintf("%s/%d", r.URL.String(), subscription.ID))
+
+	pkg.JSON(w, r, http.StatusCreated, pkg.Map{"webhook": subscription})
+}
+
+func (service *WebhooksService) DeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_webhooks"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El ID del webhook debe ser un número")
+		return
+	}
+
+	if err = service.Webhooks.Delete(ctx, uint(id)); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "El webhook no existe")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	if err = recordAudit(ctx, service.Audit, r, models.AuditEntry{
+		Action:     "webhook.delete",
+		TargetType: "webhook",
+		TargetID:   fmt.Sprint(id),
+	}); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{})
+}
+
+func (service *WebhooksService) GetAllHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_webhooks"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscriptions, err := service.Webhooks.GetAll(ctx)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(subscriptions) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"webhooks": subscriptions})
+}
+
+// Lista las últimas entregas; con `?status=dead` devuelve la lista de entregas fallidas.
+func (service *WebhooksService) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_webhooks"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.WebhookDeliveryPending && status != models.WebhookDeliveryDelivered && status != models.WebhookDeliveryDead {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El estado debe ser pending, delivered o dead")
+		return
+	}
+
+	deliveries, err := service.Webhooks.GetDeliveries(ctx, status)
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if len(deliveries) == 0 {
+		pkg.JSON(w, r, http.StatusNoContent, pkg.Map{})
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"deliveries": deliveries})
+}
+
+func (service *WebhooksService) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := service.Auth.VerifyPermission(ctx, "manage_webhooks"); err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.HTTPError(w, r, http.StatusBadRequest, "El ID de la entrega debe ser un número")
+		return
+	}
+
+	if err = service.Webhooks.Redeliver(ctx, uint(id)); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			pkg.HTTPError(w, r, http.StatusBadRequest, "La entrega no existe o no está en la lista de entregas fallidas")
+		} else {
+			pkg.HTTPError(w, r, http.StatusBadRequest, err.Error())
+		}
+
+		return
+	}
+
+	pkg.JSON(w, r, http.StatusAccepted, pkg.Map{})
+}
+
+func (service *WebhooksService) Routes() http.Handler {
+	r := chi.NewRouter()
+
+	r.Use(middlewares.Authorizator)
+
+	r.Get("/", service.GetAllHandler)
+	r.Post("/", service.CreateHandler)
+	r.Delete("/{id}", service.DeleteHandler)
+	r.Get("/deliveries", service.GetDeliveriesHandler)
+	r.Post("/deliveries/{id}/redeliver", service.RedeliverHandler)
+
+	return r
+}
@@ -17,6 +17,34 @@ func (db *Database) Close() error {
 var (
 	db   *Database
 	once sync.Once
+
+	migrations = []string{
+		"INITIAL_DATA",
+		"ORGANIZATIONS",
+		"EXPLAIN_AUTHORIZATION",
+		"PERMISSION_HOLDERS",
+		"RELATIONS",
+		"PERMISSION_POLICIES",
+		"PERMISSION_DENIES",
+		"SEPARATION_CONSTRAINTS",
+		"DELEGATION",
+		"BREAK_GLASS",
+		"ACCESS_REVIEWS",
+		"PERMISSION_USAGE",
+		"APPLICATIONS",
+		"PERMISSION_MANIFESTS",
+		"IAM_STATE",
+		"AUDIT_LOG",
+		"AUDIT_CHAIN",
+		"WEBHOOKS",
+		"OUTBOX",
+		"EVENT_STREAM",
+		"AUTHZ_CACHE",
+		"PERMISSION_CATALOG",
+
+		// Siempre debe ser la última para copiar a cada organización los permisos integrados.
+		"ORGANIZATION_PERMISSIONS",
+	}
 )
 
 func initDatabase() {
@@ -25,8 +53,10 @@ func initDatabase() {
 		log.Panic(err)
 	}
 
-	if err := RunMigration(conn, "INITIAL_DATA"); err != nil {
-		log.Panic(err)
+	for _, name := range migrations {
+		if err := RunMigration(conn, name); err != nil {
+			log.Panic(err)
+		}
 	}
 
 	db = &Database{
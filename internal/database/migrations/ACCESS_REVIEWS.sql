@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS review_campaigns (
+  id            serial       NOT NULL,
+  org_id        INTEGER      NOT NULL DEFAULT 1,
+  name          VARCHAR(50)  NOT NULL,
+  description   VARCHAR(150) NOT NULL,
+  permission_id INTEGER      NULL,
+  user_ids      INTEGER[]    NOT NULL DEFAULT '{}',
+  reviewer_ids  INTEGER[]    NOT NULL,
+  deadline      timestamp    NOT NULL,
+  status        VARCHAR(10)  NOT NULL DEFAULT 'open',
+  created_by    INTEGER      NULL,
+  created_at    timestamp    DEFAULT now(),
+  closed_at     timestamp    NULL,
+
+  CONSTRAINT pk_review_campaigns PRIMARY KEY(id),
+  CONSTRAINT fk_review_campaigns_pid FOREIGN KEY(permission_id) REFERENCES permissions(id) ON DELETE SET NULL,
+  CONSTRAINT fk_review_campaigns_cby FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL,
+  CONSTRAINT fk_review_campaigns_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- Las campañas pertenecen a la organización en la que se crearon.
+ALTER TABLE review_campaigns ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS review_items (
+  id                 serial       NOT NULL,
+  campaign_id        INTEGER      NOT NULL,
+  user_permission_id INTEGER      NULL,
+  user_id            INTEGER      NOT NULL,
+  permission_id      INTEGER      NOT NULL,
+  reviewer_id        INTEGER      NOT NULL,
+  decision           VARCHAR(15)  NOT NULL DEFAULT 'pending',
+  comment            VARCHAR(150) NOT NULL DEFAULT '',
+  decided_at         timestamp    NULL,
+
+  CONSTRAINT pk_review_items PRIMARY KEY(id),
+  CONSTRAINT fk_review_items_cid FOREIGN KEY(campaign_id) REFERENCES review_campaigns(id) ON DELETE CASCADE,
+  CONSTRAINT fk_review_items_upid FOREIGN KEY(user_permission_id) REFERENCES user_permissions(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_items_cid ON review_items(campaign_id, reviewer_id);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_reviews', 'Poder administrar las campañas de revisión de accesos', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_reviews');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_reviews'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS applications (
+  id          serial       NOT NULL,
+  org_id      INTEGER      NOT NULL,
+  name        VARCHAR(20)  NOT NULL,
+  description VARCHAR(150) NOT NULL,
+  created_at  timestamp    DEFAULT now(),
+
+  CONSTRAINT pk_applications PRIMARY KEY(id),
+  CONSTRAINT uq_applications_name UNIQUE(org_id, name),
+  CONSTRAINT fk_applications_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS application_admins (
+  id             serial    NOT NULL,
+  application_id INTEGER   NOT NULL,
+  user_id        INTEGER   NOT NULL,
+  created_at     timestamp DEFAULT now(),
+
+  CONSTRAINT pk_application_admins PRIMARY KEY(id),
+  CONSTRAINT uq_application_admins UNIQUE(application_id, user_id),
+  CONSTRAINT fk_application_admins_aid FOREIGN KEY(application_id) REFERENCES applications(id) ON DELETE CASCADE,
+  CONSTRAINT fk_application_admins_uid FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Los permisos de una aplicación se nombran `aplicacion:permiso`.
+ALTER TABLE permissions ALTER COLUMN name TYPE VARCHAR(46);
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS application_id INTEGER NULL REFERENCES applications(id) ON DELETE CASCADE;
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_applications', 'Poder administrar las aplicaciones y sus administradores', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_applications');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_applications'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,27 @@
+-- Los estados se guardan como texto para conservar los bytes exactos con los que se calculó el
+-- hash; JSONB los normaliza.
+ALTER TABLE audit_log ALTER COLUMN before TYPE TEXT;
+ALTER TABLE audit_log ALTER COLUMN after TYPE TEXT;
+
+-- Cada registro lleva el hash de su contenido encadenado con el hash del registro anterior de la
+-- misma organización. Los registros anteriores a esta migración quedan sin hash.
+ALTER TABLE audit_log
+  ADD COLUMN IF NOT EXISTS prev_hash VARCHAR(64) NULL,
+  ADD COLUMN IF NOT EXISTS hash      VARCHAR(64) NULL;
+
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+  id            serial      NOT NULL,
+  org_id        INTEGER     NOT NULL,
+  last_entry_id BIGINT      NOT NULL,
+  last_hash     VARCHAR(64) NOT NULL,
+  signature     VARCHAR(64) NOT NULL,
+  created_at    timestamp   NOT NULL DEFAULT now(),
+
+  CONSTRAINT pk_audit_checkpoints PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_org ON audit_checkpoints(org_id, last_entry_id);
+
+DROP TRIGGER IF EXISTS tr_audit_checkpoints_append_only ON audit_checkpoints;
+CREATE TRIGGER tr_audit_checkpoints_append_only BEFORE UPDATE OR DELETE ON audit_checkpoints
+  FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
@@ -0,0 +1,43 @@
+-- Los registros de auditoría no tienen llaves foráneas para conservarse aunque se borren el
+-- actor o el objetivo.
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          bigserial    NOT NULL,
+  org_id      INTEGER      NOT NULL,
+  actor_id    INTEGER      NULL,
+  action      VARCHAR(50)  NOT NULL,
+  target_type VARCHAR(30)  NOT NULL,
+  target_id   VARCHAR(50)  NULL,
+  target_name VARCHAR(100) NULL,
+  before      JSONB        NULL,
+  after       JSONB        NULL,
+  ip          VARCHAR(45)  NULL,
+  user_agent  TEXT         NULL,
+  request_id  VARCHAR(100) NULL,
+  created_at  timestamp    NOT NULL DEFAULT now(),
+
+  CONSTRAINT pk_audit_log PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_created ON audit_log(org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(org_id, actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(org_id, target_type, target_id);
+
+-- El registro solo admite inserciones.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log es de solo inserción';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_audit_log_append_only ON audit_log;
+CREATE TRIGGER tr_audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+  FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'view_audit_log', 'Poder consultar el registro de auditoría', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'view_audit_log');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'view_audit_log'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,103 @@
+-- Avisa a las réplicas qué usuarios deben volver a cargar sus permisos. El aviso lleva el id del
+-- usuario, o `*` cuando el cambio puede afectar a cualquiera, y llega al confirmar la transacción.
+CREATE OR REPLACE FUNCTION authz_cache_notify_user_permissions() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP <> 'INSERT' THEN
+    PERFORM pg_notify('iam_authz', OLD.user_id::text);
+  END IF;
+
+  IF TG_OP <> 'DELETE' THEN
+    PERFORM pg_notify('iam_authz', NEW.user_id::text);
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_authz_cache_user_permissions ON user_permissions;
+CREATE TRIGGER tr_authz_cache_user_permissions AFTER INSERT OR UPDATE OR DELETE ON user_permissions
+  FOR EACH ROW EXECUTE PROCEDURE authz_cache_notify_user_permissions();
+
+-- Cambiar el nombre, la organización o los atributos de un usuario, o eliminarlo.
+CREATE OR REPLACE FUNCTION authz_cache_notify_users() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('iam_authz', OLD.id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_authz_cache_users ON users;
+CREATE TRIGGER tr_authz_cache_users AFTER UPDATE ON users
+  FOR EACH ROW
+  WHEN (OLD.username IS DISTINCT FROM NEW.username OR OLD.org_id IS DISTINCT FROM NEW.org_id OR OLD.attributes IS DISTINCT FROM NEW.attributes)
+  EXECUTE PROCEDURE authz_cache_notify_users();
+
+DROP TRIGGER IF EXISTS tr_authz_cache_users_delete ON users;
+CREATE TRIGGER tr_authz_cache_users_delete AFTER DELETE ON users
+  FOR EACH ROW EXECUTE PROCEDURE authz_cache_notify_users();
+
+-- Renombrar un permiso afecta a quienes lo tienen asignado o denegado. Al eliminarlo, los borrados
+-- en cascada de sus asignaciones y denegaciones ya avisan.
+CREATE OR REPLACE FUNCTION authz_cache_notify_permissions() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('iam_authz', up.user_id::text) FROM user_permissions up WHERE up.permission_id = NEW.id;
+  PERFORM pg_notify('iam_authz', d.user_id::text) FROM permission_denies d WHERE d.permission_id = NEW.id AND d.user_id IS NOT NULL;
+
+  IF EXISTS (SELECT 1 FROM permission_denies d WHERE d.permission_id = NEW.id AND d.user_id IS NULL) THEN
+    PERFORM pg_notify('iam_authz', '*');
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_authz_cache_permissions ON permissions;
+CREATE TRIGGER tr_authz_cache_permissions AFTER UPDATE ON permissions
+  FOR EACH ROW
+  WHEN (OLD.name IS DISTINCT FROM NEW.name OR OLD.org_id IS DISTINCT FROM NEW.org_id)
+  EXECUTE PROCEDURE authz_cache_notify_permissions();
+
+-- Las políticas se guardan junto con los permisos del usuario.
+CREATE OR REPLACE FUNCTION authz_cache_notify_permission_policies() RETURNS trigger AS $$
+DECLARE
+  changed_permission_id INTEGER;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    changed_permission_id := OLD.permission_id;
+  ELSE
+    changed_permission_id := NEW.permission_id;
+  END IF;
+
+  PERFORM pg_notify('iam_authz', up.user_id::text) FROM user_permissions up WHERE up.permission_id = changed_permission_id;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_authz_cache_permission_policies ON permission_policies;
+CREATE TRIGGER tr_authz_cache_permission_policies AFTER INSERT OR UPDATE OR DELETE ON permission_policies
+  FOR EACH ROW EXECUTE PROCEDURE authz_cache_notify_permission_policies();
+
+-- Una denegación sin usuario aplica a toda la organización.
+CREATE OR REPLACE FUNCTION authz_cache_notify_permission_denies() RETURNS trigger AS $$
+DECLARE
+  changed permission_denies;
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    changed := OLD;
+  ELSE
+    changed := NEW;
+  END IF;
+
+  IF changed.user_id IS NULL OR (TG_OP = 'UPDATE' AND OLD.user_id IS DISTINCT FROM NEW.user_id) THEN
+    PERFORM pg_notify('iam_authz', '*');
+  ELSE
+    PERFORM pg_notify('iam_authz', changed.user_id::text);
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_authz_cache_permission_denies ON permission_denies;
+CREATE TRIGGER tr_authz_cache_permission_denies AFTER INSERT OR UPDATE OR DELETE ON permission_denies
+  FOR EACH ROW EXECUTE PROCEDURE authz_cache_notify_permission_denies();
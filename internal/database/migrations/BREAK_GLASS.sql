@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS break_glass_sessions (
+  id            serial       NOT NULL,
+  user_id       INTEGER      NOT NULL,
+  justification VARCHAR(500) NOT NULL,
+  permissions   TEXT[]       NOT NULL,
+  started_at    timestamp    DEFAULT now(),
+  expires_at    timestamp    NOT NULL,
+
+  CONSTRAINT pk_break_glass_sessions PRIMARY KEY(id),
+  CONSTRAINT fk_break_glass_sessions_uid FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_break_glass_sessions_uid ON break_glass_sessions(user_id, expires_at);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'break_glass', 'Poder activar el acceso de emergencia', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'break_glass');
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'review_break_glass', 'Poder revisar los accesos de emergencia', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'review_break_glass');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name IN ('break_glass', 'review_break_glass')
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,10 @@
+ALTER TABLE user_permissions ADD COLUMN IF NOT EXISTS grantable BOOLEAN NOT NULL DEFAULT FALSE;
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'delegate_any_permission', 'Poder otorgar y quitar cualquier permiso sin tenerlo asignado como delegable', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'delegate_any_permission');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'delegate_any_permission'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
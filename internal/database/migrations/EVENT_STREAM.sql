@@ -0,0 +1,21 @@
+-- Avisa a todas las réplicas que hay eventos nuevos en la bandeja de salida. El aviso llega al
+-- confirmar la transacción, así que los eventos ya son visibles al recibirlo.
+CREATE OR REPLACE FUNCTION outbox_events_notify() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('iam_events', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_outbox_events_notify ON outbox_events;
+CREATE TRIGGER tr_outbox_events_notify AFTER INSERT ON outbox_events
+  FOR EACH STATEMENT EXECUTE PROCEDURE outbox_events_notify();
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'view_events', 'Poder recibir los eventos de cambios de todos los usuarios y permisos', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'view_events');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'view_events'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
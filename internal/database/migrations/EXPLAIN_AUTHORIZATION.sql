@@ -0,0 +1,8 @@
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'explain_authorization', 'Poder consultar por qué se otorga o se niega un permiso a un usuario', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'explain_authorization');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'explain_authorization'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
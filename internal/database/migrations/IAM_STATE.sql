@@ -0,0 +1,12 @@
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'export_iam_state', 'Poder exportar los usuarios, permisos y asignaciones de la organización', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'export_iam_state');
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'import_iam_state', 'Poder importar los usuarios, permisos y asignaciones de la organización', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'import_iam_state');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name IN ('export_iam_state', 'import_iam_state')
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
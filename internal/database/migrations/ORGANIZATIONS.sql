@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS organizations (
+  id         serial      NOT NULL,
+  name       VARCHAR(30) NOT NULL,
+  owner_id   INTEGER     NULL,
+  created_at timestamp   DEFAULT now(),
+
+  CONSTRAINT pk_organizations PRIMARY KEY(id),
+  CONSTRAINT uq_organizations_name UNIQUE(name),
+  CONSTRAINT fk_organizations_oid FOREIGN KEY(owner_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO organizations (id, name, owner_id)
+  VALUES (1, 'platform', 1)
+  ON CONFLICT(id) DO NOTHING;
+
+SELECT SETVAL(
+  (SELECT pg_get_serial_sequence('organizations', 'id')),
+  (SELECT MAX(id) FROM organizations)
+);
+
+-- Los usuarios y permisos existentes pertenecen a la organización de la plataforma.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_users_org ON users(org_id, username);
+CREATE INDEX IF NOT EXISTS idx_permissions_org ON permissions(org_id, name);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_organizations', 'Poder administrar las organizaciones de la plataforma', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_organizations');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_organizations'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,19 @@
+-- Copia a cada organización los permisos integrados que le falten (por ejemplo, los
+-- añadidos por migraciones posteriores a su creación) y se los otorga a su dueño. La
+-- asignación se hace solo al copiar el permiso, así que un permiso que se le quitó al dueño
+-- no se le vuelve a otorgar al reiniciar; las asignaciones iniciales las hace
+-- `OrganizationsRepository.Create`.
+WITH copied AS (
+  INSERT INTO permissions (name, description, deletable, editable, org_id)
+    SELECT p.name, p.description, FALSE, FALSE, o.id FROM permissions p
+      CROSS JOIN organizations o
+    WHERE p.org_id = 1 AND o.id <> 1
+      AND p.deletable = FALSE AND p.editable = FALSE
+      AND p.name <> 'manage_organizations'
+      AND NOT EXISTS (SELECT 1 FROM permissions op WHERE op.org_id = o.id AND op.name = p.name)
+  RETURNING id, org_id
+)
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT o.owner_id, c.id FROM copied c
+    INNER JOIN organizations o ON o.id = c.org_id
+  WHERE o.owner_id IS NOT NULL;
@@ -0,0 +1,25 @@
+-- Bandeja de salida: los eventos se escriben en la misma transacción que el cambio que los genera y
+-- el relay los publica después, así no se pierden si el proceso cae entre el cambio y la
+-- publicación.
+CREATE TABLE IF NOT EXISTS outbox_events (
+  id              bigserial    NOT NULL,
+  org_id          INTEGER      NOT NULL,
+  aggregate_type  VARCHAR(30)  NOT NULL,
+  aggregate_id    VARCHAR(50)  NOT NULL,
+  event_type      VARCHAR(30)  NOT NULL,
+  idempotency_key UUID         NOT NULL DEFAULT gen_random_uuid(),
+  payload         JSONB        NOT NULL,
+  attempts        INTEGER      NOT NULL DEFAULT 0,
+  last_error      VARCHAR(500) NULL,
+  created_at      timestamp    NOT NULL DEFAULT now(),
+  published_at    timestamp    NULL,
+
+  CONSTRAINT pk_outbox_events PRIMARY KEY(id),
+  CONSTRAINT uq_outbox_events_key UNIQUE(idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(id) WHERE published_at IS NULL;
+
+-- Las entregas de webhooks usan la llave de idempotencia del evento, así que publicar dos veces
+-- el mismo evento no duplica las entregas.
+CREATE UNIQUE INDEX IF NOT EXISTS uq_webhook_deliveries_event ON webhook_deliveries(subscription_id, event_id);
@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS permission_catalogs (
+  org_id  INTEGER NOT NULL,
+  version BIGINT  NOT NULL DEFAULT 1,
+
+  CONSTRAINT pk_permission_catalogs PRIMARY KEY(org_id),
+  CONSTRAINT fk_permission_catalogs_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- La posición de cada permiso en el catálogo depende de los permisos que existen, así que cualquier
+-- alta, baja o cambio de nombre publica una versión nueva.
+CREATE OR REPLACE FUNCTION permission_catalogs_bump(catalog_org_id INTEGER) RETURNS void AS $$
+BEGIN
+  INSERT INTO permission_catalogs (org_id, version)
+    SELECT catalog_org_id, 2 WHERE EXISTS (SELECT 1 FROM organizations WHERE id = catalog_org_id)
+    ON CONFLICT (org_id) DO UPDATE SET version = permission_catalogs.version + 1;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION permission_catalogs_notify() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP <> 'INSERT' THEN
+    PERFORM permission_catalogs_bump(OLD.org_id);
+  END IF;
+
+  IF TG_OP <> 'DELETE' AND (TG_OP = 'INSERT' OR OLD.org_id <> NEW.org_id) THEN
+    PERFORM permission_catalogs_bump(NEW.org_id);
+  END IF;
+
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS tr_permission_catalogs_insert_delete ON permissions;
+CREATE TRIGGER tr_permission_catalogs_insert_delete AFTER INSERT OR DELETE ON permissions
+  FOR EACH ROW EXECUTE PROCEDURE permission_catalogs_notify();
+
+DROP TRIGGER IF EXISTS tr_permission_catalogs_update ON permissions;
+CREATE TRIGGER tr_permission_catalogs_update AFTER UPDATE ON permissions
+  FOR EACH ROW
+  WHEN (OLD.name IS DISTINCT FROM NEW.name OR OLD.org_id IS DISTINCT FROM NEW.org_id)
+  EXECUTE PROCEDURE permission_catalogs_notify();
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS permission_denies (
+  id              serial       NOT NULL,
+  permission_id   INTEGER      NOT NULL,
+  user_id         INTEGER      NULL,
+  except_user_ids INTEGER[]    NOT NULL DEFAULT '{}',
+  reason          VARCHAR(150) NOT NULL,
+  expires_at      timestamp    NULL,
+  created_by      INTEGER      NULL,
+  created_at      timestamp    DEFAULT now(),
+
+  CONSTRAINT pk_permission_denies PRIMARY KEY(id),
+  CONSTRAINT fk_permission_denies_pid FOREIGN KEY(permission_id) REFERENCES permissions(id) ON DELETE CASCADE,
+  CONSTRAINT fk_permission_denies_uid FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_permission_denies_cby FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_permission_denies_pid ON permission_denies(permission_id);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_denies', 'Poder denegar explícitamente permisos a los usuarios', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_denies');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_denies'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,7 @@
+ALTER TABLE user_permissions
+  ADD COLUMN IF NOT EXISTS granted_by INTEGER NULL,
+  ADD COLUMN IF NOT EXISTS created_at timestamp DEFAULT now();
+
+ALTER TABLE user_permissions DROP CONSTRAINT IF EXISTS fk_user_permissions_gby;
+ALTER TABLE user_permissions
+  ADD CONSTRAINT fk_user_permissions_gby FOREIGN KEY(granted_by) REFERENCES users(id) ON DELETE SET NULL;
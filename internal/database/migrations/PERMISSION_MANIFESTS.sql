@@ -0,0 +1,12 @@
+-- Los permisos que desaparecen del manifiesto de su aplicación se marcan como obsoletos en lugar
+-- de borrarse, para no retirar de golpe las asignaciones existentes.
+ALTER TABLE permissions ADD COLUMN IF NOT EXISTS deprecated_at timestamp NULL;
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'import_permission_manifest', 'Poder importar el manifiesto de permisos de cualquier aplicación', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'import_permission_manifest');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'import_permission_manifest'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
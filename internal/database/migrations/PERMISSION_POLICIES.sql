@@ -0,0 +1,21 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS permission_policies (
+  id            serial       NOT NULL,
+  permission_id INTEGER      NOT NULL,
+  description   VARCHAR(150) NOT NULL DEFAULT '',
+  condition     VARCHAR(500) NOT NULL,
+  created_at    timestamp    DEFAULT now(),
+
+  CONSTRAINT pk_permission_policies PRIMARY KEY(id),
+  CONSTRAINT fk_permission_policies_pid FOREIGN KEY(permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'update_user_attributes', 'Poder actualizar los atributos de un usuario usados por las políticas', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'update_user_attributes');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'update_user_attributes'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
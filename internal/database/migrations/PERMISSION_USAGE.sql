@@ -0,0 +1,10 @@
+ALTER TABLE user_permissions ADD COLUMN IF NOT EXISTS last_used_at timestamp NULL;
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'view_permission_usage', 'Poder consultar el uso de los permisos otorgados', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'view_permission_usage');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'view_permission_usage'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS relation_namespaces (
+  org_id     INTEGER     NOT NULL DEFAULT 1,
+  name       VARCHAR(64) NOT NULL,
+  config     TEXT        NOT NULL,
+  created_at timestamp   DEFAULT now(),
+  updated_at timestamp   DEFAULT now(),
+
+  CONSTRAINT fk_relation_namespaces_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS relation_tuples (
+  id                serial       NOT NULL,
+  org_id            INTEGER      NOT NULL DEFAULT 1,
+  namespace         VARCHAR(64)  NOT NULL,
+  object_id         VARCHAR(128) NOT NULL,
+  relation          VARCHAR(64)  NOT NULL,
+  subject_namespace VARCHAR(64)  NOT NULL,
+  subject_object_id VARCHAR(128) NOT NULL,
+  subject_relation  VARCHAR(64)  NOT NULL DEFAULT '',
+  created_at        timestamp    DEFAULT now(),
+
+  CONSTRAINT pk_relation_tuples PRIMARY KEY(id),
+  CONSTRAINT fk_relation_tuples_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- Los namespaces y las tuplas pertenecen a una organización y solo son únicos dentro de ella.
+ALTER TABLE relation_namespaces ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE relation_namespaces DROP CONSTRAINT IF EXISTS pk_relation_namespaces;
+
+ALTER TABLE relation_tuples ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE relation_tuples DROP CONSTRAINT IF EXISTS uq_relation_tuples;
+
+DROP INDEX IF EXISTS idx_relation_tuples_object;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_relation_namespaces_org_name ON relation_namespaces(org_id, name);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_relation_tuples_org ON relation_tuples(org_id, namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_relations', 'Poder configurar los namespaces y escribir tuplas de relaciones', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_relations');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_relations'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
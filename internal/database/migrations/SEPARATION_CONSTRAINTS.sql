@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS separation_constraints (
+  id             serial       NOT NULL,
+  org_id         INTEGER      NOT NULL DEFAULT 1,
+  name           VARCHAR(25)  NOT NULL,
+  description    VARCHAR(150) NOT NULL,
+  max_allowed    INTEGER      NOT NULL DEFAULT 1,
+  permission_ids INTEGER[]    NOT NULL,
+  created_at     timestamp    DEFAULT now(),
+
+  CONSTRAINT pk_separation_constraints PRIMARY KEY(id),
+  CONSTRAINT fk_separation_constraints_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- Las restricciones pertenecen a una organización y su nombre solo es único dentro de ella.
+ALTER TABLE separation_constraints ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations(id) ON DELETE CASCADE;
+ALTER TABLE separation_constraints DROP CONSTRAINT IF EXISTS separation_constraints_name_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_separation_constraints_org_name ON separation_constraints(org_id, name);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_constraints', 'Poder administrar las restricciones de separación de funciones', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_constraints');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_constraints'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
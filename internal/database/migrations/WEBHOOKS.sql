@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+  id          serial        NOT NULL,
+  org_id      INTEGER       NOT NULL DEFAULT 1,
+  url         VARCHAR(500)  NOT NULL,
+  secret      VARCHAR(100)  NOT NULL,
+  event_types VARCHAR(30)[] NOT NULL,
+  created_at  timestamp     DEFAULT now(),
+
+  CONSTRAINT pk_webhook_subscriptions PRIMARY KEY(id),
+  CONSTRAINT fk_webhook_subscriptions_oid FOREIGN KEY(org_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- Cada evento genera una entrega por suscripción. Las entregas que agotan los intentos quedan
+-- con el estado `dead` hasta que se vuelvan a enviar.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               serial       NOT NULL,
+  org_id           INTEGER      NOT NULL DEFAULT 1,
+  subscription_id  INTEGER      NOT NULL,
+  event_id         VARCHAR(36)  NOT NULL,
+  event_type       VARCHAR(30)  NOT NULL,
+  payload          TEXT         NOT NULL,
+  status           VARCHAR(10)  NOT NULL DEFAULT 'pending',
+  attempts         INTEGER      NOT NULL DEFAULT 0,
+  last_status_code INTEGER      NULL,
+  last_error       VARCHAR(500) NULL,
+  next_attempt_at  timestamp    NOT NULL DEFAULT now(),
+  created_at       timestamp    NOT NULL DEFAULT now(),
+  delivered_at     timestamp    NULL,
+
+  CONSTRAINT pk_webhook_deliveries PRIMARY KEY(id),
+  CONSTRAINT fk_webhook_deliveries_sid FOREIGN KEY(subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  CONSTRAINT ck_webhook_deliveries_status CHECK (status IN ('pending', 'delivered', 'dead'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+
+INSERT INTO permissions (name, description, deletable, editable)
+  SELECT 'manage_webhooks', 'Poder administrar las suscripciones de webhooks y sus entregas', FALSE, FALSE
+  WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE org_id = 1 AND name = 'manage_webhooks');
+
+INSERT INTO user_permissions (user_id, permission_id)
+  SELECT 1, p.id FROM permissions p
+  WHERE p.org_id = 1 AND p.name = 'manage_webhooks'
+    AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = 1 AND up.permission_id = p.id);
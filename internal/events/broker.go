@@ -0,0 +1,199 @@
+// Package events reparte a los clientes conectados los eventos de la bandeja de salida.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const (
+	// Eventos que se leen por consulta.
+	BatchSize = 500
+
+	// Eventos que puede acumular un cliente lento antes de desconectarlo; al reconectarse con
+	// `Last-Event-ID` recupera los que perdió.
+	SubscriptionBuffer = 256
+
+	// Cada cuánto se consulta la bandeja aunque no llegue un aviso de PostgreSQL.
+	PollInterval = time.Second
+)
+
+// Subscription recibe en `Events` los eventos de su organización que acepta `Filter`. Si el
+// cliente no los consume a tiempo el canal se cierra.
+type Subscription struct {
+	Org    uint
+	Filter func(event models.OutboxEvent) bool
+	Events chan models.OutboxEvent
+
+	// From es el último evento que el broker había repartido al suscribirse; los anteriores se
+	// deben leer de la base de datos.
+	From uint64
+
+	closed bool
+}
+
+// Broker lee en orden los eventos nuevos de la bandeja de salida y los reparte a las
+// suscripciones. Lo despiertan los avisos de `LISTEN/NOTIFY` y, por si se pierde alguno, una
+// consulta periódica.
+type Broker struct {
+	Outbox interfaces.OutboxRepository
+
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	lastID        uint64
+	started       bool
+	wake          chan struct{}
+}
+
+func NewBroker(outbox interfaces.OutboxRepository) *Broker {
+	return &Broker{
+		Outbox:        outbox,
+		subscriptions: map[*Subscription]struct{}{},
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+func (broker *Broker) Subscribe(org uint, filter func(event models.OutboxEvent) bool) *Subscription {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	subscription := &Subscription{
+		Org:    org,
+		Filter: filter,
+		Events: make(chan models.OutboxEvent, SubscriptionBuffer),
+		From:   broker.lastID,
+	}
+
+	broker.subscriptions[subscription] = struct{}{}
+
+	return subscription
+}
+
+func (broker *Broker) Unsubscribe(subscription *Subscription) {
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	broker.close(subscription)
+}
+
+func (broker *Broker) close(subscription *Subscription) {
+	delete(broker.subscriptions, subscription)
+
+	if !subscription.closed {
+		subscription.closed = true
+		close(subscription.Events)
+	}
+}
+
+// Wake pide leer los eventos nuevos sin esperar a la siguiente consulta periódica.
+func (broker *Broker) Wake() {
+	select {
+	case broker.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start fija el punto de partida en el último evento existente; los clientes que necesiten
+// eventos anteriores los piden con `Last-Event-ID`.
+func (broker *Broker) Start(ctx context.Context) error {
+	lastID, err := broker.Outbox.LastID(ctx)
+	if err != nil {
+		return err
+	}
+
+	broker.mu.Lock()
+	broker.lastID = lastID
+	broker.started = true
+	broker.mu.Unlock()
+
+	return nil
+}
+
+// Poll reparte los eventos nuevos. Si encuentra un salto en los IDs que todavía no está asentado
+// se detiene ahí para no saltarse un evento que se confirme tarde.
+func (broker *Broker) Poll(ctx context.Context) error {
+	for {
+		broker.mu.Lock()
+		lastID := broker.lastID
+		broker.mu.Unlock()
+
+		events, err := broker.Outbox.GetAllSince(ctx, lastID, BatchSize)
+		if err != nil {
+			return err
+		}
+
+		broker.mu.Lock()
+		for _, event := range events {
+			if event.ID != broker.lastID+1 && !event.Settled {
+				break
+			}
+
+			broker.dispatch(event)
+			broker.lastID = event.ID
+		}
+
+		advanced := broker.lastID > lastID
+		broker.mu.Unlock()
+
+		if len(events) < BatchSize || !advanced {
+			return nil
+		}
+	}
+}
+
+func (broker *Broker) dispatch(event models.OutboxEvent) {
+	for subscription := range broker.subscriptions {
+		if subscription.Org != event.OrgID || (subscription.Filter != nil && !subscription.Filter(event)) {
+			continue
+		}
+
+		select {
+		case subscription.Events <- event:
+		default:
+			broker.close(subscription)
+		}
+	}
+}
+
+// Run reparte los eventos hasta que se cierre `stop`.
+func (broker *Broker) Run(stop <-chan struct{}) {
+	ctx := context.Background()
+
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		broker.mu.Lock()
+		started := broker.started
+		broker.mu.Unlock()
+
+		var err error
+		if started {
+			err = broker.Poll(ctx)
+		} else {
+			err = broker.Start(ctx)
+		}
+
+		if err != nil {
+			log.Printf("No se pudieron leer los eventos: %s", err.Error())
+		}
+
+		select {
+		case <-stop:
+			broker.mu.Lock()
+			for subscription := range broker.subscriptions {
+				broker.close(subscription)
+			}
+			broker.mu.Unlock()
+
+			return
+		case <-ticker.C:
+		case <-broker.wake:
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Canal de PostgreSQL en el que el trigger de la bandeja de salida avisa de eventos nuevos.
+const Channel = "iam_events"
+
+// Listen despierta al broker con cada aviso de `LISTEN/NOTIFY`, así los eventos escritos desde
+// cualquier réplica llegan a los clientes de todas.
+func Listen(uri string, broker *Broker, stop <-chan struct{}) {
+	listener := pq.NewListener(uri, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Error en la escucha de eventos: %s", err.Error())
+		}
+	})
+
+	defer listener.Close()
+
+	if err := listener.Listen(Channel); err != nil {
+		log.Printf("No se pudo escuchar el canal %s: %s", Channel, err.Error())
+		return
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-listener.Notify:
+			// Un aviso nil indica que la conexión se restableció y pudo perder avisos.
+			broker.Wake()
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package iamctl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/iamapi"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+func userTable(users ...models.User) Table {
+	table := Table{Headers: []string{"ID", "USUARIO", "ATRIBUTOS", "CREADO"}}
+
+	for _, user := range users {
+		attributes := []string{}
+		for key, value := range user.Attributes {
+			attributes = append(attributes, key+"="+value)
+		}
+
+		sort.Strings(attributes)
+
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(int(user.ID)),
+			user.Username,
+			strings.Join(attributes, ","),
+			user.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	return table
+}
+
+func permissionTable(permissions ...models.Permission) Table {
+	table := Table{Headers: []string{"ID", "NOMBRE", "DESCRIPCIÓN", "EDITABLE", "ELIMINABLE"}}
+
+	for _, permission := range permissions {
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(int(permission.ID)),
+			permission.Name,
+			permission.Description,
+			strconv.FormatBool(permission.Editable),
+			strconv.FormatBool(permission.Deletable),
+		})
+	}
+
+	return table
+}
+
+func users(cmd *command, args []string) int {
+	positional, err := cmd.parse(args)
+	if err != nil {
+		return ExitUsage
+	}
+
+	if len(positional) == 0 {
+		return cmd.usage("Uso: iamctl users list | get <usuario> | delete <usuario>")
+	}
+
+	if positional[0] != "list" && len(positional) != 2 {
+		return cmd.usage(fmt.Sprintf("Uso: iamctl users %s <usuario>", positional[0]))
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	ctx := context.Background()
+
+	switch positional[0] {
+	case "list":
+		users, err := client.ListUsers(ctx)
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(users, userTable(users...))
+	case "get":
+		user, err := client.GetUser(ctx, positional[1])
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(user, userTable(user))
+	case "delete":
+		if err := client.DeleteUser(ctx, positional[1]); err != nil {
+			return cmd.fail(err)
+		}
+
+		fmt.Fprintf(cmd.stderr, "Usuario %s eliminado.\n", positional[1])
+
+		return ExitOK
+	}
+
+	return cmd.usage(fmt.Sprintf("El subcomando users %s no existe.", positional[0]))
+}
+
+func permissions(cmd *command, args []string) int {
+	name := cmd.flags.String("name", "", "Nombre del permiso")
+	description := cmd.flags.String("description", "", "Descripción del permiso")
+
+	positional, err := cmd.parse(args)
+	if err != nil {
+		return ExitUsage
+	}
+
+	if len(positional) == 0 {
+		return cmd.usage("Uso: iamctl permissions list | create -name N [-description D] | update <id> [-name N] [-description D] | delete <id>")
+	}
+
+	var id uint64
+	if positional[0] == "update" || positional[0] == "delete" {
+		if len(positional) != 2 {
+			return cmd.usage(fmt.Sprintf("Uso: iamctl permissions %s <id>", positional[0]))
+		}
+
+		if id, err = strconv.ParseUint(positional[1], 10, 64); err != nil {
+			return cmd.usage("El ID del permiso debe ser un número")
+		}
+	}
+
+	if positional[0] == "create" && *name == "" {
+		return cmd.usage("Uso: iamctl permissions create -name N [-description D]")
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	ctx := context.Background()
+
+	switch positional[0] {
+	case "list":
+		permissions, err := client.ListPermissions(ctx)
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(permissions, permissionTable(permissions...))
+	case "create":
+		permission, err := client.CreatePermission(ctx, dto.CreatePermissionBody{Name: *name, Description: *description})
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(permission, permissionTable(permission))
+	case "update":
+		if err := client.UpdatePermission(ctx, uint(id), dto.UpdatePermissionBody{Name: *name, Description: *description}); err != nil {
+			return cmd.fail(err)
+		}
+
+		permission, err := client.GetPermission(ctx, uint(id))
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(permission, permissionTable(permission))
+	case "delete":
+		if err := client.DeletePermission(ctx, uint(id)); err != nil {
+			return cmd.fail(err)
+		}
+
+		fmt.Fprintf(cmd.stderr, "Permiso %d eliminado.\n", id)
+
+		return ExitOK
+	}
+
+	return cmd.usage(fmt.Sprintf("El subcomando permissions %s no existe.", positional[0]))
+}
+
+func grants(cmd *command, args []string) int {
+	grantable := cmd.flags.Bool("grantable", false, "Permite que el usuario delegue el permiso")
+
+	positional, err := cmd.parse(args)
+	if err != nil {
+		return ExitUsage
+	}
+
+	if len(positional) == 0 {
+		return cmd.usage("Uso: iamctl grants list <usuario> | grant <usuario> <permiso> [-grantable] | revoke <usuario> <permiso>")
+	}
+
+	if positional[0] == "list" && len(positional) != 2 {
+		return cmd.usage("Uso: iamctl grants list <usuario>")
+	}
+
+	if (positional[0] == "grant" || positional[0] == "revoke") && len(positional) != 3 {
+		return cmd.usage(fmt.Sprintf("Uso: iamctl grants %s <usuario> <permiso>", positional[0]))
+	}
+
+	client, err := cmd.client()
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	ctx := context.Background()
+
+	switch positional[0] {
+	case "list":
+		permissions, err := client.ListUserPermissions(ctx, positional[1])
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(permissions, grantTable(permissions))
+	case "grant":
+		permission, err := client.GrantPermission(ctx, positional[1], positional[2], *grantable)
+		if err != nil {
+			return cmd.fail(err)
+		}
+
+		return cmd.write(permission, grantTable(iamapi.UserPermissions{Permissions: []models.UserPermission{permission}}))
+	case "revoke":
+		if err := client.RevokePermission(ctx, positional[1], positional[2]); err != nil {
+			return cmd.fail(err)
+		}
+
+		fmt.Fprintf(cmd.stderr, "Permiso %s revocado a %s.\n", positional[2], positional[1])
+
+		return ExitOK
+	}
+
+	return cmd.usage(fmt.Sprintf("El subcomando grants %s no existe.", positional[0]))
+}
+
+func grantTable(permissions iamapi.UserPermissions) Table {
+	table := Table{Headers: []string{"PERMISO", "DELEGABLE", "DENEGADO"}}
+
+	for _, permission := range permissions.Permissions {
+		table.Rows = append(table.Rows, []string{
+			permission.PermissionName,
+			strconv.FormatBool(permission.Grantable),
+			strconv.FormatBool(permission.Denied),
+		})
+	}
+
+	return table
+}
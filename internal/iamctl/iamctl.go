@@ -0,0 +1,226 @@
+// Package iamctl implementa la CLI de administración `iamctl` sobre el cliente de pkg/iamapi.
+package iamctl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/iamapi"
+)
+
+// Códigos de salida de `iamctl`, pensados para scripts.
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitUsage        = 2
+	ExitUnauthorized = 3
+	ExitForbidden    = 4
+	ExitNotFound     = 5
+	ExitConflict     = 6
+)
+
+const usage = `Uso: iamctl <comando> [opciones]
+
+Comandos:
+  login -server URL -username USUARIO [-password CLAVE] [-organization ORG]
+  users list | get <usuario> | delete <usuario>
+  permissions list | create -name N [-description D] | update <id> [-name N] [-description D] | delete <id>
+  grants list <usuario> | grant <usuario> <permiso> [-grantable] | revoke <usuario> <permiso>
+
+Opciones comunes: -profile NOMBRE (default) y -output table|json|yaml (table).`
+
+type command struct {
+	flags   *flag.FlagSet
+	profile *string
+	output  *string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func newCommand(name string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *command {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	return &command{
+		flags:   flags,
+		profile: flags.String("profile", "default", "Perfil de credenciales a usar"),
+		output:  flags.String("output", "table", "Formato del resultado: table, json o yaml"),
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+}
+
+// parse permite mezclar opciones y argumentos (`users get meli -output json`), a diferencia de
+// flag.Parse, que se detiene en el primer argumento.
+func (cmd *command) parse(args []string) ([]string, error) {
+	positional := []string{}
+
+	for {
+		if err := cmd.flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if cmd.flags.NArg() == 0 {
+			break
+		}
+
+		positional = append(positional, cmd.flags.Arg(0))
+		args = cmd.flags.Args()[1:]
+	}
+
+	switch *cmd.output {
+	case "table", "json", "yaml":
+		return positional, nil
+	}
+
+	err := fmt.Errorf("El formato %s no existe, debe ser table, json o yaml", *cmd.output)
+	fmt.Fprintln(cmd.stderr, err.Error())
+
+	return nil, err
+}
+
+func (cmd *command) client() (*iamapi.Client, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := config.Profiles[*cmd.profile]
+	if !ok || profile.Token == "" {
+		return nil, fmt.Errorf("El perfil %s no tiene sesión, ejecuta `iamctl login`: %w", *cmd.profile, iamapi.ErrUnauthorized)
+	}
+
+	client := iamapi.New(profile.Server)
+	client.Token = profile.Token
+
+	return client, nil
+}
+
+func (cmd *command) write(value interface{}, table Table) int {
+	if err := write(cmd.stdout, *cmd.output, value, table); err != nil {
+		fmt.Fprintln(cmd.stderr, err.Error())
+		return ExitUsage
+	}
+
+	return ExitOK
+}
+
+// fail imprime el error y devuelve el código de salida que le corresponde.
+func (cmd *command) fail(err error) int {
+	fmt.Fprintln(cmd.stderr, err.Error())
+
+	switch {
+	case errors.Is(err, iamapi.ErrUnauthorized):
+		return ExitUnauthorized
+	case errors.Is(err, iamapi.ErrForbidden):
+		return ExitForbidden
+	case errors.Is(err, iamapi.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, iamapi.ErrConflict):
+		return ExitConflict
+	}
+
+	return ExitError
+}
+
+func (cmd *command) usage(message string) int {
+	fmt.Fprintln(cmd.stderr, message)
+	return ExitUsage
+}
+
+// Run ejecuta `iamctl` con los argumentos dados (sin el nombre del programa) y devuelve el código
+// de salida.
+func Run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, usage)
+		return ExitUsage
+	}
+
+	switch args[0] {
+	case "login":
+		return login(newCommand("login", stdin, stdout, stderr), args[1:])
+	case "users":
+		return users(newCommand("users", stdin, stdout, stderr), args[1:])
+	case "permissions":
+		return permissions(newCommand("permissions", stdin, stdout, stderr), args[1:])
+	case "grants":
+		return grants(newCommand("grants", stdin, stdout, stderr), args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprintln(stdout, usage)
+		return ExitOK
+	}
+
+	fmt.Fprintf(stderr, "El comando %s no existe.\n\n%s\n", args[0], usage)
+
+	return ExitUsage
+}
+
+func login(cmd *command, args []string) int {
+	server := cmd.flags.String("server", "", "URL del IAM, por ejemplo http://localhost")
+	username := cmd.flags.String("username", "", "Nombre de usuario")
+	password := cmd.flags.String("password", "", "Contraseña; si no se pasa se usa IAMCTL_PASSWORD o la entrada estándar")
+	organization := cmd.flags.String("organization", "", "Organización del usuario")
+
+	if _, err := cmd.parse(args); err != nil {
+		return ExitUsage
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	if *server == "" {
+		*server = config.Profiles[*cmd.profile].Server
+	}
+
+	if *server == "" || *username == "" {
+		return cmd.usage("Uso: iamctl login -server URL -username USUARIO [-password CLAVE] [-organization ORG]")
+	}
+
+	if *password == "" {
+		*password = os.Getenv("IAMCTL_PASSWORD")
+	}
+
+	if *password == "" {
+		fmt.Fprint(cmd.stderr, "Contraseña: ")
+
+		line, err := bufio.NewReader(cmd.stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return cmd.fail(err)
+		}
+
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	client := iamapi.New(*server)
+
+	token, err := client.Login(context.Background(), dto.LoginAndSignUpBody{
+		Organization: *organization,
+		Username:     *username,
+		Password:     *password,
+	})
+	if err != nil {
+		return cmd.fail(err)
+	}
+
+	config.Profiles[*cmd.profile] = Profile{Server: *server, Username: *username, Token: token.AccessToken}
+
+	if err := config.Save(); err != nil {
+		return cmd.fail(err)
+	}
+
+	fmt.Fprintf(cmd.stderr, "Sesión iniciada como %s en el perfil %s.\n", *username, *cmd.profile)
+
+	return ExitOK
+}
@@ -0,0 +1,139 @@
+package iamctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Table es la vista en columnas de un resultado; JSON y YAML usan el valor original.
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+func write(w io.Writer, format string, value interface{}, table Table) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(value)
+	case "yaml":
+		// Se pasa por JSON para respetar las etiquetas `json` de los modelos.
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		var generic interface{}
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return err
+		}
+
+		writeYAML(w, generic, 0)
+
+		return nil
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+		fmt.Fprintln(tw, strings.Join(table.Headers, "\t"))
+		for _, row := range table.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+
+		return tw.Flush()
+	}
+
+	return fmt.Errorf("El formato %s no existe, debe ser table, json o yaml", format)
+}
+
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		if v == "" || strings.ContainsAny(v, ":#{}[],&*!|>'\"%@`\n") || strings.TrimSpace(v) != v {
+			return strconv.Quote(v)
+		}
+
+		// Los valores que YAML leería como otro tipo van entre comillas.
+		switch strings.ToLower(v) {
+		case "true", "false", "yes", "no", "null", "~":
+			return strconv.Quote(v)
+		}
+
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return strconv.Quote(v)
+		}
+
+		return v
+	}
+
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+func writeYAML(w io.Writer, value interface{}, indent int) {
+	prefix := strings.Repeat("  ", indent)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(w, "%s{}\n", prefix)
+			return
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			writeYAMLEntry(w, prefix+yamlScalar(key)+":", v[key], indent)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(w, "%s[]\n", prefix)
+			return
+		}
+
+		for _, item := range v {
+			writeYAMLEntry(w, prefix+"-", item, indent)
+		}
+	default:
+		fmt.Fprintf(w, "%s%s\n", prefix, yamlScalar(v))
+	}
+}
+
+func writeYAMLEntry(w io.Writer, key string, value interface{}, indent int) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			fmt.Fprintln(w, key)
+			writeYAML(w, v, indent+1)
+			return
+		}
+
+		fmt.Fprintf(w, "%s {}\n", key)
+	case []interface{}:
+		if len(v) > 0 {
+			fmt.Fprintln(w, key)
+			writeYAML(w, v, indent+1)
+			return
+		}
+
+		fmt.Fprintf(w, "%s []\n", key)
+	default:
+		fmt.Fprintf(w, "%s %s\n", key, yamlScalar(v))
+	}
+}
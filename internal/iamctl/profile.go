@@ -0,0 +1,81 @@
+package iamctl
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type Profile struct {
+	Server   string `json:"server"`
+	Username string `json:"username,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+type Config struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// ConfigPath es el archivo de perfiles: `IAMCTL_CONFIG` o `iamctl/profiles.json` dentro del
+// directorio de configuración del usuario.
+func ConfigPath() (string, error) {
+	if path := os.Getenv("IAMCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "iamctl", "profiles.json"), nil
+}
+
+func LoadConfig() (Config, error) {
+	config := Config{Profiles: map[string]Profile{}}
+
+	path, err := ConfigPath()
+	if err != nil {
+		return config, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, err
+	}
+
+	if config.Profiles == nil {
+		config.Profiles = map[string]Profile{}
+	}
+
+	return config, nil
+}
+
+// Save guarda los perfiles solo para el usuario actual porque incluyen el token de acceso.
+func (config Config) Save() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, b, 0600)
+}
@@ -0,0 +1,28 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+func (notifier *LogNotifier) Notify(ctx context.Context, event models.SecurityEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if notifier.Logger == nil {
+		log.Printf("[%s] %s", event.Severity, b)
+		return nil
+	}
+
+	notifier.Logger.Printf("[%s] %s", event.Severity, b)
+	return nil
+}
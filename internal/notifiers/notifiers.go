@@ -0,0 +1,16 @@
+package notifiers
+
+import (
+	"os"
+
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+)
+
+// Si se configura `SECURITY_WEBHOOK_URL` los eventos se envían al webhook, de lo contrario se escriben en el log.
+func New() interfaces.Notifier {
+	if url := os.Getenv("SECURITY_WEBHOOK_URL"); url != "" {
+		return &WebhookNotifier{URL: url}
+	}
+
+	return &LogNotifier{}
+}
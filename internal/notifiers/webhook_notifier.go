@@ -0,0 +1,49 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (notifier *WebhookNotifier) Notify(ctx context.Context, event models.SecurityEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.URL, bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	client := notifier.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("El webhook de notificaciones respondió con el estado %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+// Package outbox publica los eventos de la bandeja de salida en los destinos configurados.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const (
+	DefaultBatchSize = 100
+	DefaultInterval  = 2 * time.Second
+)
+
+// Relay publica cada evento en todos los destinos y lo marca como publicado solo si todos lo
+// aceptan; si alguno falla se vuelve a publicar en todos (al menos una vez). Cuando un evento
+// falla, los siguientes del mismo agregado esperan a la próxima ronda para no publicarse antes.
+type Relay struct {
+	Outbox    interfaces.OutboxRepository
+	Sinks     []interfaces.EventSink
+	BatchSize int
+}
+
+func aggregateKey(event models.OutboxEvent) string {
+	return event.AggregateType + ":" + event.AggregateID
+}
+
+// ProcessOnce publica un lote de eventos pendientes y devuelve cuántos se publicaron.
+func (relay *Relay) ProcessOnce(ctx context.Context) (int, error) {
+	limit := relay.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+
+	blocked := map[string]bool{}
+
+	return relay.Outbox.Process(ctx, limit, func(event models.OutboxEvent) error {
+		key := aggregateKey(event)
+		if blocked[key] {
+			return fmt.Errorf("Un evento anterior de %s no se ha publicado", key)
+		}
+
+		for _, sink := range relay.Sinks {
+			if err := sink.Publish(ctx, event); err != nil {
+				blocked[key] = true
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Run publica los eventos cada intervalo hasta que se cierre `stop`.
+func (relay *Relay) Run(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := relay.ProcessOnce(context.Background()); err != nil {
+				log.Printf("No se pudieron publicar los eventos de la bandeja de salida: %s", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// WebhookSink deja en cola las entregas del evento para las suscripciones de webhooks. La llave
+// de idempotencia se usa como ID del evento, así que publicarlo de nuevo no duplica entregas.
+type WebhookSink struct {
+	Webhooks interfaces.WebhooksRepository
+}
+
+func (sink *WebhookSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(event.Payload, &data); err != nil {
+		return err
+	}
+
+	webhookEvent := models.WebhookEvent{
+		ID:        event.IdempotencyKey,
+		Type:      event.Type,
+		Data:      data,
+		CreatedAt: event.CreatedAt,
+	}
+
+	_, err := sink.Webhooks.Enqueue(context.WithValue(ctx, "current_org_id", int(event.OrgID)), &webhookEvent)
+	return err
+}
+
+// NDJSONSink escribe cada evento como una línea JSON, por ejemplo en la salida estándar.
+type NDJSONSink struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+func (sink *NDJSONSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	_, err = sink.Writer.Write(append(b, '\n'))
+	return err
+}
+
+// MemorySink guarda los eventos en memoria; sirve para las pruebas. Si `Fail` devuelve un error
+// el evento no se guarda.
+type MemorySink struct {
+	Fail func(event models.OutboxEvent) error
+
+	mu     sync.Mutex
+	events []models.OutboxEvent
+}
+
+func (sink *MemorySink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	if sink.Fail != nil {
+		if err := sink.Fail(event); err != nil {
+			return err
+		}
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	sink.events = append(sink.events, event)
+	return nil
+}
+
+func (sink *MemorySink) Events() []models.OutboxEvent {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	return append([]models.OutboxEvent{}, sink.events...)
+}
+
+// SinksFromEnv crea los destinos de `OUTBOX_SINKS` (separados por comas: `webhook`, `ndjson`). Por
+// defecto solo se publica a los webhooks.
+func SinksFromEnv(webhooks interfaces.WebhooksRepository) []interfaces.EventSink {
+	names := os.Getenv("OUTBOX_SINKS")
+	if names == "" {
+		names = "webhook"
+	}
+
+	var sinks []interfaces.EventSink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "webhook":
+			sinks = append(sinks, &WebhookSink{Webhooks: webhooks})
+		case "ndjson":
+			sinks = append(sinks, &NDJSONSink{Writer: os.Stdout})
+		}
+	}
+
+	return sinks
+}
@@ -0,0 +1,41 @@
+package reconciler
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config indica qué archivo reconciliar y en qué organización. `User` es el usuario con el que se
+// aplican los cambios: las asignaciones pasan por las mismas validaciones que si las hiciera a mano.
+type Config struct {
+	File     string
+	Interval time.Duration
+	Apply    bool
+	Prune    bool
+	OrgID    int
+	User     string
+}
+
+// ConfigFromEnv lee la configuración del modo periódico. El reconciliador solo se activa si se
+// configura `RECONCILE_FILE`; con `RECONCILE_DRY_RUN=true` solo reporta las diferencias.
+func ConfigFromEnv() (Config, bool) {
+	config := Config{
+		File:     os.Getenv("RECONCILE_FILE"),
+		Interval: 5 * time.Minute,
+		Apply:    os.Getenv("RECONCILE_DRY_RUN") != "true",
+		Prune:    os.Getenv("RECONCILE_PRUNE") == "true",
+		OrgID:    1,
+		User:     os.Getenv("RECONCILE_USER"),
+	}
+
+	if org, err := strconv.Atoi(os.Getenv("RECONCILE_ORG_ID")); err == nil && org > 0 {
+		config.OrgID = org
+	}
+
+	if interval, err := time.ParseDuration(os.Getenv("RECONCILE_INTERVAL")); err == nil && interval > 0 {
+		config.Interval = interval
+	}
+
+	return config, config.File != ""
+}
@@ -0,0 +1,73 @@
+package reconciler
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Metrics expone el estado del reconciliador en el formato de texto de Prometheus.
+type Metrics struct {
+	mu sync.Mutex
+
+	runs      int
+	failures  int
+	applied   int
+	drift     int
+	conflicts int
+	lastRun   time.Time
+}
+
+func (metrics *Metrics) observe(drift int, conflicts int, applied bool, err error) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.runs++
+	metrics.lastRun = time.Now()
+
+	if err != nil {
+		metrics.failures++
+		return
+	}
+
+	metrics.drift = drift
+	metrics.conflicts = conflicts
+
+	// Después de aplicar el plan ya no quedan diferencias.
+	if applied {
+		metrics.applied += drift
+		metrics.drift = 0
+	}
+}
+
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	lastRun := int64(0)
+	if !metrics.lastRun.IsZero() {
+		lastRun = metrics.lastRun.Unix()
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP iam_reconcile_runs_total Reconciliaciones ejecutadas.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_runs_total counter")
+	fmt.Fprintf(w, "iam_reconcile_runs_total %d\n", metrics.runs)
+	fmt.Fprintln(w, "# HELP iam_reconcile_failures_total Reconciliaciones fallidas.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_failures_total counter")
+	fmt.Fprintf(w, "iam_reconcile_failures_total %d\n", metrics.failures)
+	fmt.Fprintln(w, "# HELP iam_reconcile_applied_changes_total Cambios aplicados por el reconciliador.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_applied_changes_total counter")
+	fmt.Fprintf(w, "iam_reconcile_applied_changes_total %d\n", metrics.applied)
+	fmt.Fprintln(w, "# HELP iam_reconcile_drift Diferencias pendientes con el estado deseado.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_drift gauge")
+	fmt.Fprintf(w, "iam_reconcile_drift %d\n", metrics.drift)
+	fmt.Fprintln(w, "# HELP iam_reconcile_conflicts Elementos del estado deseado que no se pueden aplicar.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_conflicts gauge")
+	fmt.Fprintf(w, "iam_reconcile_conflicts %d\n", metrics.conflicts)
+	fmt.Fprintln(w, "# HELP iam_reconcile_last_run_timestamp_seconds Fecha de la última reconciliación.")
+	fmt.Fprintln(w, "# TYPE iam_reconcile_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(w, "iam_reconcile_last_run_timestamp_seconds %d\n", lastRun)
+}
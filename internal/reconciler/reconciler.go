@@ -0,0 +1,468 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/policies"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+)
+
+// Plan es el plan que se muestra y, si se pide, se aplica. Todo se relaciona por nombre.
+type Plan struct {
+	models.ReconcilePlan
+}
+
+type Reconciler struct {
+	Applications interfaces.ApplicationsRepository
+	Auth         interfaces.AuthorizationRepository
+	Constraints  interfaces.ConstraintsRepository
+	Permissions  interfaces.PermissionsRepository
+	State        interfaces.StateRepository
+	Users        interfaces.UsersRepository
+	Notifier     interfaces.Notifier
+	Metrics      *Metrics
+}
+
+func LoadDesiredState(path string) (models.DesiredState, error) {
+	var desired models.DesiredState
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return desired, err
+	}
+
+	if err = json.Unmarshal(b, &desired); err != nil {
+		return desired, err
+	}
+
+	if desired.Version != models.StateVersion {
+		return desired, errors.New("La versión del estado deseado no es compatible")
+	}
+
+	return desired, nil
+}
+
+// actorContext agrega al contexto la organización y el usuario con el que se reconcilia.
+func (reconciler *Reconciler) actorContext(ctx context.Context, config Config) (context.Context, error) {
+	if config.User == "" {
+		return nil, errors.New("Se debe indicar el usuario con el que se reconcilia el estado deseado")
+	}
+
+	ctx = context.WithValue(ctx, "current_org_id", config.OrgID)
+
+	user, err := reconciler.Users.GetByUsername(ctx, config.User, false)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, fmt.Errorf("El usuario %s no existe", config.User)
+		}
+
+		return nil, err
+	}
+
+	return context.WithValue(ctx, "current_user_id", int(user.ID)), nil
+}
+
+// verifyPermissionChange verifica la acción sobre un permiso existente con el permiso como
+// `resource` de las políticas, igual que los endpoints de permisos.
+func (reconciler *Reconciler) verifyPermissionChange(ctx context.Context, action string, permission models.Permission) error {
+	authCtx := policies.WithResourceLoader(ctx, func() (map[string]interface{}, error) {
+		return map[string]interface{}{"id": int64(permission.ID), "name": permission.Name, "application": permission.Application}, nil
+	})
+
+	return reconciler.Auth.VerifyPermission(authCtx, action)
+}
+
+// Plan compara el estado deseado con los permisos y asignaciones actuales. Con `prune` también
+// elimina los permisos no declarados, salvo los integrados y los de las aplicaciones (que mantiene
+// su manifiesto), y las asignaciones no declaradas, sin importar el permiso. Cada cambio pasa por
+// las mismas validaciones que si lo hiciera a mano el usuario del contexto: los de permisos
+// requieren `create_permission`, `update_permission` o `delete_permission`, y las asignaciones, las
+// de separación de funciones y de delegación.
+func (reconciler *Reconciler) Plan(ctx context.Context, desired models.DesiredState, prune bool) (*Plan, error) {
+	plan := &Plan{
+		ReconcilePlan: models.ReconcilePlan{
+			CreatePermissions: []models.StatePermission{},
+			UpdatePermissions: []models.StatePermission{},
+			DeletePermissions: []string{},
+			CreateGrants:      []models.StateGrant{},
+			UpdateGrants:      []models.StateGrant{},
+			RevokeGrants:      []models.StateGrant{},
+			Conflicts:         []models.StateConflict{},
+		},
+	}
+
+	actorID, _ := ctx.Value("current_user_id").(int)
+
+	conflict := func(kind string, name string, reason string) {
+		plan.Conflicts = append(plan.Conflicts, models.StateConflict{Kind: kind, Name: name, Reason: reason})
+	}
+
+	applications, err := reconciler.Applications.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationNames := map[string]bool{}
+	for _, application := range applications {
+		applicationNames[application.Name] = true
+	}
+
+	current, err := reconciler.Permissions.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]models.Permission{}
+	for _, permission := range current {
+		existing[permission.Name] = permission
+	}
+
+	declared := map[string]bool{}
+	for _, permission := range desired.Permissions {
+		if declared[permission.Name] {
+			conflict("permission", permission.Name, "El permiso está repetido en el estado deseado")
+			continue
+		}
+
+		declared[permission.Name] = true
+
+		if actual, ok := existing[permission.Name]; ok {
+			if actual.Description == permission.Description {
+				continue
+			}
+
+			if !actual.Editable {
+				conflict("permission", permission.Name, "El permiso no puede ser editado")
+				continue
+			}
+
+			if err = reconciler.verifyPermissionChange(ctx, "update_permission", actual); err != nil {
+				conflict("permission", permission.Name, err.Error())
+				continue
+			}
+
+			plan.UpdatePermissions = append(plan.UpdatePermissions, permission)
+			continue
+		}
+
+		if err = utils.ValidatePermissionName(permission.Name); err != nil {
+			conflict("permission", permission.Name, err.Error())
+			continue
+		}
+
+		if err = utils.ValidatePermissionDescription(permission.Description); err != nil {
+			conflict("permission", permission.Name, err.Error())
+			continue
+		}
+
+		if application, _ := models.SplitPermissionName(permission.Name); application != "" && !applicationNames[application] {
+			conflict("permission", permission.Name, fmt.Sprintf("La aplicación %s no existe", application))
+			continue
+		}
+
+		if err = reconciler.Auth.VerifyPermission(ctx, "create_permission"); err != nil {
+			conflict("permission", permission.Name, err.Error())
+			continue
+		}
+
+		plan.CreatePermissions = append(plan.CreatePermissions, permission)
+	}
+
+	deleted := map[string]bool{}
+	if prune {
+		for _, permission := range current {
+			if declared[permission.Name] || !permission.Deletable || permission.Application != "" {
+				continue
+			}
+
+			if err = reconciler.verifyPermissionChange(ctx, "delete_permission", permission); err != nil {
+				conflict("permission", permission.Name, err.Error())
+				continue
+			}
+
+			deleted[permission.Name] = true
+			plan.DeletePermissions = append(plan.DeletePermissions, permission.Name)
+		}
+	}
+
+	users, err := reconciler.Users.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := map[string]int{}
+	granted := map[string]models.StateGrant{}
+	held := map[string]map[string]bool{}
+
+	var actualGrants []models.StateGrant
+	for _, user := range users {
+		userIDs[user.Username] = int(user.ID)
+		held[user.Username] = map[string]bool{}
+
+		userPermissions, err := reconciler.Users.GetAllUserPermissions(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, userPermission := range userPermissions {
+			grant := models.StateGrant{Username: user.Username, Permission: userPermission.PermissionName, Grantable: userPermission.Grantable}
+
+			granted[grant.Username+"/"+grant.Permission] = grant
+			held[user.Username][grant.Permission] = true
+			actualGrants = append(actualGrants, grant)
+		}
+	}
+
+	constraints, err := reconciler.Constraints.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Los permisos que se crean en el mismo plan todavía no tienen ID.
+	permissionFor := func(name string) models.Permission {
+		permission := existing[name]
+		permission.Name = name
+
+		return permission
+	}
+
+	wanted := map[string]bool{}
+	for _, grant := range desired.Grants {
+		key := grant.Username + "/" + grant.Permission
+		if wanted[key] {
+			continue
+		}
+
+		wanted[key] = true
+
+		// Una asignación existente con otro valor de `grantable` se actualiza con la misma
+		// validación de delegación que la importación del estado.
+		if actual, ok := granted[key]; ok {
+			if actual.Grantable == grant.Grantable {
+				continue
+			}
+
+			if userIDs[grant.Username] == actorID {
+				conflict("grant", key, "No puedes otorgarte un permiso a ti mismo")
+				continue
+			}
+
+			if err = reconciler.Auth.VerifyDelegation(ctx, permissionFor(grant.Permission), grant.Grantable); err != nil {
+				conflict("grant", key, err.Error())
+				continue
+			}
+
+			plan.UpdateGrants = append(plan.UpdateGrants, grant)
+			continue
+		}
+
+		userID, ok := userIDs[grant.Username]
+		if !ok {
+			conflict("grant", key, "El usuario no existe")
+			continue
+		}
+
+		if _, ok := existing[grant.Permission]; !ok && !declared[grant.Permission] {
+			conflict("grant", key, "El permiso no existe")
+			continue
+		}
+
+		if userID == actorID {
+			conflict("grant", key, "No puedes otorgarte un permiso a ti mismo")
+			continue
+		}
+
+		if constraint, breached := utils.BreachedConstraint(constraints, held[grant.Username], grant.Permission); breached {
+			conflict("grant", key, fmt.Sprintf("No se puede otorgar el permiso porque viola la restricción de separación de funciones %s", constraint.Name))
+			continue
+		}
+
+		if err = reconciler.Auth.VerifyDelegation(ctx, permissionFor(grant.Permission), grant.Grantable); err != nil {
+			conflict("grant", key, err.Error())
+			continue
+		}
+
+		held[grant.Username][grant.Permission] = true
+		plan.CreateGrants = append(plan.CreateGrants, grant)
+	}
+
+	if prune {
+		for _, grant := range actualGrants {
+			key := grant.Username + "/" + grant.Permission
+
+			// Las asignaciones de los permisos que se van a borrar se eliminan junto con ellos.
+			if wanted[key] || deleted[grant.Permission] {
+				continue
+			}
+
+			if userIDs[grant.Username] == actorID {
+				conflict("grant", key, "No puedes quitarte un permiso a ti mismo")
+				continue
+			}
+
+			if err = reconciler.Auth.VerifyDelegation(ctx, permissionFor(grant.Permission), false); err != nil {
+				conflict("grant", key, err.Error())
+				continue
+			}
+
+			plan.RevokeGrants = append(plan.RevokeGrants, grant)
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply aplica el plan en una sola transacción: si un cambio falla no se aplica ninguno.
+func (reconciler *Reconciler) Apply(ctx context.Context, plan *Plan) error {
+	return reconciler.State.ApplyReconcile(ctx, &plan.ReconcilePlan)
+}
+
+// Reconcile lee el archivo de estado deseado, calcula el plan para la organización de la
+// configuración y lo aplica si se pide. Las diferencias encontradas se reportan en las métricas y
+// como eventos.
+func (reconciler *Reconciler) Reconcile(ctx context.Context, config Config) (*Plan, error) {
+	plan, err := reconciler.reconcile(ctx, config)
+
+	if reconciler.Metrics != nil {
+		drift := 0
+		if plan != nil {
+			drift = plan.Drift()
+		}
+
+		reconciler.Metrics.observe(drift, len(planConflicts(plan)), config.Apply && err == nil, err)
+	}
+
+	if err != nil {
+		reconciler.notify(ctx, "reconcile.failed", "high", fmt.Sprintf("No se pudo reconciliar el estado deseado: %s", err.Error()), plan)
+		return plan, err
+	}
+
+	if plan.Drift() > 0 {
+		if config.Apply {
+			reconciler.notify(ctx, "reconcile.applied", "medium", fmt.Sprintf("Se aplicaron %d cambios del estado deseado", plan.Drift()), plan)
+		} else {
+			reconciler.notify(ctx, "reconcile.drift", "medium", fmt.Sprintf("Se detectaron %d diferencias con el estado deseado", plan.Drift()), plan)
+		}
+	}
+
+	return plan, nil
+}
+
+func (reconciler *Reconciler) reconcile(ctx context.Context, config Config) (*Plan, error) {
+	desired, err := LoadDesiredState(config.File)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err = reconciler.actorContext(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := reconciler.Plan(ctx, desired, config.Prune)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Apply && plan.Drift() > 0 {
+		return plan, reconciler.Apply(ctx, plan)
+	}
+
+	return plan, nil
+}
+
+func (reconciler *Reconciler) notify(ctx context.Context, eventType string, severity string, message string, plan *Plan) {
+	if reconciler.Notifier == nil {
+		return
+	}
+
+	event := models.SecurityEvent{
+		Type:      eventType,
+		Severity:  severity,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+
+	if plan != nil {
+		event.Data = map[string]interface{}{"plan": plan.ReconcilePlan}
+	}
+
+	if err := reconciler.Notifier.Notify(ctx, event); err != nil {
+		log.Printf("No se pudo notificar el evento %s: %s", eventType, err.Error())
+	}
+}
+
+// Run reconcilia periódicamente hasta que se cierre `stop`. Sin `Apply` solo detecta las
+// diferencias.
+func (reconciler *Reconciler) Run(config Config, stop chan struct{}) {
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := reconciler.Reconcile(context.Background(), config); err != nil {
+			log.Printf("Reconciliación fallida: %s", err.Error())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func planConflicts(plan *Plan) []models.StateConflict {
+	if plan == nil {
+		return nil
+	}
+
+	return plan.Conflicts
+}
+
+// WritePlan escribe el plan en un formato legible: `+` crea, `~` actualiza, `-` elimina y `!`
+// marca los conflictos.
+func WritePlan(w io.Writer, plan *Plan) {
+	for _, permission := range plan.CreatePermissions {
+		fmt.Fprintf(w, "+ permission %s\n", permission.Name)
+	}
+
+	for _, permission := range plan.UpdatePermissions {
+		fmt.Fprintf(w, "~ permission %s\n", permission.Name)
+	}
+
+	for _, grant := range plan.CreateGrants {
+		fmt.Fprintf(w, "+ grant %s %s\n", grant.Username, grant.Permission)
+	}
+
+	for _, grant := range plan.UpdateGrants {
+		fmt.Fprintf(w, "~ grant %s %s grantable=%t\n", grant.Username, grant.Permission, grant.Grantable)
+	}
+
+	for _, grant := range plan.RevokeGrants {
+		fmt.Fprintf(w, "- grant %s %s\n", grant.Username, grant.Permission)
+	}
+
+	for _, name := range plan.DeletePermissions {
+		fmt.Fprintf(w, "- permission %s\n", name)
+	}
+
+	for _, conflict := range plan.Conflicts {
+		fmt.Fprintf(w, "! %s %s: %s\n", conflict.Kind, conflict.Name, conflict.Reason)
+	}
+
+	if plan.Drift() == 0 {
+		fmt.Fprintln(w, "Sin cambios: el estado actual coincide con el estado deseado.")
+		return
+	}
+
+	fmt.Fprintf(w, "%d cambios, %d conflictos.\n", plan.Drift(), len(plan.Conflicts))
+}
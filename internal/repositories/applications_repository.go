@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type ApplicationsRepository struct {
+	Database *database.Database
+}
+
+func (repository *ApplicationsRepository) AddAdmin(ctx context.Context, applicationID uint, userID uint) error {
+	query := "INSERT INTO application_admins (application_id, user_id) VALUES ($1, $2) ON CONFLICT (application_id, user_id) DO NOTHING;"
+
+	_, err := repository.Database.Conn.ExecContext(ctx, query, applicationID, userID)
+	return err
+}
+
+func (repository *ApplicationsRepository) Create(ctx context.Context, data *models.Application) error {
+	query := "INSERT INTO applications (name, description, org_id) VALUES ($1, $2, $3) RETURNING id;"
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Name, data.Description, currentOrg(ctx))
+
+	return row.Scan(&data.ID)
+}
+
+func (repository *ApplicationsRepository) GetAdmins(ctx context.Context, applicationID uint) ([]models.User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at FROM application_admins aa
+			INNER JOIN users u ON u.id = aa.user_id
+			WHERE aa.application_id = $1
+			ORDER BY u.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var admins []models.User
+	for rows.Next() {
+		var admin models.User
+
+		if err = rows.Scan(&admin.ID, &admin.Username, &admin.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		admins = append(admins, admin)
+	}
+
+	return admins, nil
+}
+
+func (repository *ApplicationsRepository) GetAll(ctx context.Context) ([]models.Application, error) {
+	query := "SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var applications []models.Application
+	for rows.Next() {
+		var application models.Application
+
+		if err = rows.Scan(&application.ID, &application.Name, &application.Description, &application.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, application)
+	}
+
+	return applications, nil
+}
+
+func (repository *ApplicationsRepository) GetByName(ctx context.Context, name string) (models.Application, error) {
+	query := "SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;"
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, name, currentOrg(ctx))
+
+	var application models.Application
+
+	if err := row.Scan(&application.ID, &application.Name, &application.Description, &application.CreatedAt); err != nil {
+		return models.Application{}, err
+	}
+
+	return application, nil
+}
+
+// Indica si el usuario administra la aplicación con el nombre indicado.
+func (repository *ApplicationsRepository) IsAdmin(ctx context.Context, name string, userID uint) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM application_admins aa
+				INNER JOIN applications a ON a.id = aa.application_id
+				WHERE a.name = $1 AND a.org_id = $2 AND aa.user_id = $3
+		);
+	`
+
+	var admin bool
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, name, currentOrg(ctx), userID)
+	if err := row.Scan(&admin); err != nil {
+		return false, err
+	}
+
+	return admin, nil
+}
+
+func (repository *ApplicationsRepository) RemoveAdmin(ctx context.Context, applicationID uint, userID uint) error {
+	query := "DELETE FROM application_admins WHERE application_id = $1 AND user_id = $2;"
+
+	_, err := repository.Database.Conn.ExecContext(ctx, query, applicationID, userID)
+	return err
+}
@@ -0,0 +1,406 @@
+package repositories
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type AuditRepository struct {
+	Database *database.Database
+}
+
+// Llave de los bloqueos de la cadena de auditoría; el segundo valor es la organización.
+const auditChainLock = 7001
+
+func auditState(state interface{}) (string, error) {
+	if state == nil {
+		return "", nil
+	}
+
+	if raw, ok := state.(json.RawMessage); ok {
+		return string(raw), nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// auditHash calcula el hash de un registro a partir de su contenido y del hash del registro
+// anterior. El orden de los campos es fijo para que el resultado sea reproducible.
+func auditHash(prevHash string, org uint, entry *models.AuditEntry, before string, after string) string {
+	content, _ := json.Marshal([]interface{}{
+		prevHash,
+		org,
+		entry.ActorID,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.TargetName,
+		before,
+		after,
+		entry.IP,
+		entry.UserAgent,
+		entry.RequestID,
+		entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func checkpointContent(org uint, checkpoint *models.AuditCheckpoint) []byte {
+	return []byte(fmt.Sprintf("%d:%d:%s", org, checkpoint.LastEntryID, checkpoint.LastHash))
+}
+
+// Crea los puntos de control firmados de las organizaciones con registros nuevos desde su último
+// punto de control y devuelve cuántos creó.
+func (repository *AuditRepository) Checkpoint(ctx context.Context, key string) (int, error) {
+	query := `
+		SELECT DISTINCT ON (a.org_id) a.org_id, a.id, a.hash
+		FROM audit_log a
+		WHERE a.hash IS NOT NULL
+			AND a.id > COALESCE((SELECT MAX(c.last_entry_id) FROM audit_checkpoints c WHERE c.org_id = a.org_id), 0)
+		ORDER BY a.org_id, a.id DESC;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	type pending struct {
+		org        uint
+		checkpoint models.AuditCheckpoint
+	}
+
+	var checkpoints []pending
+	for rows.Next() {
+		var item pending
+
+		if err = rows.Scan(&item.org, &item.checkpoint.LastEntryID, &item.checkpoint.LastHash); err != nil {
+			return 0, err
+		}
+
+		checkpoints = append(checkpoints, item)
+	}
+
+	query = "INSERT INTO audit_checkpoints (org_id, last_entry_id, last_hash, signature) VALUES ($1, $2, $3, $4);"
+
+	for _, item := range checkpoints {
+		signature := pkg.Sign(key, checkpointContent(item.org, &item.checkpoint))
+
+		if _, err = repository.Database.Conn.ExecContext(ctx, query, item.org, item.checkpoint.LastEntryID, item.checkpoint.LastHash, signature); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(checkpoints), nil
+}
+
+// insertAudit guarda el registro encadenado al último de la organización dentro de la transacción
+// del cambio, así el registro y el cambio se confirman juntos. El bloqueo evita que dos registros
+// concurrentes usen el mismo hash anterior.
+func insertAudit(ctx context.Context, tx *sql.Tx, org uint, data *models.AuditEntry) error {
+	before, err := auditState(data.Before)
+	if err != nil {
+		return err
+	}
+
+	after, err := auditState(data.After)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1, $2);", auditChainLock, org); err != nil {
+		return err
+	}
+
+	var prevHash string
+
+	row := tx.QueryRowContext(ctx, "SELECT hash FROM audit_log WHERE org_id = $1 AND hash IS NOT NULL ORDER BY id DESC LIMIT 1;", org)
+	if err = row.Scan(&prevHash); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// PostgreSQL guarda microsegundos, así que truncamos para que el hash se pueda recalcular.
+	data.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	hash := auditHash(prevHash, org, data, before, after)
+
+	query := `
+		INSERT INTO audit_log (org_id, actor_id, action, target_type, target_id, target_name, before, after, ip, user_agent, request_id, created_at, prev_hash, hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id;
+	`
+
+	row = tx.QueryRowContext(
+		ctx,
+		query,
+		org,
+		data.ActorID,
+		data.Action,
+		data.TargetType,
+		nullString(data.TargetID),
+		nullString(data.TargetName),
+		nullString(before),
+		nullString(after),
+		nullString(data.IP),
+		nullString(data.UserAgent),
+		nullString(data.RequestID),
+		data.CreatedAt,
+		nullString(prevHash),
+		hash,
+	)
+
+	return row.Scan(&data.ID)
+}
+
+// contextActor devuelve el usuario de la petición o del proceso que hace el cambio, si hay uno.
+func contextActor(ctx context.Context) *uint {
+	if userID, ok := ctx.Value("current_user_id").(int); ok {
+		actorID := uint(userID)
+		return &actorID
+	}
+
+	return nil
+}
+
+func (repository *AuditRepository) Create(ctx context.Context, data *models.AuditEntry) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err = insertAudit(ctx, tx, currentOrg(ctx), data); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *AuditRepository) GetAll(ctx context.Context, filter models.AuditFilter, limit int, offset int) ([]models.AuditEntry, error) {
+	conditions := []string{"a.org_id = $1"}
+	args := []interface{}{currentOrg(ctx)}
+
+	// El actor y el objetivo se pueden buscar por ID o por nombre.
+	if filter.Actor != "" {
+		args = append(args, filter.Actor)
+		conditions = append(conditions, fmt.Sprintf("(a.actor_id::text = $%d OR u.username = $%d)", len(args), len(args)))
+	}
+
+	if filter.Target != "" {
+		args = append(args, filter.Target)
+		conditions = append(conditions, fmt.Sprintf("(a.target_id = $%d OR a.target_name = $%d)", len(args), len(args)))
+	}
+
+	if filter.Action != "" {
+		args = append(args, filter.Action)
+		conditions = append(conditions, fmt.Sprintf("a.action = $%d", len(args)))
+	}
+
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf("a.created_at >= $%d", len(args)))
+	}
+
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf("a.created_at < $%d", len(args)))
+	}
+
+	query := `
+		SELECT
+			a.id,
+			a.actor_id,
+			u.username as actor_username,
+			a.action,
+			a.target_type,
+			COALESCE(a.target_id, ''),
+			COALESCE(a.target_name, ''),
+			a.before,
+			a.after,
+			COALESCE(a.ip, ''),
+			COALESCE(a.user_agent, ''),
+			COALESCE(a.request_id, ''),
+			a.created_at
+		FROM audit_log a
+			LEFT JOIN users u ON u.id = a.actor_id
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY a.id DESC`
+
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d;", len(args)-1, len(args))
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after []byte
+
+		err = rows.Scan(&entry.ID, &entry.ActorID, &entry.ActorUsername, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.TargetName, &before, &after, &entry.IP, &entry.UserAgent, &entry.RequestID, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if before != nil {
+			entry.Before = json.RawMessage(before)
+		}
+
+		if after != nil {
+			entry.After = json.RawMessage(after)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Recorre la cadena de la organización y devuelve el primer registro roto: un hash que no
+// coincide con el contenido, un registro que no apunta al anterior o un punto de control cuya
+// firma o registro no coinciden.
+func (repository *AuditRepository) Verify(ctx context.Context, key string) (models.AuditVerification, error) {
+	org := currentOrg(ctx)
+
+	verification := models.AuditVerification{Valid: true}
+
+	broken := func(id uint, reason string) (models.AuditVerification, error) {
+		verification.Valid = false
+		verification.BrokenAt = &id
+		verification.Reason = reason
+
+		return verification, nil
+	}
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT id, last_entry_id, last_hash, signature, created_at FROM audit_checkpoints WHERE org_id = $1 ORDER BY id;", org)
+	if err != nil {
+		return verification, err
+	}
+
+	defer rows.Close()
+
+	checkpoints := map[uint]models.AuditCheckpoint{}
+	for rows.Next() {
+		var checkpoint models.AuditCheckpoint
+
+		if err = rows.Scan(&checkpoint.ID, &checkpoint.LastEntryID, &checkpoint.LastHash, &checkpoint.Signature, &checkpoint.CreatedAt); err != nil {
+			return verification, err
+		}
+
+		if !pkg.VerifySignature(key, checkpointContent(org, &checkpoint), checkpoint.Signature) {
+			return broken(checkpoint.LastEntryID, fmt.Sprintf("La firma del punto de control %d no es válida", checkpoint.ID))
+		}
+
+		checkpoints[checkpoint.LastEntryID] = checkpoint
+		verification.Checkpoints++
+		verification.LastCheckpoint = &checkpoint
+	}
+
+	query := `
+		SELECT
+			id,
+			actor_id,
+			action,
+			target_type,
+			COALESCE(target_id, ''),
+			COALESCE(target_name, ''),
+			COALESCE(before, ''),
+			COALESCE(after, ''),
+			COALESCE(ip, ''),
+			COALESCE(user_agent, ''),
+			COALESCE(request_id, ''),
+			created_at,
+			COALESCE(prev_hash, ''),
+			COALESCE(hash, '')
+		FROM audit_log
+		WHERE org_id = $1
+		ORDER BY id;
+	`
+
+	rows, err = repository.Database.Conn.QueryContext(ctx, query, org)
+	if err != nil {
+		return verification, err
+	}
+
+	defer rows.Close()
+
+	lastHash := ""
+	chained := false
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		var before, after, prevHash, hash string
+
+		err = rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.TargetName, &before, &after, &entry.IP, &entry.UserAgent, &entry.RequestID, &entry.CreatedAt, &prevHash, &hash)
+		if err != nil {
+			return verification, err
+		}
+
+		// Los registros anteriores a la cadena no tienen hash.
+		if hash == "" && !chained {
+			verification.LegacyEntries++
+			continue
+		}
+
+		chained = true
+		verification.Entries++
+
+		if hash == "" {
+			return broken(entry.ID, "El registro no tiene hash")
+		}
+
+		if prevHash != lastHash {
+			return broken(entry.ID, "El registro no está encadenado con el anterior")
+		}
+
+		if auditHash(prevHash, org, &entry, before, after) != hash {
+			return broken(entry.ID, "El contenido del registro fue modificado")
+		}
+
+		if checkpoint, ok := checkpoints[entry.ID]; ok {
+			if checkpoint.LastHash != hash {
+				return broken(entry.ID, fmt.Sprintf("El registro no coincide con el punto de control %d", checkpoint.ID))
+			}
+
+			delete(checkpoints, entry.ID)
+		}
+
+		lastHash = hash
+	}
+
+	// Un punto de control sin su registro indica que se borraron registros al final de la cadena.
+	for entryID, checkpoint := range checkpoints {
+		return broken(entryID, fmt.Sprintf("El registro del punto de control %d no existe", checkpoint.ID))
+	}
+
+	return verification, nil
+}
@@ -2,35 +2,502 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
 	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/policies"
 )
 
 type AuthorizationRepository struct {
 	Database *database.Database
+	Usage    interfaces.UsageRecorder
+	Cache    interfaces.PermissionCache
 }
 
-func (repository *AuthorizationRepository) VerifyPermission(ctx context.Context, permissionName string) error {
+func evaluatePolicies(ctx context.Context, subject map[string]interface{}, conditions []models.PermissionPolicy) ([]models.PolicyEvaluation, bool) {
+	evaluationContext := policies.FromContext(ctx, subject)
+
+	passed := true
+
+	evaluations := []models.PolicyEvaluation{}
+	for _, condition := range conditions {
+		evaluation := models.PolicyEvaluation{PolicyID: condition.ID, Condition: condition.Condition}
+
+		program, err := policies.Compile(condition.Condition)
+		if err == nil {
+			evaluation.Passed, err = program.Evaluate(evaluationContext)
+		}
+
+		if err != nil {
+			evaluation.Error = err.Error()
+		}
+
+		passed = passed && evaluation.Passed
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return evaluations, passed
+}
+
+func (repository *AuthorizationRepository) findActiveDeny(ctx context.Context, userID uint, permissionName string) (*models.PermissionDeny, error) {
+	query := `
+		SELECT d.id, d.permission_id, d.reason, d.expires_at FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+			INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id
+			WHERE p.name = $2
+				AND (d.user_id = $1 OR (d.user_id IS NULL AND NOT ($1 = ANY(d.except_user_ids))))
+				AND (d.expires_at IS NULL OR d.expires_at > now())
+			ORDER BY d.id LIMIT 1;
+	`
+
+	deny := models.PermissionDeny{PermissionName: permissionName}
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permissionName)
+
+	err := row.Scan(&deny.ID, &deny.PermissionID, &deny.Reason, &deny.ExpiresAt)
+	if err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &deny, nil
+}
+
+func (repository *AuthorizationRepository) findBreakGlass(ctx context.Context, userID uint, permissionName string) (bool, error) {
+	query := "SELECT id FROM break_glass_sessions WHERE user_id = $1 AND $2 = ANY(permissions) AND expires_at > now() LIMIT 1;"
+
+	var id uint
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permissionName)
+	if err := row.Scan(&id); err != nil {
+		if err.Error() == "sql: no rows in result set" {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func denyError(deny *models.PermissionDeny) error {
+	if deny.ExpiresAt != nil {
+		return fmt.Errorf("%w hasta el %s", models.ErrPermissionDenied, deny.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+
+	return models.ErrPermissionDenied
+}
+
+func (repository *AuthorizationRepository) Explain(ctx context.Context, user models.User, permissionName string) (models.AuthorizationDecision, error) {
+	// Las denegaciones explícitas se evalúan antes que los permisos otorgados.
+	deny, err := repository.findActiveDeny(ctx, user.ID, permissionName)
+	if err != nil {
+		return models.AuthorizationDecision{}, err
+	}
+
+	query := `
+		SELECT
+			up.id,
+			up.permission_id,
+			p.name as permission_name
+		FROM user_permissions up
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE up.user_id = $1
+		ORDER BY up.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return models.AuthorizationDecision{}, err
+	}
+
+	defer rows.Close()
+
+	decision := models.AuthorizationDecision{
+		Subject:    user,
+		Permission: permissionName,
+		Candidates: []models.AuthorizationCandidate{},
+	}
+
+	var permissionID uint
+	for rows.Next() {
+		var candidate models.AuthorizationCandidate
+
+		err = rows.Scan(&candidate.UserPermissionID, &candidate.PermissionID, &candidate.PermissionName)
+		if err != nil {
+			return models.AuthorizationDecision{}, err
+		}
+
+		if candidate.PermissionName == permissionName {
+			candidate.Applies = true
+			candidate.Reason = "El permiso otorgado coincide con el permiso requerido"
+
+			permissionID = candidate.PermissionID
+			decision.Allowed = true
+		} else {
+			candidate.Reason = "El permiso otorgado no coincide con el permiso requerido"
+		}
+
+		decision.Candidates = append(decision.Candidates, candidate)
+	}
+
+	if deny != nil {
+		decision.Allowed = false
+		decision.Deny = deny
+		decision.Reason = "El usuario tiene una denegación explícita del permiso requerido"
+		return decision, nil
+	}
+
+	if !decision.Allowed {
+		breakGlass, err := repository.findBreakGlass(ctx, user.ID, permissionName)
+		if err != nil {
+			return models.AuthorizationDecision{}, err
+		}
+
+		if breakGlass {
+			decision.Allowed = true
+			decision.Reason = "El usuario tiene un acceso de emergencia activo que incluye el permiso requerido"
+		} else {
+			decision.Reason = "El usuario no tiene asignado el permiso requerido"
+		}
+
+		return decision, nil
+	}
+
+	query = "SELECT id, condition FROM permission_policies WHERE permission_id = $1 ORDER BY id;"
+
+	policyRows, err := repository.Database.Conn.QueryContext(ctx, query, permissionID)
+	if err != nil {
+		return models.AuthorizationDecision{}, err
+	}
+
+	defer policyRows.Close()
+
+	var conditions []models.PermissionPolicy
+	for policyRows.Next() {
+		var condition models.PermissionPolicy
+
+		if err = policyRows.Scan(&condition.ID, &condition.Condition); err != nil {
+			return models.AuthorizationDecision{}, err
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	decision.Policies, decision.Allowed = evaluatePolicies(ctx, policies.NewSubject(user.ID, user.Username, user.Attributes), conditions)
+
+	if decision.Allowed {
+		decision.Reason = "El usuario tiene asignado el permiso requerido"
+	} else {
+		decision.Reason = "El usuario tiene asignado el permiso requerido pero no cumple sus políticas"
+	}
+
+	return decision, nil
+}
+
+// TokenPermissions devuelve los permisos que se pueden verificar sin consultar el IAM: los asignados
+// que no tienen políticas ni una denegación vigente.
+func (repository *AuthorizationRepository) TokenPermissions(ctx context.Context, userID uint) ([]string, error) {
+	var (
+		effective *models.EffectivePermissions
+		err       error
+	)
+
+	if repository.Cache != nil {
+		effective, err = repository.Cache.Load(userID, func() (*models.EffectivePermissions, error) {
+			return repository.loadEffectivePermissions(ctx, userID)
+		})
+	} else {
+		effective, err = repository.loadEffectivePermissions(ctx, userID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	permissions := []string{}
+	for name, permission := range effective.Permissions {
+		if len(permission.Conditions) == 0 && effective.ActiveDeny(name, now) == nil {
+			permissions = append(permissions, name)
+		}
+	}
+
+	sort.Strings(permissions)
+
+	return permissions, nil
+}
+
+// VerifyDelegation comprueba que el usuario autenticado pueda otorgar o quitar el permiso, y
+// otorgarlo como delegable si se indica.
+func (repository *AuthorizationRepository) VerifyDelegation(ctx context.Context, permission models.Permission, grantable bool) error {
 	userID, ok := ctx.Value("current_user_id").(int)
 	if !ok {
 		return errors.New("¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
 	}
 
+	// Una denegación vigente también impide delegar el permiso.
+	deny, err := repository.findActiveDeny(ctx, uint(userID), permission.Name)
+	if err != nil {
+		return err
+	}
+
+	if deny != nil {
+		return denyError(deny)
+	}
+
 	query := `
-		SELECT p.id FROM permissions p
+		SELECT
+			EXISTS (
+				SELECT 1 FROM user_permissions up
+					INNER JOIN permissions p ON p.id = up.permission_id
+				WHERE up.user_id = $1 AND p.name = 'delegate_any_permission'
+					AND NOT EXISTS (
+						SELECT 1 FROM permission_denies d
+						WHERE d.permission_id = p.id
+							AND (d.user_id = $1 OR (d.user_id IS NULL AND NOT ($1 = ANY(d.except_user_ids))))
+							AND (d.expires_at IS NULL OR d.expires_at > now())
+					)
+			) as admin,
+			EXISTS (
+				SELECT 1 FROM break_glass_sessions bg
+				WHERE bg.user_id = $1 AND 'delegate_any_permission' = ANY(bg.permissions) AND bg.expires_at > now()
+			) as emergency,
+			EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = $1 AND up.permission_id = $2) as holds,
+			EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = $1 AND up.permission_id = $2 AND up.grantable) as grantable,
+			(
+				SELECT c.name FROM separation_constraints c
+				WHERE $2 = ANY(c.permission_ids)
+					AND c.org_id = (SELECT p.org_id FROM permissions p WHERE p.id = $2)
+					AND (SELECT COUNT(*) FROM user_permissions up WHERE up.user_id = $1 AND up.permission_id = ANY(c.permission_ids)) > c.max_allowed
+				ORDER BY c.id LIMIT 1
+			) as breached;
+	`
+
+	var (
+		admin, emergency, holds, delegable bool
+		breached                           *string
+	)
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permission.ID)
+	if err := row.Scan(&admin, &emergency, &holds, &delegable, &breached); err != nil {
+		return err
+	}
+
+	// Quien tiene el alcance de administrador puede delegar cualquier permiso y es el único que
+	// puede otorgarlo como delegable.
+	if admin {
+		return nil
+	}
+
+	// Un acceso de emergencia con delegate_any_permission permite delegar durante la sesión, pero
+	// no otorgar permisos delegables que sobrevivan a ella.
+	if emergency && !grantable {
+		return nil
+	}
+
+	if grantable {
+		return fmt.Errorf("No puedes otorgar el permiso %s como delegable porque no tienes el permiso delegate_any_permission", permission.Name)
+	}
+
+	if delegable && breached != nil {
+		return fmt.Errorf("No puedes delegar el permiso %s porque tus permisos violan la restricción de separación de funciones %s", permission.Name, *breached)
+	}
+
+	if delegable {
+		return nil
+	}
+
+	if holds {
+		return fmt.Errorf("Tienes asignado el permiso %s pero no como delegable; necesitas que te lo otorguen como delegable o tener el permiso delegate_any_permission", permission.Name)
+	}
+
+	return fmt.Errorf("No puedes delegar el permiso %s porque no lo tienes asignado como delegable ni tienes el permiso delegate_any_permission", permission.Name)
+}
+
+// loadPermission consulta solo lo necesario para verificar un permiso, cuando no hay caché.
+func (repository *AuthorizationRepository) loadPermission(ctx context.Context, userID uint, permissionName string) (*models.EffectivePermissions, error) {
+	effective := models.EffectivePermissions{
+		Permissions: map[string]models.EffectivePermission{},
+		Denies:      map[string][]models.PermissionDeny{},
+	}
+
+	deny, err := repository.findActiveDeny(ctx, userID, permissionName)
+	if err != nil {
+		return nil, err
+	}
+
+	if deny != nil {
+		effective.Denies[permissionName] = []models.PermissionDeny{*deny}
+		return &effective, nil
+	}
+
+	query := `
+		SELECT p.id, u.username, u.attributes, pp.condition FROM permissions p
 			INNER JOIN user_permissions up ON up.user_id = $1 AND up.permission_id = p.id
-			WHERE name = $2
+			INNER JOIN users u ON u.id = up.user_id AND u.org_id = p.org_id
+			LEFT JOIN permission_policies pp ON pp.permission_id = p.id
+			WHERE p.name = $2
 	`
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permissionName)
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, userID, permissionName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var condition *string
 
-	permission := models.Permission{}
+		permission := effective.Permissions[permissionName]
+		if err = rows.Scan(&permission.PermissionID, &effective.Username, &effective.Attributes, &condition); err != nil {
+			return nil, err
+		}
+
+		if condition != nil {
+			permission.Conditions = append(permission.Conditions, models.PermissionPolicy{Condition: *condition})
+		}
+
+		effective.Permissions[permissionName] = permission
+	}
+
+	return &effective, nil
+}
+
+// loadEffectivePermissions consulta todos los permisos y denegaciones del usuario para guardarlos en la caché.
+func (repository *AuthorizationRepository) loadEffectivePermissions(ctx context.Context, userID uint) (*models.EffectivePermissions, error) {
+	effective := models.EffectivePermissions{
+		Permissions: map[string]models.EffectivePermission{},
+		Denies:      map[string][]models.PermissionDeny{},
+	}
+
+	query := `
+		SELECT p.id, p.name, u.username, u.attributes, pp.condition FROM user_permissions up
+			INNER JOIN permissions p ON p.id = up.permission_id
+			INNER JOIN users u ON u.id = up.user_id AND u.org_id = p.org_id
+			LEFT JOIN permission_policies pp ON pp.permission_id = p.id
+			WHERE up.user_id = $1
+			ORDER BY p.id, pp.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			permissionID   uint
+			permissionName string
+			condition      *string
+		)
+
+		if err = rows.Scan(&permissionID, &permissionName, &effective.Username, &effective.Attributes, &condition); err != nil {
+			return nil, err
+		}
+
+		permission := effective.Permissions[permissionName]
+		permission.PermissionID = permissionID
+
+		if condition != nil {
+			permission.Conditions = append(permission.Conditions, models.PermissionPolicy{Condition: *condition})
+		}
+
+		effective.Permissions[permissionName] = permission
+	}
+
+	// Las denegaciones con vencimiento se guardan igual y se comparan con la hora al verificar.
+	query = `
+		SELECT d.id, d.permission_id, p.name, d.reason, d.expires_at FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+			INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id
+			WHERE (d.user_id = $1 OR (d.user_id IS NULL AND NOT ($1 = ANY(d.except_user_ids))))
+				AND (d.expires_at IS NULL OR d.expires_at > now())
+			ORDER BY d.id;
+	`
+
+	denyRows, err := repository.Database.Conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer denyRows.Close()
+
+	for denyRows.Next() {
+		var deny models.PermissionDeny
+
+		if err = denyRows.Scan(&deny.ID, &deny.PermissionID, &deny.PermissionName, &deny.Reason, &deny.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		effective.Denies[deny.PermissionName] = append(effective.Denies[deny.PermissionName], deny)
+	}
+
+	return &effective, nil
+}
+
+func (repository *AuthorizationRepository) VerifyPermission(ctx context.Context, permissionName string) error {
+	userID, ok := ctx.Value("current_user_id").(int)
+	if !ok {
+		return errors.New("¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
+	}
+
+	var (
+		effective *models.EffectivePermissions
+		err       error
+	)
+
+	if repository.Cache != nil {
+		effective, err = repository.Cache.Load(uint(userID), func() (*models.EffectivePermissions, error) {
+			return repository.loadEffectivePermissions(ctx, uint(userID))
+		})
+	} else {
+		effective, err = repository.loadPermission(ctx, uint(userID), permissionName)
+	}
+
+	if err != nil {
+		return errors.New("¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
+	}
+
+	if deny := effective.ActiveDeny(permissionName, time.Now()); deny != nil {
+		return denyError(deny)
+	}
+
+	permission, granted := effective.Permissions[permissionName]
+	if !granted {
+		// Los accesos de emergencia otorgan temporalmente los permisos configurados.
+		if breakGlass, err := repository.findBreakGlass(ctx, uint(userID), permissionName); err == nil && breakGlass {
+			return nil
+		}
 
-	if err := row.Scan(&permission.ID); err != nil {
 		return errors.New("¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
 	}
 
+	if len(permission.Conditions) > 0 {
+		userAttributes := map[string]string{}
+		json.Unmarshal(effective.Attributes, &userAttributes)
+
+		if _, passed := evaluatePolicies(ctx, policies.NewSubject(uint(userID), effective.Username, userAttributes), permission.Conditions); !passed {
+			return errors.New("No cumples las condiciones requeridas para usar este permiso")
+		}
+	}
+
+	if repository.Usage != nil {
+		repository.Usage.Record(ctx, uint(userID), permission.PermissionID)
+	}
+
 	return nil
 }
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+type BreakGlassRepository struct {
+	Database *database.Database
+}
+
+// Create abre la sesión solo si el usuario no tiene otra vigente y, si la tiene, devuelve
+// sql.ErrNoRows. La fila del usuario se bloquea para que dos activaciones simultáneas no abran
+// sesiones superpuestas.
+func (repository *BreakGlassRepository) Create(ctx context.Context, data *models.BreakGlassSession) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE;", data.UserID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO break_glass_sessions (user_id, justification, permissions, started_at, expires_at)
+			SELECT $1, $2, $3, $4, $5
+			WHERE NOT EXISTS (SELECT 1 FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now())
+			RETURNING id;
+	`
+
+	row := tx.QueryRowContext(ctx, query, data.UserID, data.Justification, pq.Array(data.Permissions), data.StartedAt, data.ExpiresAt)
+	if err = row.Scan(&data.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *BreakGlassRepository) GetActive(ctx context.Context, userID uint) (models.BreakGlassSession, error) {
+	query := `
+		SELECT id, user_id, justification, permissions, started_at, expires_at FROM break_glass_sessions
+			WHERE user_id = $1 AND expires_at > now()
+			ORDER BY expires_at DESC LIMIT 1;
+	`
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, userID)
+
+	var session models.BreakGlassSession
+
+	err := row.Scan(&session.ID, &session.UserID, &session.Justification, pq.Array(&session.Permissions), &session.StartedAt, &session.ExpiresAt)
+	if err != nil {
+		return models.BreakGlassSession{}, err
+	}
+
+	return session, nil
+}
+
+func (repository *BreakGlassRepository) GetAll(ctx context.Context) ([]models.BreakGlassSession, error) {
+	query := `
+		SELECT
+			bg.id,
+			bg.user_id,
+			u.username,
+			bg.justification,
+			bg.permissions,
+			bg.started_at,
+			bg.expires_at
+		FROM break_glass_sessions bg
+			INNER JOIN users u ON u.id = bg.user_id
+		WHERE u.org_id = $1
+		ORDER BY bg.id DESC;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []models.BreakGlassSession
+	for rows.Next() {
+		var session models.BreakGlassSession
+
+		err = rows.Scan(&session.ID, &session.UserID, &session.Username, &session.Justification, pq.Array(&session.Permissions), &session.StartedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,178 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+type ConstraintsRepository struct {
+	Database *database.Database
+}
+
+const constraintColumns = `
+	c.id,
+	c.name,
+	c.description,
+	c.max_allowed,
+	c.permission_ids,
+	ARRAY(SELECT p.name FROM permissions p WHERE p.id = ANY(c.permission_ids) ORDER BY p.name) as permissions,
+	c.created_at
+`
+
+func scanConstraints(rows *sql.Rows) ([]models.SeparationConstraint, error) {
+	var constraints []models.SeparationConstraint
+	for rows.Next() {
+		var constraint models.SeparationConstraint
+
+		err := rows.Scan(&constraint.ID, &constraint.Name, &constraint.Description, &constraint.MaxAllowed, pq.Array(&constraint.PermissionIDs), pq.Array(&constraint.Permissions), &constraint.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints, nil
+}
+
+func (repository *ConstraintsRepository) Create(ctx context.Context, data *models.SeparationConstraint) error {
+	query := "INSERT INTO separation_constraints (org_id, name, description, max_allowed, permission_ids) VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, currentOrg(ctx), data.Name, data.Description, data.MaxAllowed, pq.Array(data.PermissionIDs))
+
+	return row.Scan(&data.ID)
+}
+
+func (repository *ConstraintsRepository) Delete(ctx context.Context, id uint) error {
+	query := "DELETE FROM separation_constraints WHERE id = $1 AND org_id = $2;"
+
+	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id, currentOrg(ctx))
+	return err
+}
+
+func (repository *ConstraintsRepository) GetAll(ctx context.Context) ([]models.SeparationConstraint, error) {
+	query := "SELECT" + constraintColumns + "FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanConstraints(rows)
+}
+
+// checkSeparation revisa, dentro de la transacción de la asignación, que el usuario no viole
+// ninguna restricción de separación de funciones al recibir el permiso. Quien llama debe haber
+// bloqueado antes la fila del usuario, así dos asignaciones simultáneas se revisan en orden.
+func checkSeparation(ctx context.Context, tx *sql.Tx, userID uint, permissionID uint) error {
+	query := "SELECT" + constraintColumns + `
+		FROM separation_constraints c
+		WHERE $2 = ANY(c.permission_ids)
+			AND c.org_id = $3
+			AND (SELECT COUNT(*) FROM user_permissions up WHERE up.user_id = $1 AND up.permission_id = ANY(c.permission_ids) AND up.permission_id <> $2) + 1 > c.max_allowed
+		ORDER BY c.id;
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userID, permissionID, currentOrg(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	breached, err := scanConstraints(rows)
+	if err != nil {
+		return err
+	}
+
+	if len(breached) > 0 {
+		return fmt.Errorf("%w %s", models.ErrSeparationBreached, breached[0].Name)
+	}
+
+	return nil
+}
+
+func (repository *ConstraintsRepository) getOne(ctx context.Context, where string, arg interface{}) (models.SeparationConstraint, error) {
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT"+constraintColumns+"FROM separation_constraints c WHERE c.org_id = $1 AND "+where, currentOrg(ctx), arg)
+	if err != nil {
+		return models.SeparationConstraint{}, err
+	}
+
+	defer rows.Close()
+
+	constraints, err := scanConstraints(rows)
+	if err != nil {
+		return models.SeparationConstraint{}, err
+	}
+
+	if len(constraints) == 0 {
+		return models.SeparationConstraint{}, sql.ErrNoRows
+	}
+
+	return constraints[0], nil
+}
+
+func (repository *ConstraintsRepository) GetByID(ctx context.Context, id uint) (models.SeparationConstraint, error) {
+	return repository.getOne(ctx, "c.id = $2;", id)
+}
+
+func (repository *ConstraintsRepository) GetByName(ctx context.Context, name string) (models.SeparationConstraint, error) {
+	return repository.getOne(ctx, "c.name = $2;", name)
+}
+
+func (repository *ConstraintsRepository) GetViolations(ctx context.Context) ([]models.SeparationViolation, error) {
+	query := `
+		SELECT
+			c.id,
+			c.name,
+			u.id,
+			u.username,
+			array_agg(p.name ORDER BY p.name) as permissions
+		FROM separation_constraints c
+			INNER JOIN user_permissions up ON up.permission_id = ANY(c.permission_ids)
+			INNER JOIN users u ON u.id = up.user_id
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE c.org_id = $1
+		GROUP BY c.id, c.name, c.max_allowed, u.id, u.username
+		HAVING COUNT(*) > c.max_allowed
+		ORDER BY c.id, u.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var violations []models.SeparationViolation
+	for rows.Next() {
+		var violation models.SeparationViolation
+
+		err = rows.Scan(&violation.ConstraintID, &violation.ConstraintName, &violation.UserID, &violation.Username, pq.Array(&violation.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		violations = append(violations, violation)
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,138 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+type DeniesRepository struct {
+	Database *database.Database
+}
+
+const denyColumns = `
+	d.id,
+	d.permission_id,
+	p.name as permission_name,
+	d.user_id,
+	d.except_user_ids,
+	d.reason,
+	d.expires_at,
+	d.created_by,
+	d.created_at
+`
+
+func scanDenies(rows *sql.Rows) ([]models.PermissionDeny, error) {
+	var denies []models.PermissionDeny
+	for rows.Next() {
+		var deny models.PermissionDeny
+
+		err := rows.Scan(&deny.ID, &deny.PermissionID, &deny.PermissionName, &deny.UserID, pq.Array(&deny.ExceptUserIDs), &deny.Reason, &deny.ExpiresAt, &deny.CreatedBy, &deny.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		denies = append(denies, deny)
+	}
+
+	return denies, nil
+}
+
+func (repository *DeniesRepository) Create(ctx context.Context, data *models.PermissionDeny) error {
+	query := `
+		INSERT INTO permission_denies (permission_id, user_id, except_user_ids, reason, expires_at, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+	`
+
+	if data.ExceptUserIDs == nil {
+		data.ExceptUserIDs = []int64{}
+	}
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.PermissionID, data.UserID, pq.Array(data.ExceptUserIDs), data.Reason, data.ExpiresAt, data.CreatedBy)
+
+	return row.Scan(&data.ID)
+}
+
+func (repository *DeniesRepository) Delete(ctx context.Context, id uint) error {
+	query := "DELETE FROM permission_denies d USING permissions p WHERE d.id = $1 AND p.id = d.permission_id AND p.org_id = $2;"
+
+	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id, currentOrg(ctx))
+	return err
+}
+
+func (repository *DeniesRepository) GetActiveByUser(ctx context.Context, userID uint) ([]models.PermissionDeny, error) {
+	query := "SELECT" + denyColumns + `
+		FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+			INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id
+		WHERE (d.user_id = $1 OR (d.user_id IS NULL AND NOT ($1 = ANY(d.except_user_ids))))
+			AND (d.expires_at IS NULL OR d.expires_at > now())
+		ORDER BY d.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDenies(rows)
+}
+
+func (repository *DeniesRepository) GetAll(ctx context.Context) ([]models.PermissionDeny, error) {
+	query := "SELECT" + denyColumns + `
+		FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+		WHERE p.org_id = $1
+		ORDER BY d.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDenies(rows)
+}
+
+func (repository *DeniesRepository) GetByID(ctx context.Context, id uint) (models.PermissionDeny, error) {
+	query := "SELECT" + denyColumns + `
+		FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+		WHERE d.id = $1 AND p.org_id = $2;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, id, currentOrg(ctx))
+	if err != nil {
+		return models.PermissionDeny{}, err
+	}
+
+	defer rows.Close()
+
+	denies, err := scanDenies(rows)
+	if err != nil {
+		return models.PermissionDeny{}, err
+	}
+
+	if len(denies) == 0 {
+		return models.PermissionDeny{}, sql.ErrNoRows
+	}
+
+	return denies[0], nil
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// Obtiene la organización activa del token de acceso; las rutas sin autenticación usan
+// la organización de la plataforma salvo que el servicio indique otra.
+func currentOrg(ctx context.Context) uint {
+	if org, ok := ctx.Value("current_org_id").(int); ok && org > 0 {
+		return uint(org)
+	}
+
+	return models.PlatformOrganizationID
+}
+
+type OrganizationsRepository struct {
+	Database *database.Database
+}
+
+// Crea la organización junto con su dueño, copia los permisos integrados de la plataforma
+// y se los otorga al dueño.
+func (repository *OrganizationsRepository) Create(ctx context.Context, data *models.Organization, owner *models.User) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	data.CreatedAt = time.Now()
+
+	row := tx.QueryRowContext(ctx, "INSERT INTO organizations (name) VALUES ($1) RETURNING id;", data.Name)
+	if err = row.Scan(&data.ID); err != nil {
+		return err
+	}
+
+	if err = owner.EncryptPassword(); err != nil {
+		return err
+	}
+
+	owner.CreatedAt = time.Now()
+
+	row = tx.QueryRowContext(ctx, "INSERT INTO users (username, password, org_id) VALUES ($1, $2, $3) RETURNING id;", owner.Username, owner.Password, data.ID)
+	if err = row.Scan(&owner.ID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO permissions (name, description, deletable, editable, org_id)
+			SELECT name, description, FALSE, FALSE, $1 FROM permissions
+			WHERE org_id = $2 AND deletable = FALSE AND editable = FALSE AND name <> 'manage_organizations';
+	`
+
+	if _, err = tx.ExecContext(ctx, query, data.ID, models.PlatformOrganizationID); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO user_permissions (user_id, permission_id) SELECT $1, id FROM permissions WHERE org_id = $2;"
+
+	if _, err = tx.ExecContext(ctx, query, owner.ID, data.ID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE organizations SET owner_id = $1 WHERE id = $2;", owner.ID, data.ID); err != nil {
+		return err
+	}
+
+	data.OwnerID = &owner.ID
+
+	return tx.Commit()
+}
+
+func (repository *OrganizationsRepository) GetAll(ctx context.Context) ([]models.Organization, error) {
+	query := "SELECT id, name, owner_id, created_at FROM organizations ORDER BY id;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var organizations []models.Organization
+	for rows.Next() {
+		var organization models.Organization
+
+		if err = rows.Scan(&organization.ID, &organization.Name, &organization.OwnerID, &organization.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		organizations = append(organizations, organization)
+	}
+
+	return organizations, nil
+}
+
+func (repository *OrganizationsRepository) GetByID(ctx context.Context, id uint) (models.Organization, error) {
+	query := "SELECT id, name, owner_id, created_at FROM organizations WHERE id = $1;"
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, id)
+
+	var organization models.Organization
+
+	if err := row.Scan(&organization.ID, &organization.Name, &organization.OwnerID, &organization.CreatedAt); err != nil {
+		return models.Organization{}, err
+	}
+
+	return organization, nil
+}
+
+func (repository *OrganizationsRepository) GetByName(ctx context.Context, name string) (models.Organization, error) {
+	query := "SELECT id, name, owner_id, created_at FROM organizations WHERE name = $1;"
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, name)
+
+	var organization models.Organization
+
+	if err := row.Scan(&organization.ID, &organization.Name, &organization.OwnerID, &organization.CreatedAt); err != nil {
+		return models.Organization{}, err
+	}
+
+	return organization, nil
+}
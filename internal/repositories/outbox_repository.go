@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// Llave del bloqueo que asegura que un solo relay publique a la vez; así se mantiene el orden de
+// los eventos de cada agregado aunque haya varias réplicas.
+const outboxRelayLock = 7002
+
+// Consultas que escriben los eventos en la bandeja de salida. Se ejecutan dentro de la
+// transacción del cambio; las de usuarios y asignaciones van antes del DELETE porque necesitan
+// los datos que se van a borrar.
+const (
+	outboxInsert = "INSERT INTO outbox_events (org_id, aggregate_type, aggregate_id, event_type, payload)"
+
+	outboxUserDeleted = outboxInsert + `
+		SELECT org_id, 'user', id::text, 'user.deleted', json_build_object('user_id', id, 'username', username)
+			FROM users WHERE id = $1 AND org_id = $2;
+	`
+
+	outboxPermissionUpdated = outboxInsert + `
+		SELECT org_id, 'permission', id::text, 'permission.updated', json_build_object('permission_id', id, 'permission_name', name, 'description', description, 'deprecated', deprecated_at IS NOT NULL)
+			FROM permissions WHERE id = $1 AND org_id = $2;
+	`
+)
+
+// outboxUserPermission devuelve la consulta que escribe un evento por cada asignación que cumple
+// la condición. El agregado es el usuario.
+func outboxUserPermission(eventType string, where string) string {
+	return fmt.Sprintf(outboxInsert+`
+		SELECT p.org_id, 'user', u.id::text, '%s', json_build_object('user_id', u.id, 'username', u.username, 'permission_id', p.id, 'permission_name', p.name, 'user_permission_id', up.id)
+			FROM user_permissions up
+				INNER JOIN users u ON u.id = up.user_id
+				INNER JOIN permissions p ON p.id = up.permission_id
+			WHERE %s;
+	`, eventType, where)
+}
+
+type OutboxRepository struct {
+	Database *database.Database
+}
+
+func scanOutboxEvents(rows *sql.Rows, withSettled bool) ([]models.OutboxEvent, error) {
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+
+		dest := []interface{}{&event.ID, &event.OrgID, &event.AggregateType, &event.AggregateID, &event.Type, &event.IdempotencyKey, &event.Payload, &event.CreatedAt}
+		if withSettled {
+			dest = append(dest, &event.Settled)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Devuelve los eventos de todas las organizaciones posteriores a `after`. Los IDs se asignan al
+// insertar pero se confirman en otro orden, así que un evento se considera asentado cuando tiene
+// más de 5 segundos.
+func (repository *OutboxRepository) GetAllSince(ctx context.Context, after uint64, limit int) ([]models.OutboxEvent, error) {
+	query := `
+		SELECT id, org_id, aggregate_type, aggregate_id, event_type, idempotency_key, payload, created_at, created_at < now() - interval '5 seconds'
+		FROM outbox_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEvents(rows, true)
+}
+
+// Devuelve los eventos de la organización entre `after` (sin incluir) y `until`.
+func (repository *OutboxRepository) GetSince(ctx context.Context, after uint64, until uint64, limit int) ([]models.OutboxEvent, error) {
+	query := `
+		SELECT id, org_id, aggregate_type, aggregate_id, event_type, idempotency_key, payload, created_at
+		FROM outbox_events
+		WHERE org_id = $1 AND id > $2 AND id <= $3
+		ORDER BY id
+		LIMIT $4;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx), after, until, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanOutboxEvents(rows, false)
+}
+
+func (repository *OutboxRepository) LastID(ctx context.Context) (uint64, error) {
+	row := repository.Database.Conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox_events;")
+
+	var id uint64
+
+	err := row.Scan(&id)
+	return id, err
+}
+
+// Publica con `publish` los eventos pendientes en orden y marca como publicados los que no
+// fallan. Si otro relay tiene el bloqueo no hace nada.
+func (repository *OutboxRepository) Process(ctx context.Context, limit int, publish func(event models.OutboxEvent) error) (int, error) {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var locked bool
+
+	if err = tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1);", outboxRelayLock).Scan(&locked); err != nil || !locked {
+		return 0, err
+	}
+
+	query := `
+		SELECT id, org_id, aggregate_type, aggregate_id, event_type, idempotency_key, payload, created_at
+		FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1;
+	`
+
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+
+		if err = rows.Scan(&event.ID, &event.OrgID, &event.AggregateType, &event.AggregateID, &event.Type, &event.IdempotencyKey, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		events = append(events, event)
+	}
+
+	rows.Close()
+
+	published := 0
+	for _, event := range events {
+		if publishErr := publish(event); publishErr != nil {
+			reason := publishErr.Error()
+			if len(reason) > 500 {
+				reason = reason[:500]
+			}
+
+			query = "UPDATE outbox_events SET attempts = attempts + 1, last_error = $2 WHERE id = $1;"
+			if _, err = tx.ExecContext(ctx, query, event.ID, reason); err != nil {
+				return 0, err
+			}
+
+			continue
+		}
+
+		query = "UPDATE outbox_events SET attempts = attempts + 1, last_error = NULL, published_at = now() WHERE id = $1;"
+		if _, err = tx.ExecContext(ctx, query, event.ID); err != nil {
+			return 0, err
+		}
+
+		published++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return published, nil
+}
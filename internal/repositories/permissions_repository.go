@@ -7,25 +7,86 @@ import (
 	"github.com/dsolartec/iam-meli/internal/database"
 	"github.com/dsolartec/iam-meli/pkg/dto"
 	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
 )
 
 type PermissionsRepository struct {
 	Database *database.Database
 }
 
-func (repository *PermissionsRepository) Create(ctx context.Context, data *models.Permission) error {
-	query := "INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id;"
+// Aplica el plan de un manifiesto en una sola transacción; si algún cambio falla no se aplica
+// ninguno.
+func (repository *PermissionsRepository) ApplyManifest(ctx context.Context, plan *models.PermissionManifestPlan) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	query := `
+		INSERT INTO permissions (name, description, org_id, application_id)
+			VALUES ($1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4))
+			RETURNING id;
+	`
+
+	for i := range plan.Create {
+		permission := &plan.Create[i]
 
+		row := tx.QueryRowContext(ctx, query, permission.Name, permission.Description, org, plan.Application)
+		if err = row.Scan(&permission.ID); err != nil {
+			return err
+		}
+	}
+
+	query = "UPDATE permissions SET description = $1, deprecated_at = NULL, updated_at = now() WHERE id = $2 AND org_id = $3 AND editable = TRUE;"
+
+	for _, permission := range plan.Update {
+		if _, err = tx.ExecContext(ctx, query, permission.Description, permission.ID, org); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, outboxPermissionUpdated, permission.ID, org); err != nil {
+			return err
+		}
+	}
+
+	query = "UPDATE permissions SET deprecated_at = now(), updated_at = now() WHERE id = $1 AND org_id = $2 AND editable = TRUE;"
+
+	for _, permission := range plan.Deprecate {
+		if _, err = tx.ExecContext(ctx, query, permission.ID, org); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, outboxPermissionUpdated, permission.ID, org); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repository *PermissionsRepository) Create(ctx context.Context, data *models.Permission) error {
+	// Los permisos de una aplicación quedan asociados a ella para borrarse junto con la aplicación.
+	query := `
+		INSERT INTO permissions (name, description, org_id, application_id)
+			VALUES ($1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4))
+			RETURNING id;
+	`
+
+	data.Application, _ = models.SplitPermissionName(data.Name)
 	data.CreatedAt = time.Now()
 	data.UpdatedAt = time.Now()
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Name, data.Description)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Name, data.Description, currentOrg(ctx), data.Application)
 
 	return row.Scan(&data.ID)
 }
 
 func (repository *PermissionsRepository) Delete(ctx context.Context, id uint) error {
-	query := "DELETE FROM permissions WHERE id = $1 AND deletable = TRUE;"
+	query := "DELETE FROM permissions WHERE id = $1 AND org_id = $2 AND deletable = TRUE;"
 
 	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
 	if err != nil {
@@ -34,14 +95,14 @@ func (repository *PermissionsRepository) Delete(ctx context.Context, id uint) er
 
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, id)
+	_, err = stmt.ExecContext(ctx, id, currentOrg(ctx))
 	return err
 }
 
 func (repository *PermissionsRepository) GetAll(ctx context.Context) ([]models.Permission, error) {
-	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions;"
+	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;"
 
-	rows, err := repository.Database.Conn.QueryContext(ctx, query)
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +118,40 @@ func (repository *PermissionsRepository) GetAll(ctx context.Context) ([]models.P
 			return nil, err
 		}
 
+		permission.Application, _ = models.SplitPermissionName(permission.Name)
+
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, nil
+}
+
+func (repository *PermissionsRepository) GetByApplication(ctx context.Context, application string) ([]models.Permission, error) {
+	query := `
+		SELECT id, name, description, deletable, editable, deprecated_at, created_at, updated_at
+		FROM permissions
+		WHERE org_id = $1 AND split_part(name, ':', 1) = $2 AND position(':' in name) > 0
+		ORDER BY name;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx), application)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var permissions []models.Permission
+	for rows.Next() {
+		var permission models.Permission
+
+		err = rows.Scan(&permission.ID, &permission.Name, &permission.Description, &permission.Deletable, &permission.Editable, &permission.DeprecatedAt, &permission.CreatedAt, &permission.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		permission.Application = application
+
 		permissions = append(permissions, permission)
 	}
 
@@ -64,9 +159,9 @@ func (repository *PermissionsRepository) GetAll(ctx context.Context) ([]models.P
 }
 
 func (repository *PermissionsRepository) GetByID(ctx context.Context, id uint) (models.Permission, error) {
-	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;"
+	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;"
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, id)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, id, currentOrg(ctx))
 
 	var permission models.Permission
 
@@ -75,13 +170,17 @@ func (repository *PermissionsRepository) GetByID(ctx context.Context, id uint) (
 		return models.Permission{}, err
 	}
 
+	permission.Application, _ = models.SplitPermissionName(permission.Name)
+
 	return permission, nil
 }
 
+// Busca el permiso por su identificador completo, por lo que `read_orders` y `billing:read_orders`
+// son permisos distintos aunque compartan el nombre local.
 func (repository *PermissionsRepository) GetByName(ctx context.Context, name string) (models.Permission, error) {
-	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;"
+	query := "SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;"
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, name)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, name, currentOrg(ctx))
 
 	var permission models.Permission
 
@@ -90,19 +189,178 @@ func (repository *PermissionsRepository) GetByName(ctx context.Context, name str
 		return models.Permission{}, err
 	}
 
+	permission.Application, _ = models.SplitPermissionName(permission.Name)
+
 	return permission, nil
 }
 
+// GetCatalog lee la versión y los permisos en una sola consulta para que siempre correspondan.
+func (repository *PermissionsRepository) GetCatalog(ctx context.Context) (models.PermissionCatalog, error) {
+	query := `
+		SELECT
+			COALESCE((SELECT version FROM permission_catalogs WHERE org_id = $1), 1),
+			COALESCE(array_agg(name ORDER BY id), '{}')
+		FROM permissions WHERE org_id = $1;
+	`
+
+	catalog := models.PermissionCatalog{}
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, currentOrg(ctx))
+	if err := row.Scan(&catalog.Version, pq.Array(&catalog.Permissions)); err != nil {
+		return models.PermissionCatalog{}, err
+	}
+
+	return catalog, nil
+}
+
 func (repository *PermissionsRepository) Update(ctx context.Context, id uint, data *dto.UpdatePermissionBody) error {
-	query := "UPDATE permissions SET name = $1, description = $2, updated_at = $3 WHERE id = $4 AND editable = TRUE;"
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	query := "UPDATE permissions SET name = $1, description = $2, updated_at = $3 WHERE id = $4 AND org_id = $5 AND editable = TRUE;"
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, data.Name, data.Description, time.Now(), id)
-	return err
+	result, err := stmt.ExecContext(ctx, data.Name, data.Description, time.Now(), id, org)
+	if err != nil {
+		return err
+	}
+
+	// Si el permiso no se pudo editar no hay evento que publicar.
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, outboxPermissionUpdated, id, org); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Los titulares de un permiso son los usuarios que lo tienen asignado más los que lo tienen por
+// una sesión de acceso de emergencia vigente.
+const holdersQuery = `
+	FROM (
+		SELECT
+			u.id,
+			u.username,
+			up.id as user_permission_id,
+			'direct' as source,
+			up.granted_by,
+			g.username as granted_by_username,
+			up.created_at as granted_at,
+			NULL::timestamp as expires_at
+		FROM user_permissions up
+			INNER JOIN users u ON u.id = up.user_id
+			LEFT JOIN users g ON g.id = up.granted_by
+		WHERE up.permission_id = $1 AND u.org_id = $2
+		UNION ALL
+		SELECT
+			u.id,
+			u.username,
+			NULL,
+			'break_glass',
+			NULL,
+			NULL,
+			bg.started_at,
+			bg.expires_at
+		FROM break_glass_sessions bg
+			INNER JOIN users u ON u.id = bg.user_id
+			INNER JOIN permissions p ON p.id = $1 AND p.org_id = u.org_id
+		WHERE u.org_id = $2 AND bg.expires_at > now() AND p.name = ANY(bg.permissions)
+	) h`
+
+func (repository *PermissionsRepository) CountHolders(ctx context.Context, id uint) (int, error) {
+	row := repository.Database.Conn.QueryRowContext(ctx, "SELECT COUNT(*)"+holdersQuery+";", id, currentOrg(ctx))
+
+	var total int
+
+	if err := row.Scan(&total); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (repository *PermissionsRepository) GetHolders(ctx context.Context, id uint, limit int, offset int) ([]models.PermissionHolder, error) {
+	query := "SELECT h.*" + holdersQuery + " ORDER BY h.id, h.source"
+
+	args := []interface{}{id, currentOrg(ctx)}
+	if limit > 0 {
+		query += " LIMIT $3 OFFSET $4"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var holders []models.PermissionHolder
+	for rows.Next() {
+		var holder models.PermissionHolder
+
+		err = rows.Scan(&holder.UserID, &holder.Username, &holder.UserPermissionID, &holder.Source, &holder.GrantedBy, &holder.GrantedByUsername, &holder.GrantedAt, &holder.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		holders = append(holders, holder)
+	}
+
+	return holders, nil
+}
+
+func (repository *PermissionsRepository) GetStaleGrants(ctx context.Context, since time.Time) ([]models.StaleGrant, error) {
+	query := `
+		SELECT
+			up.id,
+			up.user_id,
+			u.username,
+			up.permission_id,
+			p.name as permission_name,
+			up.created_at as granted_at,
+			up.last_used_at
+		FROM user_permissions up
+			INNER JOIN users u ON u.id = up.user_id
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE COALESCE(up.last_used_at, up.created_at) < $1 AND u.org_id = $2
+		ORDER BY COALESCE(up.last_used_at, up.created_at), up.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, since, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var grants []models.StaleGrant
+	for rows.Next() {
+		var grant models.StaleGrant
+
+		err = rows.Scan(&grant.UserPermissionID, &grant.UserID, &grant.Username, &grant.PermissionID, &grant.PermissionName, &grant.GrantedAt, &grant.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		grants = append(grants, grant)
+	}
+
+	return grants, nil
 }
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type PoliciesRepository struct {
+	Database *database.Database
+}
+
+func (repository *PoliciesRepository) Create(ctx context.Context, data *models.PermissionPolicy) error {
+	// Solo se crea la política si el permiso pertenece a la organización actual.
+	query := "INSERT INTO permission_policies (permission_id, description, condition) SELECT p.id, $2, $3 FROM permissions p WHERE p.id = $1 AND p.org_id = $4 RETURNING id;"
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.PermissionID, data.Description, data.Condition, currentOrg(ctx))
+
+	return row.Scan(&data.ID)
+}
+
+func (repository *PoliciesRepository) Delete(ctx context.Context, id uint) error {
+	query := "DELETE FROM permission_policies pp USING permissions p WHERE pp.id = $1 AND p.id = pp.permission_id AND p.org_id = $2;"
+
+	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id, currentOrg(ctx))
+	return err
+}
+
+func (repository *PoliciesRepository) GetByPermission(ctx context.Context, permissionID uint) ([]models.PermissionPolicy, error) {
+	query := `
+		SELECT pp.id, pp.permission_id, pp.description, pp.condition, pp.created_at
+		FROM permission_policies pp
+			INNER JOIN permissions p ON p.id = pp.permission_id
+		WHERE pp.permission_id = $1 AND p.org_id = $2
+		ORDER BY pp.id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, permissionID, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var policies []models.PermissionPolicy
+	for rows.Next() {
+		var policy models.PermissionPolicy
+
+		err = rows.Scan(&policy.ID, &policy.PermissionID, &policy.Description, &policy.Condition, &policy.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
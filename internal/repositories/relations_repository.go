@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type RelationsRepository struct {
+	Database *database.Database
+}
+
+func (repository *RelationsRepository) DeleteTuple(ctx context.Context, id uint) error {
+	query := "DELETE FROM relation_tuples WHERE id = $1 AND org_id = $2;"
+
+	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id, currentOrg(ctx))
+	return err
+}
+
+func (repository *RelationsRepository) GetNamespaces(ctx context.Context) ([]models.RelationNamespace, error) {
+	query := "SELECT name, config, created_at, updated_at FROM relation_namespaces WHERE org_id = $1 ORDER BY name;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var namespaces []models.RelationNamespace
+	for rows.Next() {
+		var namespace models.RelationNamespace
+
+		err = rows.Scan(&namespace.Name, &namespace.Config, &namespace.CreatedAt, &namespace.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		namespaces = append(namespaces, namespace)
+	}
+
+	return namespaces, nil
+}
+
+func (repository *RelationsRepository) GetObjectIDs(ctx context.Context, namespace string) ([]string, error) {
+	query := "SELECT DISTINCT object_id FROM relation_tuples WHERE namespace = $1 AND org_id = $2 ORDER BY object_id;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, namespace, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var objectIDs []string
+	for rows.Next() {
+		var objectID string
+
+		if err = rows.Scan(&objectID); err != nil {
+			return nil, err
+		}
+
+		objectIDs = append(objectIDs, objectID)
+	}
+
+	return objectIDs, nil
+}
+
+func (repository *RelationsRepository) GetTuples(ctx context.Context, namespace string, objectID string, relation string) ([]models.RelationTuple, error) {
+	query := `
+		SELECT
+			id,
+			namespace,
+			object_id,
+			relation,
+			subject_namespace,
+			subject_object_id,
+			subject_relation,
+			created_at
+		FROM relation_tuples
+		WHERE namespace = $1 AND object_id = $2 AND relation = $3 AND org_id = $4
+		ORDER BY id;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, namespace, objectID, relation, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var tuples []models.RelationTuple
+	for rows.Next() {
+		var tuple models.RelationTuple
+
+		err = rows.Scan(&tuple.ID, &tuple.Namespace, &tuple.ObjectID, &tuple.Relation, &tuple.SubjectNamespace, &tuple.SubjectObjectID, &tuple.SubjectRelation, &tuple.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		tuples = append(tuples, tuple)
+	}
+
+	return tuples, nil
+}
+
+func (repository *RelationsRepository) SaveNamespace(ctx context.Context, data *models.RelationNamespace) error {
+	query := `
+		INSERT INTO relation_namespaces (name, config, org_id) VALUES ($1, $2, $3)
+			ON CONFLICT (org_id, name) DO UPDATE SET config = EXCLUDED.config, updated_at = $4
+			RETURNING created_at, updated_at;
+	`
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Name, data.Config, currentOrg(ctx), time.Now())
+
+	return row.Scan(&data.CreatedAt, &data.UpdatedAt)
+}
+
+func (repository *RelationsRepository) WriteTuple(ctx context.Context, data *models.RelationTuple) error {
+	query := `
+		INSERT INTO relation_tuples (namespace, object_id, relation, subject_namespace, subject_object_id, subject_relation, org_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;
+	`
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Namespace, data.ObjectID, data.Relation, data.SubjectNamespace, data.SubjectObjectID, data.SubjectRelation, currentOrg(ctx))
+
+	return row.Scan(&data.ID)
+}
@@ -0,0 +1,348 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+type ReviewsRepository struct {
+	Database *database.Database
+}
+
+const campaignColumns = `
+	id,
+	name,
+	description,
+	permission_id,
+	user_ids,
+	reviewer_ids,
+	deadline,
+	status,
+	created_by,
+	created_at,
+	closed_at
+`
+
+const reviewItemColumns = `
+	ri.id,
+	ri.campaign_id,
+	ri.user_permission_id,
+	ri.user_id,
+	COALESCE(u.username, '') as username,
+	ri.permission_id,
+	COALESCE(p.name, '') as permission_name,
+	ri.reviewer_id,
+	COALESCE(r.username, '') as reviewer_username,
+	ri.decision,
+	ri.comment,
+	ri.decided_at
+	FROM review_items ri
+		LEFT JOIN users u ON u.id = ri.user_id
+		LEFT JOIN permissions p ON p.id = ri.permission_id
+		LEFT JOIN users r ON r.id = ri.reviewer_id
+`
+
+func scanCampaigns(rows *sql.Rows) ([]models.ReviewCampaign, error) {
+	var campaigns []models.ReviewCampaign
+	for rows.Next() {
+		var campaign models.ReviewCampaign
+
+		err := rows.Scan(&campaign.ID, &campaign.Name, &campaign.Description, &campaign.PermissionID, pq.Array(&campaign.UserIDs), pq.Array(&campaign.ReviewerIDs), &campaign.Deadline, &campaign.Status, &campaign.CreatedBy, &campaign.CreatedAt, &campaign.ClosedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		campaigns = append(campaigns, campaign)
+	}
+
+	return campaigns, nil
+}
+
+func scanReviewItems(rows *sql.Rows) ([]models.ReviewItem, error) {
+	var items []models.ReviewItem
+	for rows.Next() {
+		var item models.ReviewItem
+
+		err := rows.Scan(&item.ID, &item.CampaignID, &item.UserPermissionID, &item.UserID, &item.Username, &item.PermissionID, &item.PermissionName, &item.ReviewerID, &item.ReviewerUsername, &item.Decision, &item.Comment, &item.DecidedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Revoca los permisos de los elementos pendientes y cierra la campaña. El cierre y los permisos
+// revocados quedan en el registro de auditoría dentro de la misma transacción, también cuando la
+// campaña se cierra en segundo plano.
+func (repository *ReviewsRepository) Close(ctx context.Context, id uint) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		SELECT u.username, p.name FROM review_items ri
+			INNER JOIN users u ON u.id = ri.user_id
+			INNER JOIN permissions p ON p.id = ri.permission_id
+			WHERE ri.campaign_id = $1 AND ri.decision = 'pending' AND ri.user_permission_id IS NOT NULL
+			ORDER BY ri.id;
+	`
+
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	revoked := []models.StateGrant{}
+	for rows.Next() {
+		var grant models.StateGrant
+
+		if err = rows.Scan(&grant.Username, &grant.Permission); err != nil {
+			rows.Close()
+			return err
+		}
+
+		revoked = append(revoked, grant)
+	}
+
+	rows.Close()
+
+	queries := []string{
+		outboxUserPermission("permission.revoked", "up.id IN (SELECT user_permission_id FROM review_items WHERE campaign_id = $1 AND decision = 'pending')"),
+		"DELETE FROM user_permissions WHERE id IN (SELECT user_permission_id FROM review_items WHERE campaign_id = $1 AND decision = 'pending');",
+		"UPDATE review_items SET decision = 'auto_revoked', decided_at = now() WHERE campaign_id = $1 AND decision = 'pending';",
+	}
+
+	for _, query := range queries {
+		if _, err = tx.ExecContext(ctx, query, id); err != nil {
+			return err
+		}
+	}
+
+	var (
+		name string
+		org  uint
+	)
+
+	row := tx.QueryRowContext(ctx, "UPDATE review_campaigns SET status = 'closed', closed_at = now() WHERE id = $1 RETURNING name, org_id;", id)
+	if err = row.Scan(&name, &org); err != nil {
+		return err
+	}
+
+	entry := models.AuditEntry{
+		ActorID:    contextActor(ctx),
+		Action:     "review.close",
+		TargetType: "review_campaign",
+		TargetID:   fmt.Sprint(id),
+		TargetName: name,
+		After:      map[string]interface{}{"auto_revoked": revoked},
+	}
+
+	if err = insertAudit(ctx, tx, org, &entry); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *ReviewsRepository) Create(ctx context.Context, data *models.ReviewCampaign) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	data.Status = models.CampaignOpen
+	data.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO review_campaigns (name, description, permission_id, user_ids, reviewer_ids, deadline, created_by, org_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;
+	`
+
+	row := tx.QueryRowContext(ctx, query, data.Name, data.Description, data.PermissionID, pq.Array(data.UserIDs), pq.Array(data.ReviewerIDs), data.Deadline, data.CreatedBy, currentOrg(ctx))
+	if err = row.Scan(&data.ID); err != nil {
+		return err
+	}
+
+	query = "INSERT INTO review_items (campaign_id, user_permission_id, user_id, permission_id, reviewer_id) VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+
+	for i := range data.Items {
+		item := &data.Items[i]
+
+		item.CampaignID = data.ID
+		item.Decision = models.ReviewPending
+
+		row = tx.QueryRowContext(ctx, query, item.CampaignID, item.UserPermissionID, item.UserID, item.PermissionID, item.ReviewerID)
+		if err = row.Scan(&item.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (repository *ReviewsRepository) Decide(ctx context.Context, item *models.ReviewItem) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if item.Decision == models.ReviewRevoked && item.UserPermissionID != nil {
+		if _, err = tx.ExecContext(ctx, outboxUserPermission("permission.revoked", "up.id = $1"), *item.UserPermissionID); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, "DELETE FROM user_permissions WHERE id = $1;", *item.UserPermissionID); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	item.DecidedAt = &now
+
+	query := "UPDATE review_items SET decision = $1, comment = $2, decided_at = $3 WHERE id = $4;"
+
+	if _, err = tx.ExecContext(ctx, query, item.Decision, item.Comment, item.DecidedAt, item.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *ReviewsRepository) GetAll(ctx context.Context) ([]models.ReviewCampaign, error) {
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT"+campaignColumns+"FROM review_campaigns WHERE org_id = $1 ORDER BY id DESC;", currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanCampaigns(rows)
+}
+
+func (repository *ReviewsRepository) GetByID(ctx context.Context, id uint) (models.ReviewCampaign, error) {
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT"+campaignColumns+"FROM review_campaigns WHERE id = $1 AND org_id = $2;", id, currentOrg(ctx))
+	if err != nil {
+		return models.ReviewCampaign{}, err
+	}
+
+	defer rows.Close()
+
+	campaigns, err := scanCampaigns(rows)
+	if err != nil {
+		return models.ReviewCampaign{}, err
+	}
+
+	if len(campaigns) == 0 {
+		return models.ReviewCampaign{}, sql.ErrNoRows
+	}
+
+	return campaigns[0], nil
+}
+
+func (repository *ReviewsRepository) GetCandidates(ctx context.Context, permissionID *uint, userIDs []int64) ([]models.ReviewItem, error) {
+	query := `
+		SELECT
+			up.id,
+			up.user_id,
+			u.username,
+			up.permission_id,
+			p.name as permission_name
+		FROM user_permissions up
+			INNER JOIN users u ON u.id = up.user_id
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE ($1::integer IS NULL OR up.permission_id = $1)
+			AND (cardinality($2::integer[]) = 0 OR up.user_id = ANY($2::integer[]))
+			AND u.org_id = $3
+		ORDER BY up.id;
+	`
+
+	if userIDs == nil {
+		userIDs = []int64{}
+	}
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, permissionID, pq.Array(userIDs), currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []models.ReviewItem
+	for rows.Next() {
+		var (
+			item             models.ReviewItem
+			userPermissionID uint
+		)
+
+		err = rows.Scan(&userPermissionID, &item.UserID, &item.Username, &item.PermissionID, &item.PermissionName)
+		if err != nil {
+			return nil, err
+		}
+
+		item.UserPermissionID = &userPermissionID
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Obtiene las campañas vencidas de todas las organizaciones para cerrarlas en segundo plano.
+func (repository *ReviewsRepository) GetExpired(ctx context.Context) ([]models.ReviewCampaign, error) {
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT"+campaignColumns+"FROM review_campaigns WHERE status = 'open' AND deadline <= now() ORDER BY id;")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanCampaigns(rows)
+}
+
+func (repository *ReviewsRepository) GetItem(ctx context.Context, campaignID uint, id uint) (models.ReviewItem, error) {
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT"+reviewItemColumns+"WHERE ri.campaign_id = $1 AND ri.id = $2;", campaignID, id)
+	if err != nil {
+		return models.ReviewItem{}, err
+	}
+
+	defer rows.Close()
+
+	items, err := scanReviewItems(rows)
+	if err != nil {
+		return models.ReviewItem{}, err
+	}
+
+	if len(items) == 0 {
+		return models.ReviewItem{}, sql.ErrNoRows
+	}
+
+	return items[0], nil
+}
+
+func (repository *ReviewsRepository) GetItems(ctx context.Context, campaignID uint, reviewerID *uint) ([]models.ReviewItem, error) {
+	query := "SELECT" + reviewItemColumns + "WHERE ri.campaign_id = $1 AND ($2::integer IS NULL OR ri.reviewer_id = $2) ORDER BY ri.id;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, campaignID, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanReviewItems(rows)
+}
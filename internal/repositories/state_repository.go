@@ -0,0 +1,348 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type StateRepository struct {
+	Database *database.Database
+}
+
+// lockGrant bloquea la fila del usuario de una asignación por nombre y revisa en la misma
+// transacción que no viole una restricción de separación de funciones. Si el usuario o el permiso no
+// existen no hay nada que revisar, porque la inserción tampoco asigna nada.
+func lockGrant(ctx context.Context, tx *sql.Tx, username string, permission string) error {
+	query := `
+		SELECT u.id, p.id FROM users u
+			INNER JOIN permissions p ON p.name = $2 AND p.org_id = u.org_id
+			WHERE u.username = $1 AND u.org_id = $3
+			FOR UPDATE OF u;
+	`
+
+	var userID, permissionID uint
+
+	err := tx.QueryRowContext(ctx, query, username, permission, currentOrg(ctx)).Scan(&userID, &permissionID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return checkSeparation(ctx, tx, userID, permissionID)
+}
+
+// ApplyReconcile aplica el plan del reconciliador en una sola transacción, relacionando todo por
+// nombre. Las asignaciones quedan otorgadas por el usuario con el que se reconcilia, que también
+// queda como actor del registro de auditoría del plan.
+func (repository *StateRepository) ApplyReconcile(ctx context.Context, plan *models.ReconcilePlan) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	query := `
+		INSERT INTO permissions (name, description, org_id, application_id)
+			SELECT $1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4)
+			WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE name = $1 AND org_id = $3);
+	`
+
+	for _, permission := range plan.CreatePermissions {
+		application, _ := models.SplitPermissionName(permission.Name)
+
+		if _, err = tx.ExecContext(ctx, query, permission.Name, permission.Description, org, application); err != nil {
+			return err
+		}
+	}
+
+	query = "UPDATE permissions SET description = $1, updated_at = now() WHERE name = $2 AND org_id = $3 AND editable = TRUE RETURNING id;"
+
+	for _, permission := range plan.UpdatePermissions {
+		var id uint
+
+		if err = tx.QueryRowContext(ctx, query, permission.Description, permission.Name, org).Scan(&id); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, outboxPermissionUpdated, id, org); err != nil {
+			return err
+		}
+	}
+
+	var grantedBy *uint
+	if userID, ok := ctx.Value("current_user_id").(int); ok {
+		id := uint(userID)
+		grantedBy = &id
+	}
+
+	query = `
+		INSERT INTO user_permissions (user_id, permission_id, granted_by, grantable)
+			SELECT u.id, p.id, $3, $4
+			FROM users u
+				INNER JOIN permissions p ON p.name = $2 AND p.org_id = u.org_id
+			WHERE u.username = $1 AND u.org_id = $5
+				AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = u.id AND up.permission_id = p.id)
+			RETURNING id;
+	`
+
+	for _, grant := range plan.CreateGrants {
+		if err = lockGrant(ctx, tx, grant.Username, grant.Permission); err != nil {
+			return err
+		}
+
+		var id uint
+
+		err = tx.QueryRowContext(ctx, query, grant.Username, grant.Permission, grantedBy, grant.Grantable, org).Scan(&id)
+		if err == sql.ErrNoRows {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, outboxUserPermission("permission.granted", "up.id = $1"), id); err != nil {
+			return err
+		}
+	}
+
+	query = `
+		UPDATE user_permissions up SET grantable = $3
+			FROM users u, permissions p
+			WHERE up.user_id = u.id AND up.permission_id = p.id
+				AND u.username = $1 AND u.org_id = $4 AND p.name = $2 AND p.org_id = $4;
+	`
+
+	for _, grant := range plan.UpdateGrants {
+		if _, err = tx.ExecContext(ctx, query, grant.Username, grant.Permission, grant.Grantable, org); err != nil {
+			return err
+		}
+	}
+
+	outboxRevoked := outboxUserPermission("permission.revoked", "u.username = $1 AND u.org_id = $3 AND p.name = $2 AND p.org_id = $3")
+	query = `
+		DELETE FROM user_permissions up USING users u, permissions p
+			WHERE up.user_id = u.id AND up.permission_id = p.id
+				AND u.username = $1 AND u.org_id = $3 AND p.name = $2 AND p.org_id = $3;
+	`
+
+	for _, grant := range plan.RevokeGrants {
+		if _, err = tx.ExecContext(ctx, outboxRevoked, grant.Username, grant.Permission, org); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, query, grant.Username, grant.Permission, org); err != nil {
+			return err
+		}
+	}
+
+	query = "DELETE FROM permissions WHERE name = $1 AND org_id = $2 AND deletable = TRUE;"
+
+	for _, name := range plan.DeletePermissions {
+		if _, err = tx.ExecContext(ctx, query, name, org); err != nil {
+			return err
+		}
+	}
+
+	entry := models.AuditEntry{
+		ActorID:    contextActor(ctx),
+		Action:     "state.reconcile",
+		TargetType: "organization",
+		After:      plan,
+	}
+
+	if err = insertAudit(ctx, tx, org, &entry); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *StateRepository) Export(ctx context.Context, includePasswords bool) (models.StateDocument, error) {
+	org := currentOrg(ctx)
+
+	document := models.StateDocument{
+		Version:     models.StateVersion,
+		ExportedAt:  time.Now(),
+		Users:       []models.StateUser{},
+		Permissions: []models.StatePermission{},
+		Grants:      []models.StateGrant{},
+	}
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, "SELECT username, password, attributes FROM users WHERE org_id = $1 ORDER BY id;", org)
+	if err != nil {
+		return document, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.StateUser
+		var attributes []byte
+
+		if err = rows.Scan(&user.Username, &user.Password, &attributes); err != nil {
+			return document, err
+		}
+
+		if !includePasswords {
+			user.Password = ""
+		}
+
+		if err = json.Unmarshal(attributes, &user.Attributes); err != nil {
+			return document, err
+		}
+
+		if len(user.Attributes) == 0 {
+			user.Attributes = nil
+		}
+
+		document.Users = append(document.Users, user)
+	}
+
+	rows, err = repository.Database.Conn.QueryContext(ctx, "SELECT name, description, deletable, editable FROM permissions WHERE org_id = $1 ORDER BY id;", org)
+	if err != nil {
+		return document, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission models.StatePermission
+
+		if err = rows.Scan(&permission.Name, &permission.Description, &permission.Deletable, &permission.Editable); err != nil {
+			return document, err
+		}
+
+		document.Permissions = append(document.Permissions, permission)
+	}
+
+	query := `
+		SELECT u.username, p.name, up.grantable
+		FROM user_permissions up
+			INNER JOIN users u ON u.id = up.user_id
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE u.org_id = $1
+		ORDER BY up.id;
+	`
+
+	rows, err = repository.Database.Conn.QueryContext(ctx, query, org)
+	if err != nil {
+		return document, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var grant models.StateGrant
+
+		if err = rows.Scan(&grant.Username, &grant.Permission, &grant.Grantable); err != nil {
+			return document, err
+		}
+
+		document.Grants = append(document.Grants, grant)
+	}
+
+	return document, nil
+}
+
+// Aplica el plan en una sola transacción. Las inserciones se hacen por nombre y solo si el
+// elemento no existe, por lo que importar dos veces el mismo documento no duplica nada.
+func (repository *StateRepository) Import(ctx context.Context, plan *models.StateImportPlan) error {
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	query := `
+		INSERT INTO users (username, password, attributes, org_id)
+			SELECT $1, $2, $3, $4
+			WHERE NOT EXISTS (SELECT 1 FROM users WHERE username = $1 AND org_id = $4);
+	`
+
+	for _, user := range plan.CreateUsers {
+		attributes := user.Attributes
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+
+		b, err := json.Marshal(attributes)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, query, user.Username, user.Password, string(b), org); err != nil {
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO permissions (name, description, org_id, application_id)
+			SELECT $1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4)
+			WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE name = $1 AND org_id = $3);
+	`
+
+	for _, permission := range plan.CreatePermissions {
+		application, _ := models.SplitPermissionName(permission.Name)
+
+		if _, err = tx.ExecContext(ctx, query, permission.Name, permission.Description, org, application); err != nil {
+			return err
+		}
+	}
+
+	query = "UPDATE permissions SET description = $1, updated_at = now() WHERE name = $2 AND org_id = $3 AND editable = TRUE;"
+
+	for _, permission := range plan.UpdatePermissions {
+		if _, err = tx.ExecContext(ctx, query, permission.Description, permission.Name, org); err != nil {
+			return err
+		}
+	}
+
+	query = `
+		INSERT INTO user_permissions (user_id, permission_id, grantable)
+			SELECT u.id, p.id, $3
+			FROM users u
+				INNER JOIN permissions p ON p.name = $2 AND p.org_id = u.org_id
+			WHERE u.username = $1 AND u.org_id = $4
+				AND NOT EXISTS (SELECT 1 FROM user_permissions up WHERE up.user_id = u.id AND up.permission_id = p.id);
+	`
+
+	for _, grant := range plan.CreateGrants {
+		if err = lockGrant(ctx, tx, grant.Username, grant.Permission); err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, query, grant.Username, grant.Permission, grant.Grantable, org); err != nil {
+			return err
+		}
+	}
+
+	query = `
+		UPDATE user_permissions up SET grantable = $3
+			FROM users u, permissions p
+			WHERE up.user_id = u.id AND up.permission_id = p.id
+				AND u.username = $1 AND u.org_id = $4 AND p.name = $2 AND p.org_id = $4;
+	`
+
+	for _, grant := range plan.UpdateGrants {
+		if _, err = tx.ExecContext(ctx, query, grant.Username, grant.Permission, grant.Grantable, org); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
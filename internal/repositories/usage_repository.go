@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultUsageBatchSize     = 500
+	DefaultUsageFlushInterval = 30 * time.Second
+)
+
+type usageKey struct {
+	orgID        uint
+	userID       uint
+	permissionID uint
+}
+
+// Acumula en memoria el último uso de cada permiso y lo guarda por lotes para no hacer lentas las verificaciones.
+type UsageRepository struct {
+	Database *database.Database
+
+	BatchSize     int
+	FlushInterval time.Duration
+
+	mu      sync.Mutex
+	pending map[usageKey]time.Time
+	full    chan struct{}
+}
+
+func (repository *UsageRepository) init() {
+	if repository.pending == nil {
+		repository.pending = map[usageKey]time.Time{}
+		repository.full = make(chan struct{}, 1)
+	}
+}
+
+func (repository *UsageRepository) Record(ctx context.Context, userID uint, permissionID uint) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	repository.init()
+	repository.pending[usageKey{currentOrg(ctx), userID, permissionID}] = time.Now()
+
+	batchSize := repository.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultUsageBatchSize
+	}
+
+	if len(repository.pending) >= batchSize {
+		select {
+		case repository.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (repository *UsageRepository) Flush(ctx context.Context) error {
+	repository.mu.Lock()
+	repository.init()
+
+	pending := repository.pending
+	repository.pending = map[usageKey]time.Time{}
+
+	repository.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var (
+		orgIDs        []int64
+		userIDs       []int64
+		permissionIDs []int64
+		usedAt        []string
+	)
+
+	for key, at := range pending {
+		orgIDs = append(orgIDs, int64(key.orgID))
+		userIDs = append(userIDs, int64(key.userID))
+		permissionIDs = append(permissionIDs, int64(key.permissionID))
+		usedAt = append(usedAt, at.UTC().Format("2006-01-02 15:04:05.999999"))
+	}
+
+	// Solo se actualizan los permisos de usuarios de la organización en la que se usaron.
+	query := `
+		UPDATE user_permissions up SET last_used_at = u.used_at
+			FROM unnest($1::integer[], $2::integer[], $3::timestamp[], $4::integer[]) AS u(user_id, permission_id, used_at, org_id), users us
+			WHERE up.user_id = u.user_id AND up.permission_id = u.permission_id
+				AND us.id = up.user_id AND us.org_id = u.org_id
+				AND (up.last_used_at IS NULL OR up.last_used_at < u.used_at);
+	`
+
+	_, err := repository.Database.Conn.ExecContext(ctx, query, pq.Array(userIDs), pq.Array(permissionIDs), pq.Array(usedAt), pq.Array(orgIDs))
+	return err
+}
+
+// Guarda los usos pendientes cada cierto tiempo o cuando se llena el lote, hasta que se cierre `stop`.
+func (repository *UsageRepository) Run(stop <-chan struct{}) {
+	repository.mu.Lock()
+	repository.init()
+	full := repository.full
+	repository.mu.Unlock()
+
+	interval := repository.FlushInterval
+	if interval <= 0 {
+		interval = DefaultUsageFlushInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-full:
+		}
+
+		if err := repository.Flush(context.Background()); err != nil {
+			log.Printf("No se pudo guardar el uso de los permisos: %v", err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/dsolartec/iam-meli/internal/database"
@@ -13,7 +14,7 @@ type UsersRepository struct {
 }
 
 func (repository *UsersRepository) Create(ctx context.Context, data *models.User) error {
-	query := "INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id;"
+	query := "INSERT INTO users (username, password, org_id) VALUES ($1, $2, $3) RETURNING id;"
 
 	if err := data.EncryptPassword(); err != nil {
 		return err
@@ -21,29 +22,45 @@ func (repository *UsersRepository) Create(ctx context.Context, data *models.User
 
 	data.CreatedAt = time.Now()
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Username, data.Password)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.Username, data.Password, currentOrg(ctx))
 
 	return row.Scan(&data.ID)
 }
 
 func (repository *UsersRepository) Delete(ctx context.Context, id uint) error {
-	query := "DELETE FROM users WHERE id = $1;"
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	if _, err = tx.ExecContext(ctx, outboxUserDeleted, id, org); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM users WHERE id = $1 AND org_id = $2;"
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
 		return err
 	}
 
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, id)
-	return err
+	if _, err = stmt.ExecContext(ctx, id, org); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repository *UsersRepository) GetAll(ctx context.Context) ([]models.User, error) {
-	query := "SELECT id, username, created_at FROM users;"
+	query := "SELECT id, username, created_at FROM users WHERE org_id = $1;"
 
-	rows, err := repository.Database.Conn.QueryContext(ctx, query)
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -66,9 +83,9 @@ func (repository *UsersRepository) GetAll(ctx context.Context) ([]models.User, e
 }
 
 func (repository *UsersRepository) GetByID(ctx context.Context, id uint) (models.User, error) {
-	query := "SELECT id, username, created_at FROM users WHERE id = $1;"
+	query := "SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;"
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, id)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, id, currentOrg(ctx))
 
 	var user models.User
 
@@ -80,12 +97,12 @@ func (repository *UsersRepository) GetByID(ctx context.Context, id uint) (models
 }
 
 func (repository *UsersRepository) GetByUsername(ctx context.Context, username string, with_password bool) (models.User, error) {
-	query := "SELECT id, username, created_at FROM users WHERE username = $1;"
+	query := "SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;"
 	if with_password {
-		query = "SELECT id, username, password, created_at FROM users WHERE username = $1;"
+		query = "SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;"
 	}
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, username)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, username, currentOrg(ctx))
 
 	var err error
 	var user models.User
@@ -109,13 +126,14 @@ func (repository *UsersRepository) GetAllUserPermissions(ctx context.Context, us
 			up.id,
 			up.user_id,
 			up.permission_id,
-			p.name as permission_name
+			p.name as permission_name,
+			up.grantable
 		FROM user_permissions up
 			INNER JOIN permissions p ON p.id = up.permission_id
-		WHERE user_id = $1;
+		WHERE up.user_id = $1 AND p.org_id = $2;
 	`
 
-	rows, err := repository.Database.Conn.QueryContext(ctx, query, userID)
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, userID, currentOrg(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +144,7 @@ func (repository *UsersRepository) GetAllUserPermissions(ctx context.Context, us
 	for rows.Next() {
 		var user_permission models.UserPermission
 
-		err = rows.Scan(&user_permission.ID, &user_permission.UserID, &user_permission.PermissionID, &user_permission.PermissionName)
+		err = rows.Scan(&user_permission.ID, &user_permission.UserID, &user_permission.PermissionID, &user_permission.PermissionName, &user_permission.Grantable)
 		if err != nil {
 			return nil, err
 		}
@@ -138,9 +156,13 @@ func (repository *UsersRepository) GetAllUserPermissions(ctx context.Context, us
 }
 
 func (repository *UsersRepository) GetUserPermission(ctx context.Context, userID uint, permissionID uint) (models.UserPermission, error) {
-	query := "SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;"
+	query := `
+		SELECT up.id, up.user_id, up.permission_id FROM user_permissions up
+			INNER JOIN permissions p ON p.id = up.permission_id
+			WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;
+	`
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permissionID)
+	row := repository.Database.Conn.QueryRowContext(ctx, query, userID, permissionID, currentOrg(ctx))
 
 	var user_permission models.UserPermission
 
@@ -151,16 +173,101 @@ func (repository *UsersRepository) GetUserPermission(ctx context.Context, userID
 	return user_permission, nil
 }
 
+// GrantPermission asigna el permiso si no viola ninguna restricción de separación de funciones; si
+// la viola devuelve un error que envuelve models.ErrSeparationBreached.
 func (repository *UsersRepository) GrantPermission(ctx context.Context, data *models.UserPermission) error {
-	query := "INSERT INTO user_permissions (user_id, permission_id) VALUES ($1, $2) RETURNING id;"
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
 
-	row := repository.Database.Conn.QueryRowContext(ctx, query, data.UserID, data.PermissionID)
+	defer tx.Rollback()
 
-	return row.Scan(&data.ID)
+	if _, err = tx.ExecContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE;", data.UserID); err != nil {
+		return err
+	}
+
+	if err = checkSeparation(ctx, tx, data.UserID, data.PermissionID); err != nil {
+		return err
+	}
+
+	// Solo se inserta si el usuario y el permiso pertenecen a la organización activa.
+	query := `
+		INSERT INTO user_permissions (user_id, permission_id, granted_by, grantable)
+			SELECT $1::integer, $2::integer, $3::integer, $4::boolean FROM users u
+				INNER JOIN permissions p ON p.id = $2 AND p.org_id = u.org_id
+				WHERE u.id = $1 AND u.org_id = $5
+			RETURNING id;
+	`
+
+	row := tx.QueryRowContext(ctx, query, data.UserID, data.PermissionID, data.GrantedBy, data.Grantable, currentOrg(ctx))
+	if err = row.Scan(&data.ID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, outboxUserPermission("permission.granted", "up.id = $1"), data.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (repository *UsersRepository) RevokePermission(ctx context.Context, id uint) error {
-	query := "DELETE FROM user_permissions WHERE id = $1;"
+	tx, err := repository.Database.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	org := currentOrg(ctx)
+
+	if _, err = tx.ExecContext(ctx, outboxUserPermission("permission.revoked", "up.id = $1 AND p.org_id = $2"), id, org); err != nil {
+		return err
+	}
+
+	query := "DELETE FROM user_permissions up USING permissions p WHERE up.id = $1 AND p.id = up.permission_id AND p.org_id = $2;"
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	if _, err = stmt.ExecContext(ctx, id, org); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (repository *UsersRepository) GetAttributes(ctx context.Context, id uint) (map[string]string, error) {
+	query := "SELECT attributes FROM users WHERE id = $1 AND org_id = $2;"
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, id, currentOrg(ctx))
+
+	var b []byte
+
+	if err := row.Scan(&b); err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{}
+	if err := json.Unmarshal(b, &attributes); err != nil {
+		return nil, err
+	}
+
+	return attributes, nil
+}
+
+func (repository *UsersRepository) UpdateAttributes(ctx context.Context, id uint, attributes map[string]string) error {
+	query := "UPDATE users SET attributes = $1 WHERE id = $2 AND org_id = $3;"
+
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return err
+	}
 
 	stmt, err := repository.Database.Conn.PrepareContext(ctx, query)
 	if err != nil {
@@ -169,6 +276,6 @@ func (repository *UsersRepository) RevokePermission(ctx context.Context, id uint
 
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, id)
+	_, err = stmt.ExecContext(ctx, string(b), id, currentOrg(ctx))
 	return err
 }
@@ -0,0 +1,256 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+type WebhooksRepository struct {
+	Database *database.Database
+}
+
+func affectedOrNoRows(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (repository *WebhooksRepository) Create(ctx context.Context, data *models.WebhookSubscription) error {
+	query := "INSERT INTO webhook_subscriptions (url, secret, event_types, org_id) VALUES ($1, $2, $3, $4) RETURNING id;"
+
+	data.CreatedAt = time.Now()
+
+	row := repository.Database.Conn.QueryRowContext(ctx, query, data.URL, data.Secret, pq.Array(data.EventTypes), currentOrg(ctx))
+
+	return row.Scan(&data.ID)
+}
+
+func (repository *WebhooksRepository) Delete(ctx context.Context, id uint) error {
+	query := "DELETE FROM webhook_subscriptions WHERE id = $1 AND org_id = $2;"
+
+	return affectedOrNoRows(repository.Database.Conn.ExecContext(ctx, query, id, currentOrg(ctx)))
+}
+
+// Crea una entrega pendiente del evento para cada suscripción de la organización que lo escucha y
+// devuelve cuántas creó. Si el evento ya se había encolado no crea entregas nuevas.
+func (repository *WebhooksRepository) Enqueue(ctx context.Context, event *models.WebhookEvent) (int, error) {
+	event.OrgID = currentOrg(ctx)
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (org_id, subscription_id, event_id, event_type, payload)
+			SELECT $1, id, $2, $3, $4 FROM webhook_subscriptions
+			WHERE org_id = $1 AND $3 = ANY(event_types)
+		ON CONFLICT (subscription_id, event_id) DO NOTHING;
+	`
+
+	result, err := repository.Database.Conn.ExecContext(ctx, query, event.OrgID, event.ID, event.Type, string(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+
+	return int(affected), err
+}
+
+func (repository *WebhooksRepository) GetAll(ctx context.Context) ([]models.WebhookSubscription, error) {
+	query := "SELECT id, url, event_types, created_at FROM webhook_subscriptions WHERE org_id = $1 ORDER BY id;"
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var subscriptions []models.WebhookSubscription
+	for rows.Next() {
+		var subscription models.WebhookSubscription
+
+		if err = rows.Scan(&subscription.ID, &subscription.URL, pq.Array(&subscription.EventTypes), &subscription.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, nil
+}
+
+func scanDeliveries(rows *sql.Rows, withSecret bool) ([]models.WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload string
+		var statusCode sql.NullInt64
+		var lastError sql.NullString
+
+		dest := []interface{}{
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.URL,
+			&delivery.EventID,
+			&delivery.EventType,
+			&payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&statusCode,
+			&lastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.DeliveredAt,
+		}
+
+		if withSecret {
+			dest = append(dest, &delivery.Secret)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		delivery.Payload = json.RawMessage(payload)
+		delivery.LastStatusCode = int(statusCode.Int64)
+		delivery.LastError = lastError.String
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+const deliveryColumns = `
+	d.id,
+	d.subscription_id,
+	s.url,
+	d.event_id,
+	d.event_type,
+	d.payload,
+	d.status,
+	d.attempts,
+	d.last_status_code,
+	d.last_error,
+	d.next_attempt_at,
+	d.created_at,
+	d.delivered_at
+`
+
+// Devuelve las últimas entregas de la organización, opcionalmente filtradas por estado.
+func (repository *WebhooksRepository) GetDeliveries(ctx context.Context, status string) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries d
+			INNER JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		WHERE d.org_id = $1 AND ($2 = '' OR d.status = $2)
+		ORDER BY d.id DESC
+		LIMIT 100;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, currentOrg(ctx), status)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows, false)
+}
+
+// Tiempo que una réplica se reserva las entregas que va a enviar. Cubre un lote completo de
+// envíos con su timeout; si la réplica se cae, las entregas vuelven a estar pendientes al vencer.
+const webhookDeliveryLease = "15 minutes"
+
+// Reserva y devuelve las entregas pendientes de todas las organizaciones cuyo siguiente intento ya
+// venció. La reserva mueve el siguiente intento al final del plazo en la misma consulta, y las filas
+// que otra réplica está reservando se saltan, así que cada entrega la envía una sola réplica.
+func (repository *WebhooksRepository) GetDue(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+			SET next_attempt_at = now() + interval '` + webhookDeliveryLease + `'
+			FROM due, webhook_subscriptions s
+			WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING ` + deliveryColumns + `, s.secret;
+	`
+
+	rows, err := repository.Database.Conn.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows, true)
+}
+
+func (repository *WebhooksRepository) MarkDelivered(ctx context.Context, id uint, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+			SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now()
+			WHERE id = $1;
+	`
+
+	_, err := repository.Database.Conn.ExecContext(ctx, query, id, statusCode)
+	return err
+}
+
+// Registra un intento fallido. Sin siguiente intento la entrega pasa a la lista de entregas
+// fallidas.
+func (repository *WebhooksRepository) MarkFailed(ctx context.Context, id uint, statusCode int, reason string, nextAttemptAt *time.Time) error {
+	status := models.WebhookDeliveryPending
+	if nextAttemptAt == nil {
+		status = models.WebhookDeliveryDead
+	}
+
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+			SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4, next_attempt_at = COALESCE($5, next_attempt_at)
+			WHERE id = $1;
+	`
+
+	code := sql.NullInt64{Int64: int64(statusCode), Valid: statusCode != 0}
+
+	_, err := repository.Database.Conn.ExecContext(ctx, query, id, status, code, reason, nextAttemptAt)
+	return err
+}
+
+// Vuelve a dejar pendiente una entrega fallida de la organización, con los intentos reiniciados.
+func (repository *WebhooksRepository) Redeliver(ctx context.Context, id uint) error {
+	query := `
+		UPDATE webhook_deliveries
+			SET status = 'pending', attempts = 0, last_error = NULL, next_attempt_at = now()
+			WHERE id = $1 AND org_id = $2 AND status = 'dead';
+	`
+
+	return affectedOrNoRows(repository.Database.Conn.ExecContext(ctx, query, id, currentOrg(ctx)))
+}
@@ -1,14 +1,25 @@
 package internal
 
 import (
+	"context"
+	"crypto/subtle"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/dsolartec/iam-meli/internal/authcache"
 	"github.com/dsolartec/iam-meli/internal/core/services"
 	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/events"
+	"github.com/dsolartec/iam-meli/internal/notifiers"
+	"github.com/dsolartec/iam-meli/internal/outbox"
+	"github.com/dsolartec/iam-meli/internal/reconciler"
 	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/internal/webhooks"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/cors"
@@ -18,6 +29,61 @@ type Server struct {
 	server *http.Server
 
 	router http.Handler
+
+	audit              interfaces.AuditRepository
+	checkpointInterval time.Duration
+
+	reviews interfaces.ReviewsRepository
+	usage   *repositories.UsageRepository
+	stop    chan struct{}
+
+	broker *events.Broker
+
+	cache *authcache.Cache
+
+	outbox         *outbox.Relay
+	outboxInterval time.Duration
+
+	webhooks         *webhooks.Dispatcher
+	webhooksInterval time.Duration
+
+	reconciler       *reconciler.Reconciler
+	reconcilerConfig reconciler.Config
+}
+
+// metricsHandler une las métricas de los componentes activos en una sola respuesta.
+type metricsHandler []http.Handler
+
+func (handlers metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, handler := range handlers {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// metricsAuth exige el token de las métricas como `Authorization: Bearer <token>`.
+func metricsAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// jwksHandler publica la llave pública con la que se firman los tokens RS256 para que los otros
+// servicios los validen sin conocer `JWT_KEY`.
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	key, _, err := pkg.TokenSigningKey()
+	if err != nil || key == nil {
+		pkg.HTTPError(w, r, http.StatusNotFound, "Los tokens no se firman con RS256")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	pkg.JSON(w, r, http.StatusOK, pkg.Map{"keys": []pkg.JWK{pkg.PublicJWK(&key.PublicKey)}})
 }
 
 func documentationHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,27 +98,92 @@ func documentationHandler(w http.ResponseWriter, r *http.Request) {
 
 func New(db *database.Database, port string) *Server {
 	// Iniciamos los repositorios.
+	usage_repository := repositories.UsageRepository{
+		Database: db,
+	}
+
+	applications_repository := repositories.ApplicationsRepository{
+		Database: db,
+	}
+
+	audit_repository := repositories.AuditRepository{
+		Database: db,
+	}
+
 	auth_repository := repositories.AuthorizationRepository{
 		Database: db,
+		Usage:    &usage_repository,
+	}
+
+	break_glass_repository := repositories.BreakGlassRepository{
+		Database: db,
+	}
+
+	constraints_repository := repositories.ConstraintsRepository{
+		Database: db,
+	}
+
+	denies_repository := repositories.DeniesRepository{
+		Database: db,
+	}
+
+	organizations_repository := repositories.OrganizationsRepository{
+		Database: db,
+	}
+
+	outbox_repository := repositories.OutboxRepository{
+		Database: db,
 	}
 
 	permissions_repository := repositories.PermissionsRepository{
 		Database: db,
 	}
 
+	policies_repository := repositories.PoliciesRepository{
+		Database: db,
+	}
+
+	relations_repository := repositories.RelationsRepository{
+		Database: db,
+	}
+
+	reviews_repository := repositories.ReviewsRepository{
+		Database: db,
+	}
+
+	state_repository := repositories.StateRepository{
+		Database: db,
+	}
+
 	users_repository := repositories.UsersRepository{
 		Database: db,
 	}
 
+	webhooks_repository := repositories.WebhooksRepository{
+		Database: db,
+	}
+
+	notifier := notifiers.New()
+
+	broker := events.NewBroker(&outbox_repository)
+
+	// Caché de permisos efectivos, solo si se configuró su tamaño.
+	cache, cached := authcache.FromEnv()
+	if cached {
+		auth_repository.Cache = cache
+	}
+
 	// Enrutador
 	r := chi.NewRouter()
 
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.AllowAll().Handler)
 
 	r.Get("/", documentationHandler)
-	r.Mount("/api", services.New(&auth_repository, &permissions_repository, &users_repository))
+	r.Get("/.well-known/jwks.json", jwksHandler)
+	r.Mount("/api", services.New(&applications_repository, &audit_repository, &auth_repository, &break_glass_repository, &constraints_repository, &denies_repository, &organizations_repository, &outbox_repository, &permissions_repository, &policies_repository, &relations_repository, &reviews_repository, &state_repository, &users_repository, &webhooks_repository, notifier, broker))
 
 	// Servidor
 	serv := &http.Server{
@@ -62,12 +193,95 @@ func New(db *database.Database, port string) *Server {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	server := Server{server: serv, router: r}
+	server := Server{server: serv, router: r, broker: broker, cache: cache, audit: &audit_repository, checkpointInterval: time.Hour, reviews: &reviews_repository, usage: &usage_repository, stop: make(chan struct{})}
+
+	if interval, err := time.ParseDuration(os.Getenv("AUDIT_CHECKPOINT_INTERVAL")); err == nil && interval > 0 {
+		server.checkpointInterval = interval
+	}
+
+	server.outbox = &outbox.Relay{Outbox: &outbox_repository, Sinks: outbox.SinksFromEnv(&webhooks_repository)}
+	server.outboxInterval, _ = time.ParseDuration(os.Getenv("OUTBOX_INTERVAL"))
+
+	server.webhooks = webhooks.FromEnv(&webhooks_repository)
+	server.webhooksInterval, _ = time.ParseDuration(os.Getenv("WEBHOOK_INTERVAL"))
+
+	metrics := metricsHandler{}
+	if cached {
+		metrics = append(metrics, cache)
+	}
+
+	// Reconciliador del estado deseado, solo si se configuró el archivo.
+	if config, ok := reconciler.ConfigFromEnv(); ok {
+		server.reconcilerConfig = config
+		server.reconciler = &reconciler.Reconciler{
+			Applications: &applications_repository,
+			Auth:         &auth_repository,
+			Constraints:  &constraints_repository,
+			Permissions:  &permissions_repository,
+			State:        &state_repository,
+			Users:        &users_repository,
+			Notifier:     notifier,
+			Metrics:      &reconciler.Metrics{},
+		}
+
+		metrics = append(metrics, server.reconciler.Metrics)
+	}
+
+	// Las métricas solo se exponen a quien presente el token de `METRICS_TOKEN`.
+	if token := os.Getenv("METRICS_TOKEN"); len(metrics) > 0 && token != "" {
+		r.Handle("/metrics", metricsAuth(token, metrics))
+	} else if len(metrics) > 0 {
+		log.Println("Las métricas no se exponen porque no se configuró `METRICS_TOKEN`.")
+	}
 
 	return &server
 }
 
+func (serv *Server) closeExpiredReviews() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-serv.stop:
+			return
+		case <-ticker.C:
+			services.CloseExpiredCampaigns(context.Background(), serv.reviews)
+		}
+	}
+}
+
+func (serv *Server) checkpointAudit() {
+	ticker := time.NewTicker(serv.checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-serv.stop:
+			return
+		case <-ticker.C:
+			services.CheckpointAudit(context.Background(), serv.audit)
+		}
+	}
+}
+
 func (serv *Server) Start() {
+	go serv.closeExpiredReviews()
+	go serv.checkpointAudit()
+	go serv.outbox.Run(serv.outboxInterval, serv.stop)
+	go serv.broker.Run(serv.stop)
+	go events.Listen(os.Getenv("DATABASE_URI"), serv.broker, serv.stop)
+	go serv.webhooks.Run(serv.webhooksInterval, serv.stop)
+	go serv.usage.Run(serv.stop)
+
+	if serv.cache != nil {
+		go authcache.Listen(os.Getenv("DATABASE_URI"), serv.cache, serv.stop)
+	}
+
+	if serv.reconciler != nil {
+		go serv.reconciler.Run(serv.reconcilerConfig, serv.stop)
+	}
+
 	log.Printf("Server running on http://localhost%s", serv.server.Addr)
 	log.Fatal(serv.server.ListenAndServe())
 }
@@ -76,6 +290,13 @@ func (serv *Server) Router() http.Handler {
 	return serv.router
 }
 
+func (serv *Server) Broker() *events.Broker {
+	return serv.broker
+}
+
 func (serv *Server) Close() error {
-	return nil
+	close(serv.stop)
+
+	// Guardamos los usos de permisos que quedaron pendientes.
+	return serv.usage.Flush(context.Background())
 }
@@ -0,0 +1,246 @@
+// Package webhooks envía a los suscriptores las entregas pendientes de los eventos del IAM.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseDelay   = 30 * time.Second
+	DefaultMaxDelay    = 6 * time.Hour
+	DefaultBatchSize   = 50
+	DefaultInterval    = 10 * time.Second
+)
+
+// Encabezados de cada entrega. La firma es el HMAC-SHA256 de `timestamp.cuerpo` con el secreto de
+// la suscripción, así el suscriptor puede descartar entregas repetidas o viejas.
+const (
+	EventHeader     = "X-IAM-Event"
+	DeliveryHeader  = "X-IAM-Delivery"
+	TimestampHeader = "X-IAM-Timestamp"
+	SignatureHeader = "X-IAM-Signature"
+)
+
+type Dispatcher struct {
+	Webhooks interfaces.WebhooksRepository
+
+	// Client envía las entregas. Por defecto es el de NewClient, que no se conecta a direcciones
+	// internas.
+	Client *http.Client
+
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	BatchSize   int
+
+	// Now permite fijar la hora en las pruebas.
+	Now func() time.Time
+}
+
+// FromEnv crea el despachador con `WEBHOOK_MAX_ATTEMPTS` y `WEBHOOK_BASE_DELAY` si se configuraron.
+func FromEnv(webhooks interfaces.WebhooksRepository) *Dispatcher {
+	dispatcher := &Dispatcher{Webhooks: webhooks, Client: NewClient()}
+
+	if attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		dispatcher.MaxAttempts = attempts
+	}
+
+	if delay, err := time.ParseDuration(os.Getenv("WEBHOOK_BASE_DELAY")); err == nil && delay > 0 {
+		dispatcher.BaseDelay = delay
+	}
+
+	return dispatcher
+}
+
+// refuseInternal rechaza la conexión si la dirección ya resuelta es interna. Se verifica al
+// conectarse, y no solo al registrar el webhook, porque el nombre puede resolver a otra dirección
+// después (DNS rebinding) o el suscriptor puede redirigir la entrega.
+func refuseInternal(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || utils.IsInternalIP(ip) {
+		return fmt.Errorf("El webhook apunta a la dirección interna %s", host)
+	}
+
+	return nil
+}
+
+// NewClient crea el cliente HTTP de las entregas. No usa el proxy del entorno para que la
+// verificación de la dirección se haga contra el destino real.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refuseInternal}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
+
+var defaultClient = NewClient()
+
+// Sign devuelve el valor del encabezado `X-IAM-Signature` para un cuerpo y un timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	return "sha256=" + pkg.Sign(secret, append([]byte(timestamp+"."), body...))
+}
+
+func (dispatcher *Dispatcher) now() time.Time {
+	if dispatcher.Now != nil {
+		return dispatcher.Now()
+	}
+
+	return time.Now()
+}
+
+func (dispatcher *Dispatcher) maxAttempts() int {
+	if dispatcher.MaxAttempts > 0 {
+		return dispatcher.MaxAttempts
+	}
+
+	return DefaultMaxAttempts
+}
+
+// Backoff devuelve la espera antes del siguiente intento: se duplica con cada intento fallido
+// hasta el máximo.
+func (dispatcher *Dispatcher) Backoff(attempt int) time.Duration {
+	delay := dispatcher.BaseDelay
+	if delay <= 0 {
+		delay = DefaultBaseDelay
+	}
+
+	max := dispatcher.MaxDelay
+	if max <= 0 {
+		max = DefaultMaxDelay
+	}
+
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
+
+// Deliver envía una entrega y devuelve el estado HTTP de la respuesta. Cualquier estado fuera de
+// 2xx es un error.
+func (dispatcher *Dispatcher) Deliver(ctx context.Context, delivery models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(dispatcher.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(delivery.ID))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	client := dispatcher.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("El webhook respondió con el estado %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// ProcessDue envía las entregas pendientes cuyo intento ya venció y devuelve cuántas se
+// entregaron. Las que fallan se reprograman o, si agotaron los intentos, quedan como fallidas.
+func (dispatcher *Dispatcher) ProcessDue(ctx context.Context) (int, error) {
+	limit := dispatcher.BatchSize
+	if limit <= 0 {
+		limit = DefaultBatchSize
+	}
+
+	deliveries, err := dispatcher.Webhooks.GetDue(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, delivery := range deliveries {
+		statusCode, err := dispatcher.Deliver(ctx, delivery)
+		if err == nil {
+			if err = dispatcher.Webhooks.MarkDelivered(ctx, delivery.ID, statusCode); err != nil {
+				return delivered, err
+			}
+
+			delivered++
+			continue
+		}
+
+		attempt := delivery.Attempts + 1
+
+		var nextAttemptAt *time.Time
+		if attempt < dispatcher.maxAttempts() {
+			next := dispatcher.now().Add(dispatcher.Backoff(attempt))
+			nextAttemptAt = &next
+		}
+
+		if err = dispatcher.Webhooks.MarkFailed(ctx, delivery.ID, statusCode, err.Error(), nextAttemptAt); err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// Run procesa las entregas cada intervalo hasta que se cierre `stop`.
+func (dispatcher *Dispatcher) Run(interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := dispatcher.ProcessDue(context.Background()); err != nil {
+				log.Printf("No se pudieron enviar las entregas de webhooks: %s", err.Error())
+			}
+		}
+	}
+}
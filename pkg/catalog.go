@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// EncodePermissionBits marca en un bitset la posición de cada permiso dentro del catálogo y lo
+// devuelve en base64 (URL, sin relleno).
+func EncodePermissionBits(permissions []string, catalog []string) string {
+	index := map[string]int{}
+	for i, name := range catalog {
+		index[name] = i
+	}
+
+	bits := make([]byte, (len(catalog)+7)/8)
+	for _, name := range permissions {
+		if i, ok := index[name]; ok {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bits)
+}
+
+// DecodePermissionBits devuelve los nombres de los permisos marcados en el bitset.
+func DecodePermissionBits(encoded string, catalog []string) ([]string, error) {
+	bits, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("Los permisos del token no son válidos")
+	}
+
+	if len(bits) > (len(catalog)+7)/8 {
+		return nil, errors.New("Los permisos del token no corresponden al catálogo")
+	}
+
+	permissions := []string{}
+	for i, name := range catalog {
+		if i/8 < len(bits) && bits[i/8]&(1<<(i%8)) != 0 {
+			permissions = append(permissions, name)
+		}
+	}
+
+	return permissions, nil
+}
@@ -6,9 +6,20 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// Perfiles de token que incluyen los permisos del usuario para verificarlos sin consultar el IAM.
+const (
+	TokenProfilePermissions = "permissions"
+	TokenProfileBitset      = "bitset"
+)
+
 type Claim struct {
 	jwt.StandardClaims
-	ID int `json:"id"`
+	ID  int `json:"id"`
+	Org int `json:"org,omitempty"`
+
+	Permissions    []string `json:"permissions,omitempty"`
+	PermissionBits string   `json:"permission_bits,omitempty"`
+	CatalogVersion uint     `json:"catalog_version,omitempty"`
 }
 
 func (claim *Claim) GenerateToken(secret string) (string, error) {
@@ -16,14 +27,35 @@ func (claim *Claim) GenerateToken(secret string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
+// ParseToken valida los tokens HS256 con `secret` y, si se configuró `JWT_PRIVATE_KEY`, los RS256
+// con la llave pública del IAM.
 func ParseToken(tokenString string, secret string) (*Claim, error) {
+	return ParseTokenWithKey(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+			key, kid, err := TokenSigningKey()
+			if err != nil || key == nil || token.Header["kid"] != kid {
+				return nil, errors.New("El token de acceso no es válido")
+			}
+
+			return &key.PublicKey, nil
+		}
+
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("El token de acceso no es válido")
+		}
+
+		return []byte(secret), nil
+	})
+}
+
+// ParseTokenWithKey valida el token con la llave que devuelva `keyFunc`, por ejemplo una llave
+// pública obtenida de un JWKS.
+func ParseTokenWithKey(tokenString string, keyFunc jwt.Keyfunc) (*Claim, error) {
 	if tokenString == "" {
 		return nil, errors.New("El token de acceso no es válido")
 	}
 
-	token, err := jwt.Parse(tokenString, func(*jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+	token, err := jwt.Parse(tokenString, keyFunc)
 
 	if err != nil {
 		return nil, errors.New("El token de acceso no es válido")
@@ -48,5 +80,76 @@ func ParseToken(tokenString string, secret string) (*Claim, error) {
 		return nil, errors.New("El token de acceso no es válido")
 	}
 
-	return &Claim{ID: int(id)}, nil
+	// Los tokens emitidos antes de existir las organizaciones pertenecen a la plataforma.
+	org := 1
+	if iOrg, ok := claim["org"]; ok {
+		fOrg, ok := iOrg.(float64)
+		if !ok || fOrg < 1 {
+			return nil, errors.New("El token de acceso no es válido")
+		}
+
+		org = int(fOrg)
+	}
+
+	parsed := Claim{ID: int(id), Org: org}
+
+	if iPermissions, ok := claim["permissions"]; ok {
+		permissions, ok := iPermissions.([]interface{})
+		if !ok {
+			return nil, errors.New("El token de acceso no es válido")
+		}
+
+		for _, iPermission := range permissions {
+			permission, ok := iPermission.(string)
+			if !ok {
+				return nil, errors.New("El token de acceso no es válido")
+			}
+
+			parsed.Permissions = append(parsed.Permissions, permission)
+		}
+	}
+
+	if iBits, ok := claim["permission_bits"]; ok {
+		if parsed.PermissionBits, ok = iBits.(string); !ok {
+			return nil, errors.New("El token de acceso no es válido")
+		}
+	}
+
+	if iVersion, ok := claim["catalog_version"]; ok {
+		version, ok := iVersion.(float64)
+		if !ok || version < 0 {
+			return nil, errors.New("El token de acceso no es válido")
+		}
+
+		parsed.CatalogVersion = uint(version)
+	}
+
+	if iExpiresAt, ok := claim["exp"].(float64); ok {
+		parsed.ExpiresAt = int64(iExpiresAt)
+	}
+
+	return &parsed, nil
+}
+
+// HasPermission indica si el token incluye el permiso. Con el perfil `bitset` se necesita el
+// catálogo de permisos de la misma versión con la que se emitió el token.
+func (claim *Claim) HasPermission(name string, catalog []string) bool {
+	permissions := claim.Permissions
+
+	if claim.PermissionBits != "" {
+		decoded, err := DecodePermissionBits(claim.PermissionBits, catalog)
+		if err != nil {
+			return false
+		}
+
+		permissions = decoded
+	}
+
+	for _, permission := range permissions {
+		if permission == name {
+			return true
+		}
+	}
+
+	return false
 }
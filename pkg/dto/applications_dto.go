@@ -0,0 +1,6 @@
+package dto
+
+type CreateApplicationBody struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
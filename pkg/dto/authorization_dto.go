@@ -1,6 +1,8 @@
 package dto
 
 type LoginAndSignUpBody struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Organization string `json:"organization,omitempty"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	Profile      string `json:"profile,omitempty"`
 }
@@ -0,0 +1,5 @@
+package dto
+
+type BreakGlassBody struct {
+	Justification string `json:"justification,omitempty"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+type CreateConstraintBody struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	MaxAllowed  int      `json:"max_allowed,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
@@ -0,0 +1,11 @@
+package dto
+
+import "time"
+
+type CreateDenyBody struct {
+	PermissionName string     `json:"permission_name,omitempty"`
+	User           string     `json:"user,omitempty"`
+	ExceptUsers    []string   `json:"except_users,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,6 @@
+package dto
+
+type CreateOrganizationBody struct {
+	Name  string             `json:"name"`
+	Owner LoginAndSignUpBody `json:"owner"`
+}
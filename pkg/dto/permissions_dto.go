@@ -9,3 +9,12 @@ type UpdatePermissionBody struct {
 	Name        string `json:"name,omitempty"`
 	Description string `json:"description,omitempty"`
 }
+
+type CreatePermissionPolicyBody struct {
+	Description string `json:"description,omitempty"`
+	Condition   string `json:"condition,omitempty"`
+}
+
+type PermissionManifestBody struct {
+	Permissions []CreatePermissionBody `json:"permissions"`
+}
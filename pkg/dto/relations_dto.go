@@ -0,0 +1,9 @@
+package dto
+
+type SaveRelationNamespacesBody struct {
+	Config string `json:"config,omitempty"`
+}
+
+type WriteRelationTupleBody struct {
+	Tuple string `json:"tuple,omitempty"`
+}
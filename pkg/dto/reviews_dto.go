@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+type CreateReviewCampaignBody struct {
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Permission  string    `json:"permission,omitempty"`
+	Users       []string  `json:"users,omitempty"`
+	Reviewers   []string  `json:"reviewers,omitempty"`
+	Deadline    time.Time `json:"deadline,omitempty"`
+}
+
+type ReviewDecisionBody struct {
+	Comment string `json:"comment,omitempty"`
+}
@@ -0,0 +1,5 @@
+package dto
+
+type UpdateUserAttributesBody struct {
+	Attributes map[string]string `json:"attributes"`
+}
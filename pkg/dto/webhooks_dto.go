@@ -0,0 +1,7 @@
+package dto
+
+type CreateWebhookBody struct {
+	URL        string   `json:"url,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+	EventTypes []string `json:"event_types,omitempty"`
+}
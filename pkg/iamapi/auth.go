@@ -0,0 +1,42 @@
+package iamapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+)
+
+type Token struct {
+	AccessToken    string     `json:"accessToken"`
+	ID             uint       `json:"id"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	CatalogVersion uint       `json:"catalogVersion,omitempty"`
+}
+
+// Login inicia sesión y, si lo logra, usa el token en las siguientes peticiones del cliente.
+func (client *Client) Login(ctx context.Context, data dto.LoginAndSignUpBody) (Token, error) {
+	var token Token
+
+	if err := client.do(ctx, http.MethodPost, "/api/auth/login", data, &token, true); err != nil {
+		return Token{}, err
+	}
+
+	client.Token = token.AccessToken
+
+	return token, nil
+}
+
+// SignUp registra al usuario y, si lo logra, usa su token en las siguientes peticiones del cliente.
+func (client *Client) SignUp(ctx context.Context, data dto.LoginAndSignUpBody) (Token, error) {
+	var token Token
+
+	if err := client.do(ctx, http.MethodPost, "/api/auth/signup", data, &token, true); err != nil {
+		return Token{}, err
+	}
+
+	client.Token = token.AccessToken
+
+	return token, nil
+}
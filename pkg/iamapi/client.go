@@ -0,0 +1,140 @@
+// Package iamapi es el cliente de la API REST del IAM para los servicios escritos en Go.
+package iamapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+const (
+	DefaultMaxRetries = 2
+	DefaultRetryDelay = 200 * time.Millisecond
+)
+
+// Client llama a la API del IAM en `BaseURL` con el token de `Token`. Las peticiones que se pueden
+// repetir (GET, PUT y DELETE) se reintentan hasta `MaxRetries` veces si falla la conexión o el
+// IAM responde 429 o 5xx, esperando `RetryDelay` y luego el doble en cada intento.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		MaxRetries: DefaultMaxRetries,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient != nil {
+		return client.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func retryable(method string) bool {
+	return method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+}
+
+func (client *Client) send(ctx context.Context, method string, path string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, client.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if client.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+
+	return client.httpClient().Do(req)
+}
+
+// do envía la petición y decodifica la respuesta en `out`. Un 204 deja `out` sin cambios y
+// devuelve ErrNotFound si `required` es verdadero.
+func (client *Client) do(ctx context.Context, method string, path string, in interface{}, out interface{}, required bool) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	delay := client.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		res, err := client.send(ctx, method, path, body)
+
+		retry := err != nil || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+		if !retry || !retryable(method) || attempt >= client.MaxRetries || ctx.Err() != nil {
+			if err != nil {
+				return err
+			}
+
+			defer res.Body.Close()
+
+			return decodeResponse(res, out, required)
+		}
+
+		if res != nil {
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func decodeResponse(res *http.Response, out interface{}, required bool) error {
+	if res.StatusCode == http.StatusNoContent {
+		if required {
+			return &APIError{StatusCode: res.StatusCode, Message: "El recurso no existe"}
+		}
+
+		return nil
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var message pkg.ErrorMessage
+		if err := json.NewDecoder(res.Body).Decode(&message); err != nil || message.Message == "" {
+			message.Message = http.StatusText(res.StatusCode)
+		}
+
+		return &APIError{StatusCode: res.StatusCode, Message: message.Message}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
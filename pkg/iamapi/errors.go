@@ -0,0 +1,54 @@
+package iamapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var (
+	ErrUnauthorized = errors.New("iamapi: el token de acceso no es válido")
+	ErrForbidden    = errors.New("iamapi: no tienes permisos suficientes")
+	ErrNotFound     = errors.New("iamapi: el recurso no existe")
+	ErrConflict     = errors.New("iamapi: el recurso ya existe")
+)
+
+// APIError es una respuesta de error del IAM. Se puede comparar con errors.Is contra
+// ErrUnauthorized, ErrForbidden, ErrNotFound y ErrConflict.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("iamapi: %d %s", err.StatusCode, err.Message)
+}
+
+// La API responde la mayoría de los errores con 400, así que el tipo se deduce del mensaje.
+func (err *APIError) kind() error {
+	switch {
+	case err.StatusCode == http.StatusUnauthorized || err.Message == "El token de acceso no es válido":
+		return ErrUnauthorized
+	case err.StatusCode == http.StatusForbidden,
+		strings.Contains(err.Message, "No tienes permisos suficientes"),
+		strings.HasPrefix(err.Message, models.ErrPermissionDenied.Error()),
+		strings.HasPrefix(err.Message, "No cumples las condiciones"),
+		strings.HasPrefix(err.Message, "No puedes delegar el permiso"),
+		strings.HasPrefix(err.Message, "No puedes otorgar el permiso"),
+		strings.HasPrefix(err.Message, "Tienes asignado el permiso"):
+		return ErrForbidden
+	case err.StatusCode == http.StatusNotFound || err.StatusCode == http.StatusNoContent || strings.HasSuffix(err.Message, "no existe"):
+		return ErrNotFound
+	case err.StatusCode == http.StatusConflict || strings.Contains(err.Message, "ya está en uso") || strings.Contains(err.Message, "ya tiene el permiso asignado"):
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (err *APIError) Is(target error) bool {
+	return target != nil && err.kind() == target
+}
@@ -0,0 +1,54 @@
+package iamapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+func (client *Client) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	var data struct {
+		Permissions []models.Permission `json:"permissions"`
+	}
+
+	if err := client.do(ctx, http.MethodGet, "/api/permissions", nil, &data, false); err != nil {
+		return nil, err
+	}
+
+	return data.Permissions, nil
+}
+
+func (client *Client) GetPermission(ctx context.Context, id uint) (models.Permission, error) {
+	var data struct {
+		Permission models.Permission `json:"permission"`
+	}
+
+	if err := client.do(ctx, http.MethodGet, fmt.Sprintf("/api/permissions/%d", id), nil, &data, true); err != nil {
+		return models.Permission{}, err
+	}
+
+	return data.Permission, nil
+}
+
+func (client *Client) CreatePermission(ctx context.Context, data dto.CreatePermissionBody) (models.Permission, error) {
+	var created struct {
+		Permission models.Permission `json:"permission"`
+	}
+
+	if err := client.do(ctx, http.MethodPost, "/api/permissions", data, &created, true); err != nil {
+		return models.Permission{}, err
+	}
+
+	return created.Permission, nil
+}
+
+func (client *Client) UpdatePermission(ctx context.Context, id uint, data dto.UpdatePermissionBody) error {
+	return client.do(ctx, http.MethodPut, fmt.Sprintf("/api/permissions/%d", id), data, nil, false)
+}
+
+func (client *Client) DeletePermission(ctx context.Context, id uint) error {
+	return client.do(ctx, http.MethodDelete, fmt.Sprintf("/api/permissions/%d", id), nil, nil, false)
+}
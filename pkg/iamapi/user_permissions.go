@@ -0,0 +1,51 @@
+package iamapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type UserPermissions struct {
+	Permissions []models.UserPermission `json:"user_permissions"`
+	Denies      []models.PermissionDeny `json:"denies"`
+}
+
+func userPermissionPath(find string, permission string) string {
+	return userPath(find) + "/permissions/" + url.PathEscape(permission)
+}
+
+// ListUserPermissions devuelve los permisos asignados al usuario y sus denegaciones vigentes.
+func (client *Client) ListUserPermissions(ctx context.Context, find string) (UserPermissions, error) {
+	var data UserPermissions
+
+	if err := client.do(ctx, http.MethodGet, userPath(find)+"/permissions", nil, &data, false); err != nil {
+		return UserPermissions{}, err
+	}
+
+	return data, nil
+}
+
+// GrantPermission asigna el permiso al usuario; con `grantable` el usuario también lo puede delegar.
+func (client *Client) GrantPermission(ctx context.Context, find string, permission string, grantable bool) (models.UserPermission, error) {
+	path := userPermissionPath(find, permission)
+	if grantable {
+		path += "?grantable=true"
+	}
+
+	var data struct {
+		UserPermission models.UserPermission `json:"user_permission"`
+	}
+
+	if err := client.do(ctx, http.MethodPatch, path, nil, &data, true); err != nil {
+		return models.UserPermission{}, err
+	}
+
+	return data.UserPermission, nil
+}
+
+func (client *Client) RevokePermission(ctx context.Context, find string, permission string) error {
+	return client.do(ctx, http.MethodDelete, userPermissionPath(find, permission), nil, nil, false)
+}
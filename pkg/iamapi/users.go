@@ -0,0 +1,59 @@
+package iamapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// Los usuarios se buscan por ID o por nombre de usuario.
+func userPath(find string) string {
+	return "/api/users/" + url.PathEscape(find)
+}
+
+func (client *Client) ListUsers(ctx context.Context) ([]models.User, error) {
+	var data struct {
+		Users []models.User `json:"users"`
+	}
+
+	if err := client.do(ctx, http.MethodGet, "/api/users", nil, &data, false); err != nil {
+		return nil, err
+	}
+
+	return data.Users, nil
+}
+
+func (client *Client) GetUser(ctx context.Context, find string) (models.User, error) {
+	var data struct {
+		User models.User `json:"user"`
+	}
+
+	if err := client.do(ctx, http.MethodGet, userPath(find), nil, &data, true); err != nil {
+		return models.User{}, err
+	}
+
+	return data.User, nil
+}
+
+func (client *Client) DeleteUser(ctx context.Context, find string) error {
+	return client.do(ctx, http.MethodDelete, userPath(find), nil, nil, false)
+}
+
+func (client *Client) GetUserAttributes(ctx context.Context, find string) (map[string]string, error) {
+	var data struct {
+		Attributes map[string]string `json:"attributes"`
+	}
+
+	if err := client.do(ctx, http.MethodGet, userPath(find)+"/attributes", nil, &data, true); err != nil {
+		return nil, err
+	}
+
+	return data.Attributes, nil
+}
+
+func (client *Client) UpdateUserAttributes(ctx context.Context, find string, data dto.UpdateUserAttributesBody) error {
+	return client.do(ctx, http.MethodPut, userPath(find)+"/attributes", data, nil, false)
+}
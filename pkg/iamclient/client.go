@@ -0,0 +1,260 @@
+// Package iamclient permite a los servicios que consumen los tokens del IAM autenticar a sus
+// usuarios y verificar sus permisos, desde el token o consultando al IAM.
+package iamclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const (
+	DefaultCacheTTL  = 30 * time.Second
+	DefaultCacheSize = 10000
+)
+
+type checkKey struct {
+	token      string
+	permission string
+}
+
+type checkResult struct {
+	allowed   bool
+	expiresAt time.Time
+}
+
+type catalogResult struct {
+	catalog   models.PermissionCatalog
+	expiresAt time.Time
+}
+
+// Client verifica los tokens con `Keys` y, si se configura `BaseURL`, consulta al IAM los permisos
+// que no se pueden resolver desde el token. Las respuestas del IAM se guardan `CacheTTL`.
+type Client struct {
+	Keys       Keys
+	BaseURL    string
+	HTTPClient *http.Client
+	CacheTTL   time.Duration
+	CacheSize  int
+
+	mu       sync.Mutex
+	checks   map[checkKey]checkResult
+	catalogs map[int]catalogResult
+}
+
+func New(keys Keys, baseURL string) *Client {
+	return &Client{Keys: keys, BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient != nil {
+		return client.HTTPClient
+	}
+
+	return http.DefaultClient
+}
+
+func (client *Client) cacheTTL() time.Duration {
+	if client.CacheTTL > 0 {
+		return client.CacheTTL
+	}
+
+	return DefaultCacheTTL
+}
+
+// Authenticate valida el token del encabezado `Authorization` y guarda el Principal en el contexto.
+func (client *Client) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			pkg.HTTPError(w, r, http.StatusUnauthorized, "El token de acceso no es válido")
+			return
+		}
+
+		claim, err := pkg.ParseTokenWithKey(parts[1], client.Keys.Key)
+		if err != nil {
+			pkg.HTTPError(w, r, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), newPrincipal(parts[1], claim))))
+	})
+}
+
+// RequirePermission solo deja pasar a los usuarios con el permiso. Se usa después de Authenticate.
+func (client *Client) RequirePermission(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok {
+				pkg.HTTPError(w, r, http.StatusUnauthorized, "El token de acceso no es válido")
+				return
+			}
+
+			allowed, err := client.Check(r.Context(), principal, name)
+			if err != nil {
+				pkg.HTTPError(w, r, http.StatusBadGateway, "No se pudo verificar el permiso")
+				return
+			}
+
+			if !allowed {
+				pkg.HTTPError(w, r, http.StatusForbidden, "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Check busca el permiso en el token y, si no está, se lo pregunta al IAM. Un token sin el permiso
+// no basta para negarlo porque no incluye los permisos con políticas ni los accesos de emergencia.
+func (client *Client) Check(ctx context.Context, principal *Principal, name string) (bool, error) {
+	for _, permission := range principal.Permissions {
+		if permission == name {
+			return true, nil
+		}
+	}
+
+	if principal.PermissionBits != "" && client.BaseURL != "" {
+		catalog, err := client.catalog(ctx, principal)
+		if err != nil {
+			return false, err
+		}
+
+		// Con otra versión del catálogo las posiciones del bitset ya no corresponden.
+		if catalog.Version == principal.CatalogVersion {
+			claim := pkg.Claim{PermissionBits: principal.PermissionBits}
+			if claim.HasPermission(name, catalog.Permissions) {
+				return true, nil
+			}
+		}
+	}
+
+	if client.BaseURL == "" {
+		return false, nil
+	}
+
+	return client.remoteCheck(ctx, principal, name)
+}
+
+func (client *Client) get(ctx context.Context, principal *Principal, path string, data interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", client.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+principal.Token)
+
+	res, err := client.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("El IAM respondió %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(data)
+}
+
+// prune descarta las respuestas vencidas y, si aún se supera el tamaño, todas.
+func (client *Client) prune(now time.Time) {
+	size := client.CacheSize
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	if len(client.checks) < size {
+		return
+	}
+
+	for key, result := range client.checks {
+		if now.After(result.expiresAt) {
+			delete(client.checks, key)
+		}
+	}
+
+	if len(client.checks) >= size {
+		client.checks = map[checkKey]checkResult{}
+	}
+}
+
+func (client *Client) remoteCheck(ctx context.Context, principal *Principal, name string) (bool, error) {
+	key := checkKey{token: principal.Token, permission: name}
+	now := time.Now()
+
+	client.mu.Lock()
+	if result, ok := client.checks[key]; ok && now.Before(result.expiresAt) {
+		client.mu.Unlock()
+		return result.allowed, nil
+	}
+	client.mu.Unlock()
+
+	var data struct {
+		Allowed bool `json:"allowed"`
+	}
+
+	if err := client.get(ctx, principal, "/api/authz/check?permission="+url.QueryEscape(name), &data); err != nil {
+		return false, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.checks == nil {
+		client.checks = map[checkKey]checkResult{}
+	}
+
+	client.prune(now)
+	client.checks[key] = checkResult{allowed: data.Allowed, expiresAt: now.Add(client.cacheTTL())}
+
+	return data.Allowed, nil
+}
+
+func (client *Client) catalog(ctx context.Context, principal *Principal) (models.PermissionCatalog, error) {
+	now := time.Now()
+
+	client.mu.Lock()
+	cached, ok := client.catalogs[principal.Org]
+	client.mu.Unlock()
+
+	// Si el token es más nuevo que el catálogo guardado, este ya cambió.
+	if ok && now.Before(cached.expiresAt) && cached.catalog.Version >= principal.CatalogVersion {
+		return cached.catalog, nil
+	}
+
+	var data struct {
+		Catalog models.PermissionCatalog `json:"catalog"`
+	}
+
+	if err := client.get(ctx, principal, "/api/permissions/catalog", &data); err != nil {
+		return models.PermissionCatalog{}, err
+	}
+
+	if data.Catalog.Version == 0 {
+		return models.PermissionCatalog{}, errors.New("El catálogo de permisos no es válido")
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.catalogs == nil {
+		client.catalogs = map[int]catalogResult{}
+	}
+
+	client.catalogs[principal.Org] = catalogResult{catalog: data.Catalog, expiresAt: now.Add(client.cacheTTL())}
+
+	return data.Catalog, nil
+}
@@ -0,0 +1,178 @@
+package iamclient
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Keys devuelve la llave con la que se valida la firma de un token.
+type Keys interface {
+	Key(token *jwt.Token) (interface{}, error)
+}
+
+type sharedSecret []byte
+
+// SharedSecret valida los tokens firmados con HS256 y el mismo `JWT_KEY` del IAM.
+func SharedSecret(secret string) Keys {
+	return sharedSecret(secret)
+}
+
+func (secret sharedSecret) Key(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, errors.New("El token de acceso no es válido")
+	}
+
+	return []byte(secret), nil
+}
+
+// JWKS valida los tokens firmados con RS256 usando las llaves públicas publicadas en `URL`, por
+// ejemplo `https://iam.example.com/.well-known/jwks.json`. Las llaves se vuelven a descargar
+// cuando llega un `kid` desconocido, como mucho una vez por `RefreshInterval`.
+type JWKS struct {
+	URL             string
+	Client          *http.Client
+	RefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+
+	// refreshing se cierra al terminar la descarga en curso; mientras exista, los tokens con un
+	// `kid` desconocido la esperan en lugar de descargar otra vez.
+	refreshing chan struct{}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// fetch descarga las llaves sin tomar `mu`, para que los tokens con llaves conocidas se sigan
+// validando mientras tanto.
+func (jwks *JWKS) fetch() (map[string]*rsa.PublicKey, error) {
+	client := jwks.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Get(jwks.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("No se pudieron obtener las llaves del JWKS")
+	}
+
+	var data struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range data.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			continue
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			continue
+		}
+
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	return keys, nil
+}
+
+func (jwks *JWKS) lookup(kid string) (*rsa.PublicKey, bool) {
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+
+	key, ok := jwks.keys[kid]
+	return key, ok
+}
+
+func (jwks *JWKS) Key(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("El token de acceso no es válido")
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	jwks.mu.Lock()
+
+	if key, ok := jwks.keys[kid]; ok {
+		jwks.mu.Unlock()
+		return key, nil
+	}
+
+	if refreshing := jwks.refreshing; refreshing != nil {
+		jwks.mu.Unlock()
+		<-refreshing
+
+		if key, ok := jwks.lookup(kid); ok {
+			return key, nil
+		}
+
+		return nil, errors.New("El token de acceso no es válido")
+	}
+
+	interval := jwks.RefreshInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	if jwks.keys != nil && time.Since(jwks.fetchedAt) < interval {
+		jwks.mu.Unlock()
+		return nil, errors.New("El token de acceso no es válido")
+	}
+
+	refreshing := make(chan struct{})
+	jwks.refreshing = refreshing
+	jwks.mu.Unlock()
+
+	keys, err := jwks.fetch()
+
+	jwks.mu.Lock()
+	if err == nil {
+		jwks.keys = keys
+		jwks.fetchedAt = time.Now()
+	}
+
+	jwks.refreshing = nil
+	jwks.mu.Unlock()
+
+	close(refreshing)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := jwks.lookup(kid); ok {
+		return key, nil
+	}
+
+	return nil, errors.New("El token de acceso no es válido")
+}
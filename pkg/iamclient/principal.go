@@ -0,0 +1,49 @@
+package iamclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+type principalKey struct{}
+
+// Principal es el usuario autenticado con el token de acceso del IAM.
+type Principal struct {
+	UserID         int
+	Org            int
+	Permissions    []string
+	PermissionBits string
+	CatalogVersion uint
+	ExpiresAt      time.Time
+
+	// Token se reenvía al IAM para verificar los permisos que no vienen en el token.
+	Token string
+}
+
+func newPrincipal(token string, claim *pkg.Claim) *Principal {
+	principal := Principal{
+		UserID:         claim.ID,
+		Org:            claim.Org,
+		Permissions:    claim.Permissions,
+		PermissionBits: claim.PermissionBits,
+		CatalogVersion: claim.CatalogVersion,
+		Token:          token,
+	}
+
+	if claim.ExpiresAt != 0 {
+		principal.ExpiresAt = time.Unix(claim.ExpiresAt, 0)
+	}
+
+	return &principal
+}
+
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type ApplicationsRepository interface {
+	AddAdmin(ctx context.Context, applicationID uint, userID uint) error
+	Create(ctx context.Context, application *models.Application) error
+	GetAdmins(ctx context.Context, applicationID uint) ([]models.User, error)
+	GetAll(ctx context.Context) ([]models.Application, error)
+	GetByName(ctx context.Context, name string) (models.Application, error)
+	IsAdmin(ctx context.Context, name string, userID uint) (bool, error)
+	RemoveAdmin(ctx context.Context, applicationID uint, userID uint) error
+}
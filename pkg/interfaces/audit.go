@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type AuditRepository interface {
+	Checkpoint(ctx context.Context, key string) (int, error)
+	Create(ctx context.Context, entry *models.AuditEntry) error
+	GetAll(ctx context.Context, filter models.AuditFilter, limit int, offset int) ([]models.AuditEntry, error)
+	Verify(ctx context.Context, key string) (models.AuditVerification, error)
+}
@@ -1,7 +1,14 @@
 package interfaces
 
-import "context"
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
 
 type AuthorizationRepository interface {
+	Explain(ctx context.Context, user models.User, permissionName string) (models.AuthorizationDecision, error)
+	TokenPermissions(ctx context.Context, userID uint) ([]string, error)
+	VerifyDelegation(ctx context.Context, permission models.Permission, grantable bool) error
 	VerifyPermission(ctx context.Context, permissionName string) error
 }
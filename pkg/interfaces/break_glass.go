@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type BreakGlassRepository interface {
+	Create(ctx context.Context, session *models.BreakGlassSession) error
+	GetActive(ctx context.Context, userID uint) (models.BreakGlassSession, error)
+	GetAll(ctx context.Context) ([]models.BreakGlassSession, error)
+}
@@ -0,0 +1,16 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type ConstraintsRepository interface {
+	Create(ctx context.Context, constraint *models.SeparationConstraint) error
+	Delete(ctx context.Context, id uint) error
+	GetAll(ctx context.Context) ([]models.SeparationConstraint, error)
+	GetByID(ctx context.Context, id uint) (models.SeparationConstraint, error)
+	GetByName(ctx context.Context, name string) (models.SeparationConstraint, error)
+	GetViolations(ctx context.Context) ([]models.SeparationViolation, error)
+}
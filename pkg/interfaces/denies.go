@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type DeniesRepository interface {
+	Create(ctx context.Context, deny *models.PermissionDeny) error
+	Delete(ctx context.Context, id uint) error
+	GetActiveByUser(ctx context.Context, userID uint) ([]models.PermissionDeny, error)
+	GetAll(ctx context.Context) ([]models.PermissionDeny, error)
+	GetByID(ctx context.Context, id uint) (models.PermissionDeny, error)
+}
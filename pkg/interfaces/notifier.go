@@ -0,0 +1,11 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type Notifier interface {
+	Notify(ctx context.Context, event models.SecurityEvent) error
+}
@@ -0,0 +1,14 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type OrganizationsRepository interface {
+	Create(ctx context.Context, organization *models.Organization, owner *models.User) error
+	GetAll(ctx context.Context) ([]models.Organization, error)
+	GetByID(ctx context.Context, id uint) (models.Organization, error)
+	GetByName(ctx context.Context, name string) (models.Organization, error)
+}
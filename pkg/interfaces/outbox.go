@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type OutboxRepository interface {
+	GetAllSince(ctx context.Context, after uint64, limit int) ([]models.OutboxEvent, error)
+	GetSince(ctx context.Context, after uint64, until uint64, limit int) ([]models.OutboxEvent, error)
+	LastID(ctx context.Context) (uint64, error)
+	Process(ctx context.Context, limit int, publish func(event models.OutboxEvent) error) (int, error)
+}
+
+// EventSink es un destino al que el relay publica los eventos de la bandeja de salida.
+type EventSink interface {
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "github.com/dsolartec/iam-meli/pkg/models"
+
+type PermissionCache interface {
+	Invalidate(userID uint)
+	Load(userID uint, load func() (*models.EffectivePermissions, error)) (*models.EffectivePermissions, error)
+	Purge()
+}
@@ -2,16 +2,23 @@ package interfaces
 
 import (
 	"context"
+	"time"
 
 	"github.com/dsolartec/iam-meli/pkg/dto"
 	"github.com/dsolartec/iam-meli/pkg/models"
 )
 
 type PermissionsRepository interface {
+	ApplyManifest(ctx context.Context, plan *models.PermissionManifestPlan) error
+	CountHolders(ctx context.Context, id uint) (int, error)
 	Create(ctx context.Context, permission *models.Permission) error
 	Delete(ctx context.Context, id uint) error
 	GetAll(ctx context.Context) ([]models.Permission, error)
+	GetByApplication(ctx context.Context, application string) ([]models.Permission, error)
 	GetByID(ctx context.Context, id uint) (models.Permission, error)
 	GetByName(ctx context.Context, name string) (models.Permission, error)
+	GetCatalog(ctx context.Context) (models.PermissionCatalog, error)
+	GetHolders(ctx context.Context, id uint, limit int, offset int) ([]models.PermissionHolder, error)
+	GetStaleGrants(ctx context.Context, since time.Time) ([]models.StaleGrant, error)
 	Update(ctx context.Context, id uint, permission *dto.UpdatePermissionBody) error
 }
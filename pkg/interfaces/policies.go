@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type PoliciesRepository interface {
+	Create(ctx context.Context, policy *models.PermissionPolicy) error
+	Delete(ctx context.Context, id uint) error
+	GetByPermission(ctx context.Context, permissionID uint) ([]models.PermissionPolicy, error)
+}
@@ -0,0 +1,16 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type RelationsRepository interface {
+	DeleteTuple(ctx context.Context, id uint) error
+	GetNamespaces(ctx context.Context) ([]models.RelationNamespace, error)
+	GetObjectIDs(ctx context.Context, namespace string) ([]string, error)
+	GetTuples(ctx context.Context, namespace string, objectID string, relation string) ([]models.RelationTuple, error)
+	SaveNamespace(ctx context.Context, namespace *models.RelationNamespace) error
+	WriteTuple(ctx context.Context, tuple *models.RelationTuple) error
+}
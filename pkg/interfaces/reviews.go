@@ -0,0 +1,19 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type ReviewsRepository interface {
+	Close(ctx context.Context, id uint) error
+	Create(ctx context.Context, campaign *models.ReviewCampaign) error
+	Decide(ctx context.Context, item *models.ReviewItem) error
+	GetAll(ctx context.Context) ([]models.ReviewCampaign, error)
+	GetByID(ctx context.Context, id uint) (models.ReviewCampaign, error)
+	GetCandidates(ctx context.Context, permissionID *uint, userIDs []int64) ([]models.ReviewItem, error)
+	GetExpired(ctx context.Context) ([]models.ReviewCampaign, error)
+	GetItem(ctx context.Context, campaignID uint, id uint) (models.ReviewItem, error)
+	GetItems(ctx context.Context, campaignID uint, reviewerID *uint) ([]models.ReviewItem, error)
+}
@@ -0,0 +1,13 @@
+package interfaces
+
+import (
+	"context"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type StateRepository interface {
+	ApplyReconcile(ctx context.Context, plan *models.ReconcilePlan) error
+	Export(ctx context.Context, includePasswords bool) (models.StateDocument, error)
+	Import(ctx context.Context, plan *models.StateImportPlan) error
+}
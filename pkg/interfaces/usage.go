@@ -0,0 +1,7 @@
+package interfaces
+
+import "context"
+
+type UsageRecorder interface {
+	Record(ctx context.Context, userID uint, permissionID uint)
+}
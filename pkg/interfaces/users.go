@@ -10,8 +10,10 @@ type UsersRepository interface {
 	Create(ctx context.Context, user *models.User) error
 	Delete(ctx context.Context, id uint) error
 	GetAll(ctx context.Context) ([]models.User, error)
+	GetAttributes(ctx context.Context, id uint) (map[string]string, error)
 	GetByID(ctx context.Context, id uint) (models.User, error)
 	GetByUsername(ctx context.Context, username string, with_password bool) (models.User, error)
+	UpdateAttributes(ctx context.Context, id uint, attributes map[string]string) error
 
 	GetAllUserPermissions(ctx context.Context, userID uint) ([]models.UserPermission, error)
 	GetUserPermission(ctx context.Context, userID uint, permissionID uint) (models.UserPermission, error)
@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"context"
+	"time"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type WebhooksRepository interface {
+	Create(ctx context.Context, subscription *models.WebhookSubscription) error
+	Delete(ctx context.Context, id uint) error
+	Enqueue(ctx context.Context, event *models.WebhookEvent) (int, error)
+	GetAll(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetDeliveries(ctx context.Context, status string) ([]models.WebhookDelivery, error)
+	GetDue(ctx context.Context, limit int) ([]models.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id uint, statusCode int) error
+	MarkFailed(ctx context.Context, id uint, statusCode int, reason string, nextAttemptAt *time.Time) error
+	Redeliver(ctx context.Context, id uint) error
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Application struct {
+	ID          uint      `json:"id,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Admins      []User    `json:"admins,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
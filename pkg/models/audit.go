@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type AuditEntry struct {
+	ID            uint        `json:"id,omitempty"`
+	ActorID       *uint       `json:"actor_id,omitempty"`
+	ActorUsername *string     `json:"actor_username,omitempty"`
+	Action        string      `json:"action"`
+	TargetType    string      `json:"target_type"`
+	TargetID      string      `json:"target_id,omitempty"`
+	TargetName    string      `json:"target_name,omitempty"`
+	Before        interface{} `json:"before,omitempty"`
+	After         interface{} `json:"after,omitempty"`
+	IP            string      `json:"ip,omitempty"`
+	UserAgent     string      `json:"user_agent,omitempty"`
+	RequestID     string      `json:"request_id,omitempty"`
+	CreatedAt     time.Time   `json:"created_at,omitempty"`
+}
+
+// AuditFilter filtra el registro de auditoría; los campos vacíos no filtran.
+type AuditFilter struct {
+	Actor  string
+	Target string
+	Action string
+	From   *time.Time
+	To     *time.Time
+}
+
+type AuditCheckpoint struct {
+	ID          uint      `json:"id,omitempty"`
+	LastEntryID uint      `json:"last_entry_id"`
+	LastHash    string    `json:"last_hash"`
+	Signature   string    `json:"signature"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
+
+// AuditVerification es el resultado de recorrer la cadena de auditoría. Si la cadena está rota,
+// `BrokenAt` indica el primer registro afectado.
+type AuditVerification struct {
+	Valid          bool             `json:"valid"`
+	Entries        int              `json:"entries"`
+	LegacyEntries  int              `json:"legacy_entries,omitempty"`
+	Checkpoints    int              `json:"checkpoints"`
+	LastCheckpoint *AuditCheckpoint `json:"last_checkpoint,omitempty"`
+	BrokenAt       *uint            `json:"broken_at,omitempty"`
+	Reason         string           `json:"reason,omitempty"`
+}
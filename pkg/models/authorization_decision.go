@@ -0,0 +1,19 @@
+package models
+
+type AuthorizationCandidate struct {
+	UserPermissionID uint   `json:"user_permission_id,omitempty"`
+	PermissionID     uint   `json:"permission_id,omitempty"`
+	PermissionName   string `json:"permission_name,omitempty"`
+	Applies          bool   `json:"applies"`
+	Reason           string `json:"reason,omitempty"`
+}
+
+type AuthorizationDecision struct {
+	Subject    User                     `json:"subject"`
+	Permission string                   `json:"permission,omitempty"`
+	Allowed    bool                     `json:"allowed"`
+	Reason     string                   `json:"reason,omitempty"`
+	Candidates []AuthorizationCandidate `json:"candidates"`
+	Policies   []PolicyEvaluation       `json:"policies,omitempty"`
+	Deny       *PermissionDeny          `json:"deny,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type BreakGlassSession struct {
+	ID            uint      `json:"id,omitempty"`
+	UserID        uint      `json:"user_id,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Justification string    `json:"justification,omitempty"`
+	Permissions   []string  `json:"permissions,omitempty"`
+	StartedAt     time.Time `json:"started_at,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type EffectivePermission struct {
+	PermissionID uint
+	Conditions   []PermissionPolicy
+}
+
+// EffectivePermissions reúne lo necesario para autorizar a un usuario sin consultar la base de datos.
+type EffectivePermissions struct {
+	Username    string
+	Attributes  []byte
+	Permissions map[string]EffectivePermission
+	Denies      map[string][]PermissionDeny
+}
+
+// ActiveDeny devuelve la primera denegación vigente del permiso.
+func (effective *EffectivePermissions) ActiveDeny(permissionName string, now time.Time) *PermissionDeny {
+	for _, deny := range effective.Denies[permissionName] {
+		if deny.ExpiresAt == nil || deny.ExpiresAt.After(now) {
+			deny := deny
+			return &deny
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PlatformOrganizationID es la organización dueña de la plataforma, a la que pertenecen el
+// superadministrador y los datos creados antes de existir las organizaciones.
+const PlatformOrganizationID uint = 1
+
+type Organization struct {
+	ID        uint      `json:"id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	OwnerID   *uint     `json:"owner_id,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent es un evento escrito en la bandeja de salida junto con el cambio que lo generó. Los
+// eventos de un mismo agregado (por ejemplo, un usuario) se publican en el orden en que se
+// escribieron. La llave de idempotencia no cambia entre publicaciones, así que los consumidores
+// pueden descartar los eventos repetidos.
+type OutboxEvent struct {
+	ID             uint64          `json:"id,omitempty"`
+	OrgID          uint            `json:"org_id,omitempty"`
+	AggregateType  string          `json:"aggregate_type,omitempty"`
+	AggregateID    string          `json:"aggregate_id,omitempty"`
+	Type           string          `json:"type,omitempty"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	CreatedAt      time.Time       `json:"created_at,omitempty"`
+
+	// Settled indica que el evento es lo bastante viejo para que ya no se confirme otro con un ID
+	// menor; el stream de eventos no avanza más allá de uno que no lo esté.
+	Settled bool `json:"-"`
+}
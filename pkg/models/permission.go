@@ -1,13 +1,28 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type Permission struct {
-	ID          uint      `json:"id,omitempty"`
-	Name        string    `json:"name,omitempty"`
-	Description string    `json:"description,omitempty"`
-	Deletable   bool      `json:"deletable"`
-	Editable    bool      `json:"editable"`
-	CreatedAt   time.Time `json:"created_at,omitempty"`
-	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+	ID           uint       `json:"id,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	Application  string     `json:"application,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Deletable    bool       `json:"deletable"`
+	Editable     bool       `json:"editable"`
+	DeprecatedAt *time.Time `json:"deprecated_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at,omitempty"`
+}
+
+// SplitPermissionName separa un identificador `aplicacion:permiso` en la aplicación y el nombre
+// local; los permisos sin aplicación devuelven una aplicación vacía.
+func SplitPermissionName(name string) (string, string) {
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+
+	return "", name
 }
@@ -0,0 +1,8 @@
+package models
+
+// PermissionCatalog lista los permisos de la organización en el orden que usan los tokens con el
+// perfil `bitset`. La versión cambia cada vez que se crea, renombra o elimina un permiso.
+type PermissionCatalog struct {
+	Version     uint     `json:"version"`
+	Permissions []string `json:"permissions"`
+}
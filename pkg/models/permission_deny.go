@@ -0,0 +1,22 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPermissionDenied es el error de la verificación de permisos cuando el usuario tiene una
+// denegación explícita; se compara con errors.Is y los clientes de la API reconocen su mensaje.
+var ErrPermissionDenied = errors.New("Se te ha denegado explícitamente este permiso")
+
+type PermissionDeny struct {
+	ID             uint       `json:"id,omitempty"`
+	PermissionID   uint       `json:"permission_id,omitempty"`
+	PermissionName string     `json:"permission_name,omitempty"`
+	UserID         *uint      `json:"user_id,omitempty"`
+	ExceptUserIDs  []int64    `json:"except_user_ids,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	CreatedBy      *uint      `json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at,omitempty"`
+}
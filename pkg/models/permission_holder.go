@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type PermissionHolder struct {
+	UserID            uint       `json:"user_id,omitempty"`
+	Username          string     `json:"username,omitempty"`
+	UserPermissionID  *uint      `json:"user_permission_id,omitempty"`
+	Source            string     `json:"source,omitempty"`
+	GrantedBy         *uint      `json:"granted_by,omitempty"`
+	GrantedByUsername *string    `json:"granted_by_username,omitempty"`
+	GrantedAt         *time.Time `json:"granted_at,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+}
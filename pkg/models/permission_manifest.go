@@ -0,0 +1,15 @@
+package models
+
+// PermissionManifestPlan es el resultado de comparar el manifiesto de una aplicación con sus
+// permisos actuales.
+type PermissionManifestPlan struct {
+	Application string       `json:"application"`
+	Create      []Permission `json:"create"`
+	Update      []Permission `json:"update"`
+	Deprecate   []Permission `json:"deprecate"`
+	Unchanged   []string     `json:"unchanged"`
+}
+
+func (plan *PermissionManifestPlan) HasChanges() bool {
+	return len(plan.Create) > 0 || len(plan.Update) > 0 || len(plan.Deprecate) > 0
+}
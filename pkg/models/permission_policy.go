@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type PermissionPolicy struct {
+	ID           uint      `json:"id,omitempty"`
+	PermissionID uint      `json:"permission_id,omitempty"`
+	Description  string    `json:"description,omitempty"`
+	Condition    string    `json:"condition,omitempty"`
+	CreatedAt    time.Time `json:"created_at,omitempty"`
+}
+
+type PolicyEvaluation struct {
+	PolicyID  uint   `json:"policy_id,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Passed    bool   `json:"passed"`
+	Error     string `json:"error,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// DesiredState es el archivo de estado deseado que el reconciliador mantiene aplicado. Los
+// usuarios no se declaran, solo los permisos y a quién se asignan.
+type DesiredState struct {
+	Version     int               `json:"version"`
+	Permissions []StatePermission `json:"permissions"`
+	Grants      []StateGrant      `json:"grants"`
+}
+
+type ReconcilePlan struct {
+	CreatePermissions []StatePermission `json:"create_permissions"`
+	UpdatePermissions []StatePermission `json:"update_permissions"`
+	DeletePermissions []string          `json:"delete_permissions"`
+	CreateGrants      []StateGrant      `json:"create_grants"`
+	UpdateGrants      []StateGrant      `json:"update_grants"`
+	RevokeGrants      []StateGrant      `json:"revoke_grants"`
+	Conflicts         []StateConflict   `json:"conflicts"`
+}
+
+// Drift es la cantidad de diferencias entre el estado deseado y el actual, sin contar los
+// conflictos que el reconciliador no puede resolver.
+func (plan *ReconcilePlan) Drift() int {
+	return len(plan.CreatePermissions) + len(plan.UpdatePermissions) + len(plan.DeletePermissions) + len(plan.CreateGrants) + len(plan.UpdateGrants) + len(plan.RevokeGrants)
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type RelationNamespace struct {
+	Name      string    `json:"name,omitempty"`
+	Config    string    `json:"config,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type RelationTuple struct {
+	ID               uint      `json:"id,omitempty"`
+	Namespace        string    `json:"namespace,omitempty"`
+	ObjectID         string    `json:"object_id,omitempty"`
+	Relation         string    `json:"relation,omitempty"`
+	SubjectNamespace string    `json:"subject_namespace,omitempty"`
+	SubjectObjectID  string    `json:"subject_object_id,omitempty"`
+	SubjectRelation  string    `json:"subject_relation,omitempty"`
+	CreatedAt        time.Time `json:"created_at,omitempty"`
+}
+
+func (tuple *RelationTuple) Object() string {
+	return tuple.Namespace + ":" + tuple.ObjectID
+}
+
+func (tuple *RelationTuple) Subject() string {
+	subject := tuple.SubjectNamespace + ":" + tuple.SubjectObjectID
+	if tuple.SubjectRelation != "" {
+		subject += "#" + tuple.SubjectRelation
+	}
+
+	return subject
+}
+
+func (tuple *RelationTuple) String() string {
+	return tuple.Object() + "#" + tuple.Relation + "@" + tuple.Subject()
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+const (
+	ReviewPending     = "pending"
+	ReviewCertified   = "certified"
+	ReviewRevoked     = "revoked"
+	ReviewAutoRevoked = "auto_revoked"
+
+	CampaignOpen   = "open"
+	CampaignClosed = "closed"
+)
+
+type ReviewCampaign struct {
+	ID           uint         `json:"id,omitempty"`
+	Name         string       `json:"name,omitempty"`
+	Description  string       `json:"description,omitempty"`
+	PermissionID *uint        `json:"permission_id,omitempty"`
+	UserIDs      []int64      `json:"user_ids,omitempty"`
+	ReviewerIDs  []int64      `json:"reviewer_ids,omitempty"`
+	Deadline     time.Time    `json:"deadline,omitempty"`
+	Status       string       `json:"status,omitempty"`
+	CreatedBy    *uint        `json:"created_by,omitempty"`
+	CreatedAt    time.Time    `json:"created_at,omitempty"`
+	ClosedAt     *time.Time   `json:"closed_at,omitempty"`
+	Items        []ReviewItem `json:"items,omitempty"`
+}
+
+func (campaign ReviewCampaign) Expired() bool {
+	return campaign.Status == CampaignOpen && !campaign.Deadline.After(time.Now())
+}
+
+type ReviewItem struct {
+	ID               uint       `json:"id,omitempty"`
+	CampaignID       uint       `json:"campaign_id,omitempty"`
+	UserPermissionID *uint      `json:"user_permission_id,omitempty"`
+	UserID           uint       `json:"user_id,omitempty"`
+	Username         string     `json:"username,omitempty"`
+	PermissionID     uint       `json:"permission_id,omitempty"`
+	PermissionName   string     `json:"permission_name,omitempty"`
+	ReviewerID       uint       `json:"reviewer_id,omitempty"`
+	ReviewerUsername string     `json:"reviewer_username,omitempty"`
+	Decision         string     `json:"decision,omitempty"`
+	Comment          string     `json:"comment,omitempty"`
+	DecidedAt        *time.Time `json:"decided_at,omitempty"`
+}
+
+type ReviewReport struct {
+	Campaign    ReviewCampaign `json:"campaign"`
+	Summary     map[string]int `json:"summary"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type SecurityEvent struct {
+	Type      string                 `json:"type,omitempty"`
+	Severity  string                 `json:"severity,omitempty"`
+	UserID    uint                   `json:"user_id,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at,omitempty"`
+}
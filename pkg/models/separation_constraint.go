@@ -0,0 +1,28 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSeparationBreached es el error de una asignación que violaría una restricción de separación de
+// funciones; el mensaje termina con el nombre de la restricción.
+var ErrSeparationBreached = errors.New("No se puede otorgar el permiso porque viola la restricción de separación de funciones")
+
+type SeparationConstraint struct {
+	ID            uint      `json:"id,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	MaxAllowed    int       `json:"max_allowed,omitempty"`
+	PermissionIDs []int64   `json:"permission_ids,omitempty"`
+	Permissions   []string  `json:"permissions,omitempty"`
+	CreatedAt     time.Time `json:"created_at,omitempty"`
+}
+
+type SeparationViolation struct {
+	ConstraintID   uint     `json:"constraint_id,omitempty"`
+	ConstraintName string   `json:"constraint_name,omitempty"`
+	UserID         uint     `json:"user_id,omitempty"`
+	Username       string   `json:"username,omitempty"`
+	Permissions    []string `json:"permissions,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type StaleGrant struct {
+	UserPermissionID uint       `json:"user_permission_id,omitempty"`
+	UserID           uint       `json:"user_id,omitempty"`
+	Username         string     `json:"username,omitempty"`
+	PermissionID     uint       `json:"permission_id,omitempty"`
+	PermissionName   string     `json:"permission_name,omitempty"`
+	GrantedAt        *time.Time `json:"granted_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// StateVersion es la versión del formato de exportación; los documentos de otras versiones se
+// rechazan al importarlos.
+const StateVersion = 1
+
+type StateDocument struct {
+	Version     int               `json:"version"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	Users       []StateUser       `json:"users"`
+	Permissions []StatePermission `json:"permissions"`
+	Grants      []StateGrant      `json:"grants"`
+}
+
+type StateUser struct {
+	Username   string            `json:"username"`
+	Password   string            `json:"password,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type StatePermission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Deletable   bool   `json:"deletable"`
+	Editable    bool   `json:"editable"`
+}
+
+type StateGrant struct {
+	Username   string `json:"username"`
+	Permission string `json:"permission"`
+	Grantable  bool   `json:"grantable,omitempty"`
+}
+
+type StateConflict struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// StateImportPlan contiene los cambios que aplicará una importación. Los elementos en conflicto no
+// se aplican y se reportan para que se resuelvan a mano.
+type StateImportPlan struct {
+	CreateUsers       []StateUser       `json:"create_users"`
+	CreatePermissions []StatePermission `json:"create_permissions"`
+	UpdatePermissions []StatePermission `json:"update_permissions"`
+	CreateGrants      []StateGrant      `json:"create_grants"`
+	UpdateGrants      []StateGrant      `json:"update_grants"`
+	Unchanged         int               `json:"unchanged"`
+	Conflicts         []StateConflict   `json:"conflicts"`
+}
+
+func (plan *StateImportPlan) HasChanges() bool {
+	return len(plan.CreateUsers) > 0 || len(plan.CreatePermissions) > 0 || len(plan.UpdatePermissions) > 0 || len(plan.CreateGrants) > 0 || len(plan.UpdateGrants) > 0
+}
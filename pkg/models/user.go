@@ -7,10 +7,11 @@ import (
 )
 
 type User struct {
-	ID        uint      `json:"id,omitempty"`
-	Username  string    `json:"username,omitempty"`
-	Password  string    `json:"password,omitempty"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID         uint              `json:"id,omitempty"`
+	Username   string            `json:"username,omitempty"`
+	Password   string            `json:"password,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	CreatedAt  time.Time         `json:"created_at,omitempty"`
 }
 
 func (u *User) EncryptPassword() error {
@@ -5,4 +5,7 @@ type UserPermission struct {
 	UserID         uint   `json:"user_id,omitempty"`
 	PermissionID   uint   `json:"permission_id,omitempty"`
 	PermissionName string `json:"permission_name,omitempty"`
+	GrantedBy      *uint  `json:"granted_by,omitempty"`
+	Grantable      bool   `json:"grantable,omitempty"`
+	Denied         bool   `json:"denied,omitempty"`
 }
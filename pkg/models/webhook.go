@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Eventos a los que se puede suscribir un webhook.
+const (
+	WebhookUserDeleted       = "user.deleted"
+	WebhookPermissionGranted = "permission.granted"
+	WebhookPermissionRevoked = "permission.revoked"
+	WebhookPermissionUpdated = "permission.updated"
+)
+
+var WebhookEventTypes = []string{WebhookUserDeleted, WebhookPermissionGranted, WebhookPermissionRevoked, WebhookPermissionUpdated}
+
+// Estados de una entrega.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+type WebhookSubscription struct {
+	ID         uint      `json:"id,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	EventTypes []string  `json:"event_types,omitempty"`
+	CreatedAt  time.Time `json:"created_at,omitempty"`
+}
+
+// WebhookEvent es el cuerpo que recibe el suscriptor.
+type WebhookEvent struct {
+	ID        string                 `json:"id,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	OrgID     uint                   `json:"org_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uint            `json:"id,omitempty"`
+	SubscriptionID uint            `json:"subscription_id,omitempty"`
+	URL            string          `json:"url,omitempty"`
+	Secret         string          `json:"-"`
+	EventID        string          `json:"event_id,omitempty"`
+	EventType      string          `json:"event_type,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	Status         string          `json:"status,omitempty"`
+	Attempts       int             `json:"attempts,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,86 @@
+package policies
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Context struct {
+	Subject  map[string]interface{}
+	Request  map[string]interface{}
+	Resource map[string]interface{}
+}
+
+func NewSubject(id uint, username string, attributes map[string]string) map[string]interface{} {
+	values := map[string]interface{}{}
+	for key, value := range attributes {
+		values[key] = value
+	}
+
+	return map[string]interface{}{"id": int64(id), "username": username, "attributes": values}
+}
+
+func NewRequest(ip string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"ip":      ip,
+		"hour":    int64(now.Hour()),
+		"weekday": strings.ToLower(now.Weekday().String()),
+	}
+}
+
+func WithResource(ctx context.Context, attributes map[string]interface{}) context.Context {
+	return context.WithValue(ctx, "resource_attributes", attributes)
+}
+
+// ResourceLoader obtiene los atributos del recurso sobre el que se actúa.
+type ResourceLoader func() (map[string]interface{}, error)
+
+// WithResourceLoader permite verificar el permiso antes de buscar el recurso: el loader solo se
+// llama si el permiso tiene políticas que evaluar.
+func WithResourceLoader(ctx context.Context, loader ResourceLoader) context.Context {
+	return context.WithValue(ctx, "resource_loader", loader)
+}
+
+// ResourceFromQuery toma los atributos del recurso de los parámetros `resource.*` de la URL,
+// como números si lo son y si no como textos.
+func ResourceFromQuery(query url.Values) map[string]interface{} {
+	resource := map[string]interface{}{}
+	for key, values := range query {
+		if !strings.HasPrefix(key, "resource.") || len(values) == 0 {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, "resource.")
+		if number, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+			resource[name] = number
+		} else {
+			resource[name] = values[0]
+		}
+	}
+
+	return resource
+}
+
+// FromContext arma el contexto de evaluación con los datos de la petición que
+// el middleware de autenticación y los servicios dejan en ctx.
+func FromContext(ctx context.Context, subject map[string]interface{}) Context {
+	ip, _ := ctx.Value("request_ip").(string)
+
+	resource, ok := ctx.Value("resource_attributes").(map[string]interface{})
+	if loader, hasLoader := ctx.Value("resource_loader").(ResourceLoader); !ok && hasLoader {
+		resource, _ = loader()
+	}
+
+	if resource == nil {
+		resource = map[string]interface{}{}
+	}
+
+	return Context{
+		Subject:  subject,
+		Request:  NewRequest(ip, time.Now()),
+		Resource: resource,
+	}
+}
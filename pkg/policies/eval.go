@@ -0,0 +1,211 @@
+package policies
+
+import (
+	"fmt"
+	"strings"
+)
+
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	}
+
+	return value
+}
+
+func (program *Program) Evaluate(ctx Context) (bool, error) {
+	value, err := evaluate(program.root, ctx)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("La condición devolvió %v en lugar de un booleano", value)
+	}
+
+	return result, nil
+}
+
+func evaluate(n node, ctx Context) (interface{}, error) {
+	switch n := n.(type) {
+	case *literalNode:
+		return n.value, nil
+	case *listNode:
+		items := make([]interface{}, len(n.items))
+		for i, item := range n.items {
+			value, err := evaluate(item, ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = value
+		}
+
+		return items, nil
+	case *pathNode:
+		var current interface{}
+
+		switch n.path[0] {
+		case "subject":
+			current = ctx.Subject
+		case "request":
+			current = ctx.Request
+		case "resource":
+			current = ctx.Resource
+		}
+
+		for _, field := range n.path[1:] {
+			values, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("El atributo `%s` no existe en el contexto", strings.Join(n.path, "."))
+			}
+
+			if current, ok = values[field]; !ok {
+				return nil, fmt.Errorf("El atributo `%s` no existe en el contexto", strings.Join(n.path, "."))
+			}
+		}
+
+		return normalize(current), nil
+	case *unaryNode:
+		value, err := evaluate(n.operand, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("El operador `!` requiere un booleano, no %v", value)
+		}
+
+		return !b, nil
+	case *binaryNode:
+		return evaluateBinary(n, ctx)
+	case *callNode:
+		fn := functions[n.name]
+
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			value, err := evaluate(arg, ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("El argumento %d de la función `%s` debe ser texto", i+1, n.name)
+			}
+
+			args[i] = value
+		}
+
+		return fn.call(args)
+	}
+
+	return nil, fmt.Errorf("La condición no es válida")
+}
+
+func evaluateBinary(n *binaryNode, ctx Context) (interface{}, error) {
+	left, err := evaluate(n.left, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Los operadores lógicos se evalúan en cortocircuito.
+	if n.operator == "&&" || n.operator == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("El operador `%s` requiere booleanos", n.operator)
+		}
+
+		if (n.operator == "&&" && !l) || (n.operator == "||" && l) {
+			return l, nil
+		}
+
+		right, err := evaluate(n.right, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("El operador `%s` requiere booleanos", n.operator)
+		}
+
+		return r, nil
+	}
+
+	right, err := evaluate(n.right, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.operator {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		items, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("El operador `in` requiere una lista")
+		}
+
+		for _, item := range items {
+			if equal(item, left) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	switch l := left.(type) {
+	case int64:
+		if r, ok := right.(int64); ok {
+			return compare(n.operator, l < r, l == r), nil
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return compare(n.operator, l < r, l == r), nil
+		}
+	}
+
+	return nil, fmt.Errorf("No se puede comparar %v con %v usando `%s`", left, right, n.operator)
+}
+
+// equal solo compara valores escalares para no entrar en pánico con listas o
+// mapas provenientes del contexto.
+func equal(a interface{}, b interface{}) bool {
+	switch a.(type) {
+	case bool, int64, string:
+		return a == b
+	}
+
+	return false
+}
+
+func compare(operator string, less bool, equal bool) bool {
+	switch operator {
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	}
+
+	return !less
+}
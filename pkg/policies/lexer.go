@@ -0,0 +1,108 @@
+package policies
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenComma
+	tokenDot
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokenLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokenRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case c == '.':
+			tokens = append(tokens, token{tokenDot, ".", i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(input[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("Posición %d: la cadena de texto no fue cerrada", i)
+			}
+
+			tokens = append(tokens, token{tokenString, input[i+1 : i+1+end], i})
+			i += end + 2
+		case isDigit(input[i]):
+			start := i
+			for i < len(input) && isDigit(input[i]) {
+				i++
+			}
+
+			tokens = append(tokens, token{tokenNumber, input[start:i], start})
+		case isLetter(input[i]):
+			start := i
+			for i < len(input) && (isLetter(input[i]) || isDigit(input[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{tokenIdent, input[start:i], start})
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(input[i:], operator) {
+					tokens = append(tokens, token{tokenOperator, operator, i})
+					i += len(operator)
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, fmt.Errorf("Posición %d: carácter `%c` no permitido", i, c)
+			}
+		}
+	}
+
+	return append(tokens, token{tokenEOF, "", len(input)}), nil
+}
@@ -0,0 +1,281 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	MaxConditionLength = 500
+	maxDepth           = 32
+)
+
+type node interface{}
+
+type literalNode struct {
+	value interface{}
+}
+
+type listNode struct {
+	items []node
+}
+
+type pathNode struct {
+	path []string
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+type binaryNode struct {
+	operator string
+	left     node
+	right    node
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	t := p.next()
+	if t.kind != kind {
+		return fmt.Errorf("Posición %d: se esperaba `%s`", t.pos, value)
+	}
+
+	return nil
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return errors.New("La condición tiene demasiados niveles de anidación")
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+
+	defer func() { p.depth-- }()
+
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOperator && p.peek().value == "||" {
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{operator: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOperator && p.peek().value == "&&" {
+		p.next()
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &binaryNode{operator: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if t := p.peek(); t.kind == tokenOperator && t.value == "!" {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+
+		defer func() { p.depth-- }()
+
+		p.next()
+
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &unaryNode{operator: "!", operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+
+	isComparison := t.kind == tokenOperator && t.value != "&&" && t.value != "||" && t.value != "!"
+	if !isComparison && !(t.kind == tokenIdent && t.value == "in") {
+		return left, nil
+	}
+
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &binaryNode{operator: t.value, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Posición %d: el número `%s` no es válido", t.pos, t.value)
+		}
+
+		return &literalNode{value: value}, nil
+	case tokenString:
+		return &literalNode{value: t.value}, nil
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err = p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+
+		return expr, nil
+	case tokenLBracket:
+		list := &listNode{}
+
+		if p.peek().kind == tokenRBracket {
+			p.next()
+			return list, nil
+		}
+
+		for {
+			item, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+
+			list.items = append(list.items, item)
+
+			if p.peek().kind == tokenComma {
+				p.next()
+				continue
+			}
+
+			if err = p.expect(tokenRBracket, "]"); err != nil {
+				return nil, err
+			}
+
+			return list, nil
+		}
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "in":
+			return nil, fmt.Errorf("Posición %d: `in` inesperado", t.pos)
+		}
+
+		if p.peek().kind == tokenLParen {
+			p.next()
+
+			call := &callNode{name: t.value}
+
+			if p.peek().kind == tokenRParen {
+				p.next()
+				return call, nil
+			}
+
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+
+				call.args = append(call.args, arg)
+
+				if p.peek().kind == tokenComma {
+					p.next()
+					continue
+				}
+
+				if err = p.expect(tokenRParen, ")"); err != nil {
+					return nil, err
+				}
+
+				return call, nil
+			}
+		}
+
+		path := &pathNode{path: []string{t.value}}
+		for p.peek().kind == tokenDot {
+			p.next()
+
+			field := p.next()
+			if field.kind != tokenIdent {
+				return nil, fmt.Errorf("Posición %d: se esperaba el nombre de un atributo", field.pos)
+			}
+
+			path.path = append(path.path, field.value)
+		}
+
+		return path, nil
+	case tokenEOF:
+		return nil, errors.New("La condición está incompleta")
+	}
+
+	return nil, fmt.Errorf("Posición %d: `%s` inesperado", t.pos, t.value)
+}
@@ -0,0 +1,251 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type valueType int
+
+const (
+	typeAny valueType = iota
+	typeBool
+	typeInt
+	typeString
+	typeList
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typeBool:
+		return "booleano"
+	case typeInt:
+		return "número"
+	case typeString:
+		return "texto"
+	case typeList:
+		return "lista"
+	}
+
+	return "cualquiera"
+}
+
+// Atributos conocidos de cada raíz del contexto, `resource` acepta cualquiera.
+var schema = map[string]map[string]valueType{
+	"subject": {"id": typeInt, "username": typeString, "attributes": typeAny},
+	"request": {"ip": typeString, "hour": typeInt, "weekday": typeString},
+}
+
+type function struct {
+	args     []valueType
+	validate func(args []node) error
+	call     func(args []interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"ip_in_range": {
+		args: []valueType{typeString, typeString},
+		validate: func(args []node) error {
+			if literal, ok := args[1].(*literalNode); ok {
+				if _, _, err := net.ParseCIDR(fmt.Sprint(literal.value)); err != nil {
+					return fmt.Errorf("El rango `%v` no es un CIDR válido", literal.value)
+				}
+			}
+
+			return nil
+		},
+		call: func(args []interface{}) (interface{}, error) {
+			_, network, err := net.ParseCIDR(args[1].(string))
+			if err != nil {
+				return nil, fmt.Errorf("El rango `%s` no es un CIDR válido", args[1])
+			}
+
+			ip := net.ParseIP(args[0].(string))
+
+			return ip != nil && network.Contains(ip), nil
+		},
+	},
+	"starts_with": {
+		args: []valueType{typeString, typeString},
+		call: func(args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(args[0].(string), args[1].(string)), nil
+		},
+	},
+}
+
+type Program struct {
+	Source string
+	root   node
+}
+
+// Compile interpreta y valida una condición sin evaluarla, de forma que los
+// errores se reporten al guardar la política y no al verificar un permiso.
+func Compile(source string) (*Program, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, errors.New("Debes ingresar la condición de la política")
+	}
+
+	if len(source) > MaxConditionLength {
+		return nil, fmt.Errorf("La condición no puede tener más de %d caracteres", MaxConditionLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("Posición %d: `%s` inesperado", t.pos, t.value)
+	}
+
+	result, err := check(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if result != typeBool && result != typeAny {
+		return nil, fmt.Errorf("La condición debe ser booleana, no %s", result)
+	}
+
+	return &Program{Source: source, root: root}, nil
+}
+
+func compatible(a valueType, b valueType) bool {
+	return a == typeAny || b == typeAny || a == b
+}
+
+func check(n node) (valueType, error) {
+	switch n := n.(type) {
+	case *literalNode:
+		switch n.value.(type) {
+		case bool:
+			return typeBool, nil
+		case int64:
+			return typeInt, nil
+		}
+
+		return typeString, nil
+	case *listNode:
+		for _, item := range n.items {
+			if _, err := check(item); err != nil {
+				return typeAny, err
+			}
+		}
+
+		return typeList, nil
+	case *pathNode:
+		root := n.path[0]
+
+		if root != "subject" && root != "request" && root != "resource" {
+			return typeAny, fmt.Errorf("El atributo `%s` no existe, usa subject, request o resource", strings.Join(n.path, "."))
+		}
+
+		if len(n.path) == 1 {
+			return typeAny, fmt.Errorf("Debes indicar un atributo de `%s`", root)
+		}
+
+		if root == "resource" {
+			return typeAny, nil
+		}
+
+		fieldType, ok := schema[root][n.path[1]]
+		if !ok {
+			return typeAny, fmt.Errorf("El atributo `%s` no existe", strings.Join(n.path, "."))
+		}
+
+		if n.path[1] == "attributes" {
+			if len(n.path) != 3 {
+				return typeAny, errors.New("Debes indicar un único atributo de `subject.attributes`")
+			}
+
+			return typeString, nil
+		}
+
+		if len(n.path) > 2 {
+			return typeAny, fmt.Errorf("El atributo `%s` no existe", strings.Join(n.path, "."))
+		}
+
+		return fieldType, nil
+	case *unaryNode:
+		operand, err := check(n.operand)
+		if err != nil {
+			return typeAny, err
+		}
+
+		if !compatible(operand, typeBool) {
+			return typeAny, fmt.Errorf("El operador `!` requiere un booleano, no %s", operand)
+		}
+
+		return typeBool, nil
+	case *binaryNode:
+		left, err := check(n.left)
+		if err != nil {
+			return typeAny, err
+		}
+
+		right, err := check(n.right)
+		if err != nil {
+			return typeAny, err
+		}
+
+		switch n.operator {
+		case "&&", "||":
+			if !compatible(left, typeBool) || !compatible(right, typeBool) {
+				return typeAny, fmt.Errorf("El operador `%s` requiere booleanos", n.operator)
+			}
+		case "==", "!=":
+			if !compatible(left, right) || left == typeList || right == typeList {
+				return typeAny, fmt.Errorf("No se puede comparar %s con %s", left, right)
+			}
+		case "<", "<=", ">", ">=":
+			if !compatible(left, right) || left == typeBool || left == typeList || right == typeBool || right == typeList {
+				return typeAny, fmt.Errorf("El operador `%s` requiere números o textos del mismo tipo", n.operator)
+			}
+		case "in":
+			if !compatible(right, typeList) {
+				return typeAny, errors.New("El operador `in` requiere una lista")
+			}
+		}
+
+		return typeBool, nil
+	case *callNode:
+		fn, ok := functions[n.name]
+		if !ok {
+			return typeAny, fmt.Errorf("La función `%s` no existe", n.name)
+		}
+
+		if len(n.args) != len(fn.args) {
+			return typeAny, fmt.Errorf("La función `%s` recibe %d argumentos", n.name, len(fn.args))
+		}
+
+		for i, arg := range n.args {
+			argType, err := check(arg)
+			if err != nil {
+				return typeAny, err
+			}
+
+			if !compatible(argType, fn.args[i]) {
+				return typeAny, fmt.Errorf("El argumento %d de la función `%s` debe ser %s", i+1, n.name, fn.args[i])
+			}
+		}
+
+		if fn.validate != nil {
+			if err := fn.validate(n.args); err != nil {
+				return typeAny, err
+			}
+		}
+
+		return typeBool, nil
+	}
+
+	return typeAny, errors.New("La condición no es válida")
+}
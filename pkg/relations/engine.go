@@ -0,0 +1,246 @@
+package relations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const MaxDepth = 25
+
+type TupleReader interface {
+	GetObjectIDs(ctx context.Context, namespace string) ([]string, error)
+	GetTuples(ctx context.Context, namespace string, objectID string, relation string) ([]models.RelationTuple, error)
+}
+
+type Node struct {
+	Type     string   `json:"type"`
+	Userset  string   `json:"userset"`
+	Subjects []string `json:"subjects,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+type Engine struct {
+	Namespaces []Namespace
+	Tuples     TupleReader
+}
+
+type subject struct {
+	namespace string
+	objectID  string
+	relation  string
+}
+
+var errMaxDepth = errors.New("Se superó la profundidad máxima de evaluación de las relaciones")
+
+func (engine *Engine) relation(namespace string, name string) (Relation, bool) {
+	for _, ns := range engine.Namespaces {
+		if ns.Name == namespace {
+			return ns.Relation(name)
+		}
+	}
+
+	return Relation{}, false
+}
+
+func (engine *Engine) Validate(namespace string, relation string) error {
+	if _, ok := engine.relation(namespace, relation); !ok {
+		return fmt.Errorf("La relación %s#%s no está definida", namespace, relation)
+	}
+
+	return nil
+}
+
+func (engine *Engine) Check(ctx context.Context, object string, relation string, subjectStr string) (bool, error) {
+	namespace, objectID, err := ParseObject(object)
+	if err != nil {
+		return false, err
+	}
+
+	if err = engine.Validate(namespace, relation); err != nil {
+		return false, err
+	}
+
+	subjectNamespace, subjectObjectID, subjectRelation, err := ParseSubject(subjectStr)
+	if err != nil {
+		return false, err
+	}
+
+	return engine.check(ctx, namespace, objectID, relation, subject{subjectNamespace, subjectObjectID, subjectRelation}, 0)
+}
+
+func (engine *Engine) check(ctx context.Context, namespace string, objectID string, name string, target subject, depth int) (bool, error) {
+	if depth > MaxDepth {
+		return false, errMaxDepth
+	}
+
+	if target == (subject{namespace, objectID, name}) {
+		return true, nil
+	}
+
+	relation, ok := engine.relation(namespace, name)
+	if !ok {
+		return false, nil
+	}
+
+	for _, userset := range relation.Rewrite {
+		switch userset.Type {
+		case UsersetThis:
+			tuples, err := engine.Tuples.GetTuples(ctx, namespace, objectID, name)
+			if err != nil {
+				return false, err
+			}
+
+			for _, tuple := range tuples {
+				if target == (subject{tuple.SubjectNamespace, tuple.SubjectObjectID, tuple.SubjectRelation}) {
+					return true, nil
+				}
+
+				if tuple.SubjectRelation == "" {
+					continue
+				}
+
+				allowed, err := engine.check(ctx, tuple.SubjectNamespace, tuple.SubjectObjectID, tuple.SubjectRelation, target, depth+1)
+				if err != nil || allowed {
+					return allowed, err
+				}
+			}
+		case UsersetComputed:
+			allowed, err := engine.check(ctx, namespace, objectID, userset.Relation, target, depth+1)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		case UsersetTupleToUserset:
+			tuples, err := engine.Tuples.GetTuples(ctx, namespace, objectID, userset.Tupleset)
+			if err != nil {
+				return false, err
+			}
+
+			for _, tuple := range tuples {
+				allowed, err := engine.check(ctx, tuple.SubjectNamespace, tuple.SubjectObjectID, userset.Relation, target, depth+1)
+				if err != nil || allowed {
+					return allowed, err
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func (engine *Engine) Expand(ctx context.Context, object string, relation string) (*Node, error) {
+	namespace, objectID, err := ParseObject(object)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = engine.Validate(namespace, relation); err != nil {
+		return nil, err
+	}
+
+	return engine.expand(ctx, namespace, objectID, relation, 0)
+}
+
+func (engine *Engine) expand(ctx context.Context, namespace string, objectID string, name string, depth int) (*Node, error) {
+	if depth > MaxDepth {
+		return nil, errMaxDepth
+	}
+
+	userset := namespace + ":" + objectID + "#" + name
+	root := &Node{Type: UsersetUnion, Userset: userset}
+
+	relation, ok := engine.relation(namespace, name)
+	if !ok {
+		return root, nil
+	}
+
+	for _, rewrite := range relation.Rewrite {
+		switch rewrite.Type {
+		case UsersetThis:
+			tuples, err := engine.Tuples.GetTuples(ctx, namespace, objectID, name)
+			if err != nil {
+				return nil, err
+			}
+
+			node := &Node{Type: UsersetThis, Userset: userset}
+			for _, tuple := range tuples {
+				node.Subjects = append(node.Subjects, tuple.Subject())
+
+				if tuple.SubjectRelation == "" {
+					continue
+				}
+
+				child, err := engine.expand(ctx, tuple.SubjectNamespace, tuple.SubjectObjectID, tuple.SubjectRelation, depth+1)
+				if err != nil {
+					return nil, err
+				}
+
+				node.Children = append(node.Children, child)
+			}
+
+			root.Children = append(root.Children, node)
+		case UsersetComputed:
+			child, err := engine.expand(ctx, namespace, objectID, rewrite.Relation, depth+1)
+			if err != nil {
+				return nil, err
+			}
+
+			root.Children = append(root.Children, &Node{Type: UsersetComputed, Userset: userset, Children: []*Node{child}})
+		case UsersetTupleToUserset:
+			tuples, err := engine.Tuples.GetTuples(ctx, namespace, objectID, rewrite.Tupleset)
+			if err != nil {
+				return nil, err
+			}
+
+			node := &Node{Type: UsersetTupleToUserset, Userset: namespace + ":" + objectID + "#" + rewrite.Tupleset + "->" + rewrite.Relation}
+			for _, tuple := range tuples {
+				child, err := engine.expand(ctx, tuple.SubjectNamespace, tuple.SubjectObjectID, rewrite.Relation, depth+1)
+				if err != nil {
+					return nil, err
+				}
+
+				node.Children = append(node.Children, child)
+			}
+
+			root.Children = append(root.Children, node)
+		}
+	}
+
+	return root, nil
+}
+
+// ListObjects evalúa la relación sobre cada objeto del namespace que tenga
+// al menos una tupla, ya que cualquier objeto alcanzable debe tenerla.
+func (engine *Engine) ListObjects(ctx context.Context, namespace string, relation string, subjectStr string) ([]string, error) {
+	if err := engine.Validate(namespace, relation); err != nil {
+		return nil, err
+	}
+
+	subjectNamespace, subjectObjectID, subjectRelation, err := ParseSubject(subjectStr)
+	if err != nil {
+		return nil, err
+	}
+
+	target := subject{subjectNamespace, subjectObjectID, subjectRelation}
+
+	objectIDs, err := engine.Tuples.GetObjectIDs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []string{}
+	for _, objectID := range objectIDs {
+		allowed, err := engine.check(ctx, namespace, objectID, relation, target, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if allowed {
+			objects = append(objects, namespace+":"+objectID)
+		}
+	}
+
+	return objects, nil
+}
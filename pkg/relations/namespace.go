@@ -0,0 +1,231 @@
+package relations
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	UsersetThis           = "this"
+	UsersetComputed       = "computed_userset"
+	UsersetTupleToUserset = "tuple_to_userset"
+	UsersetUnion          = "union"
+)
+
+var identifierRegexp = regexp.MustCompile("^[a-z][a-z0-9_]*$")
+
+type Userset struct {
+	Type     string `json:"type"`
+	Relation string `json:"relation,omitempty"`
+	Tupleset string `json:"tupleset,omitempty"`
+}
+
+type Relation struct {
+	Name    string    `json:"name"`
+	Rewrite []Userset `json:"rewrite"`
+}
+
+type Namespace struct {
+	Name      string     `json:"name"`
+	Relations []Relation `json:"relations"`
+}
+
+func (namespace *Namespace) Relation(name string) (Relation, bool) {
+	for _, relation := range namespace.Relations {
+		if relation.Name == name {
+			return relation, true
+		}
+	}
+
+	return Relation{}, false
+}
+
+func (namespace *Namespace) String() string {
+	var builder strings.Builder
+
+	builder.WriteString("namespace " + namespace.Name + " {\n")
+
+	for _, relation := range namespace.Relations {
+		builder.WriteString("  relation " + relation.Name)
+
+		if len(relation.Rewrite) != 1 || relation.Rewrite[0].Type != UsersetThis {
+			terms := make([]string, len(relation.Rewrite))
+			for i, userset := range relation.Rewrite {
+				switch userset.Type {
+				case UsersetComputed:
+					terms[i] = userset.Relation
+				case UsersetTupleToUserset:
+					terms[i] = userset.Tupleset + "->" + userset.Relation
+				default:
+					terms[i] = UsersetThis
+				}
+			}
+
+			builder.WriteString(" = " + strings.Join(terms, " | "))
+		}
+
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("}\n")
+
+	return builder.String()
+}
+
+// Parse interpreta el lenguaje de configuración de namespaces:
+//
+//	namespace document {
+//	  relation parent
+//	  relation owner
+//	  relation editor = this | owner
+//	  relation viewer = this | editor | parent->viewer
+//	}
+//
+// Una relación sin reescritura equivale a `this`, `owner` es un computed
+// userset y `parent->viewer` un tuple-to-userset.
+func Parse(config string) ([]Namespace, error) {
+	var (
+		namespaces []Namespace
+		current    *Namespace
+		line       int
+	)
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "namespace "):
+			if current != nil {
+				return nil, fmt.Errorf("Línea %d: el namespace %s no fue cerrado", line, current.Name)
+			}
+
+			name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(text, "namespace "), "{"))
+			if !strings.HasSuffix(text, "{") {
+				return nil, fmt.Errorf("Línea %d: se esperaba `{` al final de la declaración del namespace", line)
+			}
+
+			if !identifierRegexp.MatchString(name) {
+				return nil, fmt.Errorf("Línea %d: el nombre del namespace `%s` no es válido", line, name)
+			}
+
+			for _, namespace := range namespaces {
+				if namespace.Name == name {
+					return nil, fmt.Errorf("Línea %d: el namespace %s está duplicado", line, name)
+				}
+			}
+
+			current = &Namespace{Name: name}
+		case text == "}":
+			if current == nil {
+				return nil, fmt.Errorf("Línea %d: `}` inesperado", line)
+			}
+
+			namespaces = append(namespaces, *current)
+			current = nil
+		case strings.HasPrefix(text, "relation "):
+			if current == nil {
+				return nil, fmt.Errorf("Línea %d: la relación debe estar dentro de un namespace", line)
+			}
+
+			relation, err := parseRelation(strings.TrimPrefix(text, "relation "))
+			if err != nil {
+				return nil, fmt.Errorf("Línea %d: %s", line, err.Error())
+			}
+
+			if _, ok := current.Relation(relation.Name); ok {
+				return nil, fmt.Errorf("Línea %d: la relación %s está duplicada", line, relation.Name)
+			}
+
+			current.Relations = append(current.Relations, relation)
+		default:
+			return nil, fmt.Errorf("Línea %d: no se reconoce `%s`", line, text)
+		}
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("El namespace %s no fue cerrado", current.Name)
+	}
+
+	if len(namespaces) == 0 {
+		return nil, errors.New("La configuración debe tener al menos un namespace")
+	}
+
+	for _, namespace := range namespaces {
+		if err := namespace.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return namespaces, nil
+}
+
+func parseRelation(text string) (Relation, error) {
+	parts := strings.SplitN(text, "=", 2)
+
+	relation := Relation{Name: strings.TrimSpace(parts[0])}
+	if !identifierRegexp.MatchString(relation.Name) {
+		return Relation{}, fmt.Errorf("el nombre de la relación `%s` no es válido", relation.Name)
+	}
+
+	if len(parts) == 1 {
+		relation.Rewrite = []Userset{{Type: UsersetThis}}
+		return relation, nil
+	}
+
+	for _, term := range strings.Split(parts[1], "|") {
+		term = strings.TrimSpace(term)
+
+		switch {
+		case term == UsersetThis:
+			relation.Rewrite = append(relation.Rewrite, Userset{Type: UsersetThis})
+		case strings.Contains(term, "->"):
+			names := strings.SplitN(term, "->", 2)
+
+			tupleset, computed := strings.TrimSpace(names[0]), strings.TrimSpace(names[1])
+			if !identifierRegexp.MatchString(tupleset) || !identifierRegexp.MatchString(computed) {
+				return Relation{}, fmt.Errorf("el término `%s` no es válido", term)
+			}
+
+			relation.Rewrite = append(relation.Rewrite, Userset{Type: UsersetTupleToUserset, Tupleset: tupleset, Relation: computed})
+		case identifierRegexp.MatchString(term):
+			relation.Rewrite = append(relation.Rewrite, Userset{Type: UsersetComputed, Relation: term})
+		default:
+			return Relation{}, fmt.Errorf("el término `%s` no es válido", term)
+		}
+	}
+
+	return relation, nil
+}
+
+func (namespace *Namespace) validate() error {
+	for _, relation := range namespace.Relations {
+		for _, userset := range relation.Rewrite {
+			switch userset.Type {
+			case UsersetComputed:
+				if _, ok := namespace.Relation(userset.Relation); !ok {
+					return fmt.Errorf("La relación %s#%s usa la relación %s que no existe", namespace.Name, relation.Name, userset.Relation)
+				}
+			case UsersetTupleToUserset:
+				if _, ok := namespace.Relation(userset.Tupleset); !ok {
+					return fmt.Errorf("La relación %s#%s usa la relación %s que no existe", namespace.Name, relation.Name, userset.Tupleset)
+				}
+			}
+		}
+	}
+
+	return nil
+}
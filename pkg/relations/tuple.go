@@ -0,0 +1,75 @@
+package relations
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var objectIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
+
+func ParseObject(object string) (string, string, error) {
+	parts := strings.SplitN(object, ":", 2)
+	if len(parts) != 2 || !identifierRegexp.MatchString(parts[0]) || !objectIDRegexp.MatchString(parts[1]) {
+		return "", "", fmt.Errorf("El objeto `%s` no es válido, debe tener el formato namespace:id", object)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+func ParseSubject(subject string) (string, string, string, error) {
+	relation := ""
+
+	if i := strings.Index(subject, "#"); i >= 0 {
+		relation = subject[i+1:]
+		subject = subject[:i]
+
+		if !identifierRegexp.MatchString(relation) {
+			return "", "", "", fmt.Errorf("La relación `%s` del sujeto no es válida", relation)
+		}
+	}
+
+	namespace, objectID, err := ParseObject(subject)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return namespace, objectID, relation, nil
+}
+
+// ParseTuple interpreta una tupla con el formato `namespace:id#relation@subject`,
+// donde el sujeto puede ser `namespace:id` o un subject-set `namespace:id#relation`.
+func ParseTuple(value string) (models.RelationTuple, error) {
+	parts := strings.SplitN(value, "@", 2)
+	if len(parts) != 2 {
+		return models.RelationTuple{}, fmt.Errorf("La tupla `%s` no es válida, debe tener el formato namespace:id#relation@subject", value)
+	}
+
+	object := strings.SplitN(parts[0], "#", 2)
+	if len(object) != 2 || !identifierRegexp.MatchString(object[1]) {
+		return models.RelationTuple{}, fmt.Errorf("La tupla `%s` no es válida, debe tener el formato namespace:id#relation@subject", value)
+	}
+
+	namespace, objectID, err := ParseObject(object[0])
+	if err != nil {
+		return models.RelationTuple{}, err
+	}
+
+	subjectNamespace, subjectObjectID, subjectRelation, err := ParseSubject(parts[1])
+	if err != nil {
+		return models.RelationTuple{}, err
+	}
+
+	tuple := models.RelationTuple{
+		Namespace:        namespace,
+		ObjectID:         objectID,
+		Relation:         object[1],
+		SubjectNamespace: subjectNamespace,
+		SubjectObjectID:  subjectObjectID,
+		SubjectRelation:  subjectRelation,
+	}
+
+	return tuple, nil
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"net/http"
 )
@@ -34,3 +35,16 @@ func HTTPError(w http.ResponseWriter, r *http.Request, statusCode int, message s
 
 	return JSON(w, r, statusCode, msg)
 }
+
+func CSV(w http.ResponseWriter, r *http.Request, statusCode int, filename string, records [][]string) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	w.WriteHeader(statusCode)
+
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
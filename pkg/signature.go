@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+)
+
+// SigningKey es la llave con la que el servidor firma reportes y puntos de control (`SIGNING_KEY`).
+func SigningKey() string {
+	return os.Getenv("SIGNING_KEY")
+}
+
+// ValidateSigningKey exige que `SIGNING_KEY` exista y sea distinta de `JWT_KEY`, que se comparte
+// con los servicios que validan los tokens y les permitiría falsificar las firmas.
+func ValidateSigningKey() error {
+	key := SigningKey()
+	if key == "" {
+		return errors.New("Se debe iniciar la variable `SIGNING_KEY`.")
+	}
+
+	if key == os.Getenv("JWT_KEY") {
+		return errors.New("La variable `SIGNING_KEY` debe ser distinta de `JWT_KEY`.")
+	}
+
+	return nil
+}
+
+func Sign(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(key string, body []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+
+	return hmac.Equal(mac.Sum(nil), expected)
+}
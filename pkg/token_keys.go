@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// JWK es una llave pública del JWKS que publica el IAM en `GET /.well-known/jwks.json`.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// La llave se lee en cada token, así que guardamos la última que se decodificó.
+var tokenKey struct {
+	sync.Mutex
+	pem string
+	key *rsa.PrivateKey
+	kid string
+}
+
+// TokenSigningKey devuelve la llave RSA de `JWT_PRIVATE_KEY` (en PEM, PKCS #1 o PKCS #8) con la
+// que se firman los tokens con RS256 y su `kid`. Sin la variable devuelve `nil` y los tokens se
+// firman con HS256 y `JWT_KEY`.
+func TokenSigningKey() (*rsa.PrivateKey, string, error) {
+	// Los archivos `.env` suelen guardar el PEM en una línea con `\n` literales.
+	value := strings.ReplaceAll(os.Getenv("JWT_PRIVATE_KEY"), `\n`, "\n")
+	if value == "" {
+		return nil, "", nil
+	}
+
+	tokenKey.Lock()
+	defer tokenKey.Unlock()
+
+	if tokenKey.pem == value {
+		return tokenKey.key, tokenKey.kid, nil
+	}
+
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, "", errors.New("La variable `JWT_PRIVATE_KEY` debe ser una llave RSA en formato PEM.")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, "", errors.New("La variable `JWT_PRIVATE_KEY` debe ser una llave RSA en formato PEM.")
+		}
+
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, "", errors.New("La variable `JWT_PRIVATE_KEY` debe ser una llave RSA en formato PEM.")
+		}
+	}
+
+	tokenKey.pem = value
+	tokenKey.key = key
+	tokenKey.kid = PublicJWK(&key.PublicKey).Kid
+
+	return tokenKey.key, tokenKey.kid, nil
+}
+
+// PublicJWK devuelve la llave pública como JWK. El `kid` es su huella según el RFC 7638, así que
+// cambia al rotar la llave.
+func PublicJWK(key *rsa.PublicKey) JWK {
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+	thumbprint, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{E: e, Kty: "RSA", N: n})
+
+	sum := sha256.Sum256(thumbprint)
+
+	return JWK{Kty: "RSA", Kid: base64.RawURLEncoding.EncodeToString(sum[:]), Use: "sig", Alg: "RS256", N: n, E: e}
+}
+
+// SignToken firma el token con RS256 si se configuró `JWT_PRIVATE_KEY` o, si no, con HS256 y
+// `JWT_KEY`.
+func SignToken(claim *Claim) (string, error) {
+	key, kid, err := TokenSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	if key == nil {
+		return claim.GenerateToken(os.Getenv("JWT_KEY"))
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claim)
+	token.Header["kid"] = kid
+
+	return token.SignedString(key)
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+)
+
+func ValidateApplicationName(name string) error {
+	if name == "" {
+		return errors.New("Debes ingresar el nombre de la aplicación")
+	}
+
+	nameMatches, err := regexp.MatchString("^[a-z][a-z0-9_]*$", name)
+	if err != nil {
+		return err
+	}
+
+	if !nameMatches {
+		return errors.New("El nombre de la aplicación debe empezar por una letra y solo puede contener minúsculas, números o guiones bajos")
+	}
+
+	if len(name) < 2 || len(name) > 20 {
+		return errors.New("El nombre de la aplicación debe tener entre 2 y 20 caracteres")
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"errors"
+
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+func ValidateTokenProfile(profile string) error {
+	if profile != "" && profile != pkg.TokenProfilePermissions && profile != pkg.TokenProfileBitset {
+		return errors.New("El perfil del token debe ser permissions o bitset")
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+func ValidateConstraintName(name string) error {
+	if name == "" {
+		return errors.New("Debes ingresar el nombre de la restricción")
+	}
+
+	nameMatches, err := regexp.MatchString("^[a-zA-Z0-9_]*$", name)
+	if err != nil {
+		return err
+	}
+
+	if !nameMatches {
+		return errors.New("El nombre de la restricción no puede contener espacios o caracteres especiales")
+	}
+
+	if len(name) < 4 || len(name) > 25 {
+		return errors.New("El nombre de la restricción debe tener entre 4 y 25 caracteres")
+	}
+
+	return nil
+}
+
+func ValidateConstraintPermissions(permissions []string, maxAllowed int) error {
+	if len(permissions) < 2 {
+		return errors.New("La restricción debe incluir al menos dos permisos")
+	}
+
+	seen := map[string]bool{}
+	for _, permission := range permissions {
+		if seen[permission] {
+			return errors.New("La restricción no puede incluir permisos repetidos")
+		}
+
+		seen[permission] = true
+	}
+
+	if maxAllowed < 1 || maxAllowed >= len(permissions) {
+		return errors.New("La cantidad máxima de permisos permitidos debe ser mayor a 0 y menor a la cantidad de permisos de la restricción")
+	}
+
+	return nil
+}
+
+// BreachedConstraint busca la primera restricción que se violaría si un usuario con los permisos
+// `held` recibe `permission`. Sirve para validar varias asignaciones planeadas antes de guardarlas.
+func BreachedConstraint(constraints []models.SeparationConstraint, held map[string]bool, permission string) (models.SeparationConstraint, bool) {
+	for _, constraint := range constraints {
+		included, count := false, 0
+
+		for _, name := range constraint.Permissions {
+			if name == permission {
+				included = true
+			} else if held[name] {
+				count++
+			}
+		}
+
+		if included && count+1 > constraint.MaxAllowed {
+			return constraint, true
+		}
+	}
+
+	return models.SeparationConstraint{}, false
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// PlanPermissionManifest compara el manifiesto de una aplicación con sus permisos actuales. Los
+// nombres del manifiesto pueden omitir el prefijo de la aplicación.
+func PlanPermissionManifest(application string, manifest dto.PermissionManifestBody, current []models.Permission) (models.PermissionManifestPlan, error) {
+	plan := models.PermissionManifestPlan{
+		Application: application,
+		Create:      []models.Permission{},
+		Update:      []models.Permission{},
+		Deprecate:   []models.Permission{},
+		Unchanged:   []string{},
+	}
+
+	existing := make(map[string]models.Permission, len(current))
+	for _, permission := range current {
+		existing[permission.Name] = permission
+	}
+
+	declared := make(map[string]bool, len(manifest.Permissions))
+	for _, entry := range manifest.Permissions {
+		name := entry.Name
+
+		prefix, _ := models.SplitPermissionName(name)
+		if prefix == "" {
+			name = application + ":" + name
+		} else if prefix != application {
+			return plan, fmt.Errorf("El permiso %s no pertenece a la aplicación %s", entry.Name, application)
+		}
+
+		if err := ValidatePermissionName(name); err != nil {
+			return plan, fmt.Errorf("%s: %s", entry.Name, err.Error())
+		}
+
+		if err := ValidatePermissionDescription(entry.Description); err != nil {
+			return plan, fmt.Errorf("%s: %s", entry.Name, err.Error())
+		}
+
+		if declared[name] {
+			return plan, fmt.Errorf("El permiso %s está repetido en el manifiesto", name)
+		}
+
+		declared[name] = true
+
+		permission, ok := existing[name]
+		if !ok {
+			plan.Create = append(plan.Create, models.Permission{
+				Name:        name,
+				Application: application,
+				Description: entry.Description,
+				Deletable:   true,
+				Editable:    true,
+			})
+
+			continue
+		}
+
+		if permission.Description == entry.Description && permission.DeprecatedAt == nil {
+			plan.Unchanged = append(plan.Unchanged, name)
+			continue
+		}
+
+		if !permission.Editable {
+			return plan, fmt.Errorf("El permiso %s no puede ser editado", name)
+		}
+
+		permission.Description = entry.Description
+		permission.DeprecatedAt = nil
+
+		plan.Update = append(plan.Update, permission)
+	}
+
+	for _, permission := range current {
+		if declared[permission.Name] || permission.DeprecatedAt != nil {
+			continue
+		}
+
+		if !permission.Editable {
+			return plan, fmt.Errorf("El permiso %s no puede ser editado", permission.Name)
+		}
+
+		plan.Deprecate = append(plan.Deprecate, permission)
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+)
+
+func ValidateOrganizationName(name string) error {
+	if name == "" {
+		return errors.New("Debes ingresar el nombre de la organización")
+	}
+
+	nameMatches, err := regexp.MatchString("^[a-z0-9-]*$", name)
+	if err != nil {
+		return err
+	}
+
+	if !nameMatches {
+		return errors.New("El nombre de la organización solo puede contener minúsculas, números y guiones")
+	}
+
+	if len(name) < 3 || len(name) > 30 {
+		return errors.New("El nombre de la organización debe tener entre 3 y 30 caracteres")
+	}
+
+	return nil
+}
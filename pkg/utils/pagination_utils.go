@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+func ParsePagination(values url.Values) (int, int, error) {
+	page := 1
+	limit := DefaultPageLimit
+
+	if pageStr := values.Get("page"); pageStr != "" {
+		value, err := strconv.Atoi(pageStr)
+		if err != nil || value < 1 {
+			return 0, 0, errors.New("La página debe ser un número mayor a 0")
+		}
+
+		page = value
+	}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		value, err := strconv.Atoi(limitStr)
+		if err != nil || value < 1 || value > MaxPageLimit {
+			return 0, 0, errors.New("El límite debe ser un número entre 1 y 100")
+		}
+
+		limit = value
+	}
+
+	return page, limit, nil
+}
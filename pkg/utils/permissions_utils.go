@@ -3,6 +3,8 @@ package utils
 import (
 	"errors"
 	"regexp"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
 )
 
 func ValidatePermissionDescription(description string) error {
@@ -22,6 +24,15 @@ func ValidatePermissionName(name string) error {
 		return errors.New("Debes ingresar el nombre del permiso")
 	}
 
+	// Los permisos de una aplicación llevan su nombre como prefijo (`billing:read_orders`).
+	if application, local := models.SplitPermissionName(name); local != name {
+		if err := ValidateApplicationName(application); err != nil {
+			return err
+		}
+
+		name = local
+	}
+
 	nameMatches, err := regexp.MatchString("^[a-zA-Z0-9_]*$", name)
 	if err != nil {
 		return err
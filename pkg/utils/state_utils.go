@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PlanStateImport compara un documento exportado con el estado actual de la organización. Los
+// usuarios y permisos se relacionan por nombre, nunca por ID, para poder importar el documento en
+// otro ambiente. Las asignaciones que violen las restricciones de separación de funciones, contando
+// también las demás asignaciones del documento, se reportan como conflictos.
+func PlanStateImport(document models.StateDocument, current models.StateDocument, applications map[string]bool, constraints []models.SeparationConstraint) models.StateImportPlan {
+	plan := models.StateImportPlan{
+		CreateUsers:       []models.StateUser{},
+		CreatePermissions: []models.StatePermission{},
+		UpdatePermissions: []models.StatePermission{},
+		CreateGrants:      []models.StateGrant{},
+		UpdateGrants:      []models.StateGrant{},
+		Conflicts:         []models.StateConflict{},
+	}
+
+	conflict := func(kind string, name string, reason string) {
+		plan.Conflicts = append(plan.Conflicts, models.StateConflict{Kind: kind, Name: name, Reason: reason})
+	}
+
+	users := make(map[string]models.StateUser, len(current.Users))
+	for _, user := range current.Users {
+		users[user.Username] = user
+	}
+
+	seen := map[string]bool{}
+	for _, user := range document.Users {
+		if seen[user.Username] {
+			conflict("user", user.Username, "El usuario está repetido en el documento")
+			continue
+		}
+
+		seen[user.Username] = true
+
+		if existing, ok := users[user.Username]; ok {
+			if len(user.Attributes) > 0 && !reflect.DeepEqual(existing.Attributes, user.Attributes) {
+				conflict("user", user.Username, "El usuario ya existe con otros atributos")
+				continue
+			}
+
+			plan.Unchanged++
+			continue
+		}
+
+		if err := ValidateUsername(user.Username); err != nil {
+			conflict("user", user.Username, err.Error())
+			continue
+		}
+
+		// Sin el hash de la contraseña no se puede crear el usuario en el destino.
+		if _, err := bcrypt.Cost([]byte(user.Password)); err != nil {
+			conflict("user", user.Username, "El documento no incluye la contraseña del usuario")
+			continue
+		}
+
+		if err := ValidateUserAttributes(user.Attributes); err != nil {
+			conflict("user", user.Username, err.Error())
+			continue
+		}
+
+		users[user.Username] = user
+		plan.CreateUsers = append(plan.CreateUsers, user)
+	}
+
+	permissions := make(map[string]models.StatePermission, len(current.Permissions))
+	for _, permission := range current.Permissions {
+		permissions[permission.Name] = permission
+	}
+
+	seen = map[string]bool{}
+	for _, permission := range document.Permissions {
+		if seen[permission.Name] {
+			conflict("permission", permission.Name, "El permiso está repetido en el documento")
+			continue
+		}
+
+		seen[permission.Name] = true
+
+		if existing, ok := permissions[permission.Name]; ok {
+			if existing.Description == permission.Description {
+				plan.Unchanged++
+				continue
+			}
+
+			if !existing.Editable {
+				conflict("permission", permission.Name, "El permiso no puede ser editado")
+				continue
+			}
+
+			plan.UpdatePermissions = append(plan.UpdatePermissions, permission)
+			continue
+		}
+
+		// Los permisos integrados solo los crean las migraciones.
+		if !permission.Editable {
+			conflict("permission", permission.Name, "El permiso integrado no existe en el destino")
+			continue
+		}
+
+		if err := ValidatePermissionName(permission.Name); err != nil {
+			conflict("permission", permission.Name, err.Error())
+			continue
+		}
+
+		if err := ValidatePermissionDescription(permission.Description); err != nil {
+			conflict("permission", permission.Name, err.Error())
+			continue
+		}
+
+		if application, _ := models.SplitPermissionName(permission.Name); application != "" && !applications[application] {
+			conflict("permission", permission.Name, fmt.Sprintf("La aplicación %s no existe", application))
+			continue
+		}
+
+		permission.Deletable = true
+		permissions[permission.Name] = permission
+		plan.CreatePermissions = append(plan.CreatePermissions, permission)
+	}
+
+	granted := make(map[string]models.StateGrant, len(current.Grants))
+	held := map[string]map[string]bool{}
+
+	for _, grant := range current.Grants {
+		granted[grant.Username+"/"+grant.Permission] = grant
+
+		if held[grant.Username] == nil {
+			held[grant.Username] = map[string]bool{}
+		}
+
+		held[grant.Username][grant.Permission] = true
+	}
+
+	for _, grant := range document.Grants {
+		key := grant.Username + "/" + grant.Permission
+
+		if existing, ok := granted[key]; ok {
+			if existing.Grantable == grant.Grantable {
+				plan.Unchanged++
+				continue
+			}
+
+			granted[key] = grant
+			plan.UpdateGrants = append(plan.UpdateGrants, grant)
+			continue
+		}
+
+		if _, ok := users[grant.Username]; !ok {
+			conflict("grant", key, "El usuario no existe")
+			continue
+		}
+
+		if _, ok := permissions[grant.Permission]; !ok {
+			conflict("grant", key, "El permiso no existe")
+			continue
+		}
+
+		if constraint, breached := BreachedConstraint(constraints, held[grant.Username], grant.Permission); breached {
+			conflict("grant", key, fmt.Sprintf("No se puede otorgar el permiso porque viola la restricción de separación de funciones %s", constraint.Name))
+			continue
+		}
+
+		if held[grant.Username] == nil {
+			held[grant.Username] = map[string]bool{}
+		}
+
+		held[grant.Username][grant.Permission] = true
+
+		granted[key] = grant
+		plan.CreateGrants = append(plan.CreateGrants, grant)
+	}
+
+	return plan
+}
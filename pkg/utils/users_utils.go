@@ -46,3 +46,26 @@ func ValidateUsername(username string) error {
 
 	return nil
 }
+
+func ValidateUserAttributes(attributes map[string]string) error {
+	if len(attributes) > 20 {
+		return errors.New("El usuario no puede tener más de 20 atributos")
+	}
+
+	for key, value := range attributes {
+		keyMatches, err := regexp.MatchString("^[a-z][a-z0-9_]*$", key)
+		if err != nil {
+			return err
+		}
+
+		if !keyMatches || len(key) > 25 {
+			return errors.New("El nombre del atributo `" + key + "` debe tener máximo 25 caracteres en minúscula, números o guiones bajos")
+		}
+
+		if len(value) > 150 {
+			return errors.New("El valor del atributo `" + key + "` no puede tener más de 150 caracteres")
+		}
+	}
+
+	return nil
+}
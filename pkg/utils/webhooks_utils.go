@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+// Rango de direcciones compartidas (CGNAT) que tampoco es alcanzable desde internet.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsInternalIP indica si la dirección es local, privada (RFC 1918), de enlace local (como
+// 169.254.169.254, la de los metadatos de la nube) o no enrutable, y por lo tanto no se le pueden
+// enviar webhooks.
+func IsInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+func ValidateWebhook(data *dto.CreateWebhookBody) error {
+	if data.URL == "" {
+		return errors.New("Debes ingresar la URL del webhook")
+	}
+
+	parsed, err := url.Parse(data.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("La URL del webhook debe ser una dirección http o https válida")
+	}
+
+	// Los nombres se vuelven a verificar al conectarse, porque pueden resolver a otra dirección.
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); (ip != nil && IsInternalIP(ip)) || strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return errors.New("La URL del webhook no puede apuntar a una dirección interna")
+	}
+
+	if len(data.URL) > 500 {
+		return errors.New("La URL del webhook no puede tener más de 500 caracteres")
+	}
+
+	if data.Secret != "" && (len(data.Secret) < 16 || len(data.Secret) > 100) {
+		return errors.New("El secreto del webhook debe tener entre 16 y 100 caracteres")
+	}
+
+	if len(data.EventTypes) == 0 {
+		return errors.New("Debes ingresar al menos un tipo de evento")
+	}
+
+	for _, eventType := range data.EventTypes {
+		valid := false
+		for _, known := range models.WebhookEventTypes {
+			if eventType == known {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return fmt.Errorf("El tipo de evento %s no existe", eventType)
+		}
+	}
+
+	return nil
+}
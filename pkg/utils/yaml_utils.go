@@ -0,0 +1,509 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// YAMLToJSON convierte un documento YAML en JSON para decodificarlo con los mismos cuerpos de la
+// API. Solo admite el subconjunto que usan los manifiestos: mapas y listas en bloque, listas en
+// línea, textos simples o entre comillas, bloques de texto `|` y `>`, y comentarios. Los valores
+// simples se leen como texto (salvo `null` y `~`), porque todos los campos de los manifiestos lo
+// son; las anclas, etiquetas y varios documentos no se admiten.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	parser := &yamlParser{}
+
+	content := strings.TrimPrefix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\ufeff")
+	for i, raw := range strings.Split(content, "\n") {
+		text := strings.TrimRight(raw, " \t")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, yamlError(i + 1)
+		}
+
+		parser.lines = append(parser.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	parser.skip()
+	if !parser.done() && parser.current().indent == 0 && parser.current().text == "---" {
+		parser.pos++
+		parser.skip()
+	}
+
+	if parser.done() {
+		return []byte("null"), nil
+	}
+
+	value, err := parser.node(parser.current().indent)
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skip()
+	if !parser.done() && parser.current().indent == 0 && parser.current().text == "..." {
+		parser.pos++
+		parser.skip()
+	}
+
+	if !parser.done() {
+		return nil, yamlError(parser.current().number)
+	}
+
+	return json.Marshal(value)
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func yamlError(line int) error {
+	return fmt.Errorf("El YAML no es válido en la línea %d", line)
+}
+
+func (parser *yamlParser) done() bool {
+	return parser.pos >= len(parser.lines)
+}
+
+func (parser *yamlParser) current() yamlLine {
+	return parser.lines[parser.pos]
+}
+
+// skip salta las líneas vacías y los comentarios.
+func (parser *yamlParser) skip() {
+	for !parser.done() && (parser.current().text == "" || strings.HasPrefix(parser.current().text, "#")) {
+		parser.pos++
+	}
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// node lee el valor que empieza en la línea actual, que tiene la indentación indicada.
+func (parser *yamlParser) node(indent int) (interface{}, error) {
+	line := parser.current()
+
+	if isSequenceItem(line.text) {
+		return parser.sequence(indent)
+	}
+
+	if _, _, ok := splitKey(line.text); ok {
+		return parser.mapping(indent)
+	}
+
+	parser.pos++
+
+	return scalar(line.text, line.number)
+}
+
+func (parser *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+
+	for {
+		parser.skip()
+		if parser.done() {
+			return items, nil
+		}
+
+		line := parser.current()
+		if line.indent < indent || (line.indent == indent && !isSequenceItem(line.text)) {
+			return items, nil
+		}
+
+		if line.indent > indent {
+			return nil, yamlError(line.number)
+		}
+
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			parser.pos++
+			parser.skip()
+
+			if parser.done() || parser.current().indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+
+			value, err := parser.node(parser.current().indent)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, value)
+			continue
+		}
+
+		// Lo que sigue al guion se lee como una línea más indentada, así un mapa puede empezar en
+		// la misma línea del elemento.
+		offset := len(line.text) - len(rest)
+		parser.lines[parser.pos] = yamlLine{number: line.number, indent: indent + offset, text: rest}
+
+		value, err := parser.node(indent + offset)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, value)
+	}
+}
+
+func (parser *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+
+	for {
+		parser.skip()
+		if parser.done() {
+			return result, nil
+		}
+
+		line := parser.current()
+		if line.indent < indent || (line.indent == indent && isSequenceItem(line.text)) {
+			return result, nil
+		}
+
+		key, value, ok := splitKey(line.text)
+		if line.indent > indent || !ok {
+			return nil, yamlError(line.number)
+		}
+
+		if _, exists := result[key]; exists {
+			return nil, fmt.Errorf("La clave %s está repetida en la línea %d del YAML", key, line.number)
+		}
+
+		parser.pos++
+
+		if value == "" || strings.HasPrefix(value, "#") {
+			parser.skip()
+
+			if !parser.done() && (parser.current().indent > indent || (parser.current().indent == indent && isSequenceItem(parser.current().text))) {
+				child, err := parser.node(parser.current().indent)
+				if err != nil {
+					return nil, err
+				}
+
+				result[key] = child
+			} else {
+				result[key] = nil
+			}
+
+			continue
+		}
+
+		var err error
+
+		if value[0] == '|' || value[0] == '>' {
+			result[key], err = parser.block(indent, value, line.number)
+		} else {
+			result[key], err = scalar(value, line.number)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// splitKey separa `clave: valor`. Los dos puntos deben ir seguidos de un espacio o del final de la
+// línea, así una URL no se confunde con una clave.
+func splitKey(text string) (string, string, bool) {
+	if text == "" || strings.ContainsRune("-[{#&*!|>'\"%@`", rune(text[0])) && text[0] != '"' && text[0] != '\'' {
+		return "", "", false
+	}
+
+	key := ""
+	rest := ""
+
+	if text[0] == '"' || text[0] == '\'' {
+		value, remainder, err := quoted(text, 0)
+		if err != nil || !strings.HasPrefix(remainder, ":") {
+			return "", "", false
+		}
+
+		key, _ = value.(string)
+		rest = remainder[1:]
+	} else {
+		index := -1
+		for i := 0; i < len(text); i++ {
+			if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+				index = i
+				break
+			}
+		}
+
+		if index <= 0 {
+			return "", "", false
+		}
+
+		key = strings.TrimRight(text[:index], " ")
+		rest = text[index+1:]
+	}
+
+	if rest != "" && rest[0] != ' ' {
+		return "", "", false
+	}
+
+	return key, strings.TrimSpace(rest), true
+}
+
+// block lee un bloque de texto `|` (literal) o `>` (plegado), con el indicador `-` o `+` opcional.
+func (parser *yamlParser) block(indent int, header string, number int) (string, error) {
+	header, _ = stripComment(header)
+
+	chomping := ""
+	if len(header) == 2 && (header[1] == '-' || header[1] == '+') {
+		chomping = header[1:]
+	} else if len(header) != 1 {
+		return "", yamlError(number)
+	}
+
+	var lines []string
+	blockIndent := -1
+
+	for !parser.done() {
+		line := parser.current()
+
+		if line.text != "" {
+			if line.indent <= indent || (blockIndent != -1 && line.indent < blockIndent) {
+				break
+			}
+
+			if blockIndent == -1 {
+				blockIndent = line.indent
+			}
+
+			lines = append(lines, strings.Repeat(" ", line.indent-blockIndent)+line.text)
+		} else {
+			lines = append(lines, "")
+		}
+
+		parser.pos++
+	}
+
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var text string
+	if header[0] == '|' {
+		text = strings.Join(lines, "\n")
+	} else {
+		text = fold(lines)
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	switch chomping {
+	case "-":
+		return text, nil
+	case "+":
+		return text + strings.Repeat("\n", trailing+1), nil
+	}
+
+	return text + "\n", nil
+}
+
+// fold une las líneas de un bloque `>`: los saltos entre líneas de texto se vuelven espacios, cada
+// línea vacía es un salto y las líneas más indentadas conservan los suyos.
+func fold(lines []string) string {
+	more := func(line string) bool { return strings.HasPrefix(line, " ") }
+
+	var builder strings.Builder
+
+	for i, line := range lines {
+		if i > 0 {
+			previous := lines[i-1]
+
+			switch {
+			case previous != "" && !more(previous) && line != "" && !more(line):
+				builder.WriteString(" ")
+			case previous != "" && !more(previous) && line == "":
+				// El salto se pliega salvo que el siguiente texto esté más indentado.
+				for _, next := range lines[i:] {
+					if next != "" {
+						if more(next) {
+							builder.WriteString("\n")
+						}
+
+						break
+					}
+				}
+			default:
+				builder.WriteString("\n")
+			}
+		}
+
+		builder.WriteString(line)
+	}
+
+	return builder.String()
+}
+
+// stripComment quita el comentario al final de un valor simple.
+func stripComment(text string) (string, bool) {
+	if index := strings.Index(text, " #"); index != -1 {
+		return strings.TrimRight(text[:index], " "), true
+	}
+
+	return text, false
+}
+
+func scalar(text string, number int) (interface{}, error) {
+	if text[0] == '"' || text[0] == '\'' {
+		value, rest, err := quoted(text, number)
+		if err != nil {
+			return nil, err
+		}
+
+		if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, yamlError(number)
+		}
+
+		return value, nil
+	}
+
+	text, _ = stripComment(text)
+
+	switch text[0] {
+	case '[':
+		return flowSequence(text, number)
+	case '{':
+		if strings.TrimSpace(text[1:len(text)-1]) != "" || text[len(text)-1] != '}' {
+			return nil, yamlError(number)
+		}
+
+		return map[string]interface{}{}, nil
+	case '&', '*', '!', '|', '>', '%', '@', '`':
+		return nil, yamlError(number)
+	}
+
+	if text == "~" || text == "null" || text == "Null" || text == "NULL" {
+		return nil, nil
+	}
+
+	return text, nil
+}
+
+// quoted lee un texto entre comillas dobles o simples y devuelve lo que sigue después.
+func quoted(text string, number int) (interface{}, string, error) {
+	quote := text[0]
+
+	for i := 1; i < len(text); i++ {
+		if quote == '"' && text[i] == '\\' {
+			i++
+			continue
+		}
+
+		if text[i] != quote {
+			continue
+		}
+
+		if quote == '\'' {
+			if i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+
+			return strings.ReplaceAll(text[1:i], "''", "'"), text[i+1:], nil
+		}
+
+		value, err := strconv.Unquote(text[:i+1])
+		if err != nil {
+			return nil, "", yamlError(number)
+		}
+
+		return value, text[i+1:], nil
+	}
+
+	return nil, "", yamlError(number)
+}
+
+// flowSequence lee una lista en línea de valores simples, como `[read, write]`.
+func flowSequence(text string, number int) ([]interface{}, error) {
+	if text[len(text)-1] != ']' {
+		return nil, yamlError(number)
+	}
+
+	items := []interface{}{}
+
+	rest := strings.TrimSpace(text[1 : len(text)-1])
+	for rest != "" {
+		var item interface{}
+
+		if rest[0] == '"' || rest[0] == '\'' {
+			value, remainder, err := quoted(rest, number)
+			if err != nil {
+				return nil, err
+			}
+
+			item = value
+			rest = strings.TrimSpace(remainder)
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				end = len(rest)
+			}
+
+			value := strings.TrimSpace(rest[:end])
+			if value == "" || strings.ContainsAny(value, "[]{}") {
+				return nil, yamlError(number)
+			}
+
+			item, _ = scalar(value, number)
+			rest = rest[end:]
+		}
+
+		items = append(items, item)
+
+		if rest == "" {
+			break
+		}
+
+		if rest[0] != ',' {
+			return nil, yamlError(number)
+		}
+
+		rest = strings.TrimSpace(rest[1:])
+	}
+
+	return items, nil
+}
+
+// DecodeManifest decodifica un manifiesto en YAML si el `Content-Type` es de YAML o, si no, en
+// JSON.
+func DecodeManifest(contentType string, body io.Reader, data interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+
+		converted, err := YAMLToJSON(content)
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(converted, data)
+	}
+
+	return json.NewDecoder(body).Decode(data)
+}
@@ -0,0 +1,376 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var (
+	applicationColumns = []string{"id", "name", "description", "created_at"}
+	permissionColumns  = []string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}
+)
+
+func expectNotGranted(mock sqlmock.Sqlmock, userID int, permissionName string) {
+	expectVerifyPermission(mock, userID, permissionName).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}))
+
+	expectBreakGlass(mock, userID, permissionName).WillReturnError(noResultsError)
+}
+
+func expectApplicationAdmin(mock sqlmock.Sqlmock, application string, userID int, admin bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE a.name = $1 AND a.org_id = $2 AND aa.user_id = $3")).
+		WithArgs(application, 1, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(admin))
+}
+
+func TestCreateApplication_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{body: `{"description": "Aplicación de facturación"}`, expected: "Debes ingresar el nombre de la aplicación"},
+		{body: `{"name": "Billing", "description": "Aplicación de facturación"}`, expected: "El nombre de la aplicación debe empezar por una letra y solo puede contener minúsculas, números o guiones bajos"},
+		{body: `{"name": "b", "description": "Aplicación de facturación"}`, expected: "El nombre de la aplicación debe tener entre 2 y 20 caracteres"},
+		{body: `{"name": "billing", "description": "Corta"}`, expected: "La descripción de la aplicación debe tener entre 10 y 150 caracteres"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_applications"})
+
+		res, b := request(t, serv, "/api/applications", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateApplication_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_applications"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing", 1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO applications (name, description, org_id) VALUES ($1, $2, $3) RETURNING id;")).
+		WithArgs("billing", "Aplicación de facturación", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	body := []byte(`{"name": "billing", "description": "Aplicación de facturación"}`)
+
+	res, b := request(t, serv, "/api/applications", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	if location := res.Header.Get("Location"); location != "/api/applications/billing" {
+		t.Errorf("Expected /api/applications/billing, got: %s", location)
+	}
+}
+
+func TestAddApplicationAdmin_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_applications"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing", 1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns).AddRow(3, "billing", "Aplicación de facturación", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("meli", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(5, "meli", time.Now()))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO application_admins (application_id, user_id) VALUES ($1, $2)")).
+		WithArgs(3, 5).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	expectAudit(mock, "application.add_admin", 1, "5", "meli").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	res, b := request(t, serv, "/api/applications/billing/admins/meli", "PUT", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+}
+
+func TestAddApplicationAdmin_ApplicationNotExists(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_applications"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("shipping", 1).
+		WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/applications/shipping/admins/meli", "PUT", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La aplicación shipping no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreatePermission_ApplicationAdmin(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+	expectNotGranted(mock, 5, "create_permission")
+	expectApplicationAdmin(mock, "billing", 5, true)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing", 1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns).AddRow(3, "billing", "Aplicación de facturación", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing:read_orders", 1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id)")).
+		WithArgs("billing:read_orders", "Poder consultar las órdenes", 1, "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20))
+
+	expectAudit(mock, "permission.create", 5, "20", "billing:read_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"name": "billing:read_orders", "description": "Poder consultar las órdenes"}`)
+
+	res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	permission := data["permission"].(map[string]interface{})
+	if permission["application"].(string) != "billing" {
+		t.Errorf("Expected application billing, got: %v", permission["application"])
+	}
+}
+
+func TestCreatePermission_ApplicationAdminNoAuthorized(t *testing.T) {
+	cases := []struct {
+		name  string
+		admin bool
+	}{
+		// Administra billing pero intenta crear un permiso de shipping.
+		{name: "shipping:read_orders", admin: false},
+		// Los permisos sin aplicación requieren el permiso global.
+		{name: "read_orders"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+		expectNotGranted(mock, 5, "create_permission")
+
+		if application, _ := models.SplitPermissionName(td.name); application != "" {
+			expectApplicationAdmin(mock, application, 5, td.admin)
+		}
+
+		body := []byte(`{"name": "` + td.name + `", "description": "Poder consultar las órdenes"}`)
+
+		res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+		if errorMessage.Message != expected {
+			t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCreatePermission_ApplicationAdminDenied(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+	// La denegación tiene vencimiento, así que el mensaje incluye la fecha, y no se consulta si
+	// administra la aplicación.
+	expiresAt := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+	expectPermissionDeny(mock, 5, "create_permission").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "permission_id", "reason", "expires_at"}).AddRow(1, 2, "Incidente", expiresAt))
+
+	body := []byte(`{"name": "billing:read_orders", "description": "Poder consultar las órdenes"}`)
+
+	res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "Se te ha denegado explícitamente este permiso hasta el 2030-01-02 15:04"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreatePermission_ApplicationNotExists(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"create_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing", 1).
+		WillReturnError(noResultsError)
+
+	body := []byte(`{"name": "billing:read_orders", "description": "Poder consultar las órdenes"}`)
+
+	res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La aplicación billing no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreatePermission_NamespacedValidationErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+	}{
+		{name: ":read_orders", expected: "Debes ingresar el nombre de la aplicación"},
+		{name: "Billing:read_orders", expected: "El nombre de la aplicación debe empezar por una letra y solo puede contener minúsculas, números o guiones bajos"},
+		{name: "billing:", expected: "El nombre del permiso debe tener entre 4 y 25 caracteres"},
+		{name: "billing:read:orders", expected: "El nombre del permiso no puede contener espacios o caracteres especiales"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"create_permission"})
+
+		body := []byte(`{"name": "` + td.name + `", "description": "Poder consultar las órdenes"}`)
+
+		res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestUpdatePermission_ChangeApplication(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(20, 1).
+		WillReturnRows(sqlmock.NewRows(permissionColumns).AddRow(20, "billing:read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()))
+
+	body := []byte(`{"name": "shipping:read_orders"}`)
+
+	res, b := request(t, serv, "/api/permissions/20", "PUT", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "No se puede cambiar la aplicación de un permiso"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestDeletePermission_ApplicationAdmin(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+	expectNotGranted(mock, 5, "delete_permission")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(20, 1).
+		WillReturnRows(sqlmock.NewRows(permissionColumns).AddRow(20, "billing:read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()))
+
+	expectApplicationAdmin(mock, "billing", 5, true)
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permissions WHERE id = $1 AND org_id = $2 AND deletable = TRUE;")).
+		ExpectExec().WithArgs(20, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectAudit(mock, "permission.delete", 5, "20", "billing:read_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	res, b := request(t, serv, "/api/permissions/20", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
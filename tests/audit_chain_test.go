@@ -0,0 +1,320 @@
+package tests
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var auditChainColumns = []string{"id", "actor_id", "action", "target_type", "target_id", "target_name", "before", "after", "ip", "user_agent", "request_id", "created_at", "prev_hash", "hash"}
+
+var auditCheckpointColumns = []string{"id", "last_entry_id", "last_hash", "signature", "created_at"}
+
+// captureArg acepta cualquier argumento y lo guarda para usarlo después en el test.
+type captureArg struct {
+	value *driver.Value
+}
+
+func (arg captureArg) Match(value driver.Value) bool {
+	*arg.value = value
+	return true
+}
+
+// chainRow es un registro de la cadena tal como queda guardado en la base de datos.
+type chainRow struct {
+	id         uint
+	targetName string
+	createdAt  time.Time
+	prevHash   string
+	hash       string
+}
+
+// createChain guarda registros con el repositorio real y devuelve los valores que calculó, para
+// poder verificarlos después.
+func createChain(t *testing.T, names ...string) []chainRow {
+	db, mock := newDatabaseMock()
+
+	repository := repositories.AuditRepository{Database: db}
+
+	var chain []chainRow
+	prevHash := ""
+
+	for i, name := range names {
+		var createdAt, hash driver.Value
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2);")).
+			WithArgs(sqlmock.AnyArg(), 1).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		hashRows := sqlmock.NewRows([]string{"hash"})
+		if prevHash != "" {
+			hashRows.AddRow(prevHash)
+		}
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT hash FROM audit_log WHERE org_id = $1 AND hash IS NOT NULL ORDER BY id DESC LIMIT 1;")).
+			WithArgs(1).
+			WillReturnRows(hashRows)
+
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO audit_log")).
+			WithArgs(1, 1, "user.grant_permission", "user", "2", name, nil, `{"permission_name":"read_orders"}`, "10.0.0.1", "curl/7.79", "host/abc-000001", captureArg{&createdAt}, sqlmock.AnyArg(), captureArg{&hash}).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i + 1))
+		mock.ExpectCommit()
+
+		actorID := uint(1)
+		entry := models.AuditEntry{
+			ActorID:    &actorID,
+			Action:     "user.grant_permission",
+			TargetType: "user",
+			TargetID:   "2",
+			TargetName: name,
+			After:      json.RawMessage(`{"permission_name":"read_orders"}`),
+			IP:         "10.0.0.1",
+			UserAgent:  "curl/7.79",
+			RequestID:  "host/abc-000001",
+		}
+
+		if err := repository.Create(context.Background(), &entry); err != nil {
+			t.Fatalf("Could not create the audit entry: %v", err)
+		}
+
+		chain = append(chain, chainRow{id: entry.ID, targetName: name, createdAt: createdAt.(time.Time), prevHash: prevHash, hash: hash.(string)})
+		prevHash = hash.(string)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("There were unfulfilled expectations: %s", err)
+	}
+
+	return chain
+}
+
+func chainRows(chain []chainRow) *sqlmock.Rows {
+	rows := sqlmock.NewRows(auditChainColumns)
+
+	for _, row := range chain {
+		rows.AddRow(row.id, 1, "user.grant_permission", "user", "2", row.targetName, "", `{"permission_name":"read_orders"}`, "10.0.0.1", "curl/7.79", "host/abc-000001", row.createdAt, row.prevHash, row.hash)
+	}
+
+	return rows
+}
+
+func checkpointRow(rows *sqlmock.Rows, id uint, row chainRow, key string) *sqlmock.Rows {
+	signature := pkg.Sign(key, []byte(fmt.Sprintf("%d:%d:%s", 1, row.id, row.hash)))
+
+	return rows.AddRow(id, row.id, row.hash, signature, time.Now())
+}
+
+func expectVerify(mock sqlmock.Sqlmock, checkpoints *sqlmock.Rows, entries *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, last_entry_id, last_hash, signature, created_at FROM audit_checkpoints WHERE org_id = $1 ORDER BY id;")).
+		WithArgs(1).
+		WillReturnRows(checkpoints)
+
+	if entries != nil {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log WHERE org_id = $1 ORDER BY id;")).
+			WithArgs(1).
+			WillReturnRows(entries)
+	}
+}
+
+func TestAuditChain_Verify(t *testing.T) {
+	key := "MeLiTest"
+
+	chain := createChain(t, "meli", "superadmin", "soporte")
+
+	if chain[1].prevHash != chain[0].hash || chain[2].prevHash != chain[1].hash {
+		t.Fatalf("Expected the entries to be chained, got: %v", chain)
+	}
+
+	tampered := append([]chainRow{}, chain...)
+	tampered[1].targetName = "atacante"
+
+	cases := []struct {
+		name        string
+		checkpoints *sqlmock.Rows
+		entries     *sqlmock.Rows
+		valid       bool
+		brokenAt    uint
+		reason      string
+	}{
+		{
+			name:        "valid",
+			checkpoints: checkpointRow(sqlmock.NewRows(auditCheckpointColumns), 1, chain[1], key),
+			entries:     chainRows(chain),
+			valid:       true,
+		},
+		{
+			name:        "legacy entries",
+			checkpoints: sqlmock.NewRows(auditCheckpointColumns),
+			entries: sqlmock.NewRows(auditChainColumns).
+				AddRow(100, 1, "auth.login", "user", "1", "superadmin", "", "", "", "", "", time.Now(), "", "").
+				AddRow(chain[0].id, 1, "user.grant_permission", "user", "2", chain[0].targetName, "", `{"permission_name":"read_orders"}`, "10.0.0.1", "curl/7.79", "host/abc-000001", chain[0].createdAt, "", chain[0].hash),
+			valid: true,
+		},
+		{
+			name:        "tampered content",
+			checkpoints: sqlmock.NewRows(auditCheckpointColumns),
+			entries:     chainRows(tampered),
+			brokenAt:    2,
+			reason:      "El contenido del registro fue modificado",
+		},
+		{
+			name:        "deleted entry",
+			checkpoints: sqlmock.NewRows(auditCheckpointColumns),
+			entries:     chainRows([]chainRow{chain[0], chain[2]}),
+			brokenAt:    3,
+			reason:      "El registro no está encadenado con el anterior",
+		},
+		{
+			name:        "truncated chain",
+			checkpoints: checkpointRow(sqlmock.NewRows(auditCheckpointColumns), 1, chain[2], key),
+			entries:     chainRows(chain[:2]),
+			brokenAt:    3,
+			reason:      "El registro del punto de control 1 no existe",
+		},
+		{
+			name:        "forged checkpoint",
+			checkpoints: checkpointRow(sqlmock.NewRows(auditCheckpointColumns), 1, chain[2], "otra-llave"),
+			brokenAt:    3,
+			reason:      "La firma del punto de control 1 no es válida",
+		},
+	}
+
+	for _, td := range cases {
+		db, mock := newDatabaseMock()
+
+		repository := repositories.AuditRepository{Database: db}
+
+		expectVerify(mock, td.checkpoints, td.entries)
+
+		verification, err := repository.Verify(context.Background(), key)
+		if err != nil {
+			t.Fatalf("%s: could not verify the chain: %v", td.name, err)
+		}
+
+		if verification.Valid != td.valid {
+			t.Errorf("%s: expected valid %v, got: %v (%s)", td.name, td.valid, verification.Valid, verification.Reason)
+			continue
+		}
+
+		if td.valid {
+			continue
+		}
+
+		if verification.BrokenAt == nil || *verification.BrokenAt != td.brokenAt {
+			t.Errorf("%s: expected broken at %d, got: %v", td.name, td.brokenAt, verification.BrokenAt)
+		}
+
+		if verification.Reason != td.reason {
+			t.Errorf("%s: expected %s, got: %s", td.name, td.reason, verification.Reason)
+		}
+	}
+}
+
+func TestAuditChain_Checkpoint(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	repository := repositories.AuditRepository{Database: db}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT DISTINCT ON (a.org_id) a.org_id, a.id, a.hash FROM audit_log a")).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"org_id", "id", "hash"}).
+				AddRow(1, 30, "aaaa").
+				AddRow(2, 31, "bbbb"),
+		)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_checkpoints (org_id, last_entry_id, last_hash, signature) VALUES ($1, $2, $3, $4);")).
+		WithArgs(1, 30, "aaaa", pkg.Sign("MeLiTest", []byte("1:30:aaaa"))).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_checkpoints (org_id, last_entry_id, last_hash, signature) VALUES ($1, $2, $3, $4);")).
+		WithArgs(2, 31, "bbbb", pkg.Sign("MeLiTest", []byte("2:31:bbbb"))).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	created, err := repository.Checkpoint(context.Background(), "MeLiTest")
+	if err != nil {
+		t.Fatalf("Could not create the checkpoints: %v", err)
+	}
+
+	if created != 2 {
+		t.Errorf("Expected 2 checkpoints, got: %d", created)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestVerifyAuditLog_Success(t *testing.T) {
+	chain := createChain(t, "meli", "superadmin")
+
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+	expectVerify(mock, checkpointRow(sqlmock.NewRows(auditCheckpointColumns), 1, chain[1], "MeLiSigningTest"), chainRows(chain))
+
+	res, b := request(t, serv, "/api/audit/verify", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data struct {
+		Verification models.AuditVerification `json:"verification"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if !data.Verification.Valid || data.Verification.Entries != 2 || data.Verification.Checkpoints != 1 {
+		t.Errorf("Expected a valid chain with 2 entries and 1 checkpoint, got: %+v", data.Verification)
+	}
+}
+
+func TestVerifyAuditLog_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	res, _ := request(t, serv, "/api/audit/verify", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}
+
+func TestSigningKey_Validate(t *testing.T) {
+	cases := []struct {
+		signingKey string
+		expected   string
+	}{
+		{signingKey: "", expected: "Se debe iniciar la variable `SIGNING_KEY`."},
+		{signingKey: "MeLiTest", expected: "La variable `SIGNING_KEY` debe ser distinta de `JWT_KEY`."},
+		{signingKey: "MeLiSigningTest"},
+	}
+
+	t.Setenv("JWT_KEY", "MeLiTest")
+
+	for _, td := range cases {
+		t.Setenv("SIGNING_KEY", td.signingKey)
+
+		err := pkg.ValidateSigningKey()
+		if td.expected == "" && err != nil {
+			t.Errorf("Expected %s to be valid, got: %v", td.signingKey, err)
+		}
+
+		if td.expected != "" && (err == nil || err.Error() != td.expected) {
+			t.Errorf("Expected %s, got: %v", td.expected, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+var auditColumns = []string{"id", "actor_id", "actor_username", "action", "target_type", "target_id", "target_name", "before", "after", "ip", "user_agent", "request_id", "created_at"}
+
+// expectAudit espera el registro encadenado de una acción como el primero de la organización. La
+// consulta que devuelve permite indicar las filas del INSERT; el commit ya queda esperado.
+func expectAudit(mock sqlmock.Sqlmock, action string, actorID interface{}, targetID interface{}, targetName interface{}) *sqlmock.ExpectedQuery {
+	return expectOrgAudit(mock, 1, action, actorID, targetID, targetName)
+}
+
+// expectOrgAudit es expectAudit para una organización distinta a la de por defecto.
+func expectOrgAudit(mock sqlmock.Sqlmock, org int, action string, actorID interface{}, targetID interface{}, targetName interface{}) *sqlmock.ExpectedQuery {
+	mock.ExpectBegin()
+
+	query := expectTxAudit(mock, org, action, actorID, targetID, targetName)
+
+	mock.ExpectCommit()
+
+	return query
+}
+
+// expectTxAudit espera el registro dentro de la transacción del cambio, sin inicio ni commit propios.
+func expectTxAudit(mock sqlmock.Sqlmock, org int, action string, actorID interface{}, targetID interface{}, targetName interface{}) *sqlmock.ExpectedQuery {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock($1, $2);")).
+		WithArgs(sqlmock.AnyArg(), org).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT hash FROM audit_log WHERE org_id = $1 AND hash IS NOT NULL ORDER BY id DESC LIMIT 1;")).
+		WithArgs(org).
+		WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+
+	return mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO audit_log (org_id, actor_id, action, target_type, target_id, target_name, before, after, ip, user_agent, request_id, created_at, prev_hash, hash)")).
+		WithArgs(org, actorID, action, sqlmock.AnyArg(), targetID, targetName, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg())
+}
+
+func TestGetAuditLog_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	res, b := request(t, serv, "/api/audit", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestGetAuditLog_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/api/audit?from=ayer", expected: "Las fechas deben tener el formato RFC 3339"},
+		{path: "/api/audit?from=2022-05-02T00:00:00Z&to=2022-05-01T00:00:00Z", expected: "La fecha inicial debe ser anterior a la fecha final"},
+		{path: "/api/audit?limit=500", expected: "El límite debe ser un número entre 1 y 100"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+		res, b := request(t, serv, td.path, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestGetAuditLog_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+	from := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE a.org_id = $1 AND (a.actor_id::text = $2 OR u.username = $2) AND (a.target_id = $3 OR a.target_name = $3) AND a.action = $4 AND a.created_at >= $5 AND a.created_at < $6 ORDER BY a.id DESC LIMIT $7 OFFSET $8;")).
+		WithArgs(1, "superadmin", "meli", "user.grant_permission", from, to, 10, 10).
+		WillReturnRows(
+			sqlmock.NewRows(auditColumns).
+				AddRow(7, 1, "superadmin", "user.grant_permission", "user", "2", "meli", nil, []byte(`{"permission_name":"read_orders"}`), "10.0.0.1", "curl/7.79", "host/abc-000001", time.Now()),
+		)
+
+	res, b := request(t, serv, "/api/audit?actor=superadmin&target=meli&action=user.grant_permission&from=2022-05-01T00:00:00Z&to=2022-06-01T00:00:00Z&page=2&limit=10", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	entries := data["entries"].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got: %d", len(entries))
+	}
+
+	entry := entries[0].(map[string]interface{})
+	if entry["actor_username"].(string) != "superadmin" {
+		t.Errorf("Expected superadmin, got: %v", entry["actor_username"])
+	}
+
+	after := entry["after"].(map[string]interface{})
+	if after["permission_name"].(string) != "read_orders" {
+		t.Errorf("Expected read_orders, got: %v", after)
+	}
+
+	if _, ok := entry["before"]; ok {
+		t.Errorf("Expected no before state, got: %v", entry["before"])
+	}
+}
+
+func TestAudit_LoginFailed(t *testing.T) {
+	serv, mock := newTestServer()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).
+		WillReturnError(noResultsError)
+
+	expectAudit(mock, "auth.login_failed", nil, nil, "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"username": "superadmin", "password": "superadmin"}`)
+
+	res, _ := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAudit_DeletePermission(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"delete_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(20, 1).
+		WillReturnRows(sqlmock.NewRows(permissionColumns).AddRow(20, "read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()))
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permissions WHERE id = $1 AND org_id = $2 AND deletable = TRUE;")).
+		ExpectExec().WithArgs(20, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectAudit(mock, "permission.delete", 1, "20", "read_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	res, b := request(t, serv, "/api/permissions/20", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAudit_FailureFailsRequest(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"delete_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(20, 1).
+		WillReturnRows(sqlmock.NewRows(permissionColumns).AddRow(20, "read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()))
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permissions WHERE id = $1 AND org_id = $2 AND deletable = TRUE;")).
+		ExpectExec().WithArgs(20, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+
+	res, b := request(t, serv, "/api/permissions/20", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "No se pudo guardar la acción en el registro de auditoría"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
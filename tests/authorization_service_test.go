@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/dsolartec/iam-meli/pkg"
 	"github.com/dsolartec/iam-meli/pkg/models"
 )
@@ -65,8 +66,8 @@ func TestLogin_EmptyPassword(t *testing.T) {
 func TestLogin_UserNotExists(t *testing.T) {
 	serv, mock := newTestServer()
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1;")).
-		WithArgs("superadmin").WillReturnError(noResultsError)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).WillReturnError(noResultsError)
 
 	body := []byte(`{
 		"username":"superadmin",
@@ -93,8 +94,8 @@ func TestLogin_IncorrectPassword(t *testing.T) {
 	serv, mock := newTestServer()
 
 	mock.ExpectQuery(
-		regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1;"),
-	).WithArgs("superadmin").
+		regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;"),
+	).WithArgs("superadmin", 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).
 				AddRow(1, "superadmin", "superadmin", time.Now()),
@@ -134,13 +135,16 @@ func TestLogin_AccessToken(t *testing.T) {
 	}
 
 	mock.ExpectQuery(
-		regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1;"),
-	).WithArgs("superadmin").
+		regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;"),
+	).WithArgs("superadmin", 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).
 				AddRow(1, "superadmin", user.Password, time.Now()),
 		)
 
+	expectAudit(mock, "auth.login", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 	body := []byte(`{
 		"username":"superadmin",
 		"password":"12345"
@@ -173,6 +177,54 @@ func TestLogin_AccessToken(t *testing.T) {
 	}
 }
 
+func TestLogin_RS256AccessToken(t *testing.T) {
+	key := setTokenPrivateKey(t)
+
+	serv, mock := newTestServer()
+
+	user := models.User{Password: "12345"}
+	if err := user.EncryptPassword(); err != nil {
+		t.Fatalf("Could not encrypt password %v", err)
+	}
+
+	mock.ExpectQuery(
+		regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;"),
+	).WithArgs("superadmin", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).
+				AddRow(1, "superadmin", user.Password, time.Now()),
+		)
+
+	expectAudit(mock, "auth.login", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"username": "superadmin", "password": "12345"}`)
+
+	res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	accessToken := data["accessToken"].(string)
+
+	// Con `JWT_PRIVATE_KEY` el token se valida con la llave pública y no con `JWT_KEY`.
+	token, err := jwt.Parse(accessToken, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+	if err != nil || token.Method != jwt.SigningMethodRS256 {
+		t.Fatalf("Expected an RS256 token, got: %v", err)
+	}
+
+	// El propio IAM lo acepta.
+	claim, err := pkg.ParseToken(accessToken, "MeLiTest")
+	if err != nil || claim.ID != 1 {
+		t.Errorf("Expected the IAM to accept the RS256 token, got: %v", err)
+	}
+}
+
 func TestSignUp_ValidationErrors(t *testing.T) {
 	cases := []struct {
 		username string
@@ -268,8 +320,8 @@ func TestSignUp_ValidationErrors(t *testing.T) {
 func TestSignUp_DuplicatedUsername(t *testing.T) {
 	serv, mock := newTestServer()
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).
-		WithArgs("superadmin").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
 
 	body := []byte(`{
@@ -300,11 +352,14 @@ func TestSignUp_AccessToken(t *testing.T) {
 
 	serv, mock := newTestServer()
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).
-		WithArgs("superadmin").WillReturnError(noResultsError)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (username, password, org_id) VALUES ($1, $2, $3) RETURNING id;")).
+		WithArgs("superadmin", anyPassword{}, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id;")).
-		WithArgs("superadmin", anyPassword{}).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	expectAudit(mock, "auth.signup", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	body := []byte(`{
 		"username":"superadmin",
@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/authcache"
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var (
+	effectivePermissionsColumns = []string{"id", "name", "username", "attributes", "condition"}
+	effectiveDeniesColumns      = []string{"id", "permission_id", "name", "reason", "expires_at"}
+)
+
+func expectEffectivePermissions(mock sqlmock.Sqlmock, userID int, permissions *sqlmock.Rows, denies *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1\n\t\t\tORDER BY p.id, pp.id;")).
+		WithArgs(userID).
+		WillReturnRows(permissions)
+
+	mock.ExpectQuery(regexp.QuoteMeta("AND (d.expires_at IS NULL OR d.expires_at > now())\n\t\t\tORDER BY d.id;")).
+		WithArgs(userID).
+		WillReturnRows(denies)
+}
+
+func TestAuthzCache_VerifyPermission(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	cache := authcache.New(10, time.Minute)
+	repository := repositories.AuthorizationRepository{Database: db, Cache: cache}
+
+	ctx := context.WithValue(context.Background(), "current_user_id", 2)
+
+	expires := time.Now().Add(time.Hour)
+	expectEffectivePermissions(mock, 2,
+		sqlmock.NewRows(effectivePermissionsColumns).
+			AddRow(3, "grant_permission", "ana", []byte(`{"team":"billing"}`), nil).
+			AddRow(5, "delete_user", "ana", []byte(`{"team":"billing"}`), `subject.attributes.team == "platform"`),
+		sqlmock.NewRows(effectiveDeniesColumns).
+			AddRow(1, 4, "revoke_permission", "Congelamiento de cambios", expires),
+	)
+
+	if err := repository.VerifyPermission(ctx, "grant_permission"); err != nil {
+		t.Errorf("Expected grant_permission to be allowed, got: %v", err)
+	}
+
+	// Las siguientes verificaciones salen de la caché.
+	if err := repository.VerifyPermission(ctx, "grant_permission"); err != nil {
+		t.Errorf("Expected grant_permission to be allowed, got: %v", err)
+	}
+
+	if err := repository.VerifyPermission(ctx, "delete_user"); err == nil || err.Error() != "No cumples las condiciones requeridas para usar este permiso" {
+		t.Errorf("Expected the policy to fail, got: %v", err)
+	}
+
+	if err := repository.VerifyPermission(ctx, "revoke_permission"); !errors.Is(err, models.ErrPermissionDenied) || !strings.HasPrefix(err.Error(), "Se te ha denegado explícitamente este permiso hasta el") {
+		t.Errorf("Expected revoke_permission to be denied, got: %v", err)
+	}
+
+	expectBreakGlass(mock, 2, "manage_webhooks").WillReturnError(noResultsError)
+
+	if err := repository.VerifyPermission(ctx, "manage_webhooks"); err == nil {
+		t.Error("Expected manage_webhooks to be rejected")
+	}
+
+	// Al retirar el permiso el trigger avisa por el canal y se vuelve a cargar.
+	cache.Notify("2")
+
+	expectEffectivePermissions(mock, 2, sqlmock.NewRows(effectivePermissionsColumns), sqlmock.NewRows(effectiveDeniesColumns))
+	expectBreakGlass(mock, 2, "grant_permission").WillReturnError(noResultsError)
+
+	if err := repository.VerifyPermission(ctx, "grant_permission"); err == nil {
+		t.Error("Expected grant_permission to be rejected after the invalidation")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	rec := httptest.NewRecorder()
+	cache.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, expected := range []string{"iam_authz_cache_hits_total 4", "iam_authz_cache_misses_total 2", "iam_authz_cache_invalidations_total 1", "iam_authz_cache_entries 1"} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", expected, rec.Body.String())
+		}
+	}
+}
+
+func TestAuthzCache_SizeAndTTL(t *testing.T) {
+	now := time.Now()
+
+	cache := authcache.New(2, time.Minute)
+	cache.Now = func() time.Time { return now }
+
+	loads := 0
+	load := func() (*models.EffectivePermissions, error) {
+		loads++
+		return &models.EffectivePermissions{}, nil
+	}
+
+	cache.Load(1, load)
+	cache.Load(2, load)
+	cache.Load(1, load)
+
+	// El usuario 2 es el que lleva más tiempo sin usarse, así que sale al agregar el 3.
+	cache.Load(3, load)
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got: %d", cache.Len())
+	}
+
+	cache.Load(1, load)
+	if loads != 3 {
+		t.Errorf("Expected the user 1 to stay in the cache, got %d loads", loads)
+	}
+
+	cache.Load(2, load)
+	if loads != 4 {
+		t.Errorf("Expected the user 2 to be loaded again, got %d loads", loads)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	cache.Load(2, load)
+	if loads != 5 {
+		t.Errorf("Expected the expired entry to be loaded again, got %d loads", loads)
+	}
+
+	// Una carga que coincide con una invalidación no se guarda.
+	cache.Load(4, func() (*models.EffectivePermissions, error) {
+		cache.Notify("*")
+		return load()
+	})
+
+	cache.Load(4, load)
+	if loads != 7 {
+		t.Errorf("Expected the stale load to be discarded, got %d loads", loads)
+	}
+}
+
+func TestAuthzCache_BypassedWithoutListener(t *testing.T) {
+	cache := authcache.New(10, time.Minute)
+
+	loads := 0
+	load := func() (*models.EffectivePermissions, error) {
+		loads++
+		return &models.EffectivePermissions{}, nil
+	}
+
+	cache.Load(1, load)
+
+	// La base de datos no acepta conexiones, así que no se puede escuchar el canal.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		authcache.Listen("postgres://127.0.0.1:1/iam-meli?sslmode=disable&connect_timeout=1", cache, stop)
+		close(done)
+	}()
+
+	for i := 0; cache.Enabled() && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if cache.Enabled() || cache.Len() != 0 {
+		t.Fatalf("Expected the cache to be purged and disabled, got %d entries", cache.Len())
+	}
+
+	// Sin invalidaciones cada verificación consulta la base de datos.
+	cache.Load(1, load)
+	cache.Load(1, load)
+
+	if loads != 3 || cache.Len() != 0 {
+		t.Errorf("Expected the cache to be bypassed, got %d loads and %d entries", loads, cache.Len())
+	}
+
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Listen to return after stop")
+	}
+
+	cache.Enable()
+	cache.Load(1, load)
+	cache.Load(1, load)
+
+	if loads != 4 {
+		t.Errorf("Expected the cache to be used again, got %d loads", loads)
+	}
+}
+
+func TestAuthzCache_Metrics(t *testing.T) {
+	os.Setenv("AUTHZ_CACHE_SIZE", "100")
+	defer os.Unsetenv("AUTHZ_CACHE_SIZE")
+
+	os.Setenv("METRICS_TOKEN", "MeLiMetrics")
+	defer os.Unsetenv("METRICS_TOKEN")
+
+	serv, _ := newTestServer()
+
+	res, body := request(t, serv, "/metrics", "GET", nil, "MeLiMetrics")
+	if res.StatusCode != 200 || !strings.Contains(string(body), "iam_authz_cache_hits_total 0") {
+		t.Errorf("Expected the cache metrics, got: %d %s", res.StatusCode, body)
+	}
+}
+
+// benchDriver responde siempre lo mismo y cuenta las consultas, para medir la verificación sin
+// depender de PostgreSQL.
+type benchDriver struct {
+	queries *int64
+}
+
+var benchQueries int64
+
+func init() {
+	sql.Register("iam-bench", benchDriver{queries: &benchQueries})
+}
+
+type benchConn struct{ benchDriver }
+
+type benchStmt struct {
+	benchDriver
+	query string
+}
+
+type benchRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (d benchDriver) Open(name string) (driver.Conn, error) { return benchConn{d}, nil }
+
+func (c benchConn) Prepare(query string) (driver.Stmt, error) {
+	return benchStmt{c.benchDriver, query}, nil
+}
+func (c benchConn) Close() error              { return nil }
+func (c benchConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s benchStmt) Close() error  { return nil }
+func (s benchStmt) NumInput() int { return -1 }
+
+func (s benchStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s benchStmt) Query(args []driver.Value) (driver.Rows, error) {
+	atomic.AddInt64(s.queries, 1)
+
+	switch {
+	case strings.Contains(s.query, "permission_denies"):
+		return &benchRows{columns: effectiveDeniesColumns}, nil
+	case strings.Contains(s.query, "WHERE p.name = $2"):
+		return &benchRows{columns: []string{"id", "username", "attributes", "condition"}, values: [][]driver.Value{{int64(1), "superadmin", []byte("{}"), nil}}}, nil
+	default:
+		return &benchRows{columns: effectivePermissionsColumns, values: [][]driver.Value{{int64(1), "delete_user", "superadmin", []byte("{}"), nil}}}, nil
+	}
+}
+
+func (r *benchRows) Columns() []string { return r.columns }
+func (r *benchRows) Close() error      { return nil }
+
+func (r *benchRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+
+	return nil
+}
+
+func benchmarkVerifyPermission(b *testing.B, cache *authcache.Cache) {
+	conn, err := sql.Open("iam-bench", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	repository := repositories.AuthorizationRepository{Database: &database.Database{Conn: conn}}
+	if cache != nil {
+		repository.Cache = cache
+	}
+
+	ctx := context.WithValue(context.Background(), "current_user_id", 1)
+
+	atomic.StoreInt64(&benchQueries, 0)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := repository.VerifyPermission(ctx, "delete_user"); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&benchQueries))/float64(b.N), "queries/op")
+}
+
+func BenchmarkVerifyPermission_Uncached(b *testing.B) {
+	benchmarkVerifyPermission(b, nil)
+}
+
+func BenchmarkVerifyPermission_Cached(b *testing.B) {
+	benchmarkVerifyPermission(b, authcache.New(1000, time.Minute))
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+func TestExplainAuthorization_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	res, b := request(t, serv, "/api/authz/explain?user=meli&permission=delete_user", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestExplainAuthorization_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/api/authz/explain?permission=delete_user", expected: "Debes ingresar el ID o nombre del usuario"},
+		{path: "/api/authz/explain?user=meli", expected: "Debes ingresar el nombre del permiso"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"explain_authorization"})
+
+		res, b := request(t, serv, td.path, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestExplainAuthorization_UserNotFound(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"explain_authorization"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("meli", 1).
+		WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/authz/explain?user=meli&permission=delete_user", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El usuario no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestExplainAuthorization_Success(t *testing.T) {
+	cases := []struct {
+		permission string
+		allowed    bool
+	}{{permission: "delete_user", allowed: false}, {permission: "permission_test", allowed: true}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"explain_authorization"})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs(td.permission, 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(1, td.permission, "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+			)
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT attributes FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"attributes"}).AddRow([]byte(`{"department":"it"}`)))
+
+		expectPermissionDeny(mock, 2, td.permission).WillReturnError(noResultsError)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`
+			SELECT
+				up.id,
+				up.permission_id,
+				p.name as permission_name
+			FROM user_permissions up
+				INNER JOIN permissions p ON p.id = up.permission_id
+			WHERE up.user_id = $1
+			ORDER BY up.id;
+		`)).
+			WithArgs(2).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "permission_id", "permission_name"}).
+					AddRow(7, 8, "permission_test").
+					AddRow(8, 9, "permission_test_1"),
+			)
+
+		if !td.allowed {
+			expectBreakGlass(mock, 2, td.permission).WillReturnError(noResultsError)
+		}
+
+		if td.allowed {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, condition FROM permission_policies WHERE permission_id = $1 ORDER BY id;")).
+				WithArgs(8).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "condition"}).AddRow(1, `subject.attributes.department == "it"`))
+		}
+
+		res, b := request(t, serv, "/api/authz/explain?user=2&permission="+td.permission, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+		}
+
+		var data pkg.Map
+		if err := json.Unmarshal(b, &data); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		decision := data["decision"].(map[string]interface{})
+		if decision["allowed"].(bool) != td.allowed {
+			t.Errorf("Expected %t, got: %t", td.allowed, decision["allowed"].(bool))
+		}
+
+		subject := decision["subject"].(map[string]interface{})
+		if subject["username"].(string) != "meli" {
+			t.Errorf("Expected meli, got: %s", subject["username"].(string))
+		}
+
+		candidates := decision["candidates"].([]interface{})
+		if len(candidates) != 2 {
+			t.Fatalf("Expected 2 candidates, got: %d", len(candidates))
+		}
+
+		applies := candidates[0].(map[string]interface{})["applies"].(bool)
+		if applies != td.allowed {
+			t.Errorf("Expected %t, got: %t", td.allowed, applies)
+		}
+	}
+}
+
+func TestExplainAuthorization_PolicyNotSatisfied(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"explain_authorization"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(8, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT attributes FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"attributes"}).AddRow([]byte(`{}`)))
+
+	expectPermissionDeny(mock, 2, "permission_test").WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "permission_id", "permission_name"}).AddRow(7, 8, "permission_test"))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, condition FROM permission_policies WHERE permission_id = $1 ORDER BY id;")).
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "condition"}).AddRow(1, `ip_in_range(request.ip, "10.0.0.0/8")`))
+
+	res, b := request(t, serv, "/api/authz/explain?user=2&permission=permission_test&ip=192.168.1.10", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	decision := data["decision"].(map[string]interface{})
+	if decision["allowed"].(bool) {
+		t.Errorf("Expected allowed false, got: true")
+	}
+
+	evaluations := decision["policies"].([]interface{})
+	if len(evaluations) != 1 || evaluations[0].(map[string]interface{})["passed"].(bool) {
+		t.Errorf("Expected 1 failed policy, got: %v", evaluations)
+	}
+}
@@ -0,0 +1,373 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/core/services"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var breakGlassColumns = []string{"id", "user_id", "justification", "permissions", "started_at", "expires_at"}
+
+func TestBreakGlass_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "break_glass").WillReturnError(noResultsError)
+
+	body := []byte(`{"justification": "Caída total del servicio de pagos"}`)
+
+	res, b := request(t, serv, "/api/breakglass", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestBreakGlass_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		permissions string
+		body        string
+		message     string
+	}{
+		{permissions: "", body: `{"justification": "Caída total del servicio de pagos"}`, message: "El acceso de emergencia no está configurado"},
+		{permissions: "create_user,delete_user", body: `{"justification": "Caída"}`, message: "La justificación del acceso de emergencia debe tener entre 20 y 500 caracteres"},
+	}
+
+	for _, td := range cases {
+		os.Setenv("BREAK_GLASS_PERMISSIONS", td.permissions)
+
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"break_glass"})
+
+		res, b := request(t, serv, "/api/breakglass", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+
+	os.Unsetenv("BREAK_GLASS_PERMISSIONS")
+}
+
+func TestBreakGlass_AlreadyActive(t *testing.T) {
+	os.Setenv("BREAK_GLASS_PERMISSIONS", "create_user,delete_user")
+	defer os.Unsetenv("BREAK_GLASS_PERMISSIONS")
+
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"break_glass"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+
+	expiresAt := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now()")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(breakGlassColumns).AddRow(1, 1, "Caída total del servicio de pagos", "{create_user,delete_user}", time.Now(), expiresAt))
+
+	body := []byte(`{"justification": "Caída total del servicio de pagos"}`)
+
+	res, b := request(t, serv, "/api/breakglass", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "Ya tienes un acceso de emergencia activo hasta el 2030-01-02 15:04"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestBreakGlass_ConcurrentActivation(t *testing.T) {
+	os.Setenv("BREAK_GLASS_PERMISSIONS", "create_user,delete_user")
+	defer os.Unsetenv("BREAK_GLASS_PERMISSIONS")
+
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"break_glass"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now()")).
+		WithArgs(1).
+		WillReturnError(noResultsError)
+
+	// Otra activación abrió su sesión entre la consulta y la inserción.
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("SELECT id FROM users WHERE id = $1 FOR UPDATE;")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE NOT EXISTS (SELECT 1 FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now()) RETURNING id;")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectRollback()
+
+	body := []byte(`{"justification": "Caída total del servicio de pagos"}`)
+
+	res, b := request(t, serv, "/api/breakglass", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if expected := "Ya tienes un acceso de emergencia activo"; errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestBreakGlass_Success(t *testing.T) {
+	events := make(chan models.SecurityEvent, 1)
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.SecurityEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Could not decode event %v", err)
+		}
+
+		events <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhook.Close()
+
+	os.Setenv("BREAK_GLASS_PERMISSIONS", "create_user, delete_user")
+	os.Setenv("SECURITY_WEBHOOK_URL", webhook.URL)
+
+	defer os.Unsetenv("BREAK_GLASS_PERMISSIONS")
+	defer os.Unsetenv("SECURITY_WEBHOOK_URL")
+
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"break_glass"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now()")).
+		WithArgs(1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("SELECT id FROM users WHERE id = $1 FOR UPDATE;")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE NOT EXISTS (SELECT 1 FROM break_glass_sessions WHERE user_id = $1 AND expires_at > now()) RETURNING id;")).
+		WithArgs(1, "Caída total del servicio de pagos", "{\"create_user\",\"delete_user\"}", anyTime{}, anyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "break_glass.activate", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"justification": "Caída total del servicio de pagos"}`)
+
+	res, b := request(t, serv, "/api/breakglass", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data struct {
+		Session models.BreakGlassSession `json:"session"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if window := data.Session.ExpiresAt.Sub(data.Session.StartedAt); window != time.Hour {
+		t.Errorf("Expected a window of 1h, got: %s", window)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != "break_glass.activated" || event.Severity != "high" {
+			t.Errorf("Expected a high severity break_glass.activated event, got: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the security webhook to be notified")
+	}
+}
+
+func TestBreakGlass_GrantsConfiguredPermissions(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "review_break_glass").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}))
+
+	expectBreakGlass(mock, 1, "review_break_glass").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM break_glass_sessions bg INNER JOIN users u ON u.id = bg.user_id WHERE u.org_id = $1")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "username", "justification", "permissions", "started_at", "expires_at"}).
+				AddRow(3, 1, "superadmin", "Caída total del servicio de pagos", "{review_break_glass}", time.Now(), time.Now().Add(time.Hour)),
+		)
+
+	res, b := request(t, serv, "/api/breakglass", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+}
+
+func TestBreakGlass_DelegatesPermissions(t *testing.T) {
+	cases := []struct {
+		query   string
+		message string
+	}{
+		{message: "El usuario ya tiene el permiso asignado"},
+		{query: "?grantable=true", message: "No puedes otorgar el permiso delete_user como delegable porque no tienes el permiso delegate_any_permission"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{})
+
+		// grant_permission solo está disponible por el acceso de emergencia.
+		expectVerifyPermission(mock, 1, "grant_permission").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}))
+
+		expectBreakGlass(mock, 1, "grant_permission").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("delete_user", 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(3, "delete_user", "Poder eliminar usuarios", false, false, time.Now(), time.Now()),
+			)
+
+		expectVerifyDelegation(mock, 1, 3, "delete_user").
+			WillReturnRows(sqlmock.NewRows([]string{"admin", "emergency", "holds", "grantable", "breached"}).AddRow(false, true, false, false, nil))
+
+		if td.query == "" {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+				WithArgs(2, 3, 1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id"}).AddRow(9, 2, 3))
+		}
+
+		res, b := request(t, serv, "/api/users/2/permissions/delete_user"+td.query, "PATCH", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCrossTenant_BreakGlass(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{"review_break_glass"})
+
+	// Las sesiones de emergencia de la plataforma no se listan para la organización 2.
+	mock.ExpectQuery(regexp.QuoteMeta("FROM break_glass_sessions bg INNER JOIN users u ON u.id = bg.user_id WHERE u.org_id = $1")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "username", "justification", "permissions", "started_at", "expires_at"}))
+
+	res, _ := request(t, serv, "/api/breakglass", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestValidateBreakGlassPermissions(t *testing.T) {
+	os.Setenv("BREAK_GLASS_PERMISSIONS", "delete_user, create_user")
+	defer os.Unsetenv("BREAK_GLASS_PERMISSIONS")
+
+	db, mock := newDatabaseMock()
+
+	query := regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")
+
+	mock.ExpectQuery(query).
+		WithArgs("delete_user", 1).
+		WillReturnRows(sqlmock.NewRows(permissionColumns).AddRow(3, "delete_user", "Poder eliminar usuarios", false, false, time.Now(), time.Now()))
+
+	mock.ExpectQuery(query).
+		WithArgs("create_user", 1).
+		WillReturnError(noResultsError)
+
+	err := services.ValidateBreakGlassPermissions(context.Background(), &repositories.PermissionsRepository{Database: db})
+	if err == nil || err.Error() != "El permiso create_user de `BREAK_GLASS_PERMISSIONS` no existe." {
+		t.Errorf("Expected create_user to be rejected, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"regexp"
 	"strings"
 	"testing"
@@ -49,6 +50,9 @@ func newDatabaseMock() (*database.Database, sqlmock.Sqlmock) {
 }
 
 func newTestServer() (*internal.Server, sqlmock.Sqlmock) {
+	os.Setenv("JWT_KEY", "MeLiTest")
+	os.Setenv("SIGNING_KEY", "MeLiSigningTest")
+
 	db, mock := newDatabaseMock()
 
 	return internal.New(db, "80"), mock
@@ -82,19 +86,80 @@ func request(t *testing.T, serv *internal.Server, path string, method string, bo
 	return res, b
 }
 
+func expectBreakGlass(mock sqlmock.Sqlmock, userID int, permissionName string) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM break_glass_sessions WHERE user_id = $1 AND $2 = ANY(permissions) AND expires_at > now() LIMIT 1;")).
+		WithArgs(userID, permissionName)
+}
+
+func expectUserLock(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT id FROM users WHERE id = $1 FOR UPDATE;")).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectGrantLock(mock sqlmock.Sqlmock, username string, permission string, userID int, permissionID int) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT u.id, p.id FROM users u INNER JOIN permissions p ON p.name = $2 AND p.org_id = u.org_id WHERE u.username = $1 AND u.org_id = $3 FOR UPDATE OF u;")).
+		WithArgs(username, permission, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "id"}).AddRow(userID, permissionID))
+}
+
+func expectBreachedConstraints(mock sqlmock.Sqlmock, userID int, permissionID int) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE $2 = ANY(c.permission_ids) AND c.org_id = $3")).
+		WithArgs(userID, permissionID, 1)
+}
+
+func expectVerifyDelegation(mock sqlmock.Sqlmock, userID int, permissionID int, permissionName string) *sqlmock.ExpectedQuery {
+	expectPermissionDeny(mock, userID, permissionName).WillReturnError(noResultsError)
+
+	return mock.ExpectQuery(regexp.QuoteMeta("ORDER BY c.id LIMIT 1 ) as breached;")).
+		WithArgs(userID, permissionID)
+}
+
+func delegationRows(admin bool, holds bool, grantable bool, breached interface{}) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"admin", "emergency", "holds", "grantable", "breached"}).AddRow(admin, false, holds, grantable, breached)
+}
+
+func expectPermissionDeny(mock sqlmock.Sqlmock, userID int, permissionName string) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(regexp.QuoteMeta(`
+		SELECT d.id, d.permission_id, d.reason, d.expires_at FROM permission_denies d
+			INNER JOIN permissions p ON p.id = d.permission_id
+			INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id
+			WHERE p.name = $2
+				AND (d.user_id = $1 OR (d.user_id IS NULL AND NOT ($1 = ANY(d.except_user_ids))))
+				AND (d.expires_at IS NULL OR d.expires_at > now())
+			ORDER BY d.id LIMIT 1;
+	`)).
+		WithArgs(userID, permissionName)
+}
+
+func expectVerifyPermission(mock sqlmock.Sqlmock, userID int, permissionName string) *sqlmock.ExpectedQuery {
+	expectPermissionDeny(mock, userID, permissionName).WillReturnError(noResultsError)
+
+	return mock.ExpectQuery(regexp.QuoteMeta(`
+		SELECT p.id, u.username, u.attributes, pp.condition FROM permissions p
+			INNER JOIN user_permissions up ON up.user_id = $1 AND up.permission_id = p.id
+			INNER JOIN users u ON u.id = up.user_id AND u.org_id = p.org_id
+			LEFT JOIN permission_policies pp ON pp.permission_id = p.id
+			WHERE p.name = $2
+	`)).
+		WithArgs(userID, permissionName)
+}
+
 func generateAccessToken(t *testing.T, mock sqlmock.Sqlmock, permission_names []string) string {
+	return generateTenantAccessToken(t, mock, 1, 1, permission_names)
+}
+
+func generateTenantAccessToken(t *testing.T, mock sqlmock.Sqlmock, org int, userID int, permission_names []string) string {
 	for permission_id, permission_name := range permission_names {
-		mock.ExpectQuery(regexp.QuoteMeta(`
-			SELECT p.id FROM permissions p
-				INNER JOIN user_permissions up ON up.user_id = $1 AND up.permission_id = p.id
-				WHERE name = $2
-		`)).
-			WithArgs(1, permission_name).
-			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(permission_id + 1))
+		expectVerifyPermission(mock, userID, permission_name).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).
+					AddRow(permission_id+1, "superadmin", []byte("{}"), nil),
+			)
 	}
 
-	// Generamos el token para el usuario con ID 1
-	claim := pkg.Claim{ID: 1}
+	// Generamos el token para el usuario dentro de la organización indicada.
+	claim := pkg.Claim{ID: userID, Org: org}
 
 	token, err := claim.GenerateToken("MeLiTest")
 	if err != nil {
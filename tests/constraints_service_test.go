@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+var constraintColumns = []string{"id", "name", "description", "max_allowed", "permission_ids", "permissions", "created_at"}
+
+func TestCreateConstraint_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "manage_constraints").WillReturnError(noResultsError)
+
+	body := []byte(`{"name": "payments", "description": "Pagos creados y aprobados por personas distintas", "permissions": ["create_payment", "approve_payment"]}`)
+
+	res, b := request(t, serv, "/api/constraints", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreateConstraint_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body    string
+		message string
+	}{
+		{body: `{"description": "Pagos creados y aprobados por personas distintas"}`, message: "Debes ingresar el nombre de la restricción"},
+		{body: `{"name": "payments", "description": "Pagos"}`, message: "La descripción de la restricción debe tener entre 10 y 150 caracteres"},
+		{body: `{"name": "payments", "description": "Pagos creados y aprobados por personas distintas", "permissions": ["create_payment"]}`, message: "La restricción debe incluir al menos dos permisos"},
+		{body: `{"name": "payments", "description": "Pagos creados y aprobados por personas distintas", "permissions": ["create_payment", "create_payment"]}`, message: "La restricción no puede incluir permisos repetidos"},
+		{body: `{"name": "payments", "description": "Pagos creados y aprobados por personas distintas", "permissions": ["create_payment", "approve_payment"], "max_allowed": 2}`, message: "La cantidad máxima de permisos permitidos debe ser mayor a 0 y menor a la cantidad de permisos de la restricción"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_constraints"})
+
+		res, b := request(t, serv, "/api/constraints", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateConstraint_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_constraints"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 AND c.name = $2;")).
+		WithArgs(1, "payments").
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	for id, name := range []string{"create_payment", "approve_payment"} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs(name, 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(id+7, name, "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+			)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO separation_constraints (org_id, name, description, max_allowed, permission_ids) VALUES ($1, $2, $3, $4, $5) RETURNING id;")).
+		WithArgs(1, "payments", "Pagos creados y aprobados por personas distintas", 1, "{7,8}").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	expectAudit(mock, "constraint.create", 1, "1", "payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"name": "payments", "description": "Pagos creados y aprobados por personas distintas", "permissions": ["create_payment", "approve_payment"]}`)
+
+	res, b := request(t, serv, "/api/constraints", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	if location := res.Header.Get("Location"); location != "/api/constraints/1" {
+		t.Errorf("Expected /api/constraints/1, got: %s", location)
+	}
+}
+
+func TestGetConstraintViolations_NoData(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_constraints"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c INNER JOIN user_permissions up ON up.permission_id = ANY(c.permission_ids)")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"constraint_id", "constraint_name", "user_id", "username", "permissions"}))
+
+	res, _ := request(t, serv, "/api/constraints/violations", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+}
+
+func TestGetConstraintViolations_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_constraints"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c INNER JOIN user_permissions up ON up.permission_id = ANY(c.permission_ids)")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"constraint_id", "constraint_name", "user_id", "username", "permissions"}).
+				AddRow(1, "payments", 2, "meli", "{approve_payment,create_payment}"),
+		)
+
+	res, b := request(t, serv, "/api/constraints/violations", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	violations := data["violations"].([]interface{})
+	if len(violations) != 1 {
+		t.Fatalf("Expected 1 violation, got: %d", len(violations))
+	}
+
+	violation := violations[0].(map[string]interface{})
+	if violation["username"].(string) != "meli" {
+		t.Errorf("Expected meli, got: %s", violation["username"].(string))
+	}
+
+	if permissions := violation["permissions"].([]interface{}); len(permissions) != 2 {
+		t.Errorf("Expected 2 permissions, got: %v", permissions)
+	}
+}
+
+func TestCrossTenant_Constraints(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	res, _ := request(t, serv, "/api/constraints", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	// La restricción 1 pertenece a la plataforma, así que no existe para la organización 2.
+	generateTenantAccessToken(t, mock, 2, 5, []string{"manage_constraints"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 AND c.id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	res, b := request(t, serv, "/api/constraints/1", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if errorMessage.Message != "La restricción no existe" {
+		t.Errorf("Expected La restricción no existe, got: %s", errorMessage.Message)
+	}
+
+	generateTenantAccessToken(t, mock, 2, 5, []string{"manage_constraints"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c INNER JOIN user_permissions up ON up.permission_id = ANY(c.permission_ids) INNER JOIN users u ON u.id = up.user_id INNER JOIN permissions p ON p.id = up.permission_id WHERE c.org_id = $1")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"constraint_id", "constraint_name", "user_id", "username", "permissions"}))
+
+	res, _ = request(t, serv, "/api/constraints/violations", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
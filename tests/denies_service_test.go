@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+var denyColumns = []string{"id", "permission_id", "permission_name", "user_id", "except_user_ids", "reason", "expires_at", "created_by", "created_at"}
+
+func TestCreateDeny_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "manage_denies").WillReturnError(noResultsError)
+
+	body := []byte(`{"permission_name": "permission_test", "user": "meli", "reason": "Investigación de incidente"}`)
+
+	res, b := request(t, serv, "/api/denies", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreateDeny_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body    string
+		message string
+	}{
+		{body: `{"permission_name": "permission_test"}`, message: "Debes ingresar el motivo de la denegación"},
+		{body: `{"permission_name": "permission_test", "user": "meli", "except_users": ["admin"], "reason": "Incidente"}`, message: "No puedes denegar el permiso a un usuario y exceptuar usuarios al mismo tiempo"},
+		{body: `{"permission_name": "permission_test", "reason": "Incidente", "expires_at": "2020-01-01T00:00:00Z"}`, message: "La fecha de expiración debe ser posterior a la fecha actual"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_denies"})
+
+		res, b := request(t, serv, "/api/denies", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateDeny_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_denies"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("admin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(3, "admin", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permission_denies (permission_id, user_id, except_user_ids, reason, expires_at, created_by) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;")).
+		WithArgs(7, nil, "{3}", "Investigación de incidente", nil, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+	expectAudit(mock, "deny.create", 1, "4", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"permission_name": "permission_test", "except_users": ["admin"], "reason": "Investigación de incidente"}`)
+
+	res, b := request(t, serv, "/api/denies", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	if location := res.Header.Get("Location"); location != "/api/denies/4" {
+		t.Errorf("Expected /api/denies/4, got: %s", location)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	deny := data["deny"].(map[string]interface{})
+	if _, ok := deny["user_id"]; ok {
+		t.Errorf("Expected deny without user_id, got: %v", deny["user_id"])
+	}
+
+	exceptUserIDs := deny["except_user_ids"].([]interface{})
+	if len(exceptUserIDs) != 1 || exceptUserIDs[0].(float64) != 3 {
+		t.Errorf("Expected [3], got: %v", exceptUserIDs)
+	}
+}
+
+func TestDeleteDeny_NotFound(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_denies"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id WHERE d.id = $1 AND p.org_id = $2;")).
+		WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows(denyColumns))
+
+	res, b := request(t, serv, "/api/denies/4", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La denegación no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestDeleteDeny_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_denies"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id WHERE d.id = $1 AND p.org_id = $2;")).
+		WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows(denyColumns).AddRow(4, 7, "permission_test", 2, "{}", "Investigación de incidente", nil, 1, time.Now()))
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permission_denies d USING permissions p WHERE d.id = $1 AND p.id = d.permission_id AND p.org_id = $2;")).
+		ExpectExec().
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectAudit(mock, "deny.delete", 1, "4", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	res, b := request(t, serv, "/api/denies/4", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+}
+
+func TestCrossTenant_Denies(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id WHERE p.org_id = $1 ORDER BY d.id;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(denyColumns))
+
+	res, _ := request(t, serv, "/api/denies", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	// La denegación 4 pertenece a la plataforma, así que no existe para la organización 2.
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id WHERE d.id = $1 AND p.org_id = $2;")).
+		WithArgs(4, 2).
+		WillReturnRows(sqlmock.NewRows(denyColumns))
+
+	res, _ = request(t, serv, "/api/denies/4", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	generateTenantAccessToken(t, mock, 2, 5, []string{"manage_denies"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id WHERE d.id = $1 AND p.org_id = $2;")).
+		WithArgs(4, 2).
+		WillReturnRows(sqlmock.NewRows(denyColumns))
+
+	res, b := request(t, serv, "/api/denies/4", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeniesRepository_DeleteIsScopedByOrganization(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	repository := repositories.DeniesRepository{Database: db}
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permission_denies d USING permissions p WHERE d.id = $1 AND p.id = d.permission_id AND p.org_id = $2;")).
+		ExpectExec().
+		WithArgs(4, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx := context.WithValue(context.Background(), "current_org_id", 2)
+
+	if err := repository.Delete(ctx, 4); err != nil {
+		t.Fatalf("Could not delete the deny %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestVerifyPermission_Denied(t *testing.T) {
+	serv, mock := newTestServer()
+
+	expiresAt := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+
+	expectPermissionDeny(mock, 1, "create_permission").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "permission_id", "reason", "expires_at"}).AddRow(4, 2, "Investigación de incidente", expiresAt))
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	body := []byte(`{"name": "permission_test", "description": "Este es un permiso de prueba"}`)
+
+	res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "Se te ha denegado explícitamente este permiso hasta el 2030-01-02 15:04"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
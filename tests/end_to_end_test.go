@@ -25,14 +25,17 @@ func TestEndToEnd(t *testing.T) {
 
 		body := []byte(`{"username":"meli", "password":"meli"}`)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).
-			WithArgs("meli").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+			WithArgs("meli", 1).
 			WillReturnError(noResultsError)
 
-		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (username, password) VALUES ($1, $2) RETURNING id;")).
-			WithArgs("meli", anyPassword{}).
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (username, password, org_id) VALUES ($1, $2, $3) RETURNING id;")).
+			WithArgs("meli", anyPassword{}, 1).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 
+		expectAudit(mock, "auth.signup", 2, "2", "meli").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 		res, b := request(t, serv, "/api/auth/signup", "POST", bytes.NewBuffer(body), "")
 		if res.StatusCode != http.StatusOK {
 			t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
@@ -48,12 +51,12 @@ func TestEndToEnd(t *testing.T) {
 		t.Run("Error al intentar crear un permiso", func(t *testing.T) {
 			body := []byte(`{"name": "permission_test", "description": "Este es un permiso de prueba"}`)
 
-			mock.ExpectQuery("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;").
-				WithArgs("permission_test").
+			mock.ExpectQuery("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;").
+				WithArgs("permission_test", 1).
 				WillReturnError(noResultsError)
 
-			mock.ExpectQuery("INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id;").
-				WithArgs("permission_test", "Este es un permiso de prueba").
+			mock.ExpectQuery("INSERT INTO permissions (name, description, org_id, application_id) VALUES ($1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4)) RETURNING id;").
+				WithArgs("permission_test", "Este es un permiso de prueba", 1, "").
 				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 			res, b := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
@@ -84,13 +87,16 @@ func TestEndToEnd(t *testing.T) {
 
 		body := []byte(`{"username":"superadmin","password":"superadmin"}`)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1;")).
-			WithArgs("superadmin").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+			WithArgs("superadmin", 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).
 					AddRow(1, "superadmin", user.Password, time.Now()),
 			)
 
+		expectAudit(mock, "auth.login", 1, "1", "superadmin").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 		res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
 		if res.StatusCode != http.StatusOK {
 			t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
@@ -109,22 +115,20 @@ func TestEndToEnd(t *testing.T) {
 				"description": "Este es un permiso de prueba"
 			}`)
 
-			mock.ExpectQuery(regexp.QuoteMeta(`
-				SELECT p.id FROM permissions p
-					INNER JOIN user_permissions up ON up.user_id = $1 AND up.permission_id = p.id
-					WHERE name = $2
-			`)).
-				WithArgs(1, "create_permission").
-				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+			expectVerifyPermission(mock, 1, "create_permission").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).AddRow(2, "superadmin", []byte("{}"), nil))
 
-			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-				WithArgs("permission_test").
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+				WithArgs("permission_test", 1).
 				WillReturnError(noResultsError)
 
-			mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id;")).
-				WithArgs("permission_test", "Este es un permiso de prueba").
+			mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) VALUES ($1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4)) RETURNING id;")).
+				WithArgs("permission_test", "Este es un permiso de prueba", 1, "").
 				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
 
+			expectAudit(mock, "permission.create", 1, "7", "permission_test").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 			res, _ := request(t, serv, "/api/permissions", "POST", bytes.NewBuffer(body), accessToken)
 			if res.StatusCode != http.StatusCreated {
 				t.Errorf("Expected %d, got: %d", http.StatusCreated, res.StatusCode)
@@ -136,32 +140,42 @@ func TestEndToEnd(t *testing.T) {
 			}
 
 			t.Run("Asignamos el permiso al usuario meli", func(t *testing.T) {
-				mock.ExpectQuery(regexp.QuoteMeta(`
-					SELECT p.id FROM permissions p
-						INNER JOIN user_permissions up ON up.user_id = $1 AND up.permission_id = p.id
-						WHERE name = $2
-				`)).
-					WithArgs(1, "grant_permission").
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
-
-				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).
-					WithArgs(2).
+				expectVerifyPermission(mock, 1, "grant_permission").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).AddRow(2, "superadmin", []byte("{}"), nil))
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+					WithArgs(2, 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-					WithArgs("permission_test").
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+					WithArgs("permission_test", 1).
 					WillReturnRows(
 						sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 							AddRow(7, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
 					)
 
-				mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;")).
-					WithArgs(2, 7).
+				expectVerifyDelegation(mock, 1, 7, "permission_test").
+					WillReturnRows(delegationRows(true, true, true, nil))
+
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+					WithArgs(2, 7, 1).
 					WillReturnError(noResultsError)
 
-				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id) VALUES ($1, $2) RETURNING id;")).
-					WithArgs(2, 7).
+				mock.ExpectBegin()
+
+				expectUserLock(mock, 2)
+				expectBreachedConstraints(mock, 2, 7).WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+				mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id, granted_by, grantable) SELECT $1::integer, $2::integer, $3::integer, $4::boolean FROM users u")).
+					WithArgs(2, 7, 1, false, 1).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+				expectOutbox(mock, "permission.granted").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectCommit()
+
+				expectAudit(mock, "user.grant_permission", 1, "2", "meli").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 			})
 
 			res, b := request(t, serv, "/api/users/2/permissions/permission_test", "PATCH", nil, accessToken)
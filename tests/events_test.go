@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/events"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var streamColumns = append(append([]string{}, outboxColumns...), "settled")
+
+func expectLastEventID(mock sqlmock.Sqlmock, id int) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(MAX(id), 0) FROM outbox_events;")).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(id))
+}
+
+func expectNewEvents(mock sqlmock.Sqlmock, after int, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox_events WHERE id > $1 ORDER BY id LIMIT $2;")).
+		WithArgs(after, events.BatchSize).
+		WillReturnRows(rows)
+}
+
+func streamEvent(rows *sqlmock.Rows, id int, org int, userID string, eventType string, settled bool) *sqlmock.Rows {
+	return rows.AddRow(id, org, "user", userID, eventType, "key-"+userID, []byte(`{"user_id":`+userID+`}`), time.Now(), settled)
+}
+
+func receivedIDs(subscription *events.Subscription) []uint64 {
+	var ids []uint64
+
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return ids
+			}
+
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestEventsBroker_Poll(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	broker := events.NewBroker(&repositories.OutboxRepository{Database: db})
+
+	expectLastEventID(mock, 4)
+
+	if err := broker.Start(context.Background()); err != nil {
+		t.Fatalf("Could not start the broker: %v", err)
+	}
+
+	all := broker.Subscribe(1, nil)
+	own := broker.Subscribe(1, func(event models.OutboxEvent) bool { return event.AggregateID == "2" })
+
+	// El evento 7 todavía no se confirma, así que el 8 espera aunque ya sea visible.
+	rows := sqlmock.NewRows(streamColumns)
+	streamEvent(rows, 5, 1, "2", "permission.granted", false)
+	streamEvent(rows, 6, 2, "9", "user.deleted", false)
+	streamEvent(rows, 8, 1, "3", "permission.revoked", false)
+	expectNewEvents(mock, 4, rows)
+
+	if err := broker.Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	rows = sqlmock.NewRows(streamColumns)
+	streamEvent(rows, 7, 1, "2", "permission.revoked", false)
+	streamEvent(rows, 8, 1, "3", "permission.revoked", false)
+	expectNewEvents(mock, 6, rows)
+
+	// Un salto asentado (una transacción que se deshizo) no detiene el stream.
+	if err := broker.Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	rows = sqlmock.NewRows(streamColumns)
+	streamEvent(rows, 10, 1, "2", "user.deleted", true)
+	expectNewEvents(mock, 8, rows)
+
+	if err := broker.Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	if ids := receivedIDs(all); len(ids) != 4 || ids[0] != 5 || ids[1] != 7 || ids[2] != 8 || ids[3] != 10 {
+		t.Errorf("Expected events [5 7 8 10], got: %v", ids)
+	}
+
+	if ids := receivedIDs(own); len(ids) != 3 || ids[0] != 5 || ids[1] != 7 || ids[2] != 10 {
+		t.Errorf("Expected events [5 7 10], got: %v", ids)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEventsBroker_DropsSlowSubscribers(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	broker := events.NewBroker(&repositories.OutboxRepository{Database: db})
+	subscription := broker.Subscribe(1, nil)
+
+	rows := sqlmock.NewRows(streamColumns)
+	for id := 1; id <= events.SubscriptionBuffer+1; id++ {
+		streamEvent(rows, id, 1, "2", "permission.granted", true)
+	}
+
+	expectNewEvents(mock, 0, rows)
+
+	if err := broker.Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	received := 0
+	for range subscription.Events {
+		received++
+	}
+
+	if received != events.SubscriptionBuffer {
+		t.Errorf("Expected %d events before closing, got: %d", events.SubscriptionBuffer, received)
+	}
+}
+
+// readStreamEvent lee el siguiente evento del stream, ignorando los comentarios y `retry`.
+func readStreamEvent(t *testing.T, reader *bufio.Reader) map[string]string {
+	fields := map[string]string{}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Could not read the stream: %v", err)
+		}
+
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			if fields["id"] != "" {
+				return fields
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+}
+
+func TestEventsStream_ResumeAndFilter(t *testing.T) {
+	serv, mock := newTestServer()
+
+	expectLastEventID(mock, 4)
+
+	if err := serv.Broker().Start(context.Background()); err != nil {
+		t.Fatalf("Could not start the broker: %v", err)
+	}
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 2, []string{})
+
+	expectNotGranted(mock, 2, "view_events")
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox_events WHERE org_id = $1 AND id > $2 AND id <= $3 ORDER BY id LIMIT $4;")).
+		WithArgs(1, 2, 4, events.BatchSize).
+		WillReturnRows(
+			sqlmock.NewRows(outboxColumns).
+				AddRow(3, 1, "user", "5", "permission.granted", "key-3", []byte(`{"user_id":5}`), time.Now()).
+				AddRow(4, 1, "user", "2", "permission.granted", "key-4", []byte(`{"user_id":2}`), time.Now()),
+		)
+
+	server := httptest.NewServer(serv.Router())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Last-Event-ID", "2")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not open the stream: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got: %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(res.Body)
+
+	// El evento 3 es de otro usuario, así que el primero que llega es el 4.
+	event := readStreamEvent(t, reader)
+	if event["id"] != "4" || event["event"] != "permission.granted" {
+		t.Errorf("Expected the event 4, got: %v", event)
+	}
+
+	rows := sqlmock.NewRows(streamColumns)
+	streamEvent(rows, 5, 1, "5", "permission.revoked", false)
+	streamEvent(rows, 6, 1, "2", "permission.revoked", false)
+	expectNewEvents(mock, 4, rows)
+
+	// Cada evento del propio usuario vuelve a verificar `view_events`.
+	expectNotGranted(mock, 2, "view_events")
+
+	if err := serv.Broker().Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	event = readStreamEvent(t, reader)
+	if event["id"] != "6" || event["event"] != "permission.revoked" || !strings.Contains(event["data"], `"aggregate_id":"2"`) {
+		t.Errorf("Expected the event 6, got: %v", event)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEventsStream_RevokedViewEvents(t *testing.T) {
+	serv, mock := newTestServer()
+
+	expectLastEventID(mock, 4)
+
+	if err := serv.Broker().Start(context.Background()); err != nil {
+		t.Fatalf("Could not start the broker: %v", err)
+	}
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 2, []string{"view_events"})
+
+	server := httptest.NewServer(serv.Router())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Origin", "https://panel.example.com")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not open the stream: %v", err)
+	}
+
+	defer res.Body.Close()
+
+	// La conexión se toma para manejar los plazos de escritura, pero se mantienen los encabezados
+	// de CORS.
+	if res.StatusCode != http.StatusOK || res.Header.Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("Expected an event stream with CORS headers, got: %d %v", res.StatusCode, res.Header)
+	}
+
+	reader := bufio.NewReader(res.Body)
+
+	// Con `view_events` llega el evento de otro usuario y luego el que le retira el permiso.
+	rows := sqlmock.NewRows(streamColumns)
+	streamEvent(rows, 5, 1, "5", "permission.granted", false)
+	streamEvent(rows, 6, 1, "2", "permission.revoked", false)
+	streamEvent(rows, 7, 1, "5", "permission.revoked", false)
+	streamEvent(rows, 8, 1, "2", "permission.granted", false)
+	expectNewEvents(mock, 4, rows)
+
+	expectNotGranted(mock, 2, "view_events")
+	expectNotGranted(mock, 2, "view_events")
+
+	if err := serv.Broker().Poll(context.Background()); err != nil {
+		t.Fatalf("Could not poll the events: %v", err)
+	}
+
+	// El evento 7 ya estaba en cola, pero se descarta porque el permiso se retiró.
+	for _, expected := range []string{"5", "6", "8"} {
+		if event := readStreamEvent(t, reader); event["id"] != expected {
+			t.Errorf("Expected the event %s, got: %v", expected, event)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEventsStream_InvalidLastEventID(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	req, _ := http.NewRequest("GET", "/api/events/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Last-Event-ID", "abc")
+
+	rec := httptest.NewRecorder()
+	serv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+}
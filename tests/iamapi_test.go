@@ -0,0 +1,240 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg/dto"
+	"github.com/dsolartec/iam-meli/pkg/iamapi"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+func newAPIClient(t *testing.T, handler http.Handler) (*iamapi.Client, *httptest.Server) {
+	server := httptest.NewServer(handler)
+
+	client := iamapi.New(server.URL)
+	client.RetryDelay = time.Millisecond
+
+	return client, server
+}
+
+func expectFindUser(mock sqlmock.Sqlmock, username string, rows *sqlmock.Rows) *sqlmock.ExpectedQuery {
+	query := mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs(username, 1)
+
+	if rows != nil {
+		query.WillReturnRows(rows)
+	}
+
+	return query
+}
+
+func TestIAMAPI_LoginAndUsers(t *testing.T) {
+	serv, mock := newTestServer()
+
+	client, server := newAPIClient(t, serv.Router())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	user := models.User{Password: "12345"}
+	if err := user.EncryptPassword(); err != nil {
+		t.Fatalf("Could not encrypt password %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).AddRow(1, "superadmin", user.Password, time.Now()))
+
+	expectAudit(mock, "auth.login", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	token, err := client.Login(ctx, dto.LoginAndSignUpBody{Username: "superadmin", Password: "12345"})
+	if err != nil || token.ID != 1 || client.Token == "" {
+		t.Fatalf("Expected to log in, got: %+v %v", token, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()).AddRow(2, "meli", time.Now()))
+
+	users, err := client.ListUsers(ctx)
+	if err != nil || len(users) != 2 || users[1].Username != "meli" {
+		t.Errorf("Expected 2 users, got: %+v %v", users, err)
+	}
+
+	expectFindUser(mock, "meli", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	found, err := client.GetUser(ctx, "meli")
+	if err != nil || found.ID != 2 {
+		t.Errorf("Expected the user 2, got: %+v %v", found, err)
+	}
+
+	expectFindUser(mock, "ghost", nil).WillReturnError(noResultsError)
+
+	if _, err := client.GetUser(ctx, "ghost"); !errors.Is(err, iamapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIAMAPI_Permissions(t *testing.T) {
+	serv, mock := newTestServer()
+
+	client, server := newAPIClient(t, serv.Router())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client.Token = generateAccessToken(t, mock, []string{"create_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id)")).
+		WithArgs("permission_test", "Este es un permiso de prueba", 1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	expectAudit(mock, "permission.create", 1, "7", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	permission, err := client.CreatePermission(ctx, dto.CreatePermissionBody{Name: "permission_test", Description: "Este es un permiso de prueba"})
+	if err != nil || permission.ID != 7 || permission.Name != "permission_test" {
+		t.Errorf("Expected the permission 7, got: %+v %v", permission, err)
+	}
+
+	generateAccessToken(t, mock, []string{"create_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+
+	_, err = client.CreatePermission(ctx, dto.CreatePermissionBody{Name: "permission_test", Description: "Este es un permiso de prueba"})
+
+	var apiErr *iamapi.APIError
+	if !errors.Is(err, iamapi.ErrConflict) || !errors.As(err, &apiErr) || apiErr.Message != "El nombre del permiso ya está en uso" {
+		t.Errorf("Expected ErrConflict, got: %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}))
+
+	if permissions, err := client.ListPermissions(ctx); err != nil || len(permissions) != 0 {
+		t.Errorf("Expected no permissions, got: %+v %v", permissions, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIAMAPI_UserPermissions(t *testing.T) {
+	serv, mock := newTestServer()
+
+	client, server := newAPIClient(t, serv.Router())
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client.Token = generateAccessToken(t, mock, []string{})
+
+	expectNotGranted(mock, 1, "grant_permission")
+
+	if _, err := client.GrantPermission(ctx, "meli", "permission_test", false); !errors.Is(err, iamapi.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden, got: %v", err)
+	}
+
+	generateAccessToken(t, mock, []string{"revoke_permission"})
+
+	expectFindUser(mock, "meli", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnError(noResultsError)
+
+	if err := client.RevokePermission(ctx, "meli", "permission_test"); !errors.Is(err, iamapi.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+
+	client.Token = "invalid"
+
+	if _, err := client.ListUserPermissions(ctx, "meli"); !errors.Is(err, iamapi.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIAMAPI_Retries(t *testing.T) {
+	serv, mock := newTestServer()
+
+	failures := 0
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		serv.Router().ServeHTTP(w, r)
+	})
+
+	client, server := newAPIClient(t, flaky)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client.Token = generateAccessToken(t, mock, []string{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+
+	// Las lecturas se reintentan hasta MaxRetries veces.
+	failures = 2
+
+	if users, err := client.ListUsers(ctx); err != nil || len(users) != 1 {
+		t.Errorf("Expected to succeed after retrying, got: %+v %v", users, err)
+	}
+
+	failures = 3
+
+	if _, err := client.ListUsers(ctx); !errors.As(err, new(*iamapi.APIError)) || failures != 0 {
+		t.Errorf("Expected the last 503 after retrying, got: %v (%d pending)", err, failures)
+	}
+
+	// Crear no se reintenta porque se podría crear dos veces.
+	failures = 1
+
+	_, err := client.CreatePermission(ctx, dto.CreatePermissionBody{Name: "permission_test", Description: "Este es un permiso de prueba"})
+
+	var apiErr *iamapi.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a 503 without retrying, got: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := client.ListUsers(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
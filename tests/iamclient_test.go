@@ -0,0 +1,374 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/iamclient"
+)
+
+// downstream es un servicio que protege `/invoices` con el permiso `delete_user`.
+func downstream(client *iamclient.Client) http.Handler {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := iamclient.FromContext(r.Context())
+		fmt.Fprintf(w, "%d", principal.UserID)
+	})
+
+	return client.Authenticate(client.RequirePermission("delete_user")(handler))
+}
+
+func callDownstream(t *testing.T, handler http.Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/invoices", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func signClaim(t *testing.T, claim pkg.Claim) string {
+	token, err := claim.GenerateToken("MeLiTest")
+	if err != nil {
+		t.Fatalf("Could not generate access token %v", err)
+	}
+
+	return token
+}
+
+func TestIAMClient_Authenticate(t *testing.T) {
+	handler := downstream(iamclient.New(iamclient.SharedSecret("MeLiTest"), ""))
+
+	if rec := callDownstream(t, handler, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d without token, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	forged, _ := (&pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}}).GenerateToken("otra-llave")
+	if rec := callDownstream(t, handler, forged); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d with a forged token, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	expired := pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}}
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	if rec := callDownstream(t, handler, signClaim(t, expired)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d with an expired token, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// Sin `BaseURL` solo se puede autorizar desde el token.
+	if rec := callDownstream(t, handler, signClaim(t, pkg.Claim{ID: 2, Org: 1})); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected %d without the permission, got: %d", http.StatusForbidden, rec.Code)
+	}
+
+	rec := callDownstream(t, handler, signClaim(t, pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}}))
+	if rec.Code != http.StatusOK || rec.Body.String() != "2" {
+		t.Errorf("Expected the principal 2, got: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIAMClient_BitsetWithCatalog(t *testing.T) {
+	serv, mock := newTestServer()
+
+	iam := httptest.NewServer(serv.Router())
+	defer iam.Close()
+
+	handler := downstream(iamclient.New(iamclient.SharedSecret("MeLiTest"), iam.URL))
+
+	token := signClaim(t, pkg.Claim{ID: 2, Org: 1, PermissionBits: pkg.EncodePermissionBits([]string{"delete_user"}, tokenCatalog), CatalogVersion: 7})
+
+	expectPermissionCatalog(mock, 7, tokenCatalog)
+
+	for i := 0; i < 2; i++ {
+		if rec := callDownstream(t, handler, token); rec.Code != http.StatusOK {
+			t.Errorf("Expected %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Un token emitido con una versión anterior del catálogo no sirve y se consulta al IAM.
+	stale := signClaim(t, pkg.Claim{ID: 2, Org: 1, PermissionBits: pkg.EncodePermissionBits([]string{"delete_user"}, tokenCatalog), CatalogVersion: 6})
+
+	expectNotGranted(mock, 2, "delete_user")
+
+	if rec := callDownstream(t, handler, stale); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected %d, got: %d %s", http.StatusForbidden, rec.Code, rec.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIAMClient_RemoteCheck(t *testing.T) {
+	serv, mock := newTestServer()
+
+	iam := httptest.NewServer(serv.Router())
+	defer iam.Close()
+
+	handler := downstream(iamclient.New(iamclient.SharedSecret("MeLiTest"), iam.URL))
+
+	allowed := signClaim(t, pkg.Claim{ID: 2, Org: 1})
+
+	expectVerifyPermission(mock, 2, "delete_user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).AddRow(5, "ana", []byte("{}"), nil))
+
+	// La segunda llamada sale de la caché.
+	for i := 0; i < 2; i++ {
+		if rec := callDownstream(t, handler, allowed); rec.Code != http.StatusOK {
+			t.Errorf("Expected %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+
+	denied := signClaim(t, pkg.Claim{ID: 3, Org: 1})
+
+	expectNotGranted(mock, 3, "delete_user")
+
+	if rec := callDownstream(t, handler, denied); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected %d, got: %d %s", http.StatusForbidden, rec.Code, rec.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	iam.Close()
+
+	if rec := callDownstream(t, handler, signClaim(t, pkg.Claim{ID: 4, Org: 1})); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected %d when the IAM is down, got: %d", http.StatusBadGateway, rec.Code)
+	}
+}
+
+func TestIAMClient_JWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the key %v", err)
+	}
+
+	fetches := 0
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+
+		n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+		fmt.Fprintf(w, `{"keys": [{"kty": "RSA", "kid": "iam-1", "n": %q, "e": %q}]}`, n, e)
+	}))
+
+	defer jwksServer.Close()
+
+	handler := downstream(iamclient.New(&iamclient.JWKS{URL: jwksServer.URL}, ""))
+
+	sign := func(kid string, method jwt.SigningMethod, signingKey interface{}) string {
+		token := jwt.NewWithClaims(method, &pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}})
+		token.Header["kid"] = kid
+
+		signed, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatalf("Could not sign the token %v", err)
+		}
+
+		return signed
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := callDownstream(t, handler, sign("iam-1", jwt.SigningMethodRS256, key)); rec.Code != http.StatusOK {
+			t.Errorf("Expected %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+	}
+
+	if fetches != 1 {
+		t.Errorf("Expected the keys to be fetched once, got: %d", fetches)
+	}
+
+	if rec := callDownstream(t, handler, sign("iam-2", jwt.SigningMethodRS256, key)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d with an unknown kid, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	// Un token HS256 no se acepta aunque use la llave pública como secreto.
+	if rec := callDownstream(t, handler, sign("iam-1", jwt.SigningMethodHS256, key.N.Bytes())); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d with HS256, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+// setTokenPrivateKey configura `JWT_PRIVATE_KEY` con una llave nueva para que el IAM firme con RS256.
+func setTokenPrivateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the key %v", err)
+	}
+
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	// Como en un archivo `.env`, el PEM va en una sola línea.
+	os.Setenv("JWT_PRIVATE_KEY", strings.ReplaceAll(string(pemKey), "\n", `\n`))
+	t.Cleanup(func() { os.Unsetenv("JWT_PRIVATE_KEY") })
+
+	return key
+}
+
+func TestIAMClient_JWKSFromIAM(t *testing.T) {
+	key := setTokenPrivateKey(t)
+
+	serv, _ := newTestServer()
+
+	iam := httptest.NewServer(serv.Router())
+	defer iam.Close()
+
+	res, err := http.Get(iam.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("Could not get the JWKS %v", err)
+	}
+
+	defer res.Body.Close()
+
+	var jwks struct {
+		Keys []pkg.JWK `json:"keys"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Could not decode the JWKS %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK || len(jwks.Keys) != 1 || jwks.Keys[0].Alg != "RS256" || jwks.Keys[0].Kid == "" {
+		t.Fatalf("Expected the RS256 key, got: %d %+v", res.StatusCode, jwks.Keys)
+	}
+
+	token, err := pkg.SignToken(&pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}})
+	if err != nil {
+		t.Fatalf("Could not sign the token %v", err)
+	}
+
+	parsed, _ := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return &key.PublicKey, nil })
+	if parsed == nil || !parsed.Valid || parsed.Header["kid"] != jwks.Keys[0].Kid {
+		t.Fatalf("Expected an RS256 token with the kid %s", jwks.Keys[0].Kid)
+	}
+
+	// Los servicios validan el token con el JWKS del IAM, sin conocer `JWT_KEY`.
+	handler := downstream(iamclient.New(&iamclient.JWKS{URL: iam.URL + "/.well-known/jwks.json"}, ""))
+	if rec := callDownstream(t, handler, token); rec.Code != http.StatusOK {
+		t.Errorf("Expected %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// El IAM también lo acepta, pero no uno firmado con otra llave aunque use el mismo `kid`.
+	if _, err := pkg.ParseToken(token, "MeLiTest"); err != nil {
+		t.Errorf("Expected the IAM to accept the token, got: %v", err)
+	}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, &pkg.Claim{ID: 2, Org: 1})
+	forged.Header["kid"] = jwks.Keys[0].Kid
+	signed, _ := forged.SignedString(other)
+
+	if _, err := pkg.ParseToken(signed, "MeLiTest"); err == nil {
+		t.Error("Expected the IAM to reject a token signed with another key")
+	}
+}
+
+func TestIAMClient_JWKSNotConfigured(t *testing.T) {
+	serv, _ := newTestServer()
+
+	if res, _ := request(t, serv, "/.well-known/jwks.json", "GET", nil, ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %d without `JWT_PRIVATE_KEY`, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestIAMClient_JWKSFetchDoesNotBlockKnownKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the key %v", err)
+	}
+
+	var mu sync.Mutex
+	fetches := 0
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetches++
+		fetch := fetches
+		mu.Unlock()
+
+		// La segunda descarga queda colgada hasta que se libere.
+		if fetch == 2 {
+			close(started)
+			<-release
+		}
+
+		n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+
+		fmt.Fprintf(w, `{"keys": [{"kty": "RSA", "kid": "iam-1", "n": %q, "e": %q}]}`, n, e)
+	}))
+
+	defer jwksServer.Close()
+
+	handler := downstream(iamclient.New(&iamclient.JWKS{URL: jwksServer.URL, RefreshInterval: 100 * time.Millisecond}, ""))
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, &pkg.Claim{ID: 2, Org: 1, Permissions: []string{"delete_user"}})
+		token.Header["kid"] = kid
+
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+
+	if rec := callDownstream(t, handler, sign("iam-1")); rec.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d", http.StatusOK, rec.Code)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	// Varios tokens con un `kid` desconocido comparten la misma descarga.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			callDownstream(t, handler, sign("iam-2"))
+		}()
+	}
+
+	<-started
+
+	done := make(chan int)
+	go func() { done <- callDownstream(t, handler, sign("iam-1")).Code }()
+
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("Expected %d during the fetch, got: %d", http.StatusOK, code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the known key to be used while the keys are fetched")
+	}
+
+	close(release)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if fetches != 2 {
+		t.Errorf("Expected the keys to be fetched twice, got: %d", fetches)
+	}
+}
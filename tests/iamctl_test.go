@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/iamctl"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+func runIAMCtl(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+
+	code := iamctl.Run(args, strings.NewReader(stdin), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestIAMCtl_LoginAndUsers(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "profiles.json")
+	t.Setenv("IAMCTL_CONFIG", config)
+
+	serv, mock := newTestServer()
+
+	_, server := newAPIClient(t, serv.Router())
+	defer server.Close()
+
+	if code, _, _ := runIAMCtl("", "users", "list"); code != iamctl.ExitUnauthorized {
+		t.Errorf("Expected the exit code %d without a session, got: %d", iamctl.ExitUnauthorized, code)
+	}
+
+	user := models.User{Password: "12345"}
+	if err := user.EncryptPassword(); err != nil {
+		t.Fatalf("Could not encrypt password %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).AddRow(1, "superadmin", user.Password, time.Now()))
+
+	expectAudit(mock, "auth.login", 1, "1", "superadmin").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	if code, _, stderr := runIAMCtl("12345\n", "login", "-server", server.URL, "-username", "superadmin"); code != iamctl.ExitOK {
+		t.Fatalf("Expected to log in, got: %d %s", code, stderr)
+	}
+
+	info, err := os.Stat(config)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the profile file with mode 0600, got: %v %v", info, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()).AddRow(2, "meli", time.Now()))
+
+	code, stdout, _ := runIAMCtl("", "users", "list")
+	if code != iamctl.ExitOK || !regexp.MustCompile(`(?m)^2\s+meli\s`).MatchString(stdout) {
+		t.Errorf("Expected a table with 2 users, got: %d %q", code, stdout)
+	}
+
+	expectFindUser(mock, "meli", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	code, stdout, _ = runIAMCtl("", "users", "get", "meli", "-output", "json")
+
+	var found models.User
+	if err := json.Unmarshal([]byte(stdout), &found); code != iamctl.ExitOK || err != nil || found.ID != 2 {
+		t.Errorf("Expected the user 2 as JSON, got: %d %q", code, stdout)
+	}
+
+	expectFindUser(mock, "true", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(3, "true", time.Now()))
+
+	code, stdout, _ = runIAMCtl("", "users", "get", "-output", "yaml", "true")
+	if code != iamctl.ExitOK || !strings.Contains(stdout, "id: 3\n") || !strings.Contains(stdout, "username: \"true\"\n") {
+		t.Errorf("Expected the user 3 as YAML, got: %d %q", code, stdout)
+	}
+
+	expectFindUser(mock, "ghost", nil).WillReturnError(noResultsError)
+
+	if code, _, _ := runIAMCtl("", "users", "get", "ghost"); code != iamctl.ExitNotFound {
+		t.Errorf("Expected the exit code %d, got: %d", iamctl.ExitNotFound, code)
+	}
+
+	if code, _, _ := runIAMCtl("", "users", "get"); code != iamctl.ExitUsage {
+		t.Errorf("Expected the exit code %d, got: %d", iamctl.ExitUsage, code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIAMCtl_Permissions(t *testing.T) {
+	t.Setenv("IAMCTL_CONFIG", filepath.Join(t.TempDir(), "profiles.json"))
+
+	serv, mock := newTestServer()
+
+	_, server := newAPIClient(t, serv.Router())
+	defer server.Close()
+
+	token := generateAccessToken(t, mock, []string{"create_permission"})
+
+	config := iamctl.Config{Profiles: map[string]iamctl.Profile{"ops": {Server: server.URL, Token: token}}}
+	if err := config.Save(); err != nil {
+		t.Fatalf("Could not save the profiles %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id)")).
+		WithArgs("permission_test", "Este es un permiso de prueba", 1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+	expectAudit(mock, "permission.create", 1, "7", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	code, stdout, stderr := runIAMCtl("", "permissions", "create", "-profile", "ops", "-name", "permission_test", "-description", "Este es un permiso de prueba")
+	if code != iamctl.ExitOK || !regexp.MustCompile(`(?m)^7\s+permission_test\s`).MatchString(stdout) {
+		t.Errorf("Expected the permission 7, got: %d %q %s", code, stdout, stderr)
+	}
+
+	generateAccessToken(t, mock, []string{"create_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+
+	if code, _, _ := runIAMCtl("", "permissions", "create", "-profile", "ops", "-name", "permission_test"); code != iamctl.ExitConflict {
+		t.Errorf("Expected the exit code %d, got: %d", iamctl.ExitConflict, code)
+	}
+
+	if code, _, _ := runIAMCtl("", "permissions", "delete", "-profile", "ops", "abc"); code != iamctl.ExitUsage {
+		t.Errorf("Expected the exit code %d, got: %d", iamctl.ExitUsage, code)
+	}
+
+	if code, _, _ := runIAMCtl("", "permissions", "list", "-profile", "ops", "-output", "xml"); code != iamctl.ExitUsage {
+		t.Errorf("Expected the exit code %d, got: %d", iamctl.ExitUsage, code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+var manifestColumns = []string{"id", "name", "description", "deletable", "editable", "deprecated_at", "created_at", "updated_at"}
+
+func expectManifestApplication(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE name = $1 AND org_id = $2;")).
+		WithArgs("billing", 1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns).AddRow(3, "billing", "Aplicación de facturación", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permissions WHERE org_id = $1 AND split_part(name, ':', 1) = $2")).
+		WithArgs(1, "billing").
+		WillReturnRows(rows)
+}
+
+func currentBillingPermissions() *sqlmock.Rows {
+	return sqlmock.NewRows(manifestColumns).
+		AddRow(20, "billing:read_orders", "Poder consultar las órdenes", true, true, nil, time.Now(), time.Now()).
+		AddRow(21, "billing:refund_orders", "Poder reembolsar las órdenes", true, true, nil, time.Now(), time.Now()).
+		AddRow(22, "billing:void_orders", "Poder anular las órdenes", true, true, nil, time.Now(), time.Now())
+}
+
+const billingManifest = `{"permissions": [
+	{"name": "read_orders", "description": "Poder consultar las órdenes"},
+	{"name": "billing:refund_orders", "description": "Poder reembolsar órdenes pagadas"},
+	{"name": "export_orders", "description": "Poder exportar las órdenes a CSV"}
+]}`
+
+func TestImportManifest_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+	expectNotGranted(mock, 5, "import_permission_manifest")
+	expectApplicationAdmin(mock, "billing", 5, false)
+
+	res, b := request(t, serv, "/api/permissions/manifests/billing", "PUT", bytes.NewBufferString(billingManifest), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestImportManifest_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body     string
+		current  *sqlmock.Rows
+		expected string
+	}{
+		{
+			body:     `{"permissions": [{"name": "shipping:read_orders", "description": "Poder consultar las órdenes"}]}`,
+			current:  sqlmock.NewRows(manifestColumns),
+			expected: "El permiso shipping:read_orders no pertenece a la aplicación billing",
+		},
+		{
+			body:     `{"permissions": [{"name": "read_orders", "description": "Poder consultar las órdenes"}, {"name": "billing:read_orders", "description": "Poder consultar las órdenes"}]}`,
+			current:  sqlmock.NewRows(manifestColumns),
+			expected: "El permiso billing:read_orders está repetido en el manifiesto",
+		},
+		{
+			body:     `{"permissions": [{"name": "read_orders", "description": "Corta"}]}`,
+			current:  sqlmock.NewRows(manifestColumns),
+			expected: "read_orders: La descripción del permiso debe tener entre 10 y 150 caracteres",
+		},
+		{
+			body: `{"permissions": []}`,
+			current: sqlmock.NewRows(manifestColumns).
+				AddRow(20, "billing:read_orders", "Poder consultar las órdenes", false, false, nil, time.Now(), time.Now()),
+			expected: "El permiso billing:read_orders no puede ser editado",
+		},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"import_permission_manifest"})
+
+		expectManifestApplication(mock, td.current)
+
+		res, b := request(t, serv, "/api/permissions/manifests/billing", "PUT", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestImportManifest_DryRun(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_permission_manifest"})
+
+	expectManifestApplication(mock, currentBillingPermissions())
+
+	res, b := request(t, serv, "/api/permissions/manifests/billing?dry_run=true", "PUT", bytes.NewBufferString(billingManifest), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	plan := data["plan"].(map[string]interface{})
+
+	expected := map[string]string{
+		"create":    "billing:export_orders",
+		"update":    "billing:refund_orders",
+		"deprecate": "billing:void_orders",
+	}
+
+	for action, name := range expected {
+		permissions := plan[action].([]interface{})
+		if len(permissions) != 1 || permissions[0].(map[string]interface{})["name"].(string) != name {
+			t.Errorf("Expected %s to be %s, got: %v", action, name, permissions)
+		}
+	}
+
+	if unchanged := plan["unchanged"].([]interface{}); len(unchanged) != 1 || unchanged[0].(string) != "billing:read_orders" {
+		t.Errorf("Expected billing:read_orders unchanged, got: %v", unchanged)
+	}
+
+	// El modo de prueba no debe escribir en la base de datos.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportManifest_ApplicationAdmin(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 1, 5, []string{})
+
+	expectNotGranted(mock, 5, "import_permission_manifest")
+	expectApplicationAdmin(mock, "billing", 5, true)
+	expectManifestApplication(mock, currentBillingPermissions())
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id)")).
+		WithArgs("billing:export_orders", "Poder exportar las órdenes a CSV", 1, "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(23))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE permissions SET description = $1, deprecated_at = NULL, updated_at = now() WHERE id = $2 AND org_id = $3 AND editable = TRUE;")).
+		WithArgs("Poder reembolsar órdenes pagadas", 21, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectOutbox(mock, "permission.updated").WithArgs(21, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE permissions SET deprecated_at = now(), updated_at = now() WHERE id = $1 AND org_id = $2 AND editable = TRUE;")).
+		WithArgs(22, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectOutbox(mock, "permission.updated").WithArgs(22, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "permission.import_manifest", 5, nil, "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	res, b := request(t, serv, "/api/permissions/manifests/billing", "PUT", bytes.NewBufferString(billingManifest), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportManifest_RollbackOnError(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_permission_manifest"})
+
+	expectManifestApplication(mock, currentBillingPermissions())
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id)")).
+		WithArgs("billing:export_orders", "Poder exportar las órdenes a CSV", 1, "billing").
+		WillReturnError(errors.New("pq: duplicate key value violates unique constraint"))
+
+	mock.ExpectRollback()
+
+	res, _ := request(t, serv, "/api/permissions/manifests/billing", "PUT", bytes.NewBufferString(billingManifest), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+const billingManifestYAML = `# Manifiesto de la aplicación de facturación
+permissions:
+  - name: read_orders
+    description: Poder consultar las órdenes
+  - name: "billing:refund_orders"
+    description: >-
+      Poder reembolsar
+      órdenes pagadas
+  - name: export_orders
+    description: 'Poder exportar las órdenes a CSV' # Nuevo
+`
+
+func TestImportManifest_YAML(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		expected    string
+	}{
+		{contentType: "application/yaml", body: billingManifestYAML, status: http.StatusOK},
+		{contentType: "text/yaml; charset=utf-8", body: billingManifestYAML, status: http.StatusOK},
+		{contentType: "application/x-yaml", body: "permissions:\n  - name: read_orders\n\tdescription: Poder consultar las órdenes\n", status: http.StatusBadRequest, expected: "El YAML no es válido en la línea 3"},
+		{contentType: "application/json", body: billingManifestYAML, status: http.StatusBadRequest, expected: "invalid character '#' looking for beginning of value"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"import_permission_manifest"})
+
+		expectManifestApplication(mock, currentBillingPermissions())
+
+		req, err := http.NewRequest("PUT", "/api/permissions/manifests/billing?dry_run=true", bytes.NewBufferString(td.body))
+		if err != nil {
+			t.Fatalf("could not created request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("Content-Type", td.contentType)
+
+		rec := httptest.NewRecorder()
+		serv.Router().ServeHTTP(rec, req)
+
+		if rec.Code != td.status {
+			t.Fatalf("Expected %d, got: %d - %s", td.status, rec.Code, rec.Body.String())
+		}
+
+		var data pkg.Map
+		if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if td.status != http.StatusOK {
+			if data["message"] != td.expected {
+				t.Errorf("Expected %s, got: %v", td.expected, data["message"])
+			}
+
+			continue
+		}
+
+		plan := data["plan"].(map[string]interface{})
+
+		expected := map[string]string{
+			"create":    "billing:export_orders",
+			"update":    "billing:refund_orders",
+			"deprecate": "billing:void_orders",
+		}
+
+		for action, name := range expected {
+			permissions := plan[action].([]interface{})
+			if len(permissions) != 1 || permissions[0].(map[string]interface{})["name"].(string) != name {
+				t.Errorf("Expected %s to be %s, got: %v", action, name, permissions)
+			}
+		}
+
+		// El bloque `>-` pliega las líneas sin dejar el salto del final.
+		if description := plan["update"].([]interface{})[0].(map[string]interface{})["description"]; description != "Poder reembolsar órdenes pagadas" {
+			t.Errorf("Expected the folded description, got: %v", description)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var organizationColumns = []string{"id", "name", "owner_id", "created_at"}
+
+func TestCreateOrganization_NoAuthorized(t *testing.T) {
+	cases := []struct {
+		org         int
+		permissions []string
+	}{{org: 1, permissions: []string{}}, {org: 2, permissions: []string{}}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateTenantAccessToken(t, mock, td.org, 5, td.permissions)
+
+		body := []byte(`{"name": "billing", "owner": {"username": "billing", "password": "billing"}}`)
+
+		res, b := request(t, serv, "/api/organizations", "POST", bytes.NewBuffer(body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+		if errorMessage.Message != expected {
+			t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+		}
+
+		// Los usuarios de otras organizaciones no llegan a consultar sus permisos.
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestCreateOrganization_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{body: `{"owner": {"username": "billing", "password": "billing"}}`, expected: "Debes ingresar el nombre de la organización"},
+		{body: `{"name": "Billing Team", "owner": {"username": "billing", "password": "billing"}}`, expected: "El nombre de la organización solo puede contener minúsculas, números y guiones"},
+		{body: `{"name": "bi", "owner": {"username": "billing", "password": "billing"}}`, expected: "El nombre de la organización debe tener entre 3 y 30 caracteres"},
+		{body: `{"name": "billing", "owner": {"password": "billing"}}`, expected: "Debes ingresar el nombre de usuario"},
+		{body: `{"name": "billing", "owner": {"username": "billing"}}`, expected: "Debes ingresar la contraseña"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_organizations"})
+
+		res, b := request(t, serv, "/api/organizations", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateOrganization_DuplicatedName(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_organizations"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, owner_id, created_at FROM organizations WHERE name = $1;")).
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows(organizationColumns).AddRow(2, "billing", 5, time.Now()))
+
+	body := []byte(`{"name": "billing", "owner": {"username": "billing", "password": "billing"}}`)
+
+	res, b := request(t, serv, "/api/organizations", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El nombre de la organización ya está en uso"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreateOrganization_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_organizations"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, owner_id, created_at FROM organizations WHERE name = $1;")).
+		WithArgs("billing").
+		WillReturnError(noResultsError)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO organizations (name) VALUES ($1) RETURNING id;")).
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users (username, password, org_id) VALUES ($1, $2, $3) RETURNING id;")).
+		WithArgs("billing", anyPassword{}, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	mock.ExpectExec(regexp.QuoteMeta("WHERE org_id = $2 AND deletable = FALSE AND editable = FALSE AND name <> 'manage_organizations';")).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 14))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id) SELECT $1, id FROM permissions WHERE org_id = $2;")).
+		WithArgs(5, 2).
+		WillReturnResult(sqlmock.NewResult(0, 14))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE organizations SET owner_id = $1 WHERE id = $2;")).
+		WithArgs(5, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "organization.create", 1, "2", "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"name": "billing", "owner": {"username": "billing", "password": "billing"}}`)
+
+	res, b := request(t, serv, "/api/organizations", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	organization := data["organization"].(map[string]interface{})
+	if organization["owner_id"].(float64) != 5 {
+		t.Errorf("Expected owner 5, got: %v", organization["owner_id"])
+	}
+
+	owner := data["owner"].(map[string]interface{})
+	if _, ok := owner["password"]; ok {
+		t.Errorf("Expected the owner password to be hidden")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetOrganizations_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_organizations"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, owner_id, created_at FROM organizations ORDER BY id;")).
+		WillReturnRows(
+			sqlmock.NewRows(organizationColumns).
+				AddRow(1, "platform", 1, time.Now()).
+				AddRow(2, "billing", 5, time.Now()),
+		)
+
+	res, b := request(t, serv, "/api/organizations", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if organizations := data["organizations"].([]interface{}); len(organizations) != 2 {
+		t.Errorf("Expected 2 organizations, got: %d", len(organizations))
+	}
+}
+
+func TestLogin_Organization(t *testing.T) {
+	serv, mock := newTestServer()
+
+	user := models.User{Password: "billing"}
+	if err := user.EncryptPassword(); err != nil {
+		t.Fatalf("Could not encrypt password %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, owner_id, created_at FROM organizations WHERE name = $1;")).
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows(organizationColumns).AddRow(2, "billing", 5, time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("billing", 2).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).
+				AddRow(5, "billing", user.Password, time.Now()),
+		)
+
+	expectOrgAudit(mock, 2, "auth.login", 5, "5", "billing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"organization": "billing", "username": "billing", "password": "billing"}`)
+
+	res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	claim, err := pkg.ParseToken(data["accessToken"].(string), "MeLiTest")
+	if err != nil {
+		t.Fatalf("Could not parse access token %v", err)
+	}
+
+	if claim.ID != 5 || claim.Org != 2 {
+		t.Errorf("Expected user 5 in organization 2, got: user %d in organization %d", claim.ID, claim.Org)
+	}
+}
+
+func TestLogin_OrganizationNotExists(t *testing.T) {
+	serv, mock := newTestServer()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, owner_id, created_at FROM organizations WHERE name = $1;")).
+		WithArgs("shipping").
+		WillReturnError(noResultsError)
+
+	body := []byte(`{"organization": "shipping", "username": "billing", "password": "billing"}`)
+
+	res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La organización no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestParseToken_LegacyTokenBelongsToPlatform(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"id": 1}).SignedString([]byte("MeLiTest"))
+	if err != nil {
+		t.Fatalf("Could not generate access token %v", err)
+	}
+
+	claim, err := pkg.ParseToken(token, "MeLiTest")
+	if err != nil {
+		t.Fatalf("Could not parse access token %v", err)
+	}
+
+	if claim.Org != int(models.PlatformOrganizationID) {
+		t.Errorf("Expected organization %d, got: %d", models.PlatformOrganizationID, claim.Org)
+	}
+}
+
+func TestCrossTenant_UsersAreNotVisible(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	// El superadministrador (ID 1) pertenece a la plataforma, por lo que no existe en la organización 2.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 2).
+		WillReturnError(noResultsError)
+
+	res, _ := request(t, serv, "/api/users/1", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(5, "billing", time.Now()))
+
+	res, b := request(t, serv, "/api/users", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if users := data["users"].([]interface{}); len(users) != 1 {
+		t.Errorf("Expected 1 user, got: %d", len(users))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCrossTenant_PermissionsAreNotVisible(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}))
+
+	res, _ := request(t, serv, "/api/permissions", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(7, 2).
+		WillReturnError(noResultsError)
+
+	res, _ = request(t, serv, "/api/permissions/7", "GET", nil, accessToken)
+	if res.StatusCode == http.StatusOK {
+		t.Errorf("Expected the permission of another organization to be hidden, got: %d", res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCrossTenant_GrantPermissionToAnotherOrganization(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{"grant_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 2).
+		WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/users/1/permissions/grant_permission", "PATCH", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El usuario no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
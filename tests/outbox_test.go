@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/outbox"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg/interfaces"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var outboxColumns = []string{"id", "org_id", "aggregate_type", "aggregate_id", "event_type", "idempotency_key", "payload", "created_at"}
+
+// expectOutbox espera que se escriba un evento del tipo indicado en la bandeja de salida.
+func expectOutbox(mock sqlmock.Sqlmock, eventType string) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(regexp.QuoteMeta("INSERT INTO outbox_events (org_id, aggregate_type, aggregate_id, event_type, payload)") + ".*'" + regexp.QuoteMeta(eventType) + "'")
+}
+
+func expectOutboxBatch(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_xact_lock($1);")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM outbox_events WHERE published_at IS NULL ORDER BY id LIMIT $1;")).
+		WithArgs(outbox.DefaultBatchSize).
+		WillReturnRows(rows)
+}
+
+func expectOutboxPublished(mock sqlmock.Sqlmock, id int) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox_events SET attempts = attempts + 1, last_error = NULL, published_at = now() WHERE id = $1;")).
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectOutboxFailed(mock sqlmock.Sqlmock, id int, reason string) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE outbox_events SET attempts = attempts + 1, last_error = $2 WHERE id = $1;")).
+		WithArgs(id, reason).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestOutboxRelay_OrderPerAggregate(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	sink := &outbox.MemorySink{Fail: func(event models.OutboxEvent) error {
+		if event.ID == 1 {
+			return errors.New("El destino no está disponible")
+		}
+
+		return nil
+	}}
+
+	relay := outbox.Relay{Outbox: &repositories.OutboxRepository{Database: db}, Sinks: []interfaces.EventSink{sink}}
+
+	expectOutboxBatch(mock, sqlmock.NewRows(outboxColumns).
+		AddRow(1, 1, "user", "2", "permission.granted", "key-1", []byte(`{"user_id":2}`), time.Now()).
+		AddRow(2, 1, "user", "3", "permission.granted", "key-2", []byte(`{"user_id":3}`), time.Now()).
+		AddRow(3, 1, "user", "2", "permission.revoked", "key-3", []byte(`{"user_id":2}`), time.Now()))
+
+	expectOutboxFailed(mock, 1, "El destino no está disponible")
+	expectOutboxPublished(mock, 2)
+	expectOutboxFailed(mock, 3, "Un evento anterior de user:2 no se ha publicado")
+
+	mock.ExpectCommit()
+
+	published, err := relay.ProcessOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Could not process the outbox: %v", err)
+	}
+
+	if published != 1 {
+		t.Errorf("Expected 1 published event, got: %d", published)
+	}
+
+	events := sink.Events()
+	if len(events) != 1 || events[0].IdempotencyKey != "key-2" {
+		t.Errorf("Expected only the event key-2, got: %v", events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelay_AtLeastOnce(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	failing := true
+	memory := &outbox.MemorySink{}
+	flaky := &outbox.MemorySink{Fail: func(event models.OutboxEvent) error {
+		if failing {
+			return errors.New("El destino no está disponible")
+		}
+
+		return nil
+	}}
+
+	relay := outbox.Relay{Outbox: &repositories.OutboxRepository{Database: db}, Sinks: []interfaces.EventSink{memory, flaky}}
+
+	for _, fail := range []bool{true, false} {
+		failing = fail
+
+		expectOutboxBatch(mock, sqlmock.NewRows(outboxColumns).
+			AddRow(1, 1, "user", "2", "user.deleted", "key-1", []byte(`{"user_id":2}`), time.Now()))
+
+		if fail {
+			expectOutboxFailed(mock, 1, "El destino no está disponible")
+		} else {
+			expectOutboxPublished(mock, 1)
+		}
+
+		mock.ExpectCommit()
+
+		if _, err := relay.ProcessOnce(context.Background()); err != nil {
+			t.Fatalf("Could not process the outbox: %v", err)
+		}
+	}
+
+	// El primer destino recibió el evento dos veces con la misma llave de idempotencia.
+	events := memory.Events()
+	if len(events) != 2 || events[0].IdempotencyKey != events[1].IdempotencyKey {
+		t.Errorf("Expected the same event twice, got: %v", events)
+	}
+
+	if len(flaky.Events()) != 1 {
+		t.Errorf("Expected the flaky sink to get the event once, got: %v", flaky.Events())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxRelay_LockedByAnotherRelay(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	sink := &outbox.MemorySink{}
+	relay := outbox.Relay{Outbox: &repositories.OutboxRepository{Database: db}, Sinks: []interfaces.EventSink{sink}}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_xact_lock($1);")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectRollback()
+
+	published, err := relay.ProcessOnce(context.Background())
+	if err != nil || published != 0 {
+		t.Errorf("Expected no events, got: %d, %v", published, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestOutboxSinks(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	event := models.OutboxEvent{
+		ID:             7,
+		OrgID:          3,
+		AggregateType:  "user",
+		AggregateID:    "2",
+		Type:           "permission.revoked",
+		IdempotencyKey: "8f14e45f-ceea-467f-a0e6-3b7e4c8a2b1d",
+		Payload:        json.RawMessage(`{"user_id":2,"username":"meli"}`),
+		CreatedAt:      time.Now(),
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries (org_id, subscription_id, event_id, event_type, payload)")).
+		WithArgs(3, event.IdempotencyKey, "permission.revoked", webhookPayloadArg{eventType: "permission.revoked", username: "meli"}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	webhook := outbox.WebhookSink{Webhooks: &repositories.WebhooksRepository{Database: db}}
+	if err := webhook.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Could not publish to the webhook sink: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	var out bytes.Buffer
+
+	ndjson := outbox.NDJSONSink{Writer: &out}
+	for i := 0; i < 2; i++ {
+		if err := ndjson.Publish(context.Background(), event); err != nil {
+			t.Fatalf("Could not publish to the NDJSON sink: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got: %q", out.String())
+	}
+
+	var written models.OutboxEvent
+	if err := json.Unmarshal([]byte(lines[0]), &written); err != nil {
+		t.Fatalf("Could not unmarshall the line %v", err)
+	}
+
+	if written.IdempotencyKey != event.IdempotencyKey || written.Type != event.Type {
+		t.Errorf("Expected the event %s, got: %+v", event.IdempotencyKey, written)
+	}
+}
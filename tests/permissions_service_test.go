@@ -2,6 +2,7 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/repositories"
 	"github.com/dsolartec/iam-meli/pkg"
 )
 
@@ -134,8 +136,8 @@ func TestCreatePermission_ValidationErrors(t *testing.T) {
 
 		accessToken := generateAccessToken(t, mock, []string{"create_permission"})
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs(td.permission_name).
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs(td.permission_name, 1).
 			WillReturnError(noResultsError)
 
 		body := []byte(`{
@@ -164,8 +166,8 @@ func TestCreatePermission_DuplicatedPermissionName(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"create_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-		WithArgs("permission_test").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
@@ -197,12 +199,15 @@ func TestCreatePermission_Success(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"create_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-		WithArgs("permission_test").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
 		WillReturnError(noResultsError)
 
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description) VALUES ($1, $2) RETURNING id;")).
-		WithArgs("permission_test", "Este es un permiso de prueba").
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) VALUES ($1, $2, $3, (SELECT id FROM applications WHERE org_id = $3 AND name = $4)) RETURNING id;")).
+		WithArgs("permission_test", "Este es un permiso de prueba", 1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	expectAudit(mock, "permission.create", 1, "1", "permission_test").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	body := []byte(`{
@@ -226,8 +231,8 @@ func TestDeletePermission_NotFound(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"delete_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnError(noResultsError)
 
 	res, b := request(t, serv, "/api/permissions/1", "DELETE", nil, accessToken)
@@ -251,8 +256,8 @@ func TestDeletePermission_NoDeletable(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"delete_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
@@ -279,15 +284,18 @@ func TestDeletePermission_Deletable(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"delete_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
 		)
 
-	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permissions WHERE id = $1 AND deletable = TRUE;")).
-		ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permissions WHERE id = $1 AND org_id = $2 AND deletable = TRUE;")).
+		ExpectExec().WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectAudit(mock, "permission.delete", 1, "1", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	res, _ := request(t, serv, "/api/permissions/1", "DELETE", nil, accessToken)
 	if res.StatusCode != http.StatusOK {
@@ -300,7 +308,7 @@ func TestGetAllPermissions_NoData(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions;")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}))
 
 	res, _ := request(t, serv, "/api/permissions", "GET", nil, accessToken)
@@ -314,7 +322,7 @@ func TestGetAllPermissions_Success(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions;")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", true, false, time.Now(), time.Now()).
@@ -368,8 +376,8 @@ func TestGetPermissionByID_NoData(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnError(noResultsError)
 
 	res, _ := request(t, serv, "/api/permissions/1", "GET", nil, accessToken)
@@ -383,8 +391,8 @@ func TestGetPermissionByID_Success(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
@@ -414,6 +422,182 @@ func TestGetPermissionByID_Success(t *testing.T) {
 	}
 }
 
+func TestGetPermissionHolders_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	for _, path := range []string{"/api/permissions/7/holders", "/api/permissions/7/holders?format=csv"} {
+		expectNotGranted(mock, 1, "view_audit_log")
+
+		res, b := request(t, serv, path, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetPermissionHolders_NotFound(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/permissions/1/holders", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El permiso no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestGetPermissionHolders_InvalidPagination(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{query: "?page=0", expected: "La página debe ser un número mayor a 0"},
+		{query: "?page=uno", expected: "La página debe ser un número mayor a 0"},
+		{query: "?limit=101", expected: "El límite debe ser un número entre 1 y 100"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+			WithArgs(4, 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(4, "grant_permission", "Poder añadir un permiso a un usuario", false, false, time.Now(), time.Now()),
+			)
+
+		res, b := request(t, serv, "/api/permissions/4/holders"+td.query, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+var holderColumns = []string{"id", "username", "user_permission_id", "source", "granted_by", "granted_by_username", "granted_at", "expires_at"}
+
+func TestGetPermissionHolders_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(4, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(4, "grant_permission", "Poder añadir un permiso a un usuario", false, false, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*)")).
+		WithArgs(4, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY h.id, h.source LIMIT $3 OFFSET $4;")).
+		WithArgs(4, 1, 2, 2).
+		WillReturnRows(
+			sqlmock.NewRows(holderColumns).
+				AddRow(3, "meli", 9, "direct", 1, "superadmin", time.Now(), nil),
+		)
+
+	res, b := request(t, serv, "/api/permissions/4/holders?page=2&limit=2", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if data["total"].(float64) != 3 {
+		t.Errorf("Expected 3, got: %f", data["total"].(float64))
+	}
+
+	holders := data["holders"].([]interface{})
+	if len(holders) != 1 {
+		t.Fatalf("Expected 1 holder, got: %d", len(holders))
+	}
+
+	holder := holders[0].(map[string]interface{})
+	if holder["username"].(string) != "meli" {
+		t.Errorf("Expected meli, got: %s", holder["username"].(string))
+	}
+
+	if holder["granted_by_username"].(string) != "superadmin" {
+		t.Errorf("Expected superadmin, got: %s", holder["granted_by_username"].(string))
+	}
+}
+
+func TestGetPermissionHolders_CSV(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_audit_log"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(4, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(4, "grant_permission", "Poder añadir un permiso a un usuario", false, false, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(`(?s)FROM break_glass_sessions bg.*bg\.expires_at > now\(\) AND p\.name = ANY\(bg\.permissions\).*ORDER BY h\.id, h\.source;`).
+		WithArgs(4, 1).
+		WillReturnRows(
+			sqlmock.NewRows(holderColumns).
+				AddRow(1, "superadmin", 4, "direct", nil, nil, nil, nil).
+				AddRow(3, "meli", 9, "direct", 1, "superadmin", time.Date(2022, 11, 13, 1, 36, 41, 0, time.UTC), nil).
+				AddRow(3, "meli", nil, "break_glass", nil, nil, time.Date(2022, 11, 14, 8, 0, 0, 0, time.UTC), time.Date(2022, 11, 14, 9, 0, 0, 0, time.UTC)),
+		)
+
+	res, b := request(t, serv, "/api/permissions/4/holders?format=csv", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Errorf("Expected text/csv; charset=utf-8, got: %s", contentType)
+	}
+
+	expected := "user_id,username,user_permission_id,source,granted_by,granted_by_username,granted_at,expires_at\n" +
+		"1,superadmin,4,direct,,,,\n" +
+		"3,meli,9,direct,1,superadmin,2022-11-13T01:36:41Z,\n" +
+		"3,meli,,break_glass,,,2022-11-14T08:00:00Z,2022-11-14T09:00:00Z\n"
+
+	if string(b) != expected {
+		t.Errorf("Expected %s, got: %s", expected, string(b))
+	}
+}
+
 func TestUpdatePermission_ValidationErrors(t *testing.T) {
 	cases := []struct {
 		permission_name        string
@@ -455,8 +639,8 @@ func TestUpdatePermission_ValidationErrors(t *testing.T) {
 
 		accessToken := generateAccessToken(t, mock, []string{"update_permission"})
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-			WithArgs(1).
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+			WithArgs(1, 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 					AddRow(1, "permission_test", "Este es un permiso de prueba", false, true, time.Now(), time.Now()),
@@ -488,15 +672,15 @@ func TestUpdatePermission_DuplicatePermissionName(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, true, time.Now(), time.Now()),
 		)
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-		WithArgs("permission_test_1").
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test_1", 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(2, "permission_test_1", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
@@ -525,8 +709,8 @@ func TestUpdatePermission_NotFound(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnError(noResultsError)
 
 	res, b := request(t, serv, "/api/permissions/1", "PUT", nil, accessToken)
@@ -550,8 +734,8 @@ func TestUpdatePermission_NoEditable(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
@@ -578,18 +762,27 @@ func TestUpdatePermission_Editable(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1;")).
-		WithArgs(1).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(1, 1).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 				AddRow(1, "permission_test", "Este es un permiso de prueba", false, true, time.Now(), time.Now()),
 		)
 
-	mock.ExpectPrepare(regexp.QuoteMeta("UPDATE permissions SET name = $1, description = $2, updated_at = $3 WHERE id = $4 AND editable = TRUE;")).
+	mock.ExpectBegin()
+
+	mock.ExpectPrepare(regexp.QuoteMeta("UPDATE permissions SET name = $1, description = $2, updated_at = $3 WHERE id = $4 AND org_id = $5 AND editable = TRUE;")).
 		ExpectExec().
-		WithArgs("permission_test_1", "Este es un permiso de prueba editado", anyTime{}, 1).
+		WithArgs("permission_test_1", "Este es un permiso de prueba editado", anyTime{}, 1, 1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
+	expectOutbox(mock, "permission.updated").WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "permission.update", 1, "1", "permission_test").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 	body := []byte(`{
 		"name": "permission_test_1",
 		"description": "Este es un permiso de prueba editado"
@@ -600,3 +793,194 @@ func TestUpdatePermission_Editable(t *testing.T) {
 		t.Errorf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
 	}
 }
+
+func TestCreatePermissionPolicy_InvalidCondition(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(7, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "approve_payment", "Poder aprobar pagos", true, true, time.Now(), time.Now()),
+		)
+
+	body := []byte(`{"condition": "request.hour >= \"8\""}`)
+
+	res, b := request(t, serv, "/api/permissions/7/policies", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El operador `>=` requiere números o textos del mismo tipo"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreatePermissionPolicy_BuiltInPermission(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(5, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(5, "grant_permission", "Poder otorgar permisos", false, false, time.Now(), time.Now()),
+		)
+
+	body := []byte(`{"condition": "request.hour >= 8 && request.hour < 18"}`)
+
+	res, b := request(t, serv, "/api/permissions/5/policies", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if errorMessage.Message != "El permiso no puede ser editado" {
+		t.Errorf("Expected El permiso no puede ser editado, got: %s", errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreatePermissionPolicy_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(7, 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "approve_payment", "Poder aprobar pagos", true, true, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO permission_policies (permission_id, description, condition) SELECT p.id, $2, $3 FROM permissions p WHERE p.id = $1 AND p.org_id = $4 RETURNING id;")).
+		WithArgs(7, "Solo en horario laboral", "request.hour >= 8 && request.hour < 18", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	expectAudit(mock, "permission.create_policy", 1, "7", "approve_payment").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"description": "Solo en horario laboral", "condition": "request.hour >= 8 && request.hour < 18"}`)
+
+	res, b := request(t, serv, "/api/permissions/7/policies", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	location := res.Header.Get("Location")
+	if location != "/api/permissions/7/policies/1" {
+		t.Errorf("Expected /api/permissions/7/policies/1, got: %s", location)
+	}
+}
+
+func TestCrossTenant_PermissionPolicies(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	// El permiso 7 pertenece a la plataforma, así que sus políticas no existen para la organización 2.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(7, 2).
+		WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/permissions/7/policies", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	generateTenantAccessToken(t, mock, 2, 5, []string{"update_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE id = $1 AND org_id = $2;")).
+		WithArgs(7, 2).
+		WillReturnError(noResultsError)
+
+	res, b = request(t, serv, "/api/permissions/7/policies/1", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if errorMessage.Message != "El permiso no existe" {
+		t.Errorf("Expected El permiso no existe, got: %s", errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPoliciesRepository_IsScopedByOrganization(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	repository := repositories.PoliciesRepository{Database: db}
+
+	ctx := context.WithValue(context.Background(), "current_org_id", 2)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM permission_policies pp INNER JOIN permissions p ON p.id = pp.permission_id WHERE pp.permission_id = $1 AND p.org_id = $2 ORDER BY pp.id;")).
+		WithArgs(7, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "permission_id", "description", "condition", "created_at"}))
+
+	if _, err := repository.GetByPermission(ctx, 7); err != nil {
+		t.Fatalf("Could not get the policies %v", err)
+	}
+
+	mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM permission_policies pp USING permissions p WHERE pp.id = $1 AND p.id = pp.permission_id AND p.org_id = $2;")).
+		ExpectExec().
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := repository.Delete(ctx, 1); err != nil {
+		t.Fatalf("Could not delete the policy %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPermissions_PolicyNotSatisfied(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "delete_permission").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).
+				AddRow(6, "superadmin", []byte(`{"department":"sales"}`), `subject.attributes.department == "it"`),
+		)
+
+	res, b := request(t, serv, "/api/permissions/7", "DELETE", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "No cumples las condiciones requeridas para usar este permiso"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
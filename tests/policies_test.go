@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/policies"
+)
+
+func newPolicyContext() policies.Context {
+	return policies.Context{
+		Subject:  policies.NewSubject(2, "meli", map[string]string{"department": "it"}),
+		Request:  policies.NewRequest("10.1.2.3", time.Date(2022, 11, 14, 9, 30, 0, 0, time.UTC)),
+		Resource: map[string]interface{}{"owner_id": uint(2), "tags": []string{"a"}},
+	}
+}
+
+func TestPolicies_CompileErrors(t *testing.T) {
+	cases := []struct {
+		condition string
+		expected  string
+	}{
+		{condition: "", expected: "Debes ingresar la condición de la política"},
+		{condition: "subject.id ==", expected: "La condición está incompleta"},
+		{condition: "user.id == 1", expected: "El atributo `user.id` no existe, usa subject, request o resource"},
+		{condition: "request.country == \"co\"", expected: "El atributo `request.country` no existe"},
+		{condition: "subject == 1", expected: "Debes indicar un atributo de `subject`"},
+		{condition: "subject.id == \"2\"", expected: "No se puede comparar número con texto"},
+		{condition: "request.hour", expected: "La condición debe ser booleana, no número"},
+		{condition: "request.hour >= 8 &&", expected: "La condición está incompleta"},
+		{condition: "exec(\"rm\")", expected: "La función `exec` no existe"},
+		{condition: "ip_in_range(request.ip, \"10.0.0.0/33\")", expected: "El rango `10.0.0.0/33` no es un CIDR válido"},
+		{condition: "ip_in_range(request.ip)", expected: "La función `ip_in_range` recibe 2 argumentos"},
+		{condition: "request.weekday in \"monday\"", expected: "El operador `in` requiere una lista"},
+		{condition: "subject.id == 1; true", expected: "Posición 15: carácter `;` no permitido"},
+		{condition: "(subject.id == 1", expected: "Posición 16: se esperaba `)`"},
+	}
+
+	for _, td := range cases {
+		_, err := policies.Compile(td.condition)
+		if err == nil {
+			t.Errorf("Expected error %s for %s, got: nil", td.expected, td.condition)
+			continue
+		}
+
+		if err.Error() != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, err.Error())
+		}
+	}
+}
+
+func TestPolicies_Evaluate(t *testing.T) {
+	cases := []struct {
+		condition string
+		expected  bool
+	}{
+		{condition: "true", expected: true},
+		{condition: "subject.id == 2", expected: true},
+		{condition: "subject.username != \"meli\"", expected: false},
+		{condition: "subject.attributes.department == 'it'", expected: true},
+		{condition: "request.hour >= 8 && request.hour < 18", expected: true},
+		{condition: "request.weekday in [\"saturday\", \"sunday\"]", expected: false},
+		{condition: "!(request.weekday in [\"saturday\", \"sunday\"])", expected: true},
+		{condition: "ip_in_range(request.ip, \"10.0.0.0/8\")", expected: true},
+		{condition: "ip_in_range(request.ip, \"192.168.0.0/16\") || subject.id == 1", expected: false},
+		{condition: "resource.owner_id == subject.id", expected: true},
+		{condition: "starts_with(subject.username, \"me\")", expected: true},
+		{condition: "subject.id == 1 && resource.missing == 1", expected: false},
+	}
+
+	for _, td := range cases {
+		program, err := policies.Compile(td.condition)
+		if err != nil {
+			t.Fatalf("Could not compile %s: %v", td.condition, err)
+		}
+
+		result, err := program.Evaluate(newPolicyContext())
+		if err != nil {
+			t.Fatalf("Could not evaluate %s: %v", td.condition, err)
+		}
+
+		if result != td.expected {
+			t.Errorf("Expected %t for %s, got: %t", td.expected, td.condition, result)
+		}
+	}
+}
+
+func TestPolicies_EvaluateErrors(t *testing.T) {
+	cases := []struct {
+		condition string
+		expected  string
+	}{
+		{condition: "resource.missing == 1", expected: "El atributo `resource.missing` no existe en el contexto"},
+		{condition: "subject.attributes.country == \"co\"", expected: "El atributo `subject.attributes.country` no existe en el contexto"},
+		{condition: "resource.tags == 1", expected: ""},
+		{condition: "resource.owner_id < \"a\"", expected: "No se puede comparar 2 con a usando `<`"},
+	}
+
+	for _, td := range cases {
+		program, err := policies.Compile(td.condition)
+		if err != nil {
+			t.Fatalf("Could not compile %s: %v", td.condition, err)
+		}
+
+		result, err := program.Evaluate(newPolicyContext())
+		if td.expected == "" {
+			if err != nil || result {
+				t.Errorf("Expected false without error for %s, got: %t %v", td.condition, result, err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != td.expected {
+			t.Errorf("Expected %s, got: %v", td.expected, err)
+		}
+	}
+}
+
+func expectConditionalPermission(mock sqlmock.Sqlmock, permissionName string, attributes string, condition string) {
+	expectVerifyPermission(mock, 1, permissionName).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).
+				AddRow(1, "superadmin", []byte(attributes), condition),
+		)
+}
+
+func TestPolicies_ResourceFromQuery(t *testing.T) {
+	cases := []struct {
+		ownerID string
+		allowed bool
+	}{{ownerID: "1", allowed: true}, {ownerID: "2", allowed: false}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{})
+
+		expectConditionalPermission(mock, "edit_invoice", "{}", "resource.owner_id == subject.id")
+
+		res, b := request(t, serv, "/api/authz/check?permission=edit_invoice&resource.owner_id="+td.ownerID, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+		}
+
+		var data pkg.Map
+		if err := json.Unmarshal(b, &data); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if data["allowed"] != td.allowed {
+			t.Errorf("Expected allowed %t for the owner %s, got: %v", td.allowed, td.ownerID, data)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestPolicies_ResourceFromRoute(t *testing.T) {
+	cases := []struct {
+		department string
+		expected   int
+	}{{department: "it", expected: http.StatusOK}, {department: "sales", expected: http.StatusBadRequest}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{})
+
+		expectConditionalPermission(mock, "delete_user", `{"department":"it"}`, "resource.attributes.department == subject.attributes.department")
+
+		// El usuario de la ruta se busca solo para evaluar la política.
+		expectFindUser(mock, "meli", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT attributes FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"attributes"}).AddRow([]byte(`{"department":"` + td.department + `"}`)))
+
+		if td.expected == http.StatusOK {
+			expectFindUser(mock, "meli", sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+			mock.ExpectBegin()
+
+			expectOutbox(mock, "user.deleted").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM users WHERE id = $1 AND org_id = $2;")).
+				ExpectExec().WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+			mock.ExpectCommit()
+
+			expectAudit(mock, "user.delete", 1, "2", "meli").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		}
+
+		res, b := request(t, serv, "/api/users/meli", "DELETE", nil, accessToken)
+		if res.StatusCode != td.expected {
+			t.Errorf("Expected %d for the department %s, got: %d - %s", td.expected, td.department, res.StatusCode, b)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
@@ -0,0 +1,637 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/database"
+	"github.com/dsolartec/iam-meli/internal/reconciler"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+type recordingNotifier struct {
+	events []models.SecurityEvent
+}
+
+func (notifier *recordingNotifier) Notify(ctx context.Context, event models.SecurityEvent) error {
+	notifier.events = append(notifier.events, event)
+	return nil
+}
+
+const desiredState = `{
+	"version": 1,
+	"permissions": [
+		{"name": "read_orders", "description": "Poder consultar todas las órdenes"},
+		{"name": "refund_orders", "description": "Poder reembolsar las órdenes"}
+	],
+	"grants": [
+		{"username": "meli", "permission": "read_orders"},
+		{"username": "meli", "permission": "refund_orders"},
+		{"username": "ghost", "permission": "read_orders"}
+	]
+}`
+
+func writeDesiredState(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "desired.json")
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Could not write desired state %v", err)
+	}
+
+	return path
+}
+
+func newReconciler(db *database.Database) (*reconciler.Reconciler, *recordingNotifier) {
+	notifier := &recordingNotifier{}
+
+	return &reconciler.Reconciler{
+		Applications: &repositories.ApplicationsRepository{Database: db},
+		Auth:         &repositories.AuthorizationRepository{Database: db},
+		Constraints:  &repositories.ConstraintsRepository{Database: db},
+		Permissions:  &repositories.PermissionsRepository{Database: db},
+		State:        &repositories.StateRepository{Database: db},
+		Users:        &repositories.UsersRepository{Database: db},
+		Notifier:     notifier,
+		Metrics:      &reconciler.Metrics{},
+	}, notifier
+}
+
+// El reconciliador actúa como superadmin (ID 1) en la organización de la plataforma.
+func expectReconcileActor(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("superadmin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+}
+
+func expectPermissionChange(mock sqlmock.Sqlmock, action string) {
+	expectVerifyPermission(mock, 1, action).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "attributes", "condition"}).AddRow(1, "superadmin", []byte("{}"), nil))
+}
+
+func expectCurrentState(mock sqlmock.Sqlmock, prune bool) {
+	expectReconcileActor(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(permissionColumns).
+				AddRow(1, "create_user", "Poder crear usuarios", false, false, time.Now(), time.Now()).
+				AddRow(10, "read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()).
+				AddRow(11, "old_reports", "Poder ver los reportes viejos", true, true, time.Now(), time.Now()),
+		)
+
+	expectPermissionChange(mock, "update_permission")
+	expectPermissionChange(mock, "create_permission")
+
+	if prune {
+		expectPermissionChange(mock, "delete_permission")
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()).AddRow(2, "meli", time.Now()))
+
+	userPermissionColumns := []string{"id", "user_id", "permission_id", "permission_name", "grantable"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(1, 1, 1, "create_user", true))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(5, 2, 11, "old_reports", false))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	expectVerifyDelegation(mock, 1, 10, "read_orders").WillReturnRows(delegationRows(true, false, false, nil))
+	expectVerifyDelegation(mock, 1, 0, "refund_orders").WillReturnRows(delegationRows(true, false, false, nil))
+}
+
+func reconcileConfig(t *testing.T, content string, apply bool, prune bool) reconciler.Config {
+	return reconciler.Config{File: writeDesiredState(t, content), Apply: apply, Prune: prune, OrgID: 1, User: "superadmin"}
+}
+
+func metricsOutput(t *testing.T, metrics *reconciler.Metrics) string {
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	return rec.Body.String()
+}
+
+func TestReconciler_PlanOnly(t *testing.T) {
+	// Con `prune` la asignación integrada de superadmin no se puede quitar porque es quien reconcilia.
+	cases := []struct {
+		prune     bool
+		drift     int
+		delete    []string
+		conflicts []string
+	}{
+		{prune: false, drift: 4, delete: []string{}, conflicts: []string{"ghost/read_orders"}},
+		{prune: true, drift: 5, delete: []string{"old_reports"}, conflicts: []string{"ghost/read_orders", "superadmin/create_user"}},
+	}
+
+	for _, td := range cases {
+		db, mock := newDatabaseMock()
+
+		rec, notifier := newReconciler(db)
+
+		expectCurrentState(mock, td.prune)
+
+		plan, err := rec.Reconcile(context.Background(), reconcileConfig(t, desiredState, false, td.prune))
+		if err != nil {
+			t.Fatalf("Could not reconcile %v", err)
+		}
+
+		if plan.Drift() != td.drift {
+			t.Errorf("Expected drift %d, got: %d", td.drift, plan.Drift())
+		}
+
+		if len(plan.CreatePermissions) != 1 || plan.CreatePermissions[0].Name != "refund_orders" {
+			t.Errorf("Expected to create refund_orders, got: %v", plan.CreatePermissions)
+		}
+
+		if len(plan.UpdatePermissions) != 1 || plan.UpdatePermissions[0].Name != "read_orders" {
+			t.Errorf("Expected to update read_orders, got: %v", plan.UpdatePermissions)
+		}
+
+		if len(plan.CreateGrants) != 2 {
+			t.Errorf("Expected 2 grants, got: %v", plan.CreateGrants)
+		}
+
+		// La asignación de old_reports se borra junto con el permiso.
+		if len(plan.DeletePermissions) != len(td.delete) || len(plan.RevokeGrants) != 0 {
+			t.Errorf("Expected to delete %v, got: %v - %v", td.delete, plan.DeletePermissions, plan.RevokeGrants)
+		}
+
+		if len(plan.Conflicts) != len(td.conflicts) {
+			t.Fatalf("Expected %v conflicts, got: %v", td.conflicts, plan.Conflicts)
+		}
+
+		for i, name := range td.conflicts {
+			if plan.Conflicts[i].Name != name {
+				t.Errorf("Expected %s conflict, got: %v", name, plan.Conflicts[i])
+			}
+		}
+
+		if len(notifier.events) != 1 || notifier.events[0].Type != "reconcile.drift" {
+			t.Errorf("Expected reconcile.drift event, got: %v", notifier.events)
+		}
+
+		output := metricsOutput(t, rec.Metrics)
+		for _, expected := range []string{"iam_reconcile_runs_total 1", fmt.Sprintf("iam_reconcile_conflicts %d", len(td.conflicts))} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected %s in metrics, got: %s", expected, output)
+			}
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestReconciler_Apply(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	rec, notifier := newReconciler(db)
+
+	expectCurrentState(mock, true)
+
+	// Todo el plan se aplica en una sola transacción.
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) SELECT $1, $2, $3")).
+		WithArgs("refund_orders", "Poder reembolsar las órdenes", 1, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE permissions SET description = $1, updated_at = now() WHERE name = $2 AND org_id = $3 AND editable = TRUE RETURNING id;")).
+		WithArgs("Poder consultar todas las órdenes", "read_orders", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+
+	expectOutbox(mock, "permission.updated").WithArgs(10, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	for i, permission := range []string{"read_orders", "refund_orders"} {
+		expectGrantLock(mock, "meli", permission, 2, 10+i)
+		expectBreachedConstraints(mock, 2, 10+i).WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id, granted_by, grantable) SELECT u.id, p.id, $3, $4")).
+			WithArgs("meli", permission, 1, false, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20 + i))
+
+		expectOutbox(mock, "permission.granted").WithArgs(20 + i).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM permissions WHERE name = $1 AND org_id = $2 AND deletable = TRUE;")).
+		WithArgs("old_reports", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectTxAudit(mock, 1, "state.reconcile", 1, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectCommit()
+
+	plan, err := rec.Reconcile(context.Background(), reconcileConfig(t, desiredState, true, true))
+	if err != nil {
+		t.Fatalf("Could not reconcile %v", err)
+	}
+
+	if plan.Drift() != 5 {
+		t.Errorf("Expected drift 5, got: %d", plan.Drift())
+	}
+
+	if len(notifier.events) != 1 || notifier.events[0].Type != "reconcile.applied" {
+		t.Errorf("Expected reconcile.applied event, got: %v", notifier.events)
+	}
+
+	output := metricsOutput(t, rec.Metrics)
+	for _, expected := range []string{"iam_reconcile_drift 0", "iam_reconcile_applied_changes_total 5"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s in metrics, got: %s", expected, output)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReconciler_InvalidDesiredState(t *testing.T) {
+	db, _ := newDatabaseMock()
+
+	rec, notifier := newReconciler(db)
+
+	_, err := rec.Reconcile(context.Background(), reconcileConfig(t, `{"version": 2}`, true, false))
+	if err == nil || err.Error() != "La versión del estado deseado no es compatible" {
+		t.Errorf("Expected version error, got: %v", err)
+	}
+
+	if len(notifier.events) != 1 || notifier.events[0].Type != "reconcile.failed" {
+		t.Errorf("Expected reconcile.failed event, got: %v", notifier.events)
+	}
+
+	if output := metricsOutput(t, rec.Metrics); !strings.Contains(output, "iam_reconcile_failures_total 1") {
+		t.Errorf("Expected a failure in metrics, got: %s", output)
+	}
+}
+
+func TestReconciler_MetricsEndpoint(t *testing.T) {
+	os.Setenv("RECONCILE_FILE", writeDesiredState(t, desiredState))
+	defer os.Unsetenv("RECONCILE_FILE")
+
+	os.Setenv("METRICS_TOKEN", "MeLiMetrics")
+	defer os.Unsetenv("METRICS_TOKEN")
+
+	serv, _ := newTestServer()
+
+	for _, token := range []string{"", "OtroToken"} {
+		if res, _ := request(t, serv, "/metrics", "GET", nil, token); res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected %d, got: %d", http.StatusUnauthorized, res.StatusCode)
+		}
+	}
+
+	res, b := request(t, serv, "/metrics", "GET", nil, "MeLiMetrics")
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	if !strings.Contains(string(b), "iam_reconcile_runs_total 0") {
+		t.Errorf("Expected reconciler metrics, got: %s", b)
+	}
+}
+
+func TestReconciler_MetricsRequireToken(t *testing.T) {
+	os.Setenv("RECONCILE_FILE", writeDesiredState(t, desiredState))
+	defer os.Unsetenv("RECONCILE_FILE")
+
+	serv, _ := newTestServer()
+
+	// Sin `METRICS_TOKEN` las métricas no se exponen.
+	if res, _ := request(t, serv, "/metrics", "GET", nil, ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected %d, got: %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
+func TestReconciler_GrantChecks(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	rec, _ := newReconciler(db)
+
+	expectReconcileActor(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(permissionColumns).
+				AddRow(1, "create_user", "Poder crear usuarios", false, false, time.Now(), time.Now()).
+				AddRow(7, "create_payment", "Poder crear pagos", true, true, time.Now(), time.Now()).
+				AddRow(8, "approve_payment", "Poder aprobar pagos", true, true, time.Now(), time.Now()),
+		)
+
+	// Con `prune` los permisos no declarados se borran.
+	expectPermissionChange(mock, "delete_permission")
+	expectPermissionChange(mock, "delete_permission")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()).AddRow(2, "meli", time.Now()).AddRow(3, "admin", time.Now()))
+
+	userPermissionColumns := []string{"id", "user_id", "permission_id", "permission_name", "grantable"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(4, 2, 7, "create_payment", false))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(5, 3, 1, "create_user", false))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(constraintColumns).AddRow(1, "payments", "Pagos creados y aprobados por personas distintas", 1, "{7,8}", "{approve_payment,create_payment}", time.Now()))
+
+	// superadmin no puede delegar create_payment como delegable.
+	expectVerifyDelegation(mock, 1, 7, "create_payment").WillReturnRows(delegationRows(false, true, false, nil))
+
+	// La asignación no declarada del permiso integrado create_user se quita.
+	expectVerifyDelegation(mock, 1, 1, "create_user").WillReturnRows(delegationRows(true, true, true, nil))
+
+	document := `{
+		"version": 1,
+		"permissions": [],
+		"grants": [
+			{"username": "meli", "permission": "create_payment"},
+			{"username": "meli", "permission": "approve_payment"},
+			{"username": "admin", "permission": "create_payment", "grantable": true},
+			{"username": "superadmin", "permission": "approve_payment"}
+		]
+	}`
+
+	plan, err := rec.Reconcile(context.Background(), reconcileConfig(t, document, false, true))
+	if err != nil {
+		t.Fatalf("Could not reconcile %v", err)
+	}
+
+	expected := []models.StateConflict{
+		{Kind: "grant", Name: "meli/approve_payment", Reason: "No se puede otorgar el permiso porque viola la restricción de separación de funciones payments"},
+		{Kind: "grant", Name: "admin/create_payment", Reason: "No puedes otorgar el permiso create_payment como delegable porque no tienes el permiso delegate_any_permission"},
+		{Kind: "grant", Name: "superadmin/approve_payment", Reason: "No puedes otorgarte un permiso a ti mismo"},
+	}
+
+	if len(plan.Conflicts) != len(expected) {
+		t.Fatalf("Expected %d conflicts, got: %v", len(expected), plan.Conflicts)
+	}
+
+	for i, conflict := range expected {
+		if plan.Conflicts[i] != conflict {
+			t.Errorf("Expected %v, got: %v", conflict, plan.Conflicts[i])
+		}
+	}
+
+	if len(plan.CreateGrants) != 0 {
+		t.Errorf("Expected no grants to create, got: %v", plan.CreateGrants)
+	}
+
+	if len(plan.RevokeGrants) != 1 || plan.RevokeGrants[0].Username != "admin" || plan.RevokeGrants[0].Permission != "create_user" {
+		t.Errorf("Expected to revoke create_user from admin, got: %v", plan.RevokeGrants)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReconciler_PermissionChecks(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	rec, _ := newReconciler(db)
+
+	expectReconcileActor(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(permissionColumns).
+				AddRow(10, "read_orders", "Poder consultar las órdenes", true, true, time.Now(), time.Now()).
+				AddRow(11, "old_reports", "Poder ver los reportes viejos", true, true, time.Now(), time.Now()).
+				AddRow(20, "billing:read_invoices", "Poder consultar las facturas", true, true, time.Now(), time.Now()),
+		)
+
+	// superadmin no tiene los permisos para cambiar permisos. El permiso de billing lo mantiene el
+	// manifiesto de la aplicación, así que nunca se borra.
+	expectNotGranted(mock, 1, "update_permission")
+	expectNotGranted(mock, 1, "create_permission")
+	expectNotGranted(mock, 1, "delete_permission")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id", "permission_name", "grantable"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	document := `{
+		"version": 1,
+		"permissions": [
+			{"name": "read_orders", "description": "Poder consultar todas las órdenes"},
+			{"name": "refund_orders", "description": "Poder reembolsar las órdenes"}
+		],
+		"grants": []
+	}`
+
+	plan, err := rec.Reconcile(context.Background(), reconcileConfig(t, document, true, true))
+	if err != nil {
+		t.Fatalf("Could not reconcile %v", err)
+	}
+
+	message := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	expected := []models.StateConflict{
+		{Kind: "permission", Name: "read_orders", Reason: message},
+		{Kind: "permission", Name: "refund_orders", Reason: message},
+		{Kind: "permission", Name: "old_reports", Reason: message},
+	}
+
+	if len(plan.Conflicts) != len(expected) {
+		t.Fatalf("Expected %d conflicts, got: %v", len(expected), plan.Conflicts)
+	}
+
+	for i, conflict := range expected {
+		if plan.Conflicts[i] != conflict {
+			t.Errorf("Expected %v, got: %v", conflict, plan.Conflicts[i])
+		}
+	}
+
+	// Sin cambios permitidos no se abre ninguna transacción.
+	if plan.Drift() != 0 {
+		t.Errorf("Expected no drift, got: %v", plan.ReconcilePlan)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReconciler_GrantableDrift(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	rec, _ := newReconciler(db)
+
+	expectReconcileActor(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows(permissionColumns).
+				AddRow(1, "create_user", "Poder crear usuarios", false, false, time.Now(), time.Now()).
+				AddRow(7, "create_payment", "Poder crear pagos", true, true, time.Now(), time.Now()),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(1, "superadmin", time.Now()).AddRow(2, "meli", time.Now()).AddRow(3, "admin", time.Now()))
+
+	userPermissionColumns := []string{"id", "user_id", "permission_id", "permission_name", "grantable"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(4, 2, 7, "create_payment", false))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE up.user_id = $1 AND p.org_id = $2;")).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows(userPermissionColumns).AddRow(5, 3, 1, "create_user", true))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	// Volver delegable create_payment requiere delegate_any_permission; quitarle lo delegable a
+	// create_user solo requiere poder delegarlo.
+	expectVerifyDelegation(mock, 1, 7, "create_payment").WillReturnRows(delegationRows(false, true, false, nil))
+	expectVerifyDelegation(mock, 1, 1, "create_user").WillReturnRows(delegationRows(false, true, true, nil))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_permissions up SET grantable = $3 FROM users u, permissions p")).
+		WithArgs("admin", "create_user", false, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectTxAudit(mock, 1, "state.reconcile", 1, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectCommit()
+
+	document := `{
+		"version": 1,
+		"permissions": [],
+		"grants": [
+			{"username": "meli", "permission": "create_payment", "grantable": true},
+			{"username": "admin", "permission": "create_user"}
+		]
+	}`
+
+	plan, err := rec.Reconcile(context.Background(), reconcileConfig(t, document, true, false))
+	if err != nil {
+		t.Fatalf("Could not reconcile %v", err)
+	}
+
+	expected := models.StateConflict{Kind: "grant", Name: "meli/create_payment", Reason: "No puedes otorgar el permiso create_payment como delegable porque no tienes el permiso delegate_any_permission"}
+	if len(plan.Conflicts) != 1 || plan.Conflicts[0] != expected {
+		t.Errorf("Expected %v, got: %v", expected, plan.Conflicts)
+	}
+
+	if len(plan.UpdateGrants) != 1 || plan.UpdateGrants[0].Username != "admin" || plan.UpdateGrants[0].Grantable {
+		t.Errorf("Expected to make create_user not grantable for admin, got: %v", plan.UpdateGrants)
+	}
+
+	if plan.Drift() != 1 {
+		t.Errorf("Expected drift 1, got: %d", plan.Drift())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReconciler_ApplyRollsBack(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	rec, notifier := newReconciler(db)
+
+	expectCurrentState(mock, false)
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) SELECT $1, $2, $3")).
+		WithArgs("refund_orders", "Poder reembolsar las órdenes", 1, "").
+		WillReturnError(errors.New("conexión perdida"))
+
+	mock.ExpectRollback()
+
+	if _, err := rec.Reconcile(context.Background(), reconcileConfig(t, desiredState, true, false)); err == nil {
+		t.Fatalf("Expected the reconcile to fail")
+	}
+
+	if len(notifier.events) != 1 || notifier.events[0].Type != "reconcile.failed" {
+		t.Errorf("Expected reconcile.failed event, got: %v", notifier.events)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReconciler_RequiresUser(t *testing.T) {
+	db, _ := newDatabaseMock()
+
+	rec, _ := newReconciler(db)
+
+	config := reconcileConfig(t, desiredState, true, false)
+	config.User = ""
+
+	_, err := rec.Reconcile(context.Background(), config)
+	if err == nil || err.Error() != "Se debe indicar el usuario con el que se reconcilia el estado deseado" {
+		t.Errorf("Expected user error, got: %v", err)
+	}
+}
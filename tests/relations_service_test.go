@@ -0,0 +1,230 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+func expectRelationNamespaces(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, config, created_at, updated_at FROM relation_namespaces WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"name", "config", "created_at", "updated_at"}).
+				AddRow("document", "namespace document {\n  relation owner\n  relation viewer = this | owner\n}\n", time.Now(), time.Now()),
+		)
+}
+
+func TestRelations_NoAuthorized(t *testing.T) {
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+
+	urls := []struct {
+		method string
+		path   string
+	}{
+		{method: "PUT", path: "/api/relations/namespaces"},
+		{method: "POST", path: "/api/relations/tuples"},
+		{method: "DELETE", path: "/api/relations/tuples?tuple=document:readme%23owner@user:1"},
+	}
+
+	for _, url := range urls {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{})
+
+		res, b := request(t, serv, url.path, url.method, nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != expected {
+			t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestSaveRelationNamespaces_InvalidConfig(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_relations"})
+
+	body := []byte(`{"config": "namespace document {\n relation viewer = this | owner\n}"}`)
+
+	res, b := request(t, serv, "/api/relations/namespaces", "PUT", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La relación document#viewer usa la relación owner que no existe"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestSaveRelationNamespaces_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_relations"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO relation_namespaces (name, config, org_id) VALUES ($1, $2, $3)")).
+		WithArgs("document", "namespace document {\n  relation owner\n  relation viewer = this | owner\n}\n", 1, anyTime{}).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "updated_at"}).AddRow(time.Now(), time.Now()))
+
+	expectAudit(mock, "relation.save_namespaces", 1, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"config": "namespace document {\n relation owner\n relation viewer = this|owner\n}"}`)
+
+	res, b := request(t, serv, "/api/relations/namespaces", "PUT", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	namespaces := data["namespaces"].([]interface{})
+	if len(namespaces) != 1 {
+		t.Errorf("Expected 1 namespace, got: %d", len(namespaces))
+	}
+}
+
+func TestWriteRelationTuple_UndefinedRelation(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_relations"})
+
+	expectRelationNamespaces(mock)
+
+	body := []byte(`{"tuple": "document:readme#editor@user:1"}`)
+
+	res, b := request(t, serv, "/api/relations/tuples", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La relación document#editor no está definida"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestWriteRelationTuple_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_relations"})
+
+	expectRelationNamespaces(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM relation_tuples WHERE namespace = $1 AND object_id = $2 AND relation = $3")).
+		WithArgs("document", "readme", "owner", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "namespace", "object_id", "relation", "subject_namespace", "subject_object_id", "subject_relation", "created_at"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO relation_tuples")).
+		WithArgs("document", "readme", "owner", "user", "1", "", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	expectAudit(mock, "relation.write_tuple", 1, "1", "document:readme#owner@user:1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"tuple": "document:readme#owner@user:1"}`)
+
+	res, b := request(t, serv, "/api/relations/tuples", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	tuple := data["tuple"].(map[string]interface{})
+	if tuple["id"].(float64) != 1 {
+		t.Errorf("Expected 1, got: %f", tuple["id"].(float64))
+	}
+}
+
+func TestCheckRelation_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectRelationNamespaces(mock)
+
+	tupleColumns := []string{"id", "namespace", "object_id", "relation", "subject_namespace", "subject_object_id", "subject_relation", "created_at"}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM relation_tuples WHERE namespace = $1 AND object_id = $2 AND relation = $3")).
+		WithArgs("document", "readme", "viewer", 1).
+		WillReturnRows(sqlmock.NewRows(tupleColumns))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM relation_tuples WHERE namespace = $1 AND object_id = $2 AND relation = $3")).
+		WithArgs("document", "readme", "owner", 1).
+		WillReturnRows(sqlmock.NewRows(tupleColumns).AddRow(1, "document", "readme", "owner", "user", "1", "", time.Now()))
+
+	res, b := request(t, serv, "/api/relations/check?object=document:readme&relation=viewer&subject=user:1", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if !data["allowed"].(bool) {
+		t.Errorf("Expected allowed true, got: false")
+	}
+}
+
+func TestCrossTenant_Relations(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{})
+
+	// La organización 2 no ve los namespaces ni las tuplas de la plataforma.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, config, created_at, updated_at FROM relation_namespaces WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "config", "created_at", "updated_at"}))
+
+	res, _ := request(t, serv, "/api/relations/namespaces", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM relation_tuples WHERE namespace = $1 AND object_id = $2 AND relation = $3 AND org_id = $4")).
+		WithArgs("document", "readme", "owner", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "namespace", "object_id", "relation", "subject_namespace", "subject_object_id", "subject_relation", "created_at"}))
+
+	res, _ = request(t, serv, "/api/relations/tuples?object=document:readme&relation=owner", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/relations"
+)
+
+const relationsConfig = `
+namespace group {
+  relation member
+}
+
+namespace folder {
+  relation owner
+  relation viewer = this | owner
+}
+
+namespace document {
+  relation parent
+  relation owner
+  relation editor = this | owner
+  relation viewer = this | editor | parent->viewer
+}
+`
+
+type memoryTuples []models.RelationTuple
+
+func (tuples memoryTuples) GetObjectIDs(ctx context.Context, namespace string) ([]string, error) {
+	var objectIDs []string
+
+	seen := map[string]bool{}
+	for _, tuple := range tuples {
+		if tuple.Namespace == namespace && !seen[tuple.ObjectID] {
+			seen[tuple.ObjectID] = true
+			objectIDs = append(objectIDs, tuple.ObjectID)
+		}
+	}
+
+	return objectIDs, nil
+}
+
+func (tuples memoryTuples) GetTuples(ctx context.Context, namespace string, objectID string, relation string) ([]models.RelationTuple, error) {
+	var result []models.RelationTuple
+
+	for _, tuple := range tuples {
+		if tuple.Namespace == namespace && tuple.ObjectID == objectID && tuple.Relation == relation {
+			result = append(result, tuple)
+		}
+	}
+
+	return result, nil
+}
+
+func newRelationsEngine(t *testing.T, values ...string) *relations.Engine {
+	namespaces, err := relations.Parse(relationsConfig)
+	if err != nil {
+		t.Fatalf("Could not parse config %v", err)
+	}
+
+	var tuples memoryTuples
+	for _, value := range values {
+		tuple, err := relations.ParseTuple(value)
+		if err != nil {
+			t.Fatalf("Could not parse tuple %v", err)
+		}
+
+		tuples = append(tuples, tuple)
+	}
+
+	return &relations.Engine{Namespaces: namespaces, Tuples: tuples}
+}
+
+func TestRelationsParse_Success(t *testing.T) {
+	namespaces, err := relations.Parse(relationsConfig)
+	if err != nil {
+		t.Fatalf("Could not parse config %v", err)
+	}
+
+	if len(namespaces) != 3 {
+		t.Fatalf("Expected 3 namespaces, got: %d", len(namespaces))
+	}
+
+	expected := "namespace document {\n  relation parent\n  relation owner\n  relation editor = this | owner\n  relation viewer = this | editor | parent->viewer\n}\n"
+	if namespaces[2].String() != expected {
+		t.Errorf("Expected %s, got: %s", expected, namespaces[2].String())
+	}
+}
+
+func TestRelationsParse_Errors(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected string
+	}{
+		{config: "", expected: "La configuración debe tener al menos un namespace"},
+		{config: "namespace doc {\n relation owner\n", expected: "El namespace doc no fue cerrado"},
+		{config: "namespace doc\n}", expected: "Línea 1: se esperaba `{` al final de la declaración del namespace"},
+		{config: "relation owner", expected: "Línea 1: la relación debe estar dentro de un namespace"},
+		{config: "namespace doc {\n relation owner\n relation owner\n}", expected: "Línea 3: la relación owner está duplicada"},
+		{config: "namespace doc {\n relation viewer = this | editor\n}", expected: "La relación doc#viewer usa la relación editor que no existe"},
+		{config: "namespace doc {\n relation viewer = this | parent->viewer\n}", expected: "La relación doc#viewer usa la relación parent que no existe"},
+		{config: "namespace doc {\n relation viewer = this & owner\n}", expected: "Línea 2: el término `this & owner` no es válido"},
+	}
+
+	for _, td := range cases {
+		_, err := relations.Parse(td.config)
+		if err == nil {
+			t.Errorf("Expected error %s, got: nil", td.expected)
+			continue
+		}
+
+		if err.Error() != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, err.Error())
+		}
+	}
+}
+
+func TestRelationsParseTuple(t *testing.T) {
+	tuple, err := relations.ParseTuple("document:readme#viewer@group:eng#member")
+	if err != nil {
+		t.Fatalf("Could not parse tuple %v", err)
+	}
+
+	if tuple.Object() != "document:readme" || tuple.Relation != "viewer" || tuple.Subject() != "group:eng#member" {
+		t.Errorf("Expected document:readme#viewer@group:eng#member, got: %s", tuple.String())
+	}
+
+	for _, value := range []string{"document:readme#viewer", "document#viewer@user:1", "document:readme@user:1", "document:readme#viewer@user"} {
+		if _, err := relations.ParseTuple(value); err == nil {
+			t.Errorf("Expected error for %s, got: nil", value)
+		}
+	}
+}
+
+func TestRelationsCheck(t *testing.T) {
+	engine := newRelationsEngine(t,
+		"group:eng#member@user:2",
+		"folder:docs#viewer@group:eng#member",
+		"folder:docs#owner@user:4",
+		"document:readme#parent@folder:docs",
+		"document:readme#owner@user:1",
+		"document:secret#owner@user:1",
+		"document:secret#viewer@user:3",
+	)
+
+	cases := []struct {
+		object   string
+		relation string
+		subject  string
+		expected bool
+	}{
+		{object: "document:readme", relation: "viewer", subject: "user:1", expected: true},
+		{object: "document:readme", relation: "editor", subject: "user:1", expected: true},
+		{object: "document:readme", relation: "viewer", subject: "user:2", expected: true},
+		{object: "document:readme", relation: "viewer", subject: "user:4", expected: true},
+		{object: "document:readme", relation: "editor", subject: "user:2", expected: false},
+		{object: "document:readme", relation: "viewer", subject: "group:eng#member", expected: true},
+		{object: "document:secret", relation: "viewer", subject: "user:2", expected: false},
+		{object: "document:secret", relation: "viewer", subject: "user:3", expected: true},
+		{object: "document:secret", relation: "editor", subject: "user:3", expected: false},
+	}
+
+	for _, td := range cases {
+		allowed, err := engine.Check(context.Background(), td.object, td.relation, td.subject)
+		if err != nil {
+			t.Fatalf("Could not check %v", err)
+		}
+
+		if allowed != td.expected {
+			t.Errorf("Expected %t for %s#%s@%s, got: %t", td.expected, td.object, td.relation, td.subject, allowed)
+		}
+	}
+
+	if _, err := engine.Check(context.Background(), "document:readme", "commenter", "user:1"); err == nil {
+		t.Errorf("Expected error for undefined relation, got: nil")
+	}
+}
+
+func TestRelationsCheck_Cycle(t *testing.T) {
+	engine := newRelationsEngine(t,
+		"group:a#member@group:b#member",
+		"group:b#member@group:a#member",
+	)
+
+	if _, err := engine.Check(context.Background(), "group:a", "member", "user:1"); err == nil {
+		t.Errorf("Expected max depth error, got: nil")
+	}
+}
+
+func TestRelationsExpand(t *testing.T) {
+	engine := newRelationsEngine(t,
+		"group:eng#member@user:2",
+		"document:readme#owner@user:1",
+		"document:readme#viewer@group:eng#member",
+	)
+
+	tree, err := engine.Expand(context.Background(), "document:readme", "viewer")
+	if err != nil {
+		t.Fatalf("Could not expand %v", err)
+	}
+
+	if tree.Type != relations.UsersetUnion || len(tree.Children) != 3 {
+		t.Fatalf("Expected union with 3 children, got: %s with %d", tree.Type, len(tree.Children))
+	}
+
+	this := tree.Children[0]
+	if len(this.Subjects) != 1 || this.Subjects[0] != "group:eng#member" {
+		t.Errorf("Expected [group:eng#member], got: %v", this.Subjects)
+	}
+
+	members := this.Children[0].Children[0]
+	if len(members.Subjects) != 1 || members.Subjects[0] != "user:2" {
+		t.Errorf("Expected [user:2], got: %v", members.Subjects)
+	}
+
+	owners := tree.Children[1].Children[0].Children[1].Children[0].Children[0]
+	if len(owners.Subjects) != 1 || owners.Subjects[0] != "user:1" {
+		t.Errorf("Expected [user:1], got: %v", owners.Subjects)
+	}
+}
+
+func TestRelationsListObjects(t *testing.T) {
+	engine := newRelationsEngine(t,
+		"group:eng#member@user:2",
+		"folder:docs#viewer@group:eng#member",
+		"document:readme#parent@folder:docs",
+		"document:secret#owner@user:1",
+		"document:guide#viewer@user:2",
+	)
+
+	objects, err := engine.ListObjects(context.Background(), "document", "viewer", "user:2")
+	if err != nil {
+		t.Fatalf("Could not list objects %v", err)
+	}
+
+	if len(objects) != 2 || objects[0] != "document:readme" || objects[1] != "document:guide" {
+		t.Errorf("Expected [document:readme document:guide], got: %v", objects)
+	}
+}
@@ -0,0 +1,411 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/core/services"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+var (
+	campaignColumns   = []string{"id", "name", "description", "permission_id", "user_ids", "reviewer_ids", "deadline", "status", "created_by", "created_at", "closed_at"}
+	reviewItemColumns = []string{"id", "campaign_id", "user_permission_id", "user_id", "username", "permission_id", "permission_name", "reviewer_id", "reviewer_username", "decision", "comment", "decided_at"}
+)
+
+func expectCampaign(mock sqlmock.Sqlmock, id int, status string, deadline time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_campaigns WHERE id = $1 AND org_id = $2;")).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows(campaignColumns).AddRow(id, "Revisión Q1", "Revisión trimestral de permisos", 7, "{}", "{1,3}", deadline, status, 1, time.Now(), nil))
+}
+
+func TestCreateReviewCampaign_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectVerifyPermission(mock, 1, "manage_reviews").WillReturnError(noResultsError)
+
+	res, b := request(t, serv, "/api/reviews", "POST", bytes.NewBufferString(`{}`), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestCreateReviewCampaign_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body    string
+		message string
+	}{
+		{body: `{"name": "Q1"}`, message: "El nombre de la campaña debe tener entre 4 y 50 caracteres"},
+		{body: `{"name": "Revisión Q1", "description": "Q1"}`, message: "La descripción de la campaña debe tener entre 10 y 150 caracteres"},
+		{body: `{"name": "Revisión Q1", "description": "Revisión trimestral de permisos"}`, message: "Debes indicar el permiso o los usuarios que se van a revisar"},
+		{body: `{"name": "Revisión Q1", "description": "Revisión trimestral de permisos", "permission": "permission_test"}`, message: "Debes indicar al menos un revisor"},
+		{body: `{"name": "Revisión Q1", "description": "Revisión trimestral de permisos", "permission": "permission_test", "reviewers": ["admin"], "deadline": "2020-01-01T00:00:00Z"}`, message: "La fecha límite de la campaña debe ser posterior a la fecha actual"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_reviews"})
+
+		res, b := request(t, serv, "/api/reviews", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateReviewCampaign_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_reviews"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("permission_test", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(7, "permission_test", "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+
+	for _, reviewer := range []struct {
+		id       int
+		username string
+	}{{3, "admin"}, {2, "meli"}} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+			WithArgs(reviewer.username, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(reviewer.id, reviewer.username, time.Now()))
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM user_permissions up INNER JOIN users u ON u.id = up.user_id INNER JOIN permissions p ON p.id = up.permission_id WHERE ($1::integer IS NULL OR up.permission_id = $1)")).
+		WithArgs(7, "{}", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "username", "permission_id", "permission_name"}).
+				AddRow(1, 2, "meli", 7, "permission_test").
+				AddRow(2, 3, "admin", 7, "permission_test").
+				AddRow(3, 4, "pepe", 7, "permission_test"),
+		)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO review_campaigns (name, description, permission_id, user_ids, reviewer_ids, deadline, created_by, org_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;")).
+		WithArgs("Revisión Q1", "Revisión trimestral de permisos", 7, "{}", "{3,2}", anyTime{}, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	for i, item := range [][]int{{1, 2, 3}, {2, 3, 2}, {3, 4, 3}} {
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO review_items (campaign_id, user_permission_id, user_id, permission_id, reviewer_id) VALUES ($1, $2, $3, $4, $5) RETURNING id;")).
+			WithArgs(5, item[0], item[1], 7, item[2]).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i + 1))
+	}
+
+	mock.ExpectCommit()
+
+	deadline := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	body := `{"name": "Revisión Q1", "description": "Revisión trimestral de permisos", "permission": "permission_test", "reviewers": ["admin", "meli"], "deadline": "` + deadline + `"}`
+
+	res, b := request(t, serv, "/api/reviews", "POST", bytes.NewBufferString(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data struct {
+		Campaign models.ReviewCampaign `json:"campaign"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if len(data.Campaign.Items) != 3 {
+		t.Fatalf("Expected 3 items, got: %d", len(data.Campaign.Items))
+	}
+
+	for _, item := range data.Campaign.Items {
+		if item.ReviewerID == item.UserID {
+			t.Errorf("Expected the item %d not to be reviewed by its own user", item.ID)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReviewItem_AssignedToOtherReviewer(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectCampaign(mock, 5, "open", time.Now().Add(time.Hour))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_items ri LEFT JOIN users u ON u.id = ri.user_id")).
+		WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows(reviewItemColumns).AddRow(2, 5, 2, 3, "admin", 7, "permission_test", 3, "admin", "pending", "", nil))
+
+	res, b := request(t, serv, "/api/reviews/5/items/2/certify", "POST", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "Este elemento de revisión está asignado a otro revisor"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestReviewItem_Revoke(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectCampaign(mock, 5, "open", time.Now().Add(time.Hour))
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_items ri LEFT JOIN users u ON u.id = ri.user_id")).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows(reviewItemColumns).AddRow(1, 5, 4, 2, "meli", 7, "permission_test", 1, "superadmin", "pending", "", nil))
+
+	mock.ExpectBegin()
+
+	expectOutbox(mock, "permission.revoked").WithArgs(4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_permissions WHERE id = $1;")).
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE review_items SET decision = $1, comment = $2, decided_at = $3 WHERE id = $4;")).
+		WithArgs("revoked", "Ya no pertenece al equipo", anyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "review.revoke", 1, "2", "meli").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"comment": "Ya no pertenece al equipo"}`)
+
+	res, b := request(t, serv, "/api/reviews/5/items/1/revoke", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReviewCampaign_AutoRevokeAfterDeadline(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectCampaign(mock, 5, "open", time.Now().Add(-time.Hour))
+
+	mock.ExpectBegin()
+
+	// Los permisos revocados quedan en el registro de auditoría del cierre.
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT u.username, p.name FROM review_items ri")).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"username", "name"}).AddRow("meli", "permission_test"))
+
+	expectOutbox(mock, "permission.revoked").WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_permissions WHERE id IN (SELECT user_permission_id FROM review_items WHERE campaign_id = $1 AND decision = 'pending');")).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE review_items SET decision = 'auto_revoked', decided_at = now() WHERE campaign_id = $1 AND decision = 'pending';")).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE review_campaigns SET status = 'closed', closed_at = now() WHERE id = $1 RETURNING name, org_id;")).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "org_id"}).AddRow("Revisión Q1", 1))
+
+	expectTxAudit(mock, 1, "review.close", 1, "5", "Revisión Q1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectCommit()
+
+	res, b := request(t, serv, "/api/reviews/5/items/1/certify", "POST", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La campaña de revisión ya está cerrada"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReviewCampaign_SignedReport(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_reviews"})
+
+		expectCampaign(mock, 5, "closed", time.Now().Add(-time.Hour))
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM review_items ri LEFT JOIN users u ON u.id = ri.user_id")).
+			WithArgs(5, nil).
+			WillReturnRows(
+				sqlmock.NewRows(reviewItemColumns).
+					AddRow(1, 5, nil, 2, "meli", 7, "permission_test", 1, "superadmin", "revoked", "Ya no pertenece al equipo", time.Now()).
+					AddRow(2, 5, 5, 3, "admin", 7, "permission_test", 1, "superadmin", "certified", "", time.Now()),
+			)
+
+		res, b := request(t, serv, "/api/reviews/5/report?format="+format, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+		}
+
+		expectedType := map[string]string{"json": "application/json; charset=utf-8", "csv": "text/csv; charset=utf-8"}[format]
+		if contentType := res.Header.Get("Content-Type"); contentType != expectedType {
+			t.Errorf("Expected %s, got: %s", expectedType, contentType)
+		}
+
+		signature := strings.TrimPrefix(res.Header.Get("X-Report-Signature"), "sha256=")
+
+		signed := b
+		if format == "json" {
+			var data struct {
+				Report    json.RawMessage `json:"report"`
+				Signature string          `json:"signature"`
+			}
+
+			if err := json.Unmarshal(b, &data); err != nil {
+				t.Fatalf("Could not unmarshall response %v", err)
+			}
+
+			if data.Signature != signature {
+				t.Errorf("Expected the body signature to match the header, got: %s and %s", data.Signature, signature)
+			}
+
+			signed = data.Report
+		} else if !strings.HasPrefix(string(b), "campaign_id,item_id,user_id") {
+			t.Errorf("Expected a CSV report, got: %s", b)
+		}
+
+		if !pkg.VerifySignature("MeLiSigningTest", signed, signature) {
+			t.Errorf("Expected a valid %s report signature", format)
+		}
+	}
+}
+
+func TestCrossTenant_Reviews(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateTenantAccessToken(t, mock, 2, 5, []string{"manage_reviews"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_campaigns WHERE org_id = $1 ORDER BY id DESC;")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows(campaignColumns))
+
+	res, _ := request(t, serv, "/api/reviews", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	// La campaña 5 pertenece a la plataforma, así que no existe para la organización 2.
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_campaigns WHERE id = $1 AND org_id = $2;")).
+		WithArgs(5, 2).
+		WillReturnRows(sqlmock.NewRows(campaignColumns))
+
+	res, b := request(t, serv, "/api/reviews/5/items/2/certify", "POST", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if errorMessage.Message != "La campaña de revisión no existe" {
+		t.Errorf("Expected La campaña de revisión no existe, got: %s", errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCloseExpiredCampaigns_AuditsAutoRevoke(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM review_campaigns WHERE status = 'open' AND deadline <= now() ORDER BY id;")).
+		WillReturnRows(sqlmock.NewRows(campaignColumns).AddRow(8, "Revisión Q2", "Revisión trimestral de permisos", 7, "{}", "{5}", time.Now().Add(-time.Hour), "open", 5, time.Now(), nil))
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT u.username, p.name FROM review_items ri")).
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"username", "name"}).AddRow("billing", "refund_orders"))
+
+	expectOutbox(mock, "permission.revoked").WithArgs(8).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM user_permissions WHERE id IN")).
+		WithArgs(8).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE review_items SET decision = 'auto_revoked'")).
+		WithArgs(8).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE review_campaigns SET status = 'closed', closed_at = now() WHERE id = $1 RETURNING name, org_id;")).
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "org_id"}).AddRow("Revisión Q2", 2))
+
+	// En segundo plano no hay actor y el registro va a la organización de la campaña.
+	expectTxAudit(mock, 2, "review.close", nil, "8", "Revisión Q2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectCommit()
+
+	services.CloseExpiredCampaigns(context.Background(), &repositories.ReviewsRepository{Database: db})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,495 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+)
+
+const passwordHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+func expectStateExport(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT username, password, attributes FROM users WHERE org_id = $1 ORDER BY id;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"username", "password", "attributes"}).
+				AddRow("superadmin", passwordHash, []byte(`{}`)).
+				AddRow("meli", passwordHash, []byte(`{"department":"it"}`)),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT name, description, deletable, editable FROM permissions WHERE org_id = $1 ORDER BY id;")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"name", "description", "deletable", "editable"}).
+				AddRow("create_user", "Poder crear usuarios", false, false).
+				AddRow("read_orders", "Poder consultar las órdenes", true, true),
+		)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT u.username, p.name, up.grantable FROM user_permissions up")).
+		WithArgs(1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"username", "name", "grantable"}).
+				AddRow("superadmin", "create_user", true).
+				AddRow("meli", "read_orders", false),
+		)
+}
+
+func expectStateConstraints(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM separation_constraints c WHERE c.org_id = $1 ORDER BY c.id;")).
+		WithArgs(1).
+		WillReturnRows(rows)
+}
+
+// Si `permissionID` es 0 el permiso todavía no existe y se crea en la misma importación.
+func expectStateGrantDelegation(mock sqlmock.Sqlmock, permissionID int, permissionName string) *sqlmock.ExpectedQuery {
+	query := mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs(permissionName, 1)
+
+	if permissionID == 0 {
+		query.WillReturnError(noResultsError)
+	} else {
+		query.WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(permissionID, permissionName, "Este es un permiso de prueba", true, true, time.Now(), time.Now()),
+		)
+	}
+
+	return expectVerifyDelegation(mock, 1, permissionID, permissionName)
+}
+
+func TestExportState_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	res, b := request(t, serv, "/api/state/export", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "¿Qué intentas hacer? No tienes permisos suficientes para hacer esta acción"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestExportState_Success(t *testing.T) {
+	cases := []struct {
+		path      string
+		passwords bool
+	}{{path: "/api/state/export", passwords: false}, {path: "/api/state/export?include_passwords=true", passwords: true}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"export_iam_state"})
+
+		expectStateExport(mock)
+
+		res, b := request(t, serv, td.path, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+		}
+
+		var document models.StateDocument
+		if err := json.Unmarshal(b, &document); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if document.Version != models.StateVersion {
+			t.Errorf("Expected version %d, got: %d", models.StateVersion, document.Version)
+		}
+
+		if len(document.Users) != 2 || len(document.Permissions) != 2 || len(document.Grants) != 2 {
+			t.Fatalf("Expected 2 users, permissions and grants, got: %+v", document)
+		}
+
+		if (document.Users[0].Password != "") != td.passwords {
+			t.Errorf("Expected passwords %t, got: %q", td.passwords, document.Users[0].Password)
+		}
+
+		if document.Users[1].Attributes["department"] != "it" {
+			t.Errorf("Expected department it, got: %v", document.Users[1].Attributes)
+		}
+	}
+}
+
+func TestImportState_UnsupportedVersion(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	res, b := request(t, serv, "/api/state/import", "POST", bytes.NewBufferString(`{"version": 2}`), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "La versión del documento no es compatible"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+var stagingDocument = `{
+	"version": 1,
+	"users": [
+		{"username": "meli"},
+		{"username": "billing", "password": "` + passwordHash + `"},
+		{"username": "shipping"}
+	],
+	"permissions": [
+		{"name": "create_user", "description": "Poder crear usuarios", "editable": false},
+		{"name": "read_orders", "description": "Poder consultar todas las órdenes", "editable": true},
+		{"name": "refund_orders", "description": "Poder reembolsar las órdenes", "editable": true},
+		{"name": "manage_billing", "description": "Poder administrar la facturación", "editable": false}
+	],
+	"grants": [
+		{"username": "meli", "permission": "read_orders"},
+		{"username": "billing", "permission": "refund_orders", "grantable": true},
+		{"username": "shipping", "permission": "read_orders"}
+	]
+}`
+
+func TestImportState_DryRun(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns))
+
+	expectStateGrantDelegation(mock, 0, "refund_orders").WillReturnRows(delegationRows(true, false, false, nil))
+
+	res, b := request(t, serv, "/api/state/import?dry_run=true", "POST", bytes.NewBufferString(stagingDocument), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data struct {
+		Plan   models.StateImportPlan `json:"plan"`
+		DryRun bool                   `json:"dry_run"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	plan := data.Plan
+
+	if len(plan.CreateUsers) != 1 || plan.CreateUsers[0].Username != "billing" {
+		t.Errorf("Expected to create billing, got: %v", plan.CreateUsers)
+	}
+
+	if len(plan.CreatePermissions) != 1 || plan.CreatePermissions[0].Name != "refund_orders" {
+		t.Errorf("Expected to create refund_orders, got: %v", plan.CreatePermissions)
+	}
+
+	if len(plan.UpdatePermissions) != 1 || plan.UpdatePermissions[0].Name != "read_orders" {
+		t.Errorf("Expected to update read_orders, got: %v", plan.UpdatePermissions)
+	}
+
+	if len(plan.CreateGrants) != 1 || plan.CreateGrants[0].Username != "billing" {
+		t.Errorf("Expected to grant refund_orders to billing, got: %v", plan.CreateGrants)
+	}
+
+	// meli, create_user y la asignación de read_orders a meli ya existen.
+	if plan.Unchanged != 3 {
+		t.Errorf("Expected 3 unchanged, got: %d", plan.Unchanged)
+	}
+
+	expected := []models.StateConflict{
+		{Kind: "user", Name: "shipping", Reason: "El documento no incluye la contraseña del usuario"},
+		{Kind: "permission", Name: "manage_billing", Reason: "El permiso integrado no existe en el destino"},
+		{Kind: "grant", Name: "shipping/read_orders", Reason: "El usuario no existe"},
+	}
+
+	if len(plan.Conflicts) != len(expected) {
+		t.Fatalf("Expected %d conflicts, got: %v", len(expected), plan.Conflicts)
+	}
+
+	for i, conflict := range expected {
+		if plan.Conflicts[i] != conflict {
+			t.Errorf("Expected %v, got: %v", conflict, plan.Conflicts[i])
+		}
+	}
+
+	// El modo de prueba no debe escribir en la base de datos.
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportState_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns).AddRow(3, "billing", "Aplicación de facturación", time.Now()))
+
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns))
+
+	expectStateGrantDelegation(mock, 0, "refund_orders").WillReturnRows(delegationRows(true, false, false, nil))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (username, password, attributes, org_id) SELECT $1, $2, $3, $4")).
+		WithArgs("billing", passwordHash, "{}", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) SELECT $1, $2, $3")).
+		WithArgs("refund_orders", "Poder reembolsar las órdenes", 1, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE permissions SET description = $1, updated_at = now() WHERE name = $2 AND org_id = $3 AND editable = TRUE;")).
+		WithArgs("Poder consultar todas las órdenes", "read_orders", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectGrantLock(mock, "billing", "refund_orders", 3, 12)
+	expectBreachedConstraints(mock, 3, 12).WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id, grantable) SELECT u.id, p.id, $3")).
+		WithArgs("billing", "refund_orders", true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "state.import", 1, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	res, b := request(t, serv, "/api/state/import", "POST", bytes.NewBufferString(stagingDocument), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+// Una asignación hecha entre el plan y la transacción no debe dejar pasar una violación de la
+// separación de funciones.
+func TestImportState_ConstraintBreachedInTransaction(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns).AddRow(3, "billing", "Aplicación de facturación", time.Now()))
+
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns))
+
+	expectStateGrantDelegation(mock, 0, "refund_orders").WillReturnRows(delegationRows(true, false, false, nil))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO users (username, password, attributes, org_id) SELECT $1, $2, $3, $4")).
+		WithArgs("billing", passwordHash, "{}", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO permissions (name, description, org_id, application_id) SELECT $1, $2, $3")).
+		WithArgs("refund_orders", "Poder reembolsar las órdenes", 1, "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE permissions SET description = $1, updated_at = now() WHERE name = $2 AND org_id = $3 AND editable = TRUE;")).
+		WithArgs("Poder consultar todas las órdenes", "read_orders", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectGrantLock(mock, "billing", "refund_orders", 3, 12)
+	expectBreachedConstraints(mock, 3, 12).
+		WillReturnRows(
+			sqlmock.NewRows(constraintColumns).
+				AddRow(1, "refunds", "Reembolsos creados y aprobados por personas distintas", 1, "{11,12}", "{approve_refund,refund_orders}", time.Now()),
+		)
+
+	mock.ExpectRollback()
+
+	res, b := request(t, serv, "/api/state/import", "POST", bytes.NewBufferString(stagingDocument), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusBadRequest, res.StatusCode, b)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "No se puede otorgar el permiso porque viola la restricción de separación de funciones refunds"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportState_Idempotent(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns))
+
+	// Importar el mismo estado que ya existe no debe abrir ninguna transacción.
+	document := `{
+		"version": 1,
+		"users": [{"username": "superadmin"}, {"username": "meli", "attributes": {"department": "it"}}],
+		"permissions": [{"name": "create_user", "description": "Poder crear usuarios"}, {"name": "read_orders", "description": "Poder consultar las órdenes", "editable": true}],
+		"grants": [{"username": "superadmin", "permission": "create_user", "grantable": true}, {"username": "meli", "permission": "read_orders"}]
+	}`
+
+	res, b := request(t, serv, "/api/state/import", "POST", bytes.NewBufferString(document), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportState_GrantChecks(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	// meli ya tiene read_orders, así que no puede recibir también create_user.
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns).
+		AddRow(1, "users_orders", "Usuarios y órdenes administrados por personas distintas", 1, "{9,7}", "{create_user,read_orders}", time.Now()))
+
+	// Los cambios de `grantable` son diferencias y pasan por la validación de delegación.
+	expectStateGrantDelegation(mock, 9, "create_user").WillReturnRows(delegationRows(true, true, true, nil))
+	expectStateGrantDelegation(mock, 7, "read_orders").WillReturnRows(delegationRows(false, true, false, nil))
+
+	document := `{
+		"version": 1,
+		"users": [],
+		"permissions": [],
+		"grants": [
+			{"username": "superadmin", "permission": "create_user"},
+			{"username": "meli", "permission": "read_orders", "grantable": true},
+			{"username": "meli", "permission": "create_user"}
+		]
+	}`
+
+	res, b := request(t, serv, "/api/state/import?dry_run=true", "POST", bytes.NewBufferString(document), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data struct {
+		Plan models.StateImportPlan `json:"plan"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	plan := data.Plan
+
+	if len(plan.UpdateGrants) != 1 || plan.UpdateGrants[0].Username != "superadmin" || plan.UpdateGrants[0].Grantable {
+		t.Errorf("Expected to remove grantable from superadmin/create_user, got: %v", plan.UpdateGrants)
+	}
+
+	if len(plan.CreateGrants) != 0 || plan.Unchanged != 0 {
+		t.Errorf("Expected no grants to create nor unchanged, got: %v, %d", plan.CreateGrants, plan.Unchanged)
+	}
+
+	expected := []models.StateConflict{
+		{Kind: "grant", Name: "meli/create_user", Reason: "No se puede otorgar el permiso porque viola la restricción de separación de funciones users_orders"},
+		{Kind: "grant", Name: "meli/read_orders", Reason: "No puedes otorgar el permiso read_orders como delegable porque no tienes el permiso delegate_any_permission"},
+	}
+
+	if len(plan.Conflicts) != len(expected) {
+		t.Fatalf("Expected %d conflicts, got: %v", len(expected), plan.Conflicts)
+	}
+
+	for i, conflict := range expected {
+		if plan.Conflicts[i] != conflict {
+			t.Errorf("Expected %v, got: %v", conflict, plan.Conflicts[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestImportState_UpdatesGrantable(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"import_iam_state"})
+
+	expectStateExport(mock)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, created_at FROM applications WHERE org_id = $1 ORDER BY name;")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(applicationColumns))
+
+	expectStateConstraints(mock, sqlmock.NewRows(constraintColumns))
+
+	expectStateGrantDelegation(mock, 7, "read_orders").WillReturnRows(delegationRows(true, false, false, nil))
+
+	mock.ExpectBegin()
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE user_permissions up SET grantable = $3 FROM users u, permissions p")).
+		WithArgs("meli", "read_orders", true, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectCommit()
+
+	expectAudit(mock, "state.import", 1, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	document := `{"version": 1, "users": [], "permissions": [], "grants": [{"username": "meli", "permission": "read_orders", "grantable": true}]}`
+
+	res, b := request(t, serv, "/api/state/import", "POST", bytes.NewBufferString(document), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
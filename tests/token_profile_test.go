@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/lib/pq"
+)
+
+var tokenCatalog = []string{"create_permission", "delete_user", "grant_permission", "revoke_permission"}
+
+func expectPermissionCatalog(mock sqlmock.Sqlmock, version int, permissions []string) {
+	mock.ExpectQuery(regexp.QuoteMeta("COALESCE(array_agg(name ORDER BY id), '{}')")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "permissions"}).AddRow(version, pq.Array(permissions)))
+}
+
+func loginWithProfile(t *testing.T, profile string) (pkg.Map, *pkg.Claim) {
+	serv, mock := newTestServer()
+
+	user := models.User{Password: "12345"}
+	if err := user.EncryptPassword(); err != nil {
+		t.Fatalf("Could not encrypt password %v", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, password, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("ana", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "created_at"}).AddRow(2, "ana", user.Password, time.Now()))
+
+	expectPermissionCatalog(mock, 7, tokenCatalog)
+
+	// Solo delete_user se puede verificar sin el IAM: grant_permission tiene políticas y
+	// revoke_permission está denegado.
+	expectEffectivePermissions(mock, 2,
+		sqlmock.NewRows(effectivePermissionsColumns).
+			AddRow(2, "delete_user", "ana", []byte("{}"), nil).
+			AddRow(3, "grant_permission", "ana", []byte("{}"), `subject.attributes.team == "platform"`).
+			AddRow(4, "revoke_permission", "ana", []byte("{}"), nil),
+		sqlmock.NewRows(effectiveDeniesColumns).
+			AddRow(1, 4, "revoke_permission", "Congelamiento de cambios", nil),
+	)
+
+	expectAudit(mock, "auth.login", 2, "2", "ana").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"username": "ana", "password": "12345", "profile": "` + profile + `"}`)
+
+	res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	claim, err := pkg.ParseToken(data["accessToken"].(string), "MeLiTest")
+	if err != nil {
+		t.Fatalf("Could not parse access token %v", err)
+	}
+
+	if claim.CatalogVersion != 7 || data["catalogVersion"] != float64(7) {
+		t.Errorf("Expected the catalog version 7, got: %d %v", claim.CatalogVersion, data["catalogVersion"])
+	}
+
+	if claim.ExpiresAt <= time.Now().Unix() || claim.ExpiresAt > time.Now().Add(5*time.Minute).Unix() || data["expiresAt"] == nil {
+		t.Errorf("Expected a short-lived token, got: %d", claim.ExpiresAt)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+
+	return data, claim
+}
+
+func TestLogin_TokenProfilePermissions(t *testing.T) {
+	_, claim := loginWithProfile(t, "permissions")
+
+	if !reflect.DeepEqual(claim.Permissions, []string{"delete_user"}) || claim.PermissionBits != "" {
+		t.Errorf("Expected [delete_user], got: %v %q", claim.Permissions, claim.PermissionBits)
+	}
+
+	if !claim.HasPermission("delete_user", nil) || claim.HasPermission("grant_permission", nil) {
+		t.Error("Expected only delete_user to be verifiable from the token")
+	}
+}
+
+func TestLogin_TokenProfileBitset(t *testing.T) {
+	_, claim := loginWithProfile(t, "bitset")
+
+	if claim.PermissionBits != "Ag" || claim.Permissions != nil {
+		t.Errorf("Expected the bitset Ag, got: %q %v", claim.PermissionBits, claim.Permissions)
+	}
+
+	if !claim.HasPermission("delete_user", tokenCatalog) || claim.HasPermission("revoke_permission", tokenCatalog) {
+		t.Error("Expected only delete_user to be verifiable from the token")
+	}
+}
+
+func TestLogin_InvalidTokenProfile(t *testing.T) {
+	serv, _ := newTestServer()
+
+	body := []byte(`{"username": "ana", "password": "12345", "profile": "full"}`)
+
+	res, b := request(t, serv, "/api/auth/login", "POST", bytes.NewBuffer(body), "")
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El perfil del token debe ser permissions o bitset"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestPermissionBits(t *testing.T) {
+	catalog := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	bits := pkg.EncodePermissionBits([]string{"a", "h", "j", "unknown"}, catalog)
+
+	permissions, err := pkg.DecodePermissionBits(bits, catalog)
+	if err != nil || !reflect.DeepEqual(permissions, []string{"a", "h", "j"}) {
+		t.Errorf("Expected [a h j], got: %v %v", permissions, err)
+	}
+
+	// Un token emitido con un catálogo más grande no corresponde al actual.
+	if _, err := pkg.DecodePermissionBits(bits, catalog[:4]); err == nil {
+		t.Error("Expected an error decoding against a smaller catalog")
+	}
+}
+
+func TestGetPermissionCatalog(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	expectPermissionCatalog(mock, 7, tokenCatalog)
+
+	res, b := request(t, serv, "/api/permissions/catalog", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
+	}
+
+	if res.Header.Get("ETag") != `"7"` {
+		t.Errorf("Expected the ETag \"7\", got: %s", res.Header.Get("ETag"))
+	}
+
+	var data struct {
+		Catalog models.PermissionCatalog `json:"catalog"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if data.Catalog.Version != 7 || !reflect.DeepEqual(data.Catalog.Permissions, tokenCatalog) {
+		t.Errorf("Expected the catalog, got: %+v", data.Catalog)
+	}
+
+	// Con la misma versión no hace falta volver a descargarlo.
+	expectPermissionCatalog(mock, 7, tokenCatalog)
+
+	req := httptest.NewRequest("GET", "/api/permissions/catalog", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("If-None-Match", `"7"`)
+
+	rec := httptest.NewRecorder()
+	serv.Router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got: %d", http.StatusNotModified, rec.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
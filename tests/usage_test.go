@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/pkg"
+)
+
+const flushUsageQuery = "UPDATE user_permissions up SET last_used_at = u.used_at FROM unnest($1::integer[], $2::integer[], $3::timestamp[], $4::integer[]) AS u(user_id, permission_id, used_at, org_id), users us"
+
+var staleGrantColumns = []string{"id", "user_id", "username", "permission_id", "permission_name", "granted_at", "last_used_at"}
+
+func TestUsageRepository_Flush(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	usage := repositories.UsageRepository{Database: db}
+
+	usage.Record(context.Background(), 2, 7)
+	usage.Record(context.Background(), 2, 7)
+	usage.Record(context.Background(), 3, 7)
+
+	mock.ExpectExec(regexp.QuoteMeta(flushUsageQuery)).
+		WithArgs(sqlmock.AnyArg(), "{7,7}", sqlmock.AnyArg(), "{1,1}").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := usage.Flush(context.Background()); err != nil {
+		t.Fatalf("Could not flush usage %v", err)
+	}
+
+	// Sin usos pendientes no se debe hacer ninguna consulta.
+	if err := usage.Flush(context.Background()); err != nil {
+		t.Fatalf("Could not flush usage %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUsageRepository_FlushIsScopedByOrganization(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	usage := repositories.UsageRepository{Database: db}
+
+	// El uso se guarda solo para los usuarios de la organización en la que se verificó el permiso.
+	usage.Record(context.WithValue(context.Background(), "current_org_id", 2), 5, 9)
+
+	mock.ExpectExec(regexp.QuoteMeta(flushUsageQuery+" WHERE up.user_id = u.user_id AND up.permission_id = u.permission_id AND us.id = up.user_id AND us.org_id = u.org_id")).
+		WithArgs("{5}", "{9}", sqlmock.AnyArg(), "{2}").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := usage.Flush(context.Background()); err != nil {
+		t.Fatalf("Could not flush usage %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUsageRepository_FlushOnFullBatch(t *testing.T) {
+	db, mock := newDatabaseMock()
+
+	usage := repositories.UsageRepository{Database: db, BatchSize: 2, FlushInterval: time.Hour}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		usage.Run(stop)
+		close(done)
+	}()
+
+	mock.ExpectExec(regexp.QuoteMeta(flushUsageQuery)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	usage.Record(context.Background(), 2, 7)
+	usage.Record(context.Background(), 3, 7)
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	<-done
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected the full batch to be flushed: %s", err)
+	}
+}
+
+func TestPermissionUsage_RecordedOnVerify(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_permission_usage"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE COALESCE(up.last_used_at, up.created_at) < $1 AND u.org_id = $2")).
+		WithArgs(anyTime{}, 1).
+		WillReturnRows(sqlmock.NewRows(staleGrantColumns))
+
+	res, _ := request(t, serv, "/api/permissions/stale", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected %d, got: %d", http.StatusNoContent, res.StatusCode)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(flushUsageQuery)).
+		WithArgs("{1}", "{1}", sqlmock.AnyArg(), "{1}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := serv.Close(); err != nil {
+		t.Fatalf("Could not close server %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetStaleGrants_ValidationErrors(t *testing.T) {
+	for _, days := range []string{"0", "abc", "4000"} {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"view_permission_usage"})
+
+		res, b := request(t, serv, "/api/permissions/stale?days="+days, "GET", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		expected := "Los días deben ser un número entre 1 y 3650"
+		if errorMessage.Message != expected {
+			t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestGetStaleGrants_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"view_permission_usage"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE COALESCE(up.last_used_at, up.created_at) < $1 AND u.org_id = $2")).
+		WithArgs(anyTime{}, 1).
+		WillReturnRows(
+			sqlmock.NewRows(staleGrantColumns).
+				AddRow(4, 2, "meli", 7, "permission_test", time.Now().AddDate(0, -6, 0), nil).
+				AddRow(5, 3, "admin", 7, "permission_test", time.Now().AddDate(-1, 0, 0), time.Now().AddDate(0, -2, 0)),
+		)
+
+	res, b := request(t, serv, "/api/permissions/stale?days=30", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if grants := data["grants"].([]interface{}); len(grants) != 2 {
+		t.Errorf("Expected 2 grants, got: %d", len(grants))
+	}
+
+	if data["days"].(float64) != 30 {
+		t.Errorf("Expected 30 days, got: %v", data["days"])
+	}
+}
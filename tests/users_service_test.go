@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -112,10 +113,10 @@ func TestDeleteUser_NotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -156,10 +157,10 @@ func TestDeleteUser_NoDeletable(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -198,17 +199,26 @@ func TestDeleteUser_Deletable(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM users WHERE id = $1;")).
-			ExpectExec().WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectBegin()
+
+		expectOutbox(mock, "user.deleted").WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM users WHERE id = $1 AND org_id = $2;")).
+			ExpectExec().WithArgs(2, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectCommit()
+
+		expectAudit(mock, "user.delete", 1, "2", "meli").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 		res, _ := request(t, serv, "/api/users/"+find, "DELETE", nil, accessToken)
 		if res.StatusCode != http.StatusOK {
@@ -222,7 +232,7 @@ func TestGetAllUsers_NoData(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users;")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}))
 
 	res, _ := request(t, serv, "/api/users", "GET", nil, accessToken)
@@ -236,7 +246,7 @@ func TestGetAllUsers_Success(t *testing.T) {
 
 	accessToken := generateAccessToken(t, mock, []string{})
 
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users;")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE org_id = $1;")).
 		WillReturnRows(
 			sqlmock.NewRows([]string{"id", "username", "created_at"}).
 				AddRow(1, "superadmin", time.Now()).
@@ -286,10 +296,10 @@ func TestGetOneUser_NoData(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -319,10 +329,10 @@ func TestGetOneUser_Success(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -366,10 +376,10 @@ func TestGetAllUserPermissions_UserNotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -409,10 +419,10 @@ func TestGetAllUserPermissions_NoData(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -423,13 +433,18 @@ func TestGetAllUserPermissions_NoData(t *testing.T) {
 				up.id,
 				up.user_id,
 				up.permission_id,
-				p.name as permission_name
+				p.name as permission_name,
+				up.grantable
 			FROM user_permissions up
 				INNER JOIN permissions p ON p.id = up.permission_id
-			WHERE user_id = $1;
+			WHERE up.user_id = $1 AND p.org_id = $2;
 		`)).
+			WithArgs(1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id", "permission_name", "grantable"}))
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id WHERE (d.user_id = $1")).
 			WithArgs(1).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id", "permission_name"}))
+			WillReturnRows(sqlmock.NewRows(denyColumns))
 
 		res, _ := request(t, serv, "/api/users/"+find+"/permissions", "GET", nil, accessToken)
 		if res.StatusCode != http.StatusNoContent {
@@ -455,10 +470,10 @@ func TestGetAllUserPermissions_Success(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -469,16 +484,24 @@ func TestGetAllUserPermissions_Success(t *testing.T) {
 				up.id,
 				up.user_id,
 				up.permission_id,
-				p.name as permission_name
+				p.name as permission_name,
+				up.grantable
 			FROM user_permissions up
 				INNER JOIN permissions p ON p.id = up.permission_id
-			WHERE user_id = $1;
+			WHERE up.user_id = $1 AND p.org_id = $2;
 		`)).
+			WithArgs(1, 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "user_id", "permission_id", "permission_name", "grantable"}).
+					AddRow(1, 1, 1, "permission_test", false).
+					AddRow(2, 1, 2, "permission_test_1", true),
+			)
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM permission_denies d INNER JOIN permissions p ON p.id = d.permission_id INNER JOIN users u ON u.id = $1 AND u.org_id = p.org_id WHERE (d.user_id = $1")).
 			WithArgs(1).
 			WillReturnRows(
-				sqlmock.NewRows([]string{"id", "user_id", "permission_id", "permission_name"}).
-					AddRow(1, 1, 1, "permission_test").
-					AddRow(2, 1, 2, "permission_test_1"),
+				sqlmock.NewRows(denyColumns).
+					AddRow(1, 2, "permission_test_1", 1, "{}", "Investigación de incidente", nil, 2, time.Now()),
 			)
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions", "GET", nil, accessToken)
@@ -505,6 +528,15 @@ func TestGetAllUserPermissions_Success(t *testing.T) {
 		if permission_test_1["permission_name"].(string) != "permission_test_1" {
 			t.Errorf("Expected permission_test_1, got: %s", permission_test_1["permission_name"].(string))
 		}
+
+		if permission_test_1["denied"] != true {
+			t.Errorf("Expected permission_test_1 to be denied, got: %v", permission_test_1["denied"])
+		}
+
+		denies := data["denies"].([]interface{})
+		if len(denies) != 1 {
+			t.Errorf("Expected 1 deny, got: %d", len(denies))
+		}
 	}
 }
 
@@ -525,10 +557,10 @@ func TestGrantUserPermission_UserNotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -568,10 +600,10 @@ func TestGrantUserPermission_CurrentUser(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -611,17 +643,17 @@ func TestGrantUserPermission_PermissionNotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnError(noResultsError)
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "PATCH", nil, accessToken)
@@ -641,6 +673,115 @@ func TestGrantUserPermission_PermissionNotFound(t *testing.T) {
 	}
 }
 
+func TestGrantUserPermission_NotDelegable(t *testing.T) {
+	cases := []struct {
+		holds   bool
+		message string
+	}{
+		{holds: false, message: "No puedes delegar el permiso delete_user porque no lo tienes asignado como delegable ni tienes el permiso delegate_any_permission"},
+		{holds: true, message: "Tienes asignado el permiso delete_user pero no como delegable; necesitas que te lo otorguen como delegable o tener el permiso delegate_any_permission"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"grant_permission"})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("delete_user", 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(3, "delete_user", "Poder eliminar usuarios", false, false, time.Now(), time.Now()),
+			)
+
+		expectVerifyDelegation(mock, 1, 3, "delete_user").
+			WillReturnRows(delegationRows(false, td.holds, false, nil))
+
+		res, b := request(t, serv, "/api/users/2/permissions/delete_user", "PATCH", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+}
+
+func TestGrantUserPermission_DelegationRestrictions(t *testing.T) {
+	cases := []struct {
+		query   string
+		denied  bool
+		rows    *sqlmock.Rows
+		message string
+	}{
+		{
+			denied:  true,
+			message: "Se te ha denegado explícitamente este permiso",
+		},
+		{
+			query:   "?grantable=true",
+			rows:    delegationRows(false, true, true, nil),
+			message: "No puedes otorgar el permiso delete_user como delegable porque no tienes el permiso delegate_any_permission",
+		},
+		{
+			rows:    delegationRows(false, true, true, "pagos"),
+			message: "No puedes delegar el permiso delete_user porque tus permisos violan la restricción de separación de funciones pagos",
+		},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"grant_permission"})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("delete_user", 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(3, "delete_user", "Poder eliminar usuarios", false, false, time.Now(), time.Now()),
+			)
+
+		if td.denied {
+			expectPermissionDeny(mock, 1, "delete_user").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "permission_id", "reason", "expires_at"}).AddRow(5, 3, "Incidente", nil))
+		} else {
+			expectVerifyDelegation(mock, 1, 3, "delete_user").WillReturnRows(td.rows)
+		}
+
+		res, b := request(t, serv, "/api/users/2/permissions/delete_user"+td.query, "PATCH", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
 func TestGrantUserPermission_AlreadyHasPermission(t *testing.T) {
 	cases := []struct {
 		ID       int
@@ -658,24 +799,27 @@ func TestGrantUserPermission_AlreadyHasPermission(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 					AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
 			)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;")).
-			WithArgs(2, 1).
+		expectVerifyDelegation(mock, 1, 1, "permission_test").
+			WillReturnRows(delegationRows(true, true, true, nil))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+			WithArgs(2, 1, 1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id"}).AddRow(1, 2, 1))
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "PATCH", nil, accessToken)
@@ -695,6 +839,56 @@ func TestGrantUserPermission_AlreadyHasPermission(t *testing.T) {
 	}
 }
 
+func TestGrantUserPermission_SeparationOfDuties(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"grant_permission"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+		WithArgs("approve_payment", 1).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+				AddRow(8, "approve_payment", "Poder aprobar los pagos", true, true, time.Now(), time.Now()),
+		)
+
+	expectVerifyDelegation(mock, 1, 8, "approve_payment").
+		WillReturnRows(delegationRows(true, true, true, nil))
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+		WithArgs(2, 8, 1).
+		WillReturnError(noResultsError)
+
+	mock.ExpectBegin()
+
+	expectUserLock(mock, 2)
+	expectBreachedConstraints(mock, 2, 8).
+		WillReturnRows(
+			sqlmock.NewRows(constraintColumns).
+				AddRow(1, "payments", "Pagos creados y aprobados por personas distintas", 1, "{7,8}", "{approve_payment,create_payment}", time.Now()),
+		)
+
+	mock.ExpectRollback()
+
+	res, b := request(t, serv, "/api/users/2/permissions/approve_payment", "PATCH", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "No se puede otorgar el permiso porque viola la restricción de separación de funciones payments"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
 func TestGrantUserPermission_Success(t *testing.T) {
 	cases := []struct {
 		ID       int
@@ -712,28 +906,43 @@ func TestGrantUserPermission_Success(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 					AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
 			)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;")).
-			WithArgs(2, 1).
+		expectVerifyDelegation(mock, 1, 1, "permission_test").
+			WillReturnRows(delegationRows(true, true, true, nil))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+			WithArgs(2, 1, 1).
 			WillReturnError(noResultsError)
 
-		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id) VALUES ($1, $2) RETURNING id;")).
-			WithArgs(2, 1).
+		mock.ExpectBegin()
+
+		expectUserLock(mock, 2)
+		expectBreachedConstraints(mock, 2, 1).WillReturnRows(sqlmock.NewRows(constraintColumns))
+
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO user_permissions (user_id, permission_id, granted_by, grantable) SELECT $1::integer, $2::integer, $3::integer, $4::boolean FROM users u")).
+			WithArgs(2, 1, 1, false, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		expectOutbox(mock, "permission.granted").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectCommit()
+
+		expectAudit(mock, "user.grant_permission", 1, "2", "meli").
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "PATCH", nil, accessToken)
@@ -775,10 +984,10 @@ func TestRevokeUserPermission_UserNotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -818,10 +1027,10 @@ func TestRevokeUserPermission_CurrentUser(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
@@ -861,17 +1070,17 @@ func TestRevokeUserPermission_PermissionNotFound(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnError(noResultsError)
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "DELETE", nil, accessToken)
@@ -891,6 +1100,50 @@ func TestRevokeUserPermission_PermissionNotFound(t *testing.T) {
 	}
 }
 
+func TestRevokeUserPermission_NotDelegable(t *testing.T) {
+	cases := []struct {
+		holds   bool
+		message string
+	}{
+		{holds: false, message: "No puedes delegar el permiso delete_user porque no lo tienes asignado como delegable ni tienes el permiso delegate_any_permission"},
+		{holds: true, message: "Tienes asignado el permiso delete_user pero no como delegable; necesitas que te lo otorguen como delegable o tener el permiso delegate_any_permission"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"revoke_permission"})
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("delete_user", 1).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
+					AddRow(3, "delete_user", "Poder eliminar usuarios", false, false, time.Now(), time.Now()),
+			)
+
+		expectVerifyDelegation(mock, 1, 3, "delete_user").
+			WillReturnRows(delegationRows(false, td.holds, false, nil))
+
+		res, b := request(t, serv, "/api/users/2/permissions/delete_user", "DELETE", nil, accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.message {
+			t.Errorf("Expected %s, got: %s", td.message, errorMessage.Message)
+		}
+	}
+}
+
 func TestRevokeUserPermission_NoHasPermission(t *testing.T) {
 	cases := []struct {
 		ID       int
@@ -908,24 +1161,27 @@ func TestRevokeUserPermission_NoHasPermission(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 					AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
 			)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;")).
-			WithArgs(2, 1).
+		expectVerifyDelegation(mock, 1, 1, "permission_test").
+			WillReturnRows(delegationRows(true, true, true, nil))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+			WithArgs(2, 1, 1).
 			WillReturnError(noResultsError)
 
 		res, b := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "DELETE", nil, accessToken)
@@ -962,34 +1218,112 @@ func TestRevokeUserPermission_Success(t *testing.T) {
 		)
 
 		if td.username != "" {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1;")).WithArgs(td.username)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).WithArgs(td.username, 1)
 			find = td.username
 		} else {
-			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1;")).WithArgs(td.ID)
+			query = mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE id = $1 AND org_id = $2;")).WithArgs(td.ID, 1)
 			find = fmt.Sprint(td.ID)
 		}
 
 		query.WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1;")).
-			WithArgs("permission_test").
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, description, deletable, editable, created_at, updated_at FROM permissions WHERE name = $1 AND org_id = $2;")).
+			WithArgs("permission_test", 1).
 			WillReturnRows(
 				sqlmock.NewRows([]string{"id", "name", "description", "deletable", "editable", "created_at", "updated_at"}).
 					AddRow(1, "permission_test", "Este es un permiso de prueba", false, false, time.Now(), time.Now()),
 			)
 
-		mock.ExpectQuery(regexp.QuoteMeta("SELECT id, user_id, permission_id FROM user_permissions WHERE user_id = $1 AND permission_id = $2;")).
-			WithArgs(2, 1).
+		expectVerifyDelegation(mock, 1, 1, "permission_test").
+			WillReturnRows(delegationRows(true, true, true, nil))
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT up.id, up.user_id, up.permission_id FROM user_permissions up INNER JOIN permissions p ON p.id = up.permission_id WHERE up.user_id = $1 AND up.permission_id = $2 AND p.org_id = $3;")).
+			WithArgs(2, 1, 1).
 			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "permission_id"}).AddRow(1, 2, 1))
 
-		mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM user_permissions WHERE id = $1;")).
+		mock.ExpectBegin()
+
+		expectOutbox(mock, "permission.revoked").WithArgs(1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM user_permissions up USING permissions p WHERE up.id = $1 AND p.id = up.permission_id AND p.org_id = $2;")).
 			ExpectExec().
-			WithArgs(1).
+			WithArgs(1, 1).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 
+		mock.ExpectCommit()
+
+		expectAudit(mock, "user.revoke_permission", 1, "2", "meli").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
 		res, _ := request(t, serv, "/api/users/"+find+"/permissions/permission_test", "DELETE", nil, accessToken)
 		if res.StatusCode != http.StatusOK {
 			t.Errorf("Expected %d, got: %d", http.StatusOK, res.StatusCode)
 		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("There were unfulfilled expectations: %s", err)
+		}
+	}
+}
+
+func TestUpdateUserAttributes_ValidationErrors(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_user_attributes"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("meli", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	body := []byte(`{"attributes": {"Department": "it"}}`)
+
+	res, b := request(t, serv, "/api/users/meli/attributes", "PUT", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+
+	var errorMessage pkg.ErrorMessage
+	if err := json.Unmarshal(b, &errorMessage); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	expected := "El nombre del atributo `Department` debe tener máximo 25 caracteres en minúscula, números o guiones bajos"
+	if errorMessage.Message != expected {
+		t.Errorf("Expected %s, got: %s", expected, errorMessage.Message)
+	}
+}
+
+func TestUpdateUserAttributes_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"update_user_attributes"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, username, created_at FROM users WHERE username = $1 AND org_id = $2;")).
+		WithArgs("meli", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "created_at"}).AddRow(2, "meli", time.Now()))
+
+	mock.ExpectPrepare(regexp.QuoteMeta("UPDATE users SET attributes = $1 WHERE id = $2 AND org_id = $3;")).
+		ExpectExec().
+		WithArgs(`{"department":"it"}`, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	expectAudit(mock, "user.update_attributes", 1, "2", "meli").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"attributes": {"department": "it"}}`)
+
+	res, b := request(t, serv, "/api/users/meli/attributes", "PUT", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data pkg.Map
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	attributes := data["attributes"].(map[string]interface{})
+	if attributes["department"].(string) != "it" {
+		t.Errorf("Expected it, got: %s", attributes["department"].(string))
 	}
 }
@@ -0,0 +1,373 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dsolartec/iam-meli/internal/repositories"
+	"github.com/dsolartec/iam-meli/internal/webhooks"
+	"github.com/dsolartec/iam-meli/pkg"
+	"github.com/dsolartec/iam-meli/pkg/models"
+	"github.com/dsolartec/iam-meli/pkg/utils"
+)
+
+var webhookDeliveryColumns = []string{"id", "subscription_id", "url", "event_id", "event_type", "payload", "status", "attempts", "last_status_code", "last_error", "next_attempt_at", "created_at", "delivered_at", "secret"}
+
+const webhookSecret = "un-secreto-de-prueba"
+
+// webhookPayloadArg valida que el argumento sea el evento esperado serializado.
+type webhookPayloadArg struct {
+	eventType string
+	username  string
+}
+
+func (arg webhookPayloadArg) Match(value driver.Value) bool {
+	payload, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	var event models.WebhookEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return false
+	}
+
+	return event.Type == arg.eventType && event.Data["username"] == arg.username && event.ID != ""
+}
+
+func expectDueDeliveries(mock sqlmock.Sqlmock, url string, attempts int) {
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE status = 'pending' AND next_attempt_at <= now() ORDER BY next_attempt_at, id LIMIT $1 FOR UPDATE SKIP LOCKED ) UPDATE webhook_deliveries d SET next_attempt_at = now() + interval '15 minutes'")).
+		WithArgs(webhooks.DefaultBatchSize).
+		WillReturnRows(
+			sqlmock.NewRows(webhookDeliveryColumns).
+				AddRow(9, 3, url, "ev-1", "permission.revoked", `{"id":"ev-1","type":"permission.revoked"}`, "pending", attempts, nil, nil, time.Now(), time.Now(), nil, webhookSecret),
+		)
+}
+
+func TestWebhookDispatcher_Delivered(t *testing.T) {
+	var received *http.Request
+	var body []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	db, mock := newDatabaseMock()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher := webhooks.Dispatcher{Webhooks: &repositories.WebhooksRepository{Database: db}, Client: receiver.Client(), Now: func() time.Time { return now }}
+
+	expectDueDeliveries(mock, receiver.URL, 0)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = NULL, delivered_at = now() WHERE id = $1;")).
+		WithArgs(9, http.StatusNoContent).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	delivered, err := dispatcher.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatalf("Could not process the deliveries: %v", err)
+	}
+
+	if delivered != 1 {
+		t.Errorf("Expected 1 delivery, got: %d", delivered)
+	}
+
+	if received == nil {
+		t.Fatal("Expected the receiver to get the delivery")
+	}
+
+	if received.Header.Get(webhooks.EventHeader) != "permission.revoked" || received.Header.Get(webhooks.DeliveryHeader) != "9" {
+		t.Errorf("Unexpected headers: %v", received.Header)
+	}
+
+	timestamp := received.Header.Get(webhooks.TimestampHeader)
+	if timestamp != "1651406400" {
+		t.Errorf("Expected timestamp 1651406400, got: %s", timestamp)
+	}
+
+	expected := "sha256=" + pkg.Sign(webhookSecret, append([]byte(timestamp+"."), body...))
+	if received.Header.Get(webhooks.SignatureHeader) != expected {
+		t.Errorf("Expected signature %s, got: %s", expected, received.Header.Get(webhooks.SignatureHeader))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestWebhookDispatcher_Retries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	now := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		attempts int
+		status   string
+		next     interface{}
+	}{
+		{attempts: 0, status: "pending", next: now.Add(time.Second)},
+		{attempts: 2, status: "pending", next: now.Add(4 * time.Second)},
+		{attempts: 3, status: "dead", next: nil},
+	}
+
+	for _, td := range cases {
+		db, mock := newDatabaseMock()
+
+		dispatcher := webhooks.Dispatcher{
+			Webhooks:    &repositories.WebhooksRepository{Database: db},
+			Client:      receiver.Client(),
+			MaxAttempts: 4,
+			BaseDelay:   time.Second,
+			Now:         func() time.Time { return now },
+		}
+
+		expectDueDeliveries(mock, receiver.URL, td.attempts)
+
+		mock.ExpectExec(regexp.QuoteMeta("SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4, next_attempt_at = COALESCE($5, next_attempt_at) WHERE id = $1;")).
+			WithArgs(9, td.status, http.StatusServiceUnavailable, "El webhook respondió con el estado 503", td.next).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		delivered, err := dispatcher.ProcessDue(context.Background())
+		if err != nil {
+			t.Fatalf("Could not process the deliveries: %v", err)
+		}
+
+		if delivered != 0 {
+			t.Errorf("Expected no deliveries, got: %d", delivered)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Attempt %d: there were unfulfilled expectations: %s", td.attempts, err)
+		}
+	}
+}
+
+// containsArg valida que el argumento sea un texto que contiene el valor esperado.
+type containsArg string
+
+func (arg containsArg) Match(value driver.Value) bool {
+	text, ok := value.(string)
+
+	return ok && strings.Contains(text, string(arg))
+}
+
+func TestWebhookDispatcher_RefusesInternalAddresses(t *testing.T) {
+	received := false
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	db, mock := newDatabaseMock()
+
+	// Sin cliente se usa el de NewClient, que no se conecta a la dirección local del receptor.
+	dispatcher := webhooks.Dispatcher{Webhooks: &repositories.WebhooksRepository{Database: db}, BaseDelay: time.Second}
+
+	expectDueDeliveries(mock, receiver.URL, 0)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4, next_attempt_at = COALESCE($5, next_attempt_at) WHERE id = $1;")).
+		WithArgs(9, "pending", nil, containsArg("El webhook apunta a la dirección interna 127.0.0.1"), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if _, err := dispatcher.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("Could not process the deliveries: %v", err)
+	}
+
+	if received {
+		t.Error("Expected the delivery to be refused before connecting")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestIsInternalIP(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.10":    true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	}
+
+	for address, expected := range cases {
+		if internal := utils.IsInternalIP(net.ParseIP(address)); internal != expected {
+			t.Errorf("%s: expected %t, got: %t", address, expected, internal)
+		}
+	}
+}
+
+func TestWebhookDispatcher_Backoff(t *testing.T) {
+	dispatcher := webhooks.Dispatcher{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	for attempt, expected := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 5: 10 * time.Minute, 30: 10 * time.Minute} {
+		if backoff := dispatcher.Backoff(attempt); backoff != expected {
+			t.Errorf("Attempt %d: expected %s, got: %s", attempt, expected, backoff)
+		}
+	}
+}
+
+func TestCreateWebhook_ValidationErrors(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected string
+	}{
+		{body: `{"event_types": ["user.deleted"]}`, expected: "Debes ingresar la URL del webhook"},
+		{body: `{"url": "ftp://example.com", "event_types": ["user.deleted"]}`, expected: "La URL del webhook debe ser una dirección http o https válida"},
+		{body: `{"url": "http://127.0.0.1:8080/hook", "event_types": ["user.deleted"]}`, expected: "La URL del webhook no puede apuntar a una dirección interna"},
+		{body: `{"url": "http://169.254.169.254/latest/meta-data", "event_types": ["user.deleted"]}`, expected: "La URL del webhook no puede apuntar a una dirección interna"},
+		{body: `{"url": "https://10.0.0.5/hook", "event_types": ["user.deleted"]}`, expected: "La URL del webhook no puede apuntar a una dirección interna"},
+		{body: `{"url": "http://[::1]/hook", "event_types": ["user.deleted"]}`, expected: "La URL del webhook no puede apuntar a una dirección interna"},
+		{body: `{"url": "http://localhost/hook", "event_types": ["user.deleted"]}`, expected: "La URL del webhook no puede apuntar a una dirección interna"},
+		{body: `{"url": "https://example.com/hook", "secret": "corto", "event_types": ["user.deleted"]}`, expected: "El secreto del webhook debe tener entre 16 y 100 caracteres"},
+		{body: `{"url": "https://example.com/hook"}`, expected: "Debes ingresar al menos un tipo de evento"},
+		{body: `{"url": "https://example.com/hook", "event_types": ["user.created"]}`, expected: "El tipo de evento user.created no existe"},
+	}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_webhooks"})
+
+		res, b := request(t, serv, "/api/webhooks", "POST", bytes.NewBufferString(td.body), accessToken)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+		}
+
+		var errorMessage pkg.ErrorMessage
+		if err := json.Unmarshal(b, &errorMessage); err != nil {
+			t.Fatalf("Could not unmarshall response %v", err)
+		}
+
+		if errorMessage.Message != td.expected {
+			t.Errorf("Expected %s, got: %s", td.expected, errorMessage.Message)
+		}
+	}
+}
+
+func TestCreateWebhook_Success(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_webhooks"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhook_subscriptions (url, secret, event_types, org_id) VALUES ($1, $2, $3, $4) RETURNING id;")).
+		WithArgs("https://example.com/hook", sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	expectAudit(mock, "webhook.create", 1, "3", "https://example.com/hook").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	body := []byte(`{"url": "https://example.com/hook", "event_types": ["permission.revoked", "user.deleted"]}`)
+
+	res, b := request(t, serv, "/api/webhooks", "POST", bytes.NewBuffer(body), accessToken)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusCreated, res.StatusCode, b)
+	}
+
+	var data struct {
+		Webhook models.WebhookSubscription `json:"webhook"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if data.Webhook.ID != 3 || len(data.Webhook.Secret) != 64 {
+		t.Errorf("Expected the webhook 3 with a generated secret, got: %+v", data.Webhook)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetWebhookDeliveries_DeadLetters(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{"manage_webhooks"})
+
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE d.org_id = $1 AND ($2 = '' OR d.status = $2) ORDER BY d.id DESC LIMIT 100;")).
+		WithArgs(1, "dead").
+		WillReturnRows(
+			sqlmock.NewRows(webhookDeliveryColumns[:13]).
+				AddRow(9, 3, "https://example.com/hook", "ev-1", "user.deleted", `{"id":"ev-1"}`, "dead", 8, 503, "El webhook respondió con el estado 503", time.Now(), time.Now(), nil),
+		)
+
+	res, b := request(t, serv, "/api/webhooks/deliveries?status=dead", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected %d, got: %d - %s", http.StatusOK, res.StatusCode, b)
+	}
+
+	var data struct {
+		Deliveries []models.WebhookDelivery `json:"deliveries"`
+	}
+
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatalf("Could not unmarshall response %v", err)
+	}
+
+	if len(data.Deliveries) != 1 || data.Deliveries[0].LastStatusCode != 503 || data.Deliveries[0].Status != "dead" {
+		t.Errorf("Expected the dead delivery, got: %+v", data.Deliveries)
+	}
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	cases := []struct {
+		affected int64
+		status   int
+	}{{affected: 1, status: http.StatusAccepted}, {affected: 0, status: http.StatusBadRequest}}
+
+	for _, td := range cases {
+		serv, mock := newTestServer()
+
+		accessToken := generateAccessToken(t, mock, []string{"manage_webhooks"})
+
+		mock.ExpectExec(regexp.QuoteMeta("SET status = 'pending', attempts = 0, last_error = NULL, next_attempt_at = now() WHERE id = $1 AND org_id = $2 AND status = 'dead';")).
+			WithArgs(9, 1).
+			WillReturnResult(sqlmock.NewResult(0, td.affected))
+
+		res, b := request(t, serv, "/api/webhooks/deliveries/9/redeliver", "POST", nil, accessToken)
+		if res.StatusCode != td.status {
+			t.Errorf("Expected %d, got: %d - %s", td.status, res.StatusCode, b)
+		}
+	}
+}
+
+func TestWebhooks_NoAuthorized(t *testing.T) {
+	serv, mock := newTestServer()
+
+	accessToken := generateAccessToken(t, mock, []string{})
+
+	res, _ := request(t, serv, "/api/webhooks", "GET", nil, accessToken)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d, got: %d", http.StatusBadRequest, res.StatusCode)
+	}
+}